@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pendingAck is a message sent to a client that has not acknowledged it.
+type pendingAck struct {
+	message WebSocketMessage
+	sentAt  time.Time
+	resends int
+}
+
+// ackTracker gives at-least-once delivery of the message types a client
+// asked to acknowledge (/ws?ack=deadlock_event,...). writePump stamps each
+// such message with an AckID and tracks it until the client answers with
+// {"action":"ack","id":...}; unanswered messages are resent after
+// WS_ACK_TIMEOUT, up to WS_ACK_RETRIES times, and then given up on. At most
+// WS_ACK_BUFFER messages are tracked, the oldest being given up first.
+type ackTracker struct {
+	mu       sync.Mutex
+	types    map[string]bool
+	timeout  time.Duration
+	retries  int
+	capacity int
+	nextID   uint64
+	pending  map[uint64]*pendingAck
+}
+
+// newAckTracker returns nil, which tracks nothing, when the client asked to
+// acknowledge no types.
+func newAckTracker(types map[string]bool, timeout time.Duration, retries, capacity int) *ackTracker {
+	if len(types) == 0 {
+		return nil
+	}
+	return &ackTracker{
+		types:    types,
+		timeout:  timeout,
+		retries:  retries,
+		capacity: max(capacity, 1),
+		pending:  make(map[uint64]*pendingAck),
+	}
+}
+
+// track stamps an AckID on a message the client acknowledges and starts
+// waiting for it. Other messages are returned unchanged. It also returns a
+// message given up on to make room, if any.
+func (t *ackTracker) track(message WebSocketMessage, now time.Time) (WebSocketMessage, *WebSocketMessage) {
+	if t == nil || !t.types[message.Type] {
+		return message, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var evicted *WebSocketMessage
+	if len(t.pending) >= t.capacity {
+		oldest := t.oldest()
+		evicted = &t.pending[oldest].message
+		delete(t.pending, oldest)
+	}
+	t.nextID++
+	message.AckID = t.nextID
+	t.pending[message.AckID] = &pendingAck{message: message, sentAt: now}
+	return message, evicted
+}
+
+// oldest returns the lowest pending id. Called with t.mu held.
+func (t *ackTracker) oldest() uint64 {
+	var oldest uint64
+	for id := range t.pending {
+		if oldest == 0 || id < oldest {
+			oldest = id
+		}
+	}
+	return oldest
+}
+
+// ack stops waiting for a message. It reports false for ids that are not
+// pending, such as a repeated ack or one for a message already given up on.
+func (t *ackTracker) ack(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[id]; !ok {
+		return false
+	}
+	delete(t.pending, id)
+	return true
+}
+
+// due returns, in the order they were first sent, the messages to resend
+// now and those given up on after their last resend timed out.
+func (t *ackTracker) due(now time.Time) (resend, abandoned []WebSocketMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]uint64, 0, len(t.pending))
+	for id, pending := range t.pending {
+		if now.Sub(pending.sentAt) >= t.timeout {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		pending := t.pending[id]
+		if pending.resends >= t.retries {
+			abandoned = append(abandoned, pending.message)
+			delete(t.pending, id)
+			continue
+		}
+		pending.resends++
+		pending.sentAt = now
+		resend = append(resend, pending.message)
+	}
+	return resend, abandoned
+}
+
+// trackAck stamps a message for acknowledgement before writePump sends it,
+// dead-lettering any message it displaces.
+func (c *Client) trackAck(message WebSocketMessage) WebSocketMessage {
+	message, evicted := c.acks.track(message, time.Now())
+	if evicted != nil {
+		c.abandonAck(*evicted, "ack buffer full")
+	}
+	return message
+}
+
+// resendUnacked rewrites the messages whose acknowledgement timed out and
+// dead-letters those out of resends. It is called by writePump.
+func (c *Client) resendUnacked() error {
+	resend, abandoned := c.acks.due(time.Now())
+	for _, message := range abandoned {
+		c.abandonAck(message, "not acknowledged")
+	}
+	for _, message := range resend {
+		ackRedeliveredTotal.Inc()
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+		if err := c.writeMessage(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) abandonAck(message WebSocketMessage, detail string) {
+	ackAbandonedTotal.Inc()
+	slog.Warn("gave up on unacknowledged message", "remote_addr", c.remoteAddr, "message_type", message.Type,
+		"ack_id", message.AckID, "reason", detail)
+	c.hub.dlq.add(DeadLetter{Reason: deadLetterUnacked, Detail: detail, Source: c.remoteAddr,
+		MessageType: message.Type, At: time.Now()})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAckTracker(t *testing.T) {
+	if newAckTracker(nil, time.Second, 1, 10) != nil {
+		t.Error("tracker without types is not nil, want acknowledgements disabled")
+	}
+	start := time.Now()
+	tracker := newAckTracker(map[string]bool{"deadlock_event": true}, time.Second, 1, 2)
+
+	if message, _ := tracker.track(newMessage("query_metrics", nil), start); message.AckID != 0 {
+		t.Errorf("untracked type got ack id %d", message.AckID)
+	}
+	first, _ := tracker.track(newMessage("deadlock_event", "first"), start)
+	second, _ := tracker.track(newMessage("deadlock_event", "second"), start)
+	if first.AckID != 1 || second.AckID != 2 {
+		t.Errorf("ack ids = %d, %d, want 1 and 2", first.AckID, second.AckID)
+	}
+	// A full buffer gives up on the oldest message.
+	third, evicted := tracker.track(newMessage("deadlock_event", "third"), start.Add(time.Millisecond))
+	if evicted == nil || evicted.AckID != first.AckID {
+		t.Errorf("evicted = %+v, want the first message", evicted)
+	}
+
+	if !tracker.ack(second.AckID) || tracker.ack(second.AckID) || tracker.ack(first.AckID) {
+		t.Error("ack should report true once, and false for repeated or evicted ids")
+	}
+	if resend, abandoned := tracker.due(start.Add(500 * time.Millisecond)); len(resend) != 0 || len(abandoned) != 0 {
+		t.Errorf("before the timeout: resend %d, abandon %d, want nothing", len(resend), len(abandoned))
+	}
+	resend, abandoned := tracker.due(start.Add(2 * time.Second))
+	if len(resend) != 1 || resend[0].AckID != third.AckID || len(abandoned) != 0 {
+		t.Errorf("after the timeout: resend %+v, abandon %+v, want the third message resent", resend, abandoned)
+	}
+	// The one resend is used up, so the next timeout gives up.
+	resend, abandoned = tracker.due(start.Add(4 * time.Second))
+	if len(resend) != 0 || len(abandoned) != 1 || abandoned[0].AckID != third.AckID {
+		t.Errorf("after the last resend: resend %+v, abandon %+v, want the third message given up", resend, abandoned)
+	}
+}
+
+func TestUnacknowledgedMessagesAreResent(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSAckTimeout = 100 * time.Millisecond
+	cfg.WSAckRetries = 1
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=deadlock_event,slow_query&ack=deadlock_event")
+	redelivered := counterValue(t, ackRedeliveredTotal)
+	abandoned := counterValue(t, ackAbandonedTotal)
+
+	h.publish(newMessage("slow_query", nil))
+	h.publish(newMessage("deadlock_event", "acked"))
+	h.publish(newMessage("deadlock_event", "ignored"))
+
+	if message := readTestMessage(t, conn); message.Type != "slow_query" || message.AckID != 0 {
+		t.Errorf("message = %q with ack id %d, want slow_query without one", message.Type, message.AckID)
+	}
+	acked := readTestMessage(t, conn)
+	ignored := readTestMessage(t, conn)
+	if acked.AckID == 0 || ignored.AckID == 0 || acked.AckID == ignored.AckID {
+		t.Fatalf("ack ids = %d, %d, want two distinct ids", acked.AckID, ignored.AckID)
+	}
+	if err := conn.WriteJSON(ControlMessage{Action: "ack", ID: acked.AckID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the unacknowledged message comes back, once.
+	resent := readTestMessage(t, conn)
+	if resent.AckID != ignored.AckID || resent.Data != "ignored" {
+		t.Errorf("resent = %+v, want the unacknowledged deadlock_event", resent)
+	}
+	deadline := time.Now().Add(testReadTimeout)
+	for counterValue(t, ackAbandonedTotal)-abandoned < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := counterValue(t, ackRedeliveredTotal) - redelivered; got != 1 {
+		t.Errorf("redeliveries counted %v times, want 1", got)
+	}
+	if _, letters := getDeadLetters(t, h, ""); len(letters) != 1 || letters[0].Reason != deadLetterUnacked || letters[0].MessageType != "deadlock_event" {
+		t.Errorf("dead letters = %+v, want the unacknowledged deadlock_event", letters)
+	}
+}
+
+func TestAckWithoutOptInIsAControlError(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "")
+
+	if err := conn.WriteJSON(ControlMessage{Action: "ack", ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	message := readTestMessageOfType(t, conn, "control_error")
+	if data := message.Data.(map[string]interface{}); data["action"] != "ack" {
+		t.Errorf("control_error data = %v, want action ack", data)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// admission asks the hub goroutine for a connection slot for a client from
+// ip. The hub answers on result with "" when admitted or the reason the
+// client was refused.
+type admission struct {
+	ip     string
+	result chan string
+}
+
+// admissionCounts tracks the WebSocket clients admitted in total and per
+// source IP. It is only touched by the hub goroutine. A slot is reserved
+// before the upgrade, so concurrent upgrades cannot overshoot the caps, and
+// freed when the client unregisters or its upgrade fails.
+type admissionCounts struct {
+	maxTotal int
+	maxPerIP int
+	total    int
+	perIP    map[string]int
+}
+
+func newAdmissionCounts(maxTotal, maxPerIP int) *admissionCounts {
+	return &admissionCounts{maxTotal: maxTotal, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+func (a *admissionCounts) enabled() bool {
+	return a.maxTotal > 0 || a.maxPerIP > 0
+}
+
+func (a *admissionCounts) reserve(ip string) string {
+	if a.maxTotal > 0 && a.total >= a.maxTotal {
+		return "too many clients connected"
+	}
+	if a.maxPerIP > 0 && a.perIP[ip] >= a.maxPerIP {
+		return "too many connections from this address"
+	}
+	a.total++
+	a.perIP[ip]++
+	return ""
+}
+
+func (a *admissionCounts) release(ip string) {
+	a.total--
+	if a.perIP[ip]--; a.perIP[ip] <= 0 {
+		delete(a.perIP, ip)
+	}
+}
+
+// admitClient reserves a slot for the request's source IP under MAX_CLIENTS
+// and MAX_CLIENTS_PER_IP. It answers the request with a 503 and returns
+// false when the client is refused. The returned IP is "" when no limit is
+// configured; otherwise the slot must be handed back with releaseAdmission
+// unless the client registers, after which unregistering frees it.
+func (h *Hub) admitClient(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !h.admissions.enabled() {
+		return "", true
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	request := admission{ip: ip, result: make(chan string, 1)}
+	select {
+	case h.admit <- request:
+	case <-h.done:
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return "", false
+	}
+	if reason := <-request.result; reason != "" {
+		slog.Warn("rejected websocket upgrade: client limit reached", "remote_addr", r.RemoteAddr, "reason", reason)
+		stats.recordUpgradeFailure(upgradeFailureClientLimit)
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return "", false
+	}
+	return ip, true
+}
+
+// releaseAdmission frees a slot reserved by admitClient for a client that
+// never registered.
+func (h *Hub) releaseAdmission(ip string) {
+	if ip == "" {
+		return
+	}
+	select {
+	case h.release <- ip:
+	case <-h.done:
+	}
+}
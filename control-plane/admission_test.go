@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdmissionCounts(t *testing.T) {
+	counts := newAdmissionCounts(3, 2)
+	steps := []struct {
+		ip   string
+		want string
+	}{
+		{"10.0.0.1", ""},
+		{"10.0.0.1", ""},
+		{"10.0.0.1", "too many connections from this address"},
+		{"10.0.0.2", ""},
+		{"10.0.0.3", "too many clients connected"},
+	}
+	for i, step := range steps {
+		if got := counts.reserve(step.ip); got != step.want {
+			t.Errorf("reservation %d from %s = %q, want %q", i, step.ip, got, step.want)
+		}
+	}
+
+	counts.release("10.0.0.1")
+	if got := counts.reserve("10.0.0.3"); got != "" {
+		t.Errorf("reservation after a release = %q, want it admitted", got)
+	}
+	counts.release("10.0.0.2")
+	if _, ok := counts.perIP["10.0.0.2"]; ok || counts.total != 2 {
+		t.Errorf("counts = %d total, %v per IP, want 10.0.0.2 forgotten", counts.total, counts.perIP)
+	}
+	if newAdmissionCounts(0, 0).enabled() {
+		t.Error("admission is enabled without any limit")
+	}
+}
+
+// wantRefused asserts that dialing the hub fails with a 503 giving reason.
+func wantRefused(t *testing.T, h *Hub, reason string) {
+	t.Helper()
+	_, resp, err := dialTestHubWithHeader(t, h, "", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dial = %v (response %v), want a 503", err, resp)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), reason) {
+		t.Errorf("response body = %q, want %q", body, reason)
+	}
+}
+
+func TestClientCapRejectsUpgrades(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxClients = 2
+	h := startTestHub(t, cfg)
+
+	first := dialTestHub(t, h, "")
+	dialTestHub(t, h, "")
+	wantRefused(t, h, "too many clients connected")
+
+	// A disconnected client frees its slot.
+	first.Close()
+	waitForClientCount(t, h, 1)
+	dialTestHub(t, h, "")
+}
+
+func TestPerIPCapRejectsUpgrades(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxClientsPerIP = 1
+	h := startTestHub(t, cfg)
+
+	dialTestHub(t, h, "")
+	// Every test client connects from the loopback address.
+	wantRefused(t, h, "too many connections from this address")
+}
+
+func TestFailedUpgradeReleasesSlot(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxClients = 1
+	h := startTestHub(t, cfg)
+
+	// The version is refused after the upgrade, so the slot was reserved.
+	conn, _, err := dialTestHubWithHeader(t, h, "v=7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTestClose(t, conn)
+
+	// The slot is handed back to the hub goroutine after the close.
+	deadline := time.Now().Add(testReadTimeout)
+	for {
+		conn, resp, err := dialTestHubWithHeader(t, h, "", nil)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if resp == nil || resp.StatusCode != http.StatusServiceUnavailable || time.Now().After(deadline) {
+			t.Fatalf("dial = %v (response %v), want the slot released", err, resp)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Alert is one fired alert as recorded in the alert history.
+type Alert struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Severity   string                 `json:"severity"`
+	ClusterID  string                 `json:"cluster_id,omitempty"`
+	PodName    string                 `json:"pod_name,omitempty"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	FiredAt    time.Time              `json:"fired_at"`
+	UpdatedAt  *time.Time             `json:"updated_at,omitempty"`
+	ResolvedAt *time.Time             `json:"resolved_at,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// alertRecord is one line of the alert history file.
+type alertRecord struct {
+	Event string `json:"event"` // "fired", "updated" or "resolved"
+	Alert Alert  `json:"alert"`
+}
+
+// alertHistory keeps an auditable timeline of fired and resolved alerts,
+// appended to a JSON-lines file so it survives restarts. The file is
+// rewritten with just the retained alerts once it holds twice maxSize
+// records, so it does not grow without bound. A nil history is valid and
+// records nothing.
+type alertHistory struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records int // lines in file
+	maxSize int
+	alerts  []*Alert
+	byID    map[string]*Alert
+	open    map[string]*Alert // keyed by alertKey; the condition is still active
+}
+
+// legacyAlertTypes maps the types older history files recorded heap and pool
+// alerts under to the broadcast types they are recorded under now, so one
+// ?type= filter finds both.
+var legacyAlertTypes = map[string]string{
+	"heap_alert":      "resource_alert",
+	"pool_exhaustion": "pool_exhaustion_warning",
+}
+
+// currentAlertType returns the type alerts recorded as alertType are now
+// recorded under.
+func currentAlertType(alertType string) string {
+	if current, ok := legacyAlertTypes[alertType]; ok {
+		return current
+	}
+	return alertType
+}
+
+// openAlertHistory loads any existing history from path and opens it for
+// appending.
+func openAlertHistory(path string, maxSize int) (*alertHistory, error) {
+	h := &alertHistory{
+		path:    path,
+		maxSize: maxSize,
+		byID:    make(map[string]*Alert),
+		open:    make(map[string]*Alert),
+	}
+
+	if existing, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var record alertRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				slog.Warn("skipping corrupt alert history line", "path", path, "error", err)
+				continue
+			}
+			record.Alert.Type = currentAlertType(record.Alert.Type)
+			h.apply(record)
+			h.records++
+		}
+		existing.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read alert history: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("open alert history: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open alert history: %w", err)
+	}
+	h.file = file
+	if h.oversized() {
+		if err := h.compact(); err != nil {
+			h.file.Close()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func alertKey(cluster, alertType, podName string) string {
+	return cluster + "/" + alertType + "/" + podName
+}
+
+func (a *Alert) key() string {
+	return alertKey(a.ClusterID, a.Type, a.PodName)
+}
+
+// fire records a new alert. An alert of the same type that is still active for
+// the pod is updated in place rather than recorded twice.
+func (h *alertHistory) fire(cluster, alertType, severity, podName, namespace string, details map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if active, ok := h.open[alertKey(cluster, alertType, podName)]; ok {
+		record := alertRecord{Event: "updated", Alert: *active}
+		record.Alert.Severity = severity
+		record.Alert.Details = details
+		record.Alert.UpdatedAt = &now
+		h.apply(record)
+		h.persist(record)
+		return
+	}
+
+	record := alertRecord{Event: "fired", Alert: Alert{
+		ID:        fmt.Sprintf("alert-%s-%d", alertType, now.UnixNano()),
+		Type:      alertType,
+		Severity:  severity,
+		ClusterID: cluster,
+		PodName:   podName,
+		Namespace: namespace,
+		FiredAt:   now,
+		Details:   details,
+	}}
+	h.apply(record)
+	h.persist(record)
+}
+
+// resolve marks the active alert of the given type for the pod as resolved.
+func (h *alertHistory) resolve(cluster, alertType, podName string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	active, ok := h.open[alertKey(cluster, alertType, podName)]
+	if !ok {
+		return
+	}
+	record := alertRecord{Event: "resolved", Alert: *active}
+	resolvedAt := time.Now()
+	record.Alert.ResolvedAt = &resolvedAt
+	h.apply(record)
+	h.persist(record)
+}
+
+// apply folds a record into the in-memory view. Callers hold h.mu.
+func (h *alertHistory) apply(record alertRecord) {
+	alert := record.Alert
+	switch record.Event {
+	case "fired":
+		stored := &alert
+		h.alerts = append(h.alerts, stored)
+		h.byID[stored.ID] = stored
+		if stored.ResolvedAt == nil {
+			h.open[stored.key()] = stored
+		}
+		if h.maxSize > 0 && len(h.alerts) > h.maxSize {
+			evicted := h.alerts[0]
+			h.alerts = h.alerts[1:]
+			delete(h.byID, evicted.ID)
+			if h.open[evicted.key()] == evicted {
+				delete(h.open, evicted.key())
+			}
+		}
+	case "updated":
+		if stored, ok := h.byID[alert.ID]; ok {
+			stored.Severity = alert.Severity
+			stored.Details = alert.Details
+			stored.UpdatedAt = alert.UpdatedAt
+		}
+	case "resolved":
+		if stored, ok := h.byID[alert.ID]; ok {
+			stored.ResolvedAt = alert.ResolvedAt
+			if h.open[stored.key()] == stored {
+				delete(h.open, stored.key())
+			}
+		}
+	}
+}
+
+// persist appends a record to the history file, compacting the file when it
+// has grown too large. Callers hold h.mu.
+func (h *alertHistory) persist(record alertRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		slog.Error("failed to encode alert record", "error", err)
+		return
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		slog.Error("failed to persist alert record", "error", err)
+		return
+	}
+	h.records++
+	if h.oversized() {
+		if err := h.compact(); err != nil {
+			slog.Error("failed to compact alert history", "path", h.path, "error", err)
+		}
+	}
+}
+
+// oversized reports whether the file holds more than twice the records the
+// history retains. Callers hold h.mu.
+func (h *alertHistory) oversized() bool {
+	return h.maxSize > 0 && h.records > 2*h.maxSize
+}
+
+// compact rewrites the file as one record per retained alert, in its latest
+// state, and swaps it in with a rename so a crash leaves either the old or
+// the new file. Callers hold h.mu.
+func (h *alertHistory) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("compact alert history: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, alert := range h.alerts {
+		if err = encoder.Encode(alertRecord{Event: "fired", Alert: *alert}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), h.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("compact alert history: %w", err)
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopen alert history: %w", err)
+	}
+	h.file.Close()
+	h.file = file
+	h.records = len(h.alerts)
+	return nil
+}
+
+// resolveQuiet resolves the active alerts of a type that have not fired for
+// quiet, for conditions that are only ever reported and never cleared.
+func (h *alertHistory) resolveQuiet(cluster, alertType string, quiet time.Duration, now time.Time) {
+	h.mu.Lock()
+	var quietPods []string
+	for _, active := range h.open {
+		lastFired := active.FiredAt
+		if active.UpdatedAt != nil {
+			lastFired = *active.UpdatedAt
+		}
+		if active.ClusterID == cluster && active.Type == alertType && now.Sub(lastFired) >= quiet {
+			quietPods = append(quietPods, active.PodName)
+		}
+	}
+	h.mu.Unlock()
+	for _, podName := range quietPods {
+		h.resolve(cluster, alertType, podName)
+	}
+}
+
+// query returns a cluster's alerts fired within [from, to], optionally of a
+// single type. Zero times leave that side of the range open.
+func (h *alertHistory) query(cluster string, from, to time.Time, alertType string) []Alert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	alertType = currentAlertType(alertType)
+	result := make([]Alert, 0)
+	for _, alert := range h.alerts {
+		if alert.ClusterID != cluster {
+			continue
+		}
+		if !from.IsZero() && alert.FiredAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && alert.FiredAt.After(to) {
+			continue
+		}
+		if alertType != "" && alert.Type != alertType {
+			continue
+		}
+		result = append(result, *alert)
+	}
+	return result
+}
+
+func (h *alertHistory) close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
+
+// clusterAlerts is one hub's view of the alert history, which every cluster
+// hub shares: it files the alerts it fires under the hub's cluster and only
+// sees those, so pods of the same name in two clusters never share an alert.
+// A nil view records nothing.
+type clusterAlerts struct {
+	history *alertHistory
+	cluster string
+}
+
+// forCluster returns the view of the history for one cluster, nil if the
+// history is.
+func (h *alertHistory) forCluster(cluster string) *clusterAlerts {
+	if h == nil {
+		return nil
+	}
+	return &clusterAlerts{history: h, cluster: cluster}
+}
+
+// forCluster returns the view of the same history for another cluster.
+func (a *clusterAlerts) forCluster(cluster string) *clusterAlerts {
+	if a == nil {
+		return nil
+	}
+	return a.history.forCluster(cluster)
+}
+
+func (a *clusterAlerts) fire(alertType, severity, podName, namespace string, details map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	a.history.fire(a.cluster, alertType, severity, podName, namespace, details)
+}
+
+func (a *clusterAlerts) resolve(alertType, podName string) {
+	if a == nil {
+		return
+	}
+	a.history.resolve(a.cluster, alertType, podName)
+}
+
+func (a *clusterAlerts) resolveQuiet(alertType string, quiet time.Duration, now time.Time) {
+	if a == nil {
+		return
+	}
+	a.history.resolveQuiet(a.cluster, alertType, quiet, now)
+}
+
+func (a *clusterAlerts) query(from, to time.Time, alertType string) []Alert {
+	return a.history.query(a.cluster, from, to, alertType)
+}
+
+// runAlertExpiry resolves deadlock alerts once their pod has been free of
+// deadlocks for DEADLOCK_ALERT_QUIET.
+func (h *Hub) runAlertExpiry() {
+	quiet := h.cfg.DeadlockAlertQuiet
+	if h.alerts == nil || quiet <= 0 {
+		return
+	}
+	ticker := time.NewTicker(max(quiet/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.alerts.resolveQuiet("deadlock_event", quiet, now)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// alertHistoryHandler serves GET /api/alerts/history?from=&to=&type=.
+func (h *Hub) alertHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if h.alerts == nil {
+		http.Error(w, "Alert history is disabled (set ALERT_HISTORY_FILE)", http.StatusNotImplemented)
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid from: expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid to: expected RFC3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+
+	alerts := h.alerts.query(from, to, r.URL.Query().Get("type"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestAlertHistory(t *testing.T, path string, maxSize int) *alertHistory {
+	t.Helper()
+	history, err := openAlertHistory(path, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.close() })
+	return history
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestAlertHistorySurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	history := openTestAlertHistory(t, path, 100)
+	history.fire("", "resource_alert", "warning", "pod-a", "default", map[string]interface{}{"heap_usage_ratio": 0.91})
+	history.fire("", "resource_alert", "critical", "pod-a", "default", map[string]interface{}{"heap_usage_ratio": 0.97})
+	history.fire("", "cpu_alert", "warning", "pod-b", "default", nil)
+	history.resolve("", "cpu_alert", "pod-b")
+	history.close()
+
+	reopened := openTestAlertHistory(t, path, 100)
+	alerts := reopened.query("", time.Time{}, time.Time{}, "")
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts after reopen, want 2", len(alerts))
+	}
+	heap, cpu := alerts[0], alerts[1]
+	// The re-fire updated the active alert, and the update was persisted.
+	if heap.Severity != "critical" || heap.Details["heap_usage_ratio"] != 0.97 || heap.UpdatedAt == nil {
+		t.Errorf("heap alert = %+v, want the critical update", heap)
+	}
+	if heap.ResolvedAt != nil {
+		t.Error("heap alert was resolved, want it still active")
+	}
+	if cpu.ResolvedAt == nil {
+		t.Error("cpu alert is active, want it resolved")
+	}
+
+	// The still active alert is updated, not fired again.
+	reopened.fire("", "resource_alert", "warning", "pod-a", "default", nil)
+	if got := len(reopened.query("", time.Time{}, time.Time{}, "resource_alert")); got != 1 {
+		t.Errorf("got %d heap alerts, want 1", got)
+	}
+}
+
+func TestAlertHistoryMapsLegacyTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	legacy := alertRecord{Event: "fired", Alert: Alert{ID: "old", Type: "heap_alert", PodName: "pod-a", FiredAt: time.Now()}}
+	line, _ := json.Marshal(legacy)
+	if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	history := openTestAlertHistory(t, path, 100)
+	// The heap analyzer now fires under the broadcast type; it updates the
+	// alert recorded under the old name instead of opening a second one.
+	history.fire("", "resource_alert", "critical", "pod-a", "default", nil)
+	for _, alertType := range []string{"resource_alert", "heap_alert"} {
+		alerts := history.query("", time.Time{}, time.Time{}, alertType)
+		if len(alerts) != 1 || alerts[0].ID != "old" || alerts[0].Type != "resource_alert" {
+			t.Errorf("?type=%s = %+v, want the old alert as resource_alert", alertType, alerts)
+		}
+	}
+}
+
+func TestAlertHistoryCompactsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	history := openTestAlertHistory(t, path, 3)
+	for _, pod := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		history.fire("", "pool_exhaustion_warning", "critical", pod, "default", nil)
+		history.resolve("", "pool_exhaustion_warning", pod)
+	}
+	if lines := countLines(t, path); lines > 2*3 {
+		t.Errorf("file has %d records, want at most %d", lines, 2*3)
+	}
+	history.close()
+
+	reopened := openTestAlertHistory(t, path, 3)
+	alerts := reopened.query("", time.Time{}, time.Time{}, "")
+	if len(alerts) != 3 || alerts[0].PodName != "f" || alerts[2].PodName != "h" {
+		t.Fatalf("alerts after compaction = %+v, want the last 3", alerts)
+	}
+	for _, alert := range alerts {
+		if alert.ResolvedAt == nil {
+			t.Errorf("alert %s lost its resolution in compaction", alert.PodName)
+		}
+	}
+}
+
+func TestResolveQuietResolvesOnlyQuietAlerts(t *testing.T) {
+	history := openTestAlertHistory(t, filepath.Join(t.TempDir(), "alerts.jsonl"), 100)
+	history.fire("", "deadlock_event", "critical", "quiet", "default", nil)
+	history.fire("", "resource_alert", "warning", "quiet", "default", nil)
+	time.Sleep(20 * time.Millisecond)
+	history.fire("", "deadlock_event", "critical", "busy", "default", nil)
+
+	history.resolveQuiet("", "deadlock_event", 10*time.Millisecond, time.Now())
+
+	resolved := make(map[string]bool)
+	for _, alert := range history.query("", time.Time{}, time.Time{}, "") {
+		resolved[alert.Type+"/"+alert.PodName] = alert.ResolvedAt != nil
+	}
+	want := map[string]bool{"deadlock_event/quiet": true, "deadlock_event/busy": false, "resource_alert/quiet": false}
+	for key, wantResolved := range want {
+		if resolved[key] != wantResolved {
+			t.Errorf("%s resolved = %v, want %v", key, resolved[key], wantResolved)
+		}
+	}
+}
+
+func TestAlertHistoryHandler(t *testing.T) {
+	h := newHub(testConfig())
+	history := openTestAlertHistory(t, filepath.Join(t.TempDir(), "alerts.jsonl"), 100)
+	h.alerts = history.forCluster("")
+	h.alerts.fire("resource_alert", "warning", "pod-a", "default", nil)
+	h.alerts.fire("cpu_alert", "warning", "pod-a", "default", nil)
+
+	tests := []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"", http.StatusOK, 2},
+		{"?type=cpu_alert", http.StatusOK, 1},
+		{"?to=2000-01-01T00:00:00Z", http.StatusOK, 0},
+		{"?from=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.alertHistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/alerts/history"+tt.query, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Count int `json:"count"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		if body.Count != tt.count {
+			t.Errorf("%q: count = %d, want %d", tt.query, body.Count, tt.count)
+		}
+	}
+
+	h.alerts = nil
+	rec := httptest.NewRecorder()
+	h.alertHistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/alerts/history", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("disabled history: status = %d, want %d", rec.Code, http.StatusNotImplemented)
+	}
+}
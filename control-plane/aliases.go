@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// defaultFieldAliases are the query data keys sent by older agents, mapped
+// to the keys they were renamed to:
+//
+//	execution_time -> execution_time_ms
+//	duration_ms    -> transaction_duration (transaction_event from MetricsClient)
+//	sql            -> sql_pattern
+//
+// FIELD_ALIASES adds to or overrides them.
+var defaultFieldAliases = map[string]string{
+	"execution_time": "execution_time_ms",
+	"duration_ms":    "transaction_duration",
+	"sql":            "sql_pattern",
+}
+
+// queryDataFields maps the canonical JSON keys of QueryData to their field
+// indexes.
+var queryDataFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(QueryData{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}()
+
+// parseFieldAliases reads FIELD_ALIASES, a comma-separated list of
+// alias=canonical pairs such as "exec_ms=execution_time_ms", on top of the
+// default aliases. Pairs whose target is not a query data key, or whose
+// alias is one, are ignored.
+func parseFieldAliases(raw string) map[string]string {
+	aliases := make(map[string]string, len(defaultFieldAliases))
+	for alias, canonical := range defaultFieldAliases {
+		aliases[alias] = canonical
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		alias, canonical, _ := strings.Cut(pair, "=")
+		alias, canonical = strings.TrimSpace(alias), strings.TrimSpace(canonical)
+		_, known := queryDataFields[canonical]
+		_, taken := queryDataFields[alias]
+		if alias == "" || !known || taken {
+			slog.Warn("ignoring invalid field alias", "alias", pair)
+			continue
+		}
+		aliases[alias] = canonical
+	}
+	return aliases
+}
+
+// aliasTypeError is a type mismatch in a value sent under an alias. The
+// value is looked up by key rather than met while scanning the body, so
+// unlike json.UnmarshalTypeError it has no offset.
+type aliasTypeError struct {
+	Field string // "data.<alias>"
+	Type  reflect.Type
+	Value string
+}
+
+func (e *aliasTypeError) Error() string {
+	return "json: cannot unmarshal " + e.Value + " into Go struct field QueryMetrics." + e.Field + " of type " + e.Type.String()
+}
+
+// applyFieldAliases fills the query data of decoded metrics from the keys in
+// aliases, so older agents keep working. metrics must have been decoded from
+// body. When a payload carries both an alias and its canonical key, the
+// canonical key wins.
+func applyFieldAliases(body []byte, metrics []QueryMetrics, aliases map[string]string) error {
+	if !containsAlias(body, aliases) {
+		return nil
+	}
+
+	type rawMetric struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	var raw []rawMetric
+	if isBatchBody(body) {
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return err
+		}
+	} else {
+		raw = make([]rawMetric, 1)
+		if err := json.Unmarshal(body, &raw[0]); err != nil {
+			return err
+		}
+	}
+
+	for i := range metrics {
+		if i >= len(raw) || metrics[i].Data == nil {
+			continue
+		}
+		data := reflect.ValueOf(metrics[i].Data).Elem()
+		for alias, canonical := range aliases {
+			value, ok := raw[i].Data[alias]
+			if !ok {
+				continue
+			}
+			if _, ok := raw[i].Data[canonical]; ok {
+				continue
+			}
+			field := data.Field(queryDataFields[canonical]).Addr().Interface()
+			err := json.Unmarshal(value, field)
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return &aliasTypeError{Field: "data." + alias, Type: typeErr.Type, Value: typeErr.Value}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// containsAlias reports whether a payload may use an alias, so payloads
+// from current agents skip the second decode.
+func containsAlias(body []byte, aliases map[string]string) bool {
+	for alias := range aliases {
+		if bytes.Contains(body, []byte(`"`+alias+`"`)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseFieldAliases(t *testing.T) {
+	aliases := parseFieldAliases(" exec_ms = execution_time_ms, sql=query_id, bad, nope=not_a_field, sql_type=sql_pattern, =status")
+	want := map[string]string{
+		"execution_time": "execution_time_ms",
+		"duration_ms":    "transaction_duration",
+		"exec_ms":        "execution_time_ms",
+		// Configured aliases override the defaults.
+		"sql": "query_id",
+	}
+	if len(aliases) != len(want) {
+		t.Errorf("aliases = %v, want %v", aliases, want)
+	}
+	for alias, canonical := range want {
+		if aliases[alias] != canonical {
+			t.Errorf("alias %s = %q, want %q", alias, aliases[alias], canonical)
+		}
+	}
+}
+
+func TestDecodeMetricsAppliesAliases(t *testing.T) {
+	aliases := parseFieldAliases("")
+	metrics, batch, err := decodeMetrics([]byte(`{"event_type":"query_execution","data":{"execution_time":12,"duration_ms":3400,"sql":"SELECT 1"}}`), aliases)
+	if err != nil || batch {
+		t.Fatalf("decode = %v, batch %v", err, batch)
+	}
+	data := metrics[0].Data
+	if data.ExecutionTimeMs == nil || *data.ExecutionTimeMs != 12 || data.TransactionDuration == nil || *data.TransactionDuration != 3400 || data.SQLPattern != "SELECT 1" {
+		t.Errorf("data = %+v, want each alias in its canonical field", data)
+	}
+
+	// Each batch element is aliased on its own, and the canonical key wins
+	// over an alias sent alongside it.
+	metrics, batch, err = decodeMetrics([]byte(`[{"data":{"execution_time_ms":5}},{"data":{"execution_time":7,"execution_time_ms":9}},{"data":{"execution_time":11}}]`), aliases)
+	if err != nil || !batch || len(metrics) != 3 {
+		t.Fatalf("decode batch = %d metrics, %v, batch %v", len(metrics), err, batch)
+	}
+	for i, want := range []int64{5, 9, 11} {
+		if got := metrics[i].Data.ExecutionTimeMs; got == nil || *got != want {
+			t.Errorf("metric %d execution_time_ms = %v, want %d", i, got, want)
+		}
+	}
+}
+
+func TestConfiguredAliasesAreApplied(t *testing.T) {
+	cfg := testConfig()
+	cfg.FieldAliases = parseFieldAliases("exec_ms=execution_time_ms")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	single, _ := json.Marshal(testMetric("pod-a", 10))
+	legacy := strings.Replace(string(single), `"execution_time_ms":`, `"exec_ms":`, 1)
+	if rec := postTestBody(h, legacy); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if status, summary := postTestStream(t, h, strings.NewReader(strings.Replace(legacy, `"exec_ms":10`, `"exec_ms":20`, 1)+"\n")); status != http.StatusOK || summary["count"] != float64(1) {
+		t.Fatalf("stream = %d %v, want the line accepted", status, summary)
+	}
+	for _, want := range []float64{10, 20} {
+		data := readTestMessage(t, conn).Data.(map[string]interface{})["data"].(map[string]interface{})
+		if data["execution_time_ms"] != want {
+			t.Errorf("broadcast data = %v, want execution_time_ms %v from exec_ms", data, want)
+		}
+	}
+}
+
+func TestAliasTypeErrorsHaveNoOffset(t *testing.T) {
+	cfg := testConfig()
+	cfg.FieldAliases = parseFieldAliases("exec_ms=execution_time_ms")
+	h := startTestHub(t, cfg)
+
+	tests := []struct {
+		name  string
+		body  string
+		field string
+		// offset is nil when the error has none.
+		offset interface{}
+	}{
+		{"canonical", `{"pod_name":"pod","data":{"execution_time_ms":"slow"}}`, "data.execution_time_ms", float64(52)},
+		{"alias", `{"pod_name":"pod","data":{"exec_ms":"slow"}}`, "data.exec_ms", nil},
+	}
+	for _, tt := range tests {
+		rec := postTestBody(h, tt.body)
+		var body map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&body)
+		if rec.Code != http.StatusBadRequest || body["field"] != tt.field || body["expected"] != "int64" || body["got"] != "string" {
+			t.Errorf("%s: response = %d %v, want 400 naming %s", tt.name, rec.Code, body, tt.field)
+		}
+		if body["offset"] != tt.offset {
+			t.Errorf("%s: offset = %v, want %v", tt.name, body["offset"], tt.offset)
+		}
+	}
+}
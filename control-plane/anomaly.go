@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// runningStats accumulates a mean and variance one sample at a time with
+// Welford's algorithm, which stays numerically stable over long runs. Past
+// window samples, each new sample is weighted as the window-th, which turns
+// the statistics into exponentially weighted ones that follow a pattern whose
+// normal execution time shifts, instead of staying anchored to its whole
+// history. A zero window weighs every sample equally.
+type runningStats struct {
+	window   int64
+	count    int64
+	mean     float64
+	variance float64 // population variance of the weighted samples
+}
+
+func (s *runningStats) add(value float64) {
+	s.count++
+	n := float64(s.samples())
+	delta := value - s.mean
+	s.mean += delta / n
+	s.variance = (1 - 1/n) * (s.variance + delta*delta/n)
+}
+
+// samples is how many samples the statistics cover, at most window.
+func (s *runningStats) samples() int64 {
+	if s.window > 0 && s.count > s.window {
+		return s.window
+	}
+	return s.count
+}
+
+// stddev is the sample standard deviation.
+func (s *runningStats) stddev() float64 {
+	n := s.samples()
+	if n < 2 {
+		return 0
+	}
+	return math.Sqrt(s.variance * float64(n) / float64(n-1))
+}
+
+// anomalyDetector flags executions that are slow for their own SQL pattern:
+// more than k standard deviations above the pattern's mean execution time.
+// A fixed threshold would fit either the fast lookups or the heavy reports,
+// never both.
+type anomalyDetector struct {
+	mu          sync.Mutex
+	k           float64
+	minSamples  int64
+	window      int64
+	maxPatterns int
+	patterns    map[string]*runningStats
+}
+
+// Anomaly is an execution found to be anomalous, with the statistics it was
+// compared against.
+type Anomaly struct {
+	Mean    float64
+	Stddev  float64
+	ZScore  float64
+	Samples int64
+}
+
+// newAnomalyDetector returns nil, which flags nothing, when k is not
+// positive. Each pattern's baseline covers its last window executions, all
+// of them when window is zero. Patterns past maxPatterns are not tracked.
+func newAnomalyDetector(k float64, minSamples, window, maxPatterns int) *anomalyDetector {
+	if k <= 0 {
+		return nil
+	}
+	return &anomalyDetector{
+		k:           k,
+		minSamples:  int64(max(minSamples, 2)),
+		window:      int64(window),
+		maxPatterns: maxPatterns,
+		patterns:    make(map[string]*runningStats),
+	}
+}
+
+// observe compares an execution time with the pattern's history, then adds
+// it to that history. It reports an anomaly only once the pattern has
+// minSamples executions, so the first few of a new pattern are never
+// flagged.
+func (d *anomalyDetector) observe(pattern string, elapsedMs float64) (Anomaly, bool) {
+	if d == nil {
+		return Anomaly{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats, ok := d.patterns[pattern]
+	if !ok {
+		if d.maxPatterns > 0 && len(d.patterns) >= d.maxPatterns {
+			return Anomaly{}, false
+		}
+		stats = &runningStats{window: d.window}
+		d.patterns[pattern] = stats
+	}
+
+	anomaly := Anomaly{Mean: stats.mean, Stddev: stats.stddev(), Samples: stats.count}
+	stats.add(elapsedMs)
+	if anomaly.Samples < d.minSamples || anomaly.Stddev == 0 {
+		return Anomaly{}, false
+	}
+	anomaly.ZScore = (elapsedMs - anomaly.Mean) / anomaly.Stddev
+	return anomaly, anomaly.ZScore > d.k
+}
+
+// analyzeAnomaly broadcasts and records anomaly_detected for query executions
+// far slower than their pattern usually runs. Executions are grouped by SQL
+// hash, which fingerprint has stamped on every metric with a pattern. Each
+// anomaly is a single execution, so the alert is not resolved.
+func (h *Hub) analyzeAnomaly(metric QueryMetrics) {
+	if metric.EventType != "query_execution" || metric.Data == nil || metric.Data.ExecutionTimeMs == nil || metric.Data.SQLHash == "" {
+		return
+	}
+	elapsed := *metric.Data.ExecutionTimeMs
+	anomaly, ok := h.anomalies.observe(metric.Data.SQLHash, float64(elapsed))
+	if !ok {
+		return
+	}
+
+	severity := "warning"
+	if anomaly.ZScore >= 2*h.anomalies.k {
+		severity = "high"
+	}
+	h.alerts.fire("anomaly_detected", severity, metric.PodName, metric.Namespace, map[string]interface{}{
+		"sql_hash":          metric.Data.SQLHash,
+		"execution_time_ms": elapsed,
+		"z_score":           anomaly.ZScore,
+	})
+	h.publish(newNamespacedMessage("anomaly_detected", metric.Namespace, map[string]interface{}{
+		"pod_name":          metric.PodName,
+		"namespace":         metric.Namespace,
+		"query_id":          metric.Data.QueryID,
+		"sql_hash":          metric.Data.SQLHash,
+		"sql_pattern":       metric.Data.SQLPattern,
+		"execution_time_ms": elapsed,
+		"mean_ms":           anomaly.Mean,
+		"stddev_ms":         anomaly.Stddev,
+		"z_score":           anomaly.ZScore,
+		"threshold":         h.anomalies.k,
+		"samples":           anomaly.Samples,
+		"severity":          severity,
+	}))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunningStats(t *testing.T) {
+	var stats runningStats
+	if stats.stddev() != 0 {
+		t.Error("stddev of no samples is not 0")
+	}
+	for _, value := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		stats.add(value)
+	}
+	if stats.count != 8 || stats.mean != 5 {
+		t.Errorf("count = %d, mean = %v, want 8 and 5", stats.count, stats.mean)
+	}
+	if want := math.Sqrt(32.0 / 7); math.Abs(stats.stddev()-want) > 1e-9 {
+		t.Errorf("stddev = %v, want %v", stats.stddev(), want)
+	}
+}
+
+func TestAnomalyDetectorFollowsShiftedBaseline(t *testing.T) {
+	// observe feeds n executions alternating around base and counts the
+	// flagged ones.
+	observe := func(detector *anomalyDetector, base float64, n int) int {
+		flagged := 0
+		for i := 0; i < n; i++ {
+			if _, ok := detector.observe("report", base+float64(i%2)*2); ok {
+				flagged++
+			}
+		}
+		return flagged
+	}
+
+	windowed := newAnomalyDetector(3, 5, 20, 0)
+	cumulative := newAnomalyDetector(3, 5, 0, 0)
+	observe(windowed, 10, 1000)
+	observe(cumulative, 10, 1000)
+	if flagged := observe(windowed, 50, 1); flagged != 1 {
+		t.Fatal("first execution at the new speed was not flagged")
+	}
+	observe(windowed, 50, 99)
+	observe(cumulative, 50, 100)
+
+	// The windowed baseline has settled at the new speed; the cumulative one
+	// is still dominated by the old executions.
+	if flagged := observe(windowed, 50, 20); flagged != 0 {
+		t.Errorf("windowed detector flagged %d executions at the settled speed, want 0", flagged)
+	}
+	if flagged := observe(cumulative, 50, 20); flagged == 0 {
+		t.Error("cumulative detector flagged nothing, want it still anchored to the old speed")
+	}
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	detector := newAnomalyDetector(3, 5, 0, 2)
+	// A new pattern is never flagged before it has minSamples executions.
+	for _, elapsed := range []float64{10, 12, 10, 12, 10} {
+		if _, ok := detector.observe("lookup", elapsed); ok {
+			t.Fatalf("%vms flagged while learning the pattern", elapsed)
+		}
+	}
+	if _, ok := detector.observe("lookup", 13); ok {
+		t.Error("13ms flagged, want it within three standard deviations")
+	}
+	anomaly, ok := detector.observe("lookup", 40)
+	if !ok || anomaly.Samples != 6 || anomaly.ZScore <= 3 {
+		t.Errorf("40ms = %+v, %v, want an anomaly against 6 samples", anomaly, ok)
+	}
+
+	// Patterns that always take the same time have no spread to compare to.
+	for i := 0; i < 10; i++ {
+		detector.observe("constant", 5)
+	}
+	if _, ok := detector.observe("constant", 500); ok {
+		t.Error("pattern with no variance flagged an execution")
+	}
+	// Past maxPatterns, new patterns are not tracked.
+	detector.observe("third", 10)
+	if _, tracked := detector.patterns["third"]; tracked || len(detector.patterns) != 2 {
+		t.Errorf("tracking %d patterns, want the first 2 only", len(detector.patterns))
+	}
+
+	if newAnomalyDetector(0, 5, 0, 2) != nil {
+		t.Error("detector with k = 0 is not nil, want detection disabled")
+	}
+	var none *anomalyDetector
+	if _, ok := none.observe("lookup", 1e9); ok {
+		t.Error("nil detector flagged an execution")
+	}
+}
+
+func TestAnomalyDetectedBroadcast(t *testing.T) {
+	cfg := testConfig()
+	cfg.AnomalyStddevs = 3
+	cfg.AnomalyMinSamples = 5
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=anomaly_detected,done")
+
+	for _, elapsed := range []int64{10, 12, 10, 12, 10, 12, 13, 100} {
+		postTestMetric(t, h, testMetric("pod-a", elapsed))
+	}
+	h.publish(newMessage("done", nil))
+
+	message := readTestMessage(t, conn)
+	if message.Type != "anomaly_detected" {
+		t.Fatalf("message = %q, want only the 100ms execution flagged", message.Type)
+	}
+	data := message.Data.(map[string]interface{})
+	if data["execution_time_ms"] != float64(100) || data["severity"] != "high" || data["samples"] != float64(7) ||
+		data["sql_hash"] != fingerprintSQL("SELECT * FROM users WHERE id = ?").hash || data["threshold"] != float64(3) {
+		t.Errorf("anomaly = %v, want a high severity anomaly for the 100ms execution", data)
+	}
+	if message := readTestMessage(t, conn); message.Type != "done" {
+		t.Errorf("next message = %q, want no other anomalies", message.Type)
+	}
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "anomaly_detected")
+	if len(alerts) != 1 || alerts[0].Severity != "high" || alerts[0].Details["execution_time_ms"] != int64(100) {
+		t.Errorf("alert history = %+v, want the 100ms execution", alerts)
+	}
+}
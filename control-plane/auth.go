@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+)
+
+// requireAPIKey only lets requests through whose X-API-Key header matches
+// key. An empty key disables the check so demo setups keep working.
+func requireAPIKey(key string, next http.Handler) http.Handler {
+	if key == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.Header.Get("X-API-Key")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+			slog.Warn("rejected request with missing or invalid API key", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
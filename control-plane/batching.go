@@ -0,0 +1,51 @@
+package main
+
+import "time"
+
+// maxBatchMessages bounds the messages carried by one batch frame, so a
+// burst cannot build a frame that falls foul of the outbound size limit.
+const maxBatchMessages = 100
+
+// batched reports whether writePump should gather this client's messages
+// into batch frames.
+func (c *Client) batched() bool {
+	return c.batching && c.hub.cfg.WSBatchInterval > 0
+}
+
+// collectBatch gathers the messages that reach send within WS_BATCH_INTERVAL
+// of first, up to maxBatchMessages. It reports false once send has been
+// closed, after returning what was gathered before.
+func (c *Client) collectBatch(first WebSocketMessage) ([]WebSocketMessage, bool) {
+	messages := []WebSocketMessage{first}
+	window := time.NewTimer(c.hub.cfg.WSBatchInterval)
+	defer window.Stop()
+	for len(messages) < maxBatchMessages {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return messages, false
+			}
+			if !c.expired(message, time.Now()) {
+				messages = append(messages, message)
+			}
+		case <-window.C:
+			return messages, true
+		}
+	}
+	return messages, true
+}
+
+// writeBatch sends gathered messages in one batch envelope. A lone message
+// goes out unwrapped.
+func (c *Client) writeBatch(messages []WebSocketMessage) error {
+	for i := range messages {
+		messages[i] = c.trackAck(messages[i])
+	}
+	if len(messages) == 1 {
+		return c.writeMessage(messages[0])
+	}
+	return c.writeMessage(newMessage("batch", map[string]interface{}{
+		"messages": messages,
+		"count":    len(messages),
+	}))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchIntervalFromEnvironment(t *testing.T) {
+	if cfg := loadConfig(); cfg.WSBatchInterval != 50*time.Millisecond {
+		t.Errorf("default batch interval = %v, want 50ms", cfg.WSBatchInterval)
+	}
+	t.Setenv("WS_BATCH_INTERVAL", "250ms")
+	if cfg := loadConfig(); cfg.WSBatchInterval != 250*time.Millisecond {
+		t.Errorf("batch interval = %v, want 250ms", cfg.WSBatchInterval)
+	}
+}
+
+func TestQueuedMessagesArriveAsOneBatch(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSBatchInterval = 200 * time.Millisecond
+	h := startTestHub(t, cfg)
+	batched := dialTestHub(t, h, "types=test_event&batch=1")
+	plain := dialTestHub(t, h, "types=test_event")
+	waitForClientCount(t, h, 2)
+
+	for i := 0; i < 3; i++ {
+		h.publish(newMessage("test_event", map[string]interface{}{"n": i}))
+	}
+
+	message := readTestMessage(t, batched)
+	if message.Type != "batch" {
+		t.Fatalf("message type = %q, want batch", message.Type)
+	}
+	data := message.Data.(map[string]interface{})
+	messages := data["messages"].([]interface{})
+	if data["count"] != float64(3) || len(messages) != 3 {
+		t.Fatalf("batch = %v, want the three messages", data)
+	}
+	for i, m := range messages {
+		m := m.(map[string]interface{})
+		if m["type"] != "test_event" || m["data"].(map[string]interface{})["n"] != float64(i) {
+			t.Errorf("batched message %d = %v, want test_event %d in order", i, m, i)
+		}
+	}
+
+	// Clients that did not opt in still get one frame per message.
+	for i := 0; i < 3; i++ {
+		if message := readTestMessage(t, plain); message.Type != "test_event" {
+			t.Errorf("unbatched message %d type = %q, want test_event", i, message.Type)
+		}
+	}
+}
+
+func TestLoneMessageIsNotWrapped(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSBatchInterval = 20 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=test_event&batch=1")
+	waitForClientCount(t, h, 1)
+
+	h.publish(newMessage("test_event", nil))
+	if message := readTestMessage(t, conn); message.Type != "test_event" {
+		t.Errorf("message type = %q, want the message itself", message.Type)
+	}
+}
+
+func TestZeroIntervalDisablesBatching(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSBatchInterval = 0
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=test_event&batch=1")
+	waitForClientCount(t, h, 1)
+
+	h.publish(newMessage("test_event", nil))
+	h.publish(newMessage("test_event", nil))
+	for i := 0; i < 2; i++ {
+		if message := readTestMessage(t, conn); message.Type != "test_event" {
+			t.Errorf("message %d type = %q, want test_event", i, message.Type)
+		}
+	}
+}
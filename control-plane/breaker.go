@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops calls to a failing dependency. After threshold
+// consecutive failures it opens and refuses calls for cooldown, then lets a
+// single trial call through: success closes it again, failure reopens it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: max(threshold, 1), cooldown: cooldown}
+}
+
+// allow reports whether a call may be made now.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// state describes the breaker for health output: "closed", "open" while
+// refusing calls, or "half_open" once the cooldown is over and a trial call
+// is allowed or under way.
+func (b *circuitBreaker) state(now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.failures < b.threshold:
+		return "closed"
+	case b.trial || !now.Before(b.openUntil):
+		return "half_open"
+	}
+	return "open"
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.failures, b.trial = 0, false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) failure(now time.Time) {
+	b.mu.Lock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+	b.mu.Unlock()
+}
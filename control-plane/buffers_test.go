@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBufferSizesFromEnvironment(t *testing.T) {
+	t.Setenv("BROADCAST_BUFFER", "1024")
+	t.Setenv("CLIENT_BUFFER", "32")
+	cfg := loadConfig()
+	if cfg.BroadcastBuffer != 1024 || cfg.ClientBuffer != 32 {
+		t.Errorf("buffers = %d/%d, want 1024/32", cfg.BroadcastBuffer, cfg.ClientBuffer)
+	}
+
+	for _, tt := range []struct{ broadcast, client int }{{0, 32}, {1024, 0}, {-1, 32}} {
+		cfg.BroadcastBuffer, cfg.ClientBuffer = tt.broadcast, tt.client
+		if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "must be positive") {
+			t.Errorf("validate with buffers %d/%d = %v, want an error", tt.broadcast, tt.client, err)
+		}
+	}
+}
+
+func TestConfiguredBufferCapacitiesAreApplied(t *testing.T) {
+	cfg := testConfig()
+	cfg.BroadcastBuffer = 7
+	cfg.ClientBuffer = 3
+	h := newHub(cfg)
+	if got := cap(h.broadcast); got != 7 {
+		t.Errorf("broadcast capacity = %d, want 7", got)
+	}
+
+	// The hub is not running yet, so the connection stops at registration
+	// and the test can look at the client it built.
+	conn, resp, err := dialTestHubWithHeader(t, h, "", nil)
+	if err != nil {
+		t.Fatalf("dial /ws: %v (response %v)", err, resp)
+	}
+	var client *Client
+	select {
+	case client = <-h.register:
+	case <-time.After(testReadTimeout):
+		t.Fatal("client was not registered")
+	}
+	if got := cap(client.send); got != 3 {
+		t.Errorf("client send capacity = %d, want 3", got)
+	}
+
+	h.start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.shutdown(ctx)
+	})
+	h.register <- client
+	if message := readTestMessage(t, conn); message.Type != "connected" {
+		t.Errorf("first message = %q, want connected", message.Type)
+	}
+}
+
+func TestHealthReportsQueueDepth(t *testing.T) {
+	cfg := testConfig()
+	cfg.BroadcastBuffer = 8
+	h := newHub(cfg)
+	// Nothing drains the broadcast channel before the hub starts.
+	for i := 0; i < 3; i++ {
+		h.broadcast <- newMessage("test", nil)
+	}
+
+	rec := httptest.NewRecorder()
+	h.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body["queue_depth"] != float64(3) || body["queue_capacity"] != float64(8) {
+		t.Errorf("queue = %v of %v, want 3 of 8", body["queue_depth"], body["queue_capacity"])
+	}
+}
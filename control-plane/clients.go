@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ClientInfo describes one connected stream client on /api/clients.
+type ClientInfo struct {
+	RemoteAddr    string     `json:"remote_addr"`
+	Transport     string     `json:"transport"`
+	ConnectedAt   time.Time  `json:"connected_at"`
+	Namespace     string     `json:"namespace,omitempty"`
+	Role          string     `json:"role,omitempty"`
+	Version       string     `json:"version"`
+	Format        string     `json:"format,omitempty"`
+	Subscriptions []string   `json:"subscriptions,omitempty"`
+	QueuedCount   int        `json:"queued_count"`
+	DroppedCount  int        `json:"dropped_count"`
+	LatencyMs     *float64   `json:"latency_ms,omitempty"`
+	LastPong      *time.Time `json:"last_pong,omitempty"`
+	Degraded      bool       `json:"degraded"`
+}
+
+// pingPayload carries the send time so the pong, which echoes it, yields the
+// round trip.
+func pingPayload(now time.Time) []byte {
+	return strconv.AppendInt(nil, now.UnixNano(), 10)
+}
+
+// recordPong stores the round trip measured from a pong echoing a
+// pingPayload. Pongs with any other payload, such as unsolicited ones, are
+// ignored.
+func (c *Client) recordPong(payload string, now time.Time) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil || sent <= 0 || sent > now.UnixNano() {
+		return
+	}
+	c.latency.Store(now.UnixNano() - sent)
+	c.lastPong.Store(now.UnixNano())
+}
+
+// info describes the client. It runs on the hub goroutine, which owns the
+// subscriptions and the dropped count.
+func (c *Client) info(degradedAfter time.Duration) ClientInfo {
+	info := ClientInfo{
+		RemoteAddr:   c.remoteAddr,
+		Transport:    "websocket",
+		ConnectedAt:  c.connectedAt,
+		Namespace:    c.namespace,
+		Role:         c.role,
+		Version:      c.version,
+		Format:       c.format,
+		QueuedCount:  len(c.send),
+		DroppedCount: c.dropped,
+	}
+	if c.conn == nil {
+		info.Transport = "sse"
+	}
+	for messageType := range c.subscriptions {
+		info.Subscriptions = append(info.Subscriptions, messageType)
+	}
+	sort.Strings(info.Subscriptions)
+	if rtt := time.Duration(c.latency.Load()); rtt > 0 {
+		ms := float64(rtt) / float64(time.Millisecond)
+		pong := time.Unix(0, c.lastPong.Load())
+		info.LatencyMs, info.LastPong = &ms, &pong
+		info.Degraded = degradedAfter > 0 && rtt >= degradedAfter
+	}
+	return info
+}
+
+// listClients asks the hub goroutine for the connected clients, oldest
+// first. It returns nil once the hub has stopped.
+func (h *Hub) listClients() []ClientInfo {
+	result := make(chan []ClientInfo, 1)
+	select {
+	case h.inspect <- result:
+	case <-h.done:
+		return nil
+	}
+	clients := <-result
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ConnectedAt.Before(clients[j].ConnectedAt) })
+	return clients
+}
+
+// clientsHandler serves GET /api/clients with the round-trip latency of each
+// WebSocket client's last ping; clients at or above CLIENT_DEGRADED_LATENCY
+// are flagged as degraded.
+func (h *Hub) clientsHandler(w http.ResponseWriter, r *http.Request) {
+	clients := h.listClients()
+	degraded := 0
+	for _, client := range clients {
+		if client.Degraded {
+			degraded++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"clients":        clients,
+		"count":          len(clients),
+		"degraded_count": degraded,
+		"threshold_ms":   h.cfg.ClientDegradedLatency.Milliseconds(),
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRecordPong(t *testing.T) {
+	now := time.Now()
+	client := &Client{}
+	client.recordPong(string(pingPayload(now.Add(-250*time.Millisecond))), now)
+
+	info := client.info(200 * time.Millisecond)
+	if info.LatencyMs == nil || *info.LatencyMs != 250 || !info.LastPong.Equal(now) || !info.Degraded {
+		t.Fatalf("info = %+v, want a degraded 250ms round trip", info)
+	}
+	if client.info(time.Second).Degraded {
+		t.Error("client flagged degraded under the threshold")
+	}
+
+	// Pongs that do not echo one of our pings leave the measurement alone.
+	for _, payload := range []string{"", "hello", "-5", string(pingPayload(now.Add(time.Minute)))} {
+		client.recordPong(payload, now.Add(time.Second))
+		if info := client.info(0); *info.LatencyMs != 250 {
+			t.Errorf("pong %q changed the latency to %vms", payload, *info.LatencyMs)
+		}
+	}
+	if info := (&Client{}).info(time.Millisecond); info.LatencyMs != nil || info.Degraded {
+		t.Errorf("info before any pong = %+v, want no latency", info)
+	}
+}
+
+// answerPingsAfter makes conn answer pings only after delay and keeps
+// reading so the handler runs.
+func answerPingsAfter(conn *websocket.Conn, delay time.Duration) {
+	conn.SetPingHandler(func(payload string) error {
+		time.Sleep(delay)
+		return conn.WriteControl(websocket.PongMessage, []byte(payload), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestClientsReportPingLatency(t *testing.T) {
+	cfg := testConfig()
+	cfg.PingPeriod = 100 * time.Millisecond
+	cfg.ClientDegradedLatency = 150 * time.Millisecond
+	h := startTestHub(t, cfg)
+	answerPingsAfter(dialTestHub(t, h, "namespace=fast"), 0)
+	answerPingsAfter(dialTestHub(t, h, "namespace=slow"), 300*time.Millisecond)
+
+	deadline := time.Now().Add(testReadTimeout)
+	for {
+		clients := h.listClients()
+		measured := 0
+		for _, client := range clients {
+			if client.LatencyMs != nil {
+				measured++
+			}
+		}
+		if measured == 2 {
+			for _, client := range clients {
+				if slow := client.Namespace == "slow"; client.Degraded != slow {
+					t.Errorf("%s client at %vms: degraded = %v, want %v", client.Namespace, *client.LatencyMs, client.Degraded, slow)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("clients = %+v, want both round trips measured", clients)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	h.clientsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/clients", nil))
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body["count"] != float64(2) || body["degraded_count"] != float64(1) || body["threshold_ms"] != float64(150) {
+		t.Errorf("/api/clients = %v, want 2 clients with 1 degraded at 150ms", body)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// timestampSkew returns how far a metric's timestamp is ahead of now
+// (positive) or behind it (negative). Unparseable timestamps, which
+// validation rejects, report no skew.
+func timestampSkew(timestamp string, now time.Time) time.Duration {
+	reported, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return 0
+	}
+	return reported.Sub(now)
+}
+
+// skewDirection labels a skew for logs and metrics.
+func skewDirection(skew time.Duration) string {
+	if skew > 0 {
+		return "future"
+	}
+	return "past"
+}
+
+// outsideTolerance reports whether a skew exceeds tolerance. A tolerance of
+// zero accepts any skew.
+func outsideTolerance(skew, tolerance time.Duration) bool {
+	return tolerance > 0 && (skew > tolerance || skew < -tolerance)
+}
+
+// validateClockSkew rejects a metric whose timestamp is further from server
+// time than the tolerance. It applies to batch arrays and NDJSON streams,
+// which carry many metrics at once: rewriting each to the receive time
+// would pile the whole upload into one moment of every time-windowed
+// aggregation, so the upload is refused instead. Single metrics and the
+// live transports are rewritten by correctClockSkew, since the receive time
+// of one metric is a close stand-in for when it happened.
+func validateClockSkew(metric QueryMetrics, now time.Time, tolerance time.Duration) error {
+	skew := timestampSkew(metric.Timestamp, now)
+	if !outsideTolerance(skew, tolerance) {
+		return nil
+	}
+	clockSkewTotal.WithLabelValues(skewDirection(skew), "rejected").Inc()
+	if skew > 0 {
+		return invalid("timestamp is %s ahead of server time, over the %s tolerance", skew.Round(time.Second), tolerance)
+	}
+	return invalid("timestamp is %s behind server time, over the %s tolerance", (-skew).Round(time.Second), tolerance)
+}
+
+// correctClockSkew replaces the timestamp of a metric from an agent whose
+// clock is off by more than CLOCK_SKEW_TOLERANCE with the receive time,
+// keeping the agent's in AgentTimestamp and setting ClockSkew.
+func (h *Hub) correctClockSkew(metric QueryMetrics, now time.Time) QueryMetrics {
+	skew := timestampSkew(metric.Timestamp, now)
+	if !outsideTolerance(skew, h.cfg.ClockSkewTolerance) {
+		return metric
+	}
+	clockSkewTotal.WithLabelValues(skewDirection(skew), "rewritten").Inc()
+	slog.Debug("rewrote skewed metric timestamp", "pod_name", metric.PodName, "timestamp", metric.Timestamp,
+		"skew", skew.Round(time.Second).String())
+	metric.AgentTimestamp = metric.Timestamp
+	metric.Timestamp = now.UTC().Format(time.RFC3339)
+	metric.ClockSkew = true
+	return metric
+}
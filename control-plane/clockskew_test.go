@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateClockSkew(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) QueryMetrics {
+		metric := testMetric("pod-a", 10)
+		metric.Timestamp = now.Add(offset).Format(time.RFC3339)
+		return metric
+	}
+	rejectedFuture := counterValue(t, clockSkewTotal.WithLabelValues("future", "rejected"))
+
+	tests := []struct {
+		name      string
+		metric    QueryMetrics
+		tolerance time.Duration
+		err       string
+	}{
+		{"within", at(4 * time.Minute), 5 * time.Minute, ""},
+		{"at the edge", at(-5 * time.Minute), 5 * time.Minute, ""},
+		{"ahead", at(time.Hour), 5 * time.Minute, "timestamp is 1h0m0s ahead of server time, over the 5m0s tolerance"},
+		{"behind", at(-10 * time.Minute), 5 * time.Minute, "timestamp is 10m0s behind server time, over the 5m0s tolerance"},
+		{"disabled", at(-24 * time.Hour), 0, ""},
+	}
+	for _, tt := range tests {
+		err := validateClockSkew(tt.metric, now, tt.tolerance)
+		if (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if got := counterValue(t, clockSkewTotal.WithLabelValues("future", "rejected")) - rejectedFuture; got != 1 {
+		t.Errorf("future rejections counted %v times, want 1", got)
+	}
+}
+
+func TestSkewedSingleMetricIsRewritten(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+	before := counterValue(t, clockSkewTotal.WithLabelValues("future", "rewritten"))
+
+	skewed := testMetric("pod-a", 10)
+	skewed.Timestamp = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	postTestMetric(t, h, skewed)
+	postTestMetric(t, h, testMetric("pod-a", 20))
+
+	var rewritten QueryMetrics
+	payload, _ := json.Marshal(readTestMessage(t, conn).Data)
+	json.Unmarshal(payload, &rewritten)
+	received, err := time.Parse(time.RFC3339, rewritten.Timestamp)
+	if err != nil || !rewritten.ClockSkew || rewritten.AgentTimestamp != skewed.Timestamp || time.Since(received) > time.Minute {
+		t.Errorf("rewritten metric timestamp = %s, agent_timestamp = %s, clock_skew = %v, want the receive time with the agent's kept",
+			rewritten.Timestamp, rewritten.AgentTimestamp, rewritten.ClockSkew)
+	}
+	data := readTestMessage(t, conn).Data.(map[string]interface{})
+	if _, ok := data["clock_skew"]; ok || data["agent_timestamp"] != nil {
+		t.Errorf("metric within tolerance = %v, want it untouched", data)
+	}
+	if got := counterValue(t, clockSkewTotal.WithLabelValues("future", "rewritten")) - before; got != 1 {
+		t.Errorf("rewrites counted %v times, want 1", got)
+	}
+}
+
+func TestSkewedBatchAndStreamMetricsAreRejected(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	skewed := testMetric("pod-a", 10)
+	skewed.Timestamp = time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	rec := postTestBody(h, testBatch(t, testMetric("pod-a", 10), skewed))
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusUnprocessableEntity || body["index"] != float64(1) || !strings.Contains(body["rule"].(string), "behind server time") {
+		t.Errorf("batch = %d %v, want 422 for the skewed metric at index 1", rec.Code, body)
+	}
+
+	status, summary := postTestStream(t, h, strings.NewReader(ndjsonLine(t, testMetric("pod-a", 10))+ndjsonLine(t, skewed)))
+	if status != http.StatusOK || summary["count"] != float64(1) || summary["errors"] != float64(1) {
+		t.Errorf("stream = %d %v, want the skewed line counted invalid", status, summary)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons the server closes a WebSocket client. Each is sent in the close
+// frame together with a suggested reconnect delay so that well-behaved
+// dashboards back off instead of reconnecting all at once.
+const (
+	closeReasonDrain      = "drain"
+	closeReasonSlow       = "slow"
+	closeReasonLifetime   = "lifetime"
+	closeReasonOverloaded = "overloaded"
+	// closeReasonWriteFailed is sent, when it still gets through, after
+	// writePump gave up on a write.
+	closeReasonWriteFailed = "write_failed"
+)
+
+var closeCodes = map[string]int{
+	closeReasonDrain:       websocket.CloseGoingAway,
+	closeReasonSlow:        websocket.CloseTryAgainLater,
+	closeReasonLifetime:    websocket.CloseNormalClosure,
+	closeReasonOverloaded:  websocket.CloseTryAgainLater,
+	closeReasonWriteFailed: websocket.CloseTryAgainLater,
+}
+
+// closePayload is the JSON text of a close frame sent by the server.
+type closePayload struct {
+	Reason       string `json:"reason"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// closeMessage builds the close frame for reason. An empty reason produces a
+// bare normal closure.
+func (cfg Config) closeMessage(reason string) []byte {
+	if reason == "" {
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	}
+	text, _ := json.Marshal(closePayload{
+		Reason:       reason,
+		RetryAfterMs: cfg.ReconnectBackoff[reason].Milliseconds(),
+	})
+	return websocket.FormatCloseMessage(closeCodes[reason], string(text))
+}
+
+// reconnectBackoffFromEnv reads the per-reason reconnect hints.
+func reconnectBackoffFromEnv() map[string]time.Duration {
+	return map[string]time.Duration{
+		closeReasonDrain:       getEnvDuration("WS_BACKOFF_DRAIN", 5*time.Second),
+		closeReasonSlow:        getEnvDuration("WS_BACKOFF_SLOW", 10*time.Second),
+		closeReasonLifetime:    getEnvDuration("WS_BACKOFF_LIFETIME", time.Second),
+		closeReasonOverloaded:  getEnvDuration("WS_BACKOFF_OVERLOADED", 30*time.Second),
+		closeReasonWriteFailed: getEnvDuration("WS_BACKOFF_WRITE_FAILED", time.Second),
+	}
+}
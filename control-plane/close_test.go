@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readTestClose reads from conn until the server closes it and returns the
+// close frame.
+func readTestClose(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testReadTimeout))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("read error = %v, want a close frame", err)
+			}
+			return closeErr
+		}
+	}
+}
+
+// checkClosePayload checks a close frame's code and JSON text.
+func checkClosePayload(t *testing.T, code int, text string, wantCode int, wantReason string, wantBackoff time.Duration) {
+	t.Helper()
+	var payload closePayload
+	if err := json.Unmarshal([]byte(text), &payload); err != nil {
+		t.Fatalf("close text %q: %v", text, err)
+	}
+	if code != wantCode || payload.Reason != wantReason || payload.RetryAfterMs != wantBackoff.Milliseconds() {
+		t.Errorf("close = %d %+v, want %d reason %s retry_after_ms %d",
+			code, payload, wantCode, wantReason, wantBackoff.Milliseconds())
+	}
+}
+
+func TestCloseMessageForEachReason(t *testing.T) {
+	cfg := testConfig()
+	cfg.ReconnectBackoff[closeReasonSlow] = 42 * time.Second
+	tests := []struct {
+		reason  string
+		code    int
+		backoff time.Duration
+	}{
+		{closeReasonDrain, websocket.CloseGoingAway, 5 * time.Second},
+		{closeReasonSlow, websocket.CloseTryAgainLater, 42 * time.Second},
+		{closeReasonLifetime, websocket.CloseNormalClosure, time.Second},
+		{closeReasonOverloaded, websocket.CloseTryAgainLater, 30 * time.Second},
+		{closeReasonWriteFailed, websocket.CloseTryAgainLater, time.Second},
+	}
+	for _, tt := range tests {
+		frame := cfg.closeMessage(tt.reason)
+		checkClosePayload(t, int(binary.BigEndian.Uint16(frame)), string(frame[2:]), tt.code, tt.reason, tt.backoff)
+	}
+
+	if frame := cfg.closeMessage(""); len(frame) != 2 || binary.BigEndian.Uint16(frame) != websocket.CloseNormalClosure {
+		t.Errorf("closeMessage(\"\") = %q, want a bare normal closure", frame)
+	}
+}
+
+func TestDrainCloseFrame(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go h.shutdown(ctx)
+
+	closeErr := readTestClose(t, conn)
+	checkClosePayload(t, closeErr.Code, closeErr.Text, websocket.CloseGoingAway, closeReasonDrain, h.cfg.ReconnectBackoff[closeReasonDrain])
+}
+
+func TestLifetimeCloseFrame(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxConnectionLifetime = 50 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "")
+
+	closeErr := readTestClose(t, conn)
+	checkClosePayload(t, closeErr.Code, closeErr.Text, websocket.CloseNormalClosure, closeReasonLifetime, cfg.ReconnectBackoff[closeReasonLifetime])
+}
+
+func TestSlowClientIsClosedAsSlow(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowClientPolicy = slowClientDisconnect
+	h := newHub(cfg)
+	client := &Client{hub: h, send: make(chan WebSocketMessage, 1), remoteAddr: "192.0.2.1:1234"}
+	h.clients[client] = true
+
+	h.deliver(client, newMessage("test", nil))
+	h.deliver(client, newMessage("test", nil))
+
+	if client.closeReason != closeReasonSlow {
+		t.Errorf("closeReason = %q, want %q", client.closeReason, closeReasonSlow)
+	}
+	<-client.send
+	if _, open := <-client.send; open {
+		t.Error("send is still open")
+	}
+	if h.clients[client] {
+		t.Error("slow client is still registered")
+	}
+}
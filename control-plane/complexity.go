@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// complexQueryWarnRepeat is how long a SQL pattern stays quiet after a
+// complex_query_warning before it is warned about again.
+const complexQueryWarnRepeat = 5 * time.Minute
+
+// ComplexQuery is a SQL pattern with the highest complexity score reported
+// for it.
+type ComplexQuery struct {
+	SQLPattern      string    `json:"sql_pattern"`
+	SQLType         string    `json:"sql_type,omitempty"`
+	TableNames      []string  `json:"table_names,omitempty"`
+	ComplexityScore int       `json:"complexity_score"`
+	Count           int64     `json:"count"`
+	PodName         string    `json:"pod_name,omitempty"`
+	Namespace       string    `json:"namespace,omitempty"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// complexQueryTracker keeps the capacity most complex SQL patterns seen and
+// decides when a pattern over the threshold is warned about.
+type complexQueryTracker struct {
+	mu        sync.Mutex
+	threshold int
+	capacity  int
+	queries   map[string]*ComplexQuery
+	warned    map[string]time.Time
+	swept     time.Time
+}
+
+func newComplexQueryTracker(threshold, capacity int) *complexQueryTracker {
+	return &complexQueryTracker{
+		threshold: threshold,
+		capacity:  capacity,
+		queries:   make(map[string]*ComplexQuery),
+		warned:    make(map[string]time.Time),
+	}
+}
+
+// complexQueryKey identifies a query by its hash when the agent sends one.
+func complexQueryKey(data *QueryData) string {
+	if data.SQLHash != "" {
+		return data.SQLHash
+	}
+	return data.SQLPattern
+}
+
+// record offers a scored query to the top list and reports whether it should
+// be warned about: its score reaches the threshold and the pattern was not
+// warned about within complexQueryWarnRepeat.
+func (t *complexQueryTracker) record(metric QueryMetrics, now time.Time) bool {
+	score := *metric.Data.ComplexityScore
+	key := complexQueryKey(metric.Data)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.retain(key, metric, score, now)
+
+	if t.threshold <= 0 || score < t.threshold {
+		return false
+	}
+	t.sweep(now)
+	if last, ok := t.warned[key]; ok && now.Sub(last) < complexQueryWarnRepeat {
+		return false
+	}
+	t.warned[key] = now
+	return true
+}
+
+// retain updates the query's entry, or adds one when there is room or it is
+// more complex than the least complex retained query. Callers hold t.mu.
+func (t *complexQueryTracker) retain(key string, metric QueryMetrics, score int, now time.Time) {
+	if query, ok := t.queries[key]; ok {
+		query.Count++
+		query.LastSeen = now
+		if score > query.ComplexityScore {
+			query.ComplexityScore = score
+			query.PodName, query.Namespace = metric.PodName, metric.Namespace
+		}
+		return
+	}
+	if t.capacity <= 0 {
+		return
+	}
+	if len(t.queries) >= t.capacity {
+		lowest := t.lowest()
+		if score <= t.queries[lowest].ComplexityScore {
+			return
+		}
+		delete(t.queries, lowest)
+	}
+	t.queries[key] = &ComplexQuery{
+		SQLPattern:      metric.Data.SQLPattern,
+		SQLType:         metric.Data.SQLType,
+		TableNames:      metric.Data.TableNames,
+		ComplexityScore: score,
+		Count:           1,
+		PodName:         metric.PodName,
+		Namespace:       metric.Namespace,
+		LastSeen:        now,
+	}
+}
+
+// lowest returns the key of the least complex retained query. Callers hold
+// t.mu.
+func (t *complexQueryTracker) lowest() string {
+	var lowest string
+	for key, query := range t.queries {
+		if lowest == "" || query.ComplexityScore < t.queries[lowest].ComplexityScore {
+			lowest = key
+		}
+	}
+	return lowest
+}
+
+// sweep forgets warnings older than complexQueryWarnRepeat. It runs at most
+// once per complexQueryWarnRepeat. Callers hold t.mu.
+func (t *complexQueryTracker) sweep(now time.Time) {
+	if now.Sub(t.swept) < complexQueryWarnRepeat {
+		return
+	}
+	t.swept = now
+	for key, last := range t.warned {
+		if now.Sub(last) >= complexQueryWarnRepeat {
+			delete(t.warned, key)
+		}
+	}
+}
+
+// top returns up to limit retained queries, most complex first.
+func (t *complexQueryTracker) top(limit int) []ComplexQuery {
+	t.mu.Lock()
+	result := make([]ComplexQuery, 0, len(t.queries))
+	for _, query := range t.queries {
+		result = append(result, *query)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ComplexityScore != result[j].ComplexityScore {
+			return result[i].ComplexityScore > result[j].ComplexityScore
+		}
+		return result[i].Count > result[j].Count
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// analyzeComplexity tracks the complexity score of query executions and
+// broadcasts and records a complex_query_warning for patterns at or above the
+// threshold, which often point at accidental cartesian joins. A pattern is
+// not known to be fixed until it stops being run, so the alert stays open.
+func (h *Hub) analyzeComplexity(metric QueryMetrics) {
+	if metric.EventType != "query_execution" || metric.Data == nil || metric.Data.ComplexityScore == nil {
+		return
+	}
+	if !h.complexity.record(metric, time.Now()) {
+		return
+	}
+
+	h.alerts.fire("complex_query_warning", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+		"sql_pattern":      metric.Data.SQLPattern,
+		"complexity_score": *metric.Data.ComplexityScore,
+	})
+	h.publish(newNamespacedMessage("complex_query_warning", metric.Namespace, map[string]interface{}{
+		"pod_name":         metric.PodName,
+		"namespace":        metric.Namespace,
+		"query_id":         metric.Data.QueryID,
+		"sql_pattern":      metric.Data.SQLPattern,
+		"table_names":      metric.Data.TableNames,
+		"complexity_score": *metric.Data.ComplexityScore,
+		"threshold":        h.complexity.threshold,
+		"severity":         "warning",
+	}))
+}
+
+// complexQueriesHandler serves GET /api/complex-queries?limit=20.
+func (h *Hub) complexQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	queries := h.complexity.top(limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queries":   queries,
+		"count":     len(queries),
+		"threshold": h.complexity.threshold,
+	})
+}
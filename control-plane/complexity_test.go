@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComplexQueryTopList(t *testing.T) {
+	tracker := newComplexQueryTracker(0, 3)
+	now := time.Now()
+	for _, score := range []int{4, 9, 2, 7, 1} {
+		tracker.record(testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.Data.SQLPattern = fmt.Sprintf("q%d", score)
+			m.Data.ComplexityScore = ptr(score)
+		}), now)
+	}
+	// A repeat keeps its highest score and counts up.
+	for _, score := range []int{3, 8} {
+		tracker.record(testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.Data.SQLPattern = "q7"
+			m.Data.ComplexityScore = ptr(score)
+		}), now)
+	}
+
+	top := tracker.top(0)
+	if len(top) != 3 {
+		t.Fatalf("top = %+v, want the 3 retained", top)
+	}
+	for i, want := range []struct {
+		sql   string
+		score int
+		count int64
+	}{
+		{"q9", 9, 1},
+		{"q7", 8, 3},
+		{"q4", 4, 1},
+	} {
+		if top[i].SQLPattern != want.sql || top[i].ComplexityScore != want.score || top[i].Count != want.count {
+			t.Errorf("top[%d] = %+v, want %s scored %d seen %d times", i, top[i], want.sql, want.score, want.count)
+		}
+	}
+	if limited := tracker.top(1); len(limited) != 1 || limited[0].SQLPattern != "q9" {
+		t.Errorf("top(1) = %+v, want q9 alone", limited)
+	}
+}
+
+func TestComplexQueryWarningsRepeatAfterQuietPeriod(t *testing.T) {
+	tracker := newComplexQueryTracker(10, 10)
+	now := time.Now()
+	steps := []struct {
+		sql   string
+		score int
+		at    time.Duration
+		want  bool
+	}{
+		{"a", 9, 0, false},
+		{"a", 10, 0, true},
+		{"a", 50, time.Minute, false},
+		{"b", 12, time.Minute, true},
+		{"a", 11, complexQueryWarnRepeat, true},
+	}
+	for i, step := range steps {
+		metric := testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.Data.SQLPattern = step.sql
+			m.Data.ComplexityScore = ptr(step.score)
+		})
+		if got := tracker.record(metric, now.Add(step.at)); got != step.want {
+			t.Errorf("step %d (%s scored %d): warn = %v, want %v", i, step.sql, step.score, got, step.want)
+		}
+	}
+}
+
+func TestComplexQueryWarningAndEndpoint(t *testing.T) {
+	cfg := testConfig()
+	cfg.ComplexQueryThreshold = 10
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=complex_query_warning,done")
+
+	for _, tt := range []struct {
+		sql   string
+		score int
+	}{
+		{"SELECT * FROM users WHERE id = ?", 5},
+		{"SELECT * FROM users, orders", 30},
+		{"SELECT * FROM orders JOIN items ON true", 12},
+		{"SELECT * FROM users, orders", 30},
+	} {
+		metric := testMetric("pod-a", 10)
+		metric.Data.SQLPattern = tt.sql
+		metric.Data.ComplexityScore = ptr(tt.score)
+		metric.Data.TableNames = []string{"users", "orders"}
+		postTestMetric(t, h, metric)
+	}
+	// Executions without a score are ignored.
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	h.publish(newMessage("done", nil))
+
+	var warned []string
+	for {
+		message := readTestMessage(t, conn)
+		if message.Type == "done" {
+			break
+		}
+		data := message.Data.(map[string]interface{})
+		if data["threshold"] != float64(10) || len(data["table_names"].([]interface{})) != 2 {
+			t.Errorf("warning = %v, want the threshold and tables", data)
+		}
+		warned = append(warned, fmt.Sprint(data["complexity_score"]))
+	}
+	if fmt.Sprint(warned) != "[30 12]" {
+		t.Errorf("warned about scores %v, want [30 12]", warned)
+	}
+	// The pod's alert follows its latest warning.
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "complex_query_warning")
+	if len(alerts) != 1 || alerts[0].Details["complexity_score"] != 12 {
+		t.Errorf("alert history = %+v, want one alert updated to score 12", alerts)
+	}
+
+	rec := httptest.NewRecorder()
+	h.complexQueriesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/complex-queries?limit=2", nil))
+	var body struct {
+		Queries []ComplexQuery `json:"queries"`
+		Count   int            `json:"count"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Count != 2 || body.Queries[0].ComplexityScore != 30 || body.Queries[0].Count != 2 || body.Queries[1].ComplexityScore != 12 {
+		t.Errorf("/api/complex-queries = %+v, want 30 (seen twice) then 12", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.complexQueriesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/complex-queries?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the control plane settings read from the environment at startup.
+type Config struct {
+	Port string
+
+	// StrictControl closes a WebSocket client once it has sent more than
+	// MaxControlViolations malformed or unknown control messages. When it is
+	// off, violations are only answered with a control_error message.
+	StrictControl        bool
+	MaxControlViolations int
+	// ReadLimit is the largest inbound WebSocket frame, in bytes, a client
+	// may send; larger control messages disconnect the client.
+	ReadLimit int64
+
+	// AlertHistoryFile enables alert history persistence when set. At most
+	// AlertHistorySize alerts are kept in memory for querying.
+	AlertHistoryFile string
+	AlertHistorySize int
+	// DeadlockAlertQuiet resolves an active deadlock alert once its pod has
+	// reported no deadlock for this long; deadlocks have no "cleared" event
+	// of their own. Zero keeps them open until the process restarts.
+	DeadlockAlertQuiet time.Duration
+
+	// CORSMaxAge is how long, in seconds, browsers may cache a preflight
+	// response. A longer cache saves a round trip on most dashboard XHRs, but
+	// changes to the allowed methods or headers take that long to reach
+	// already-open browsers.
+	CORSMaxAge int
+	// CORSAllowedOrigins restricts cross-origin requests to these origins
+	// and allows credentials from them. It is "*" when unset.
+	CORSAllowedOrigins []string
+
+	// SlowestCapacity bounds how many individual slow executions are kept
+	// for /api/slowest, and SlowestRetention how long they stay eligible.
+	SlowestCapacity  int
+	SlowestRetention time.Duration
+
+	// SystemMetricsInterval is the minimum spacing between SystemMetrics
+	// samples forwarded per pod. Zero forwards every sample.
+	SystemMetricsInterval time.Duration
+
+	// HistorySize is how many broadcast messages are retained for replay,
+	// and BackfillLimit caps how many of them one subscribe may request.
+	HistorySize   int
+	BackfillLimit int
+
+	// CPU alerts fire at CPUAlertHigh and clear below CPUAlertLow. The last
+	// CPUTrendSize samples per pod are kept for /api/cpu; samples older than
+	// CPUStaleAfter are dropped.
+	CPUAlertHigh  float64
+	CPUAlertLow   float64
+	CPUTrendSize  int
+	CPUStaleAfter time.Duration
+
+	// HeapAlertRatio is the heap usage ratio at which a pod raises a
+	// resource_alert.
+	HeapAlertRatio float64
+
+	// MaxMessageBytes caps the encoded size of an outbound WebSocket message.
+	// Zero disables the limit.
+	MaxMessageBytes int
+
+	// WSCompression negotiates permessage-deflate with clients that offer
+	// it. Clients that do not offer the extension get uncompressed frames.
+	WSCompression bool
+
+	// DeadlockStoreSize is how many recent deadlocks stay addressable by id.
+	DeadlockStoreSize int
+
+	// MaxConnectionLifetime closes WebSocket clients after this long so they
+	// rebalance across replicas. Zero keeps connections open indefinitely.
+	MaxConnectionLifetime time.Duration
+	// SlowClientPolicy decides whether a client whose send queue is full is
+	// disconnected or has its oldest queued messages dropped.
+	SlowClientPolicy string
+	// ReconnectBackoff is the reconnect delay suggested in the close frame
+	// for each close reason.
+	ReconnectBackoff map[string]time.Duration
+
+	// EndpointWindow is the rolling window for /api/endpoints, and
+	// MaxEndpoints caps how many distinct endpoint templates are tracked.
+	EndpointWindow time.Duration
+	MaxEndpoints   int
+
+	// RecentMetricsSize is how many ingested metrics are kept in memory for
+	// the filtered history endpoints.
+	RecentMetricsSize int
+
+	// IngestWorkers is the number of ingestion pipeline workers and
+	// IngestQueueSize the total number of metrics that may wait for them.
+	// A metric waits up to IngestSubmitTimeout for room in a full queue
+	// before it is rejected with 503.
+	IngestWorkers       int
+	IngestQueueSize     int
+	IngestSubmitTimeout time.Duration
+
+	// DeadlockSignatureWindow is how long deadlock occurrences count towards
+	// a signature's recurrence.
+	DeadlockSignatureWindow time.Duration
+	// DeadlockDedupWindow suppresses repeat reports of the same deadlock
+	// from the same pod for this long. Zero disables deduplication.
+	DeadlockDedupWindow time.Duration
+
+	// IngestAPIKey, when set, must be sent in the X-API-Key header of every
+	// ingestion request.
+	IngestAPIKey string
+
+	// AllowedWSOrigins restricts WebSocket upgrades to these origins. When
+	// empty, every origin is accepted.
+	AllowedWSOrigins originAllowlist
+
+	// DatabaseURL enables persisting metrics to PostgreSQL. SinkQueueSize is
+	// how many metrics may wait to be written before new ones are dropped.
+	DatabaseURL   string
+	SinkQueueSize int
+
+	// ReadyBroadcastSaturation is the fraction of the broadcast channel that
+	// may be full before /api/readyz reports the instance as not ready.
+	ReadyBroadcastSaturation float64
+
+	// PoolAlertRatio is the connection pool usage ratio a pod must report
+	// for PoolAlertConsecutive samples in a row to raise a
+	// pool_exhaustion_warning.
+	PoolAlertRatio       float64
+	PoolAlertConsecutive int
+
+	// NATSURL and NATSSubject, when both set, subscribe to agent metrics
+	// published on NATS in addition to the HTTP endpoint.
+	NATSURL     string
+	NATSSubject string
+
+	// KafkaBrokers (comma-separated) and KafkaTopic, when both set, consume
+	// agent metrics from Kafka in addition to the HTTP endpoint.
+	KafkaBrokers string
+	KafkaTopic   string
+
+	// MaxQueryPatterns caps how many distinct normalized SQL patterns are
+	// tracked for /api/query-stats.
+	MaxQueryPatterns int
+
+	// TableLatencyRetention is the longest window /api/table-latency can
+	// report on, and MaxTables caps how many distinct tables are tracked.
+	TableLatencyRetention time.Duration
+	MaxTables             int
+
+	// IngestRateLimit is how many ingestion requests per second each source
+	// pod or IP may make, with bursts of up to IngestBurst. Zero disables
+	// rate limiting. IngestLimiterKeys bounds how many sources are tracked.
+	IngestRateLimit   float64
+	IngestBurst       int
+	IngestLimiterKeys int
+
+	// LongTransactionThreshold is how long a transaction may stay open
+	// before a long_transaction_warning; it escalates at 30s and 60s. Open
+	// transactions not reported for LongTransactionTTL are forgotten.
+	LongTransactionThreshold time.Duration
+	LongTransactionTTL       time.Duration
+
+	// RecordFile enables recording every processed metric as JSON lines,
+	// rotated once the file reaches RecordMaxBytes. ReplayFile is replayed
+	// through processing at startup, at ReplaySpeed times the original pace
+	// (zero replays as fast as possible).
+	RecordFile     string
+	RecordMaxBytes int64
+	ReplayFile     string
+	ReplaySpeed    float64
+
+	// PodTTL is how long a pod may go without reporting before it is
+	// dropped from /api/pods and announced as pod_left.
+	PodTTL time.Duration
+
+	// PongWait is how long a WebSocket client may stay silent before it is
+	// dropped, PingPeriod how often it is pinged and WriteWait how long a
+	// single write may take. PingPeriod must be shorter than PongWait.
+	PongWait   time.Duration
+	PingPeriod time.Duration
+	WriteWait  time.Duration
+
+	// DeadLetterSize is how many failures /api/dead-letters retains.
+	DeadLetterSize int
+
+	// SQLSecurityRules are the injection heuristics applied to reported SQL
+	// patterns for security_alert broadcasts (SQL_SECURITY_RULES, a
+	// comma-separated list of rule names, "all" or "none").
+	SQLSecurityRules sqlRuleSet
+
+	// MaxMetricBytes caps the body of a single-metric POST and
+	// MaxBatchBytes that of a JSON array batch; larger bodies get 413.
+	MaxMetricBytes int64
+	MaxBatchBytes  int64
+
+	// ErrorRateAlertRatio is the share of failed query executions per pod
+	// over ErrorRateWindow that raises error_rate_alert, once the window
+	// holds at least ErrorRateMinSamples executions.
+	ErrorRateAlertRatio float64
+	ErrorRateWindow     time.Duration
+	ErrorRateMinSamples int
+
+	// JWTSecret (HS256) and JWKSURL (RS256) enable token authentication on
+	// /ws and /api/stream. With neither set the streams stay open.
+	JWTSecret string
+	JWKSURL   string
+
+	// BroadcastBuffer is the capacity of the hub's broadcast channel and
+	// ClientBuffer that of each client's send queue.
+	BroadcastBuffer int
+	ClientBuffer    int
+
+	// ClusterID and Region are stamped on metrics that arrive without
+	// them, so a central aggregator can tell clusters apart.
+	ClusterID string
+	Region    string
+
+	// UpstreamURL is a parent control plane's /ws/ingest URL to forward
+	// every processed metric to, authenticated with UpstreamAPIKey. Up to
+	// UpstreamBuffer metrics are held while it is unreachable.
+	UpstreamURL    string
+	UpstreamAPIKey string
+	UpstreamBuffer int
+
+	// InFlightInterval is how often in_flight_update is broadcast, and
+	// InFlightTTL how long a started query may go without completing
+	// before it is dropped as lost.
+	InFlightInterval time.Duration
+	InFlightTTL      time.Duration
+
+	// A deadlock is classified as a warning rather than critical when it
+	// resolved in under DeadlockWarnDuration and involved at most
+	// DeadlockWarnParticipants transactions.
+	DeadlockWarnDuration     time.Duration
+	DeadlockWarnParticipants int
+
+	// RollbackRatioAlert is the share of a pod's completed transactions
+	// rolled back over RollbackRatioWindow that raises rollback_ratio_alert,
+	// once the window holds at least RollbackRatioMinSamples transactions.
+	RollbackRatioAlert      float64
+	RollbackRatioWindow     time.Duration
+	RollbackRatioMinSamples int
+
+	// MaxClients caps concurrent WebSocket clients and MaxClientsPerIP
+	// those from one source IP; upgrades past either get a 503. Zero
+	// means unlimited.
+	MaxClients      int
+	MaxClientsPerIP int
+
+	// ClientDegradedLatency is the ping round trip at which a WebSocket
+	// client is reported as degraded on /api/clients.
+	ClientDegradedLatency time.Duration
+
+	// RedactPatterns mask matching substrings of SQL patterns and error
+	// messages before a metric is recorded, stored or broadcast.
+	RedactPatterns []*regexp.Regexp
+
+	// ComplexQueryThreshold is the complexity score at which a query raises
+	// complex_query_warning; zero disables the warning. ComplexQueriesSize
+	// bounds the patterns listed on /api/complex-queries.
+	ComplexQueryThreshold int
+	ComplexQueriesSize    int
+
+	// QuerySampleRate is the share of successful, fast query_execution
+	// events that are broadcast; the rest still count towards every
+	// aggregation. Queries at or above QuerySampleSlowThreshold and failed
+	// ones are always broadcast.
+	QuerySampleRate          float64
+	QuerySampleSlowThreshold time.Duration
+
+	// AlertWebhookURL receives a POST for every broadcast whose type is in
+	// AlertWebhookEvents (comma-separated) and whose severity is at least
+	// AlertWebhookMinSeverity. Empty disables the webhook.
+	AlertWebhookURL         string
+	AlertWebhookEvents      string
+	AlertWebhookMinSeverity string
+	AlertWebhookTimeout     time.Duration
+
+	// WSBatchInterval is how long writePump gathers messages for clients
+	// that asked for batching (/ws?batch=1) before sending them as one
+	// batch frame. Zero disables batching.
+	WSBatchInterval time.Duration
+
+	// ShutdownTimeout bounds draining queued metrics, broadcasts and sink
+	// writes and closing the HTTP server on SIGTERM.
+	ShutdownTimeout time.Duration
+
+	// MaxClusters caps the per-cluster hubs created for metrics and stream
+	// clients naming a cluster other than ClusterID. Metrics from further
+	// clusters go to the root hub. Zero means unlimited.
+	MaxClusters int
+
+	// FingerprintCacheSize bounds the SQL statements whose normalized
+	// pattern and hash are cached. Zero disables the cache.
+	FingerprintCacheSize int
+
+	// EnableSimulator turns on POST /api/simulate, which feeds synthetic
+	// metrics to dashboards. It is meant for development only.
+	EnableSimulator bool
+
+	// SinkBreakerFailures consecutive failed writes open the metric sink's
+	// circuit breaker, sending metrics to the dead-letter buffer instead,
+	// until a trial write after SinkBreakerCooldown succeeds.
+	SinkBreakerFailures int
+	SinkBreakerCooldown time.Duration
+
+	// MassMutationThreshold is the number of rows an UPDATE or DELETE may
+	// affect before it raises mass_mutation_warning; zero disables the
+	// warning. LargeMutationsSize bounds /api/large-mutations.
+	MassMutationThreshold int64
+	LargeMutationsSize    int
+
+	// WSMessageTTL is how long a broadcast may wait in a client's send
+	// queue before it is skipped as stale. Zero keeps every message.
+	WSMessageTTL time.Duration
+
+	// GRPCPort serves the MetricIngest gRPC service (ingestpb) next to the
+	// HTTP server. Empty disables it.
+	GRPCPort string
+
+	// AnomalyStddevs is how many standard deviations above its SQL pattern's
+	// mean an execution time must be to raise anomaly_detected, once the
+	// pattern has AnomalyMinSamples executions. Zero disables detection.
+	// The mean and deviation weigh about the last AnomalyWindow executions,
+	// so a pattern that settles at a new speed stops being flagged; zero
+	// weighs the whole history equally.
+	AnomalyStddevs    float64
+	AnomalyMinSamples int
+	AnomalyWindow     int
+
+	// StaticDir holds the dashboard served on every path not taken by the
+	// API or the streams.
+	StaticDir string
+
+	// ClockSkewTolerance is how far a metric's timestamp may be from server
+	// time. Live metrics outside it are stamped with the receive time and
+	// flagged clock_skew; batch and bulk uploads reject them. Zero accepts
+	// any timestamp.
+	ClockSkewTolerance time.Duration
+
+	// WSAckTimeout is how long a client that opted into acknowledgements
+	// (/ws?ack=) has to acknowledge a message before it is resent, at most
+	// WSAckRetries times. WSAckBuffer bounds the messages awaiting
+	// acknowledgement per client.
+	WSAckTimeout time.Duration
+	WSAckRetries int
+	WSAckBuffer  int
+
+	// SuppressPatterns are SQL statements (SUPPRESS_PATTERNS, separated by
+	// semicolons) whose executions are counted but not broadcast. The list
+	// can be replaced at runtime with POST /api/config/suppress.
+	SuppressPatterns []string
+
+	// PoolForecastHorizon is how far ahead a pod's connection pool usage
+	// trend, fitted over its last PoolForecastSamples samples, is projected
+	// for pool_saturation_forecast. Zero disables forecasting.
+	PoolForecastHorizon time.Duration
+	PoolForecastSamples int
+
+	// ContentionHalfLife is how long it takes a table's lock contention
+	// score on /api/contention to halve once its deadlocks and long waits
+	// stop. Zero keeps scores forever.
+	ContentionHalfLife time.Duration
+
+	// FieldAliases maps query data keys used by older agents to their
+	// current names (FIELD_ALIASES, on top of defaultFieldAliases).
+	FieldAliases map[string]string
+}
+
+func loadConfig() Config {
+	return Config{
+		Port:                     getEnv("PORT", "8080"),
+		StrictControl:            getEnvBool("WS_STRICT_CONTROL", false),
+		MaxControlViolations:     getEnvInt("WS_MAX_CONTROL_VIOLATIONS", 3),
+		ReadLimit:                int64(getEnvInt("WS_READ_LIMIT", 4096)),
+		AlertHistoryFile:         getEnv("ALERT_HISTORY_FILE", ""),
+		AlertHistorySize:         getEnvInt("ALERT_HISTORY_SIZE", 10000),
+		DeadlockAlertQuiet:       getEnvDuration("DEADLOCK_ALERT_QUIET", 10*time.Minute),
+		CORSMaxAge:               getEnvInt("CORS_MAX_AGE", 600),
+		CORSAllowedOrigins:       parseCORSOrigins(getEnv("CORS_ALLOWED_ORIGINS", "")),
+		SlowestCapacity:          getEnvInt("SLOWEST_CAPACITY", 100),
+		SlowestRetention:         getEnvDuration("SLOWEST_RETENTION", 15*time.Minute),
+		SystemMetricsInterval:    getEnvDuration("SYSTEM_METRICS_INTERVAL", time.Second),
+		HistorySize:              getEnvInt("HISTORY_SIZE", 500),
+		BackfillLimit:            getEnvInt("WS_BACKFILL_LIMIT", 200),
+		CPUAlertHigh:             getEnvFloat("CPU_ALERT_HIGH", 0.9),
+		CPUAlertLow:              getEnvFloat("CPU_ALERT_LOW", 0.75),
+		CPUTrendSize:             getEnvInt("CPU_TREND_SIZE", 60),
+		CPUStaleAfter:            getEnvDuration("CPU_STALE_AFTER", 2*time.Minute),
+		HeapAlertRatio:           getEnvFloat("HEAP_ALERT_RATIO", 0.9),
+		MaxMessageBytes:          getEnvInt("WS_MAX_MESSAGE_BYTES", 1<<20),
+		WSCompression:            getEnvBool("WS_COMPRESSION", true),
+		DeadlockStoreSize:        getEnvInt("DEADLOCK_STORE_SIZE", 200),
+		MaxConnectionLifetime:    getEnvDuration("WS_MAX_LIFETIME", 0),
+		SlowClientPolicy:         slowClientPolicyFromEnv(),
+		ReconnectBackoff:         reconnectBackoffFromEnv(),
+		EndpointWindow:           getEnvDuration("ENDPOINT_WINDOW", 15*time.Minute),
+		MaxEndpoints:             getEnvInt("MAX_ENDPOINTS", 500),
+		RecentMetricsSize:        getEnvInt("RECENT_METRICS_SIZE", 5000),
+		IngestWorkers:            getEnvInt("INGEST_WORKERS", 4),
+		IngestQueueSize:          getEnvInt("INGEST_QUEUE_SIZE", 1024),
+		IngestSubmitTimeout:      getEnvDuration("INGEST_SUBMIT_TIMEOUT", 100*time.Millisecond),
+		DeadlockSignatureWindow:  getEnvDuration("DEADLOCK_SIGNATURE_WINDOW", time.Hour),
+		DeadlockDedupWindow:      getEnvDuration("DEADLOCK_DEDUP_WINDOW", 5*time.Second),
+		IngestAPIKey:             getEnv("INGEST_API_KEY", ""),
+		AllowedWSOrigins:         parseOriginAllowlist(getEnv("ALLOWED_WS_ORIGINS", "")),
+		DatabaseURL:              getEnv("DATABASE_URL", ""),
+		SinkQueueSize:            getEnvInt("SINK_QUEUE_SIZE", 10000),
+		ReadyBroadcastSaturation: getEnvFloat("READY_BROADCAST_SATURATION", 0.9),
+		PoolAlertRatio:           getEnvFloat("POOL_ALERT_RATIO", 0.95),
+		PoolAlertConsecutive:     getEnvInt("POOL_ALERT_CONSECUTIVE", 3),
+		NATSURL:                  getEnv("NATS_URL", ""),
+		NATSSubject:              getEnv("NATS_SUBJECT", ""),
+		KafkaBrokers:             getEnv("KAFKA_BROKERS", ""),
+		KafkaTopic:               getEnv("KAFKA_TOPIC", ""),
+		MaxQueryPatterns:         getEnvInt("MAX_QUERY_PATTERNS", 1000),
+		TableLatencyRetention:    getEnvDuration("TABLE_LATENCY_RETENTION", time.Hour),
+		MaxTables:                getEnvInt("MAX_TABLES", 500),
+		IngestRateLimit:          getEnvFloat("INGEST_RATE_LIMIT", 0),
+		IngestBurst:              getEnvInt("INGEST_BURST", 20),
+		IngestLimiterKeys:        getEnvInt("INGEST_LIMITER_KEYS", 10000),
+		LongTransactionThreshold: getEnvDuration("LONG_TX_THRESHOLD", 10*time.Second),
+		LongTransactionTTL:       getEnvDuration("LONG_TX_TTL", 5*time.Minute),
+		RecordFile:               getEnv("RECORD_FILE", ""),
+		RecordMaxBytes:           int64(getEnvInt("RECORD_MAX_BYTES", 100<<20)),
+		ReplayFile:               getEnv("REPLAY_FILE", ""),
+		ReplaySpeed:              getEnvFloat("REPLAY_SPEED", 1),
+		PodTTL:                   getEnvDuration("POD_TTL", 60*time.Second),
+		PongWait:                 getEnvDuration("WS_PONG_WAIT", 60*time.Second),
+		PingPeriod:               getEnvDuration("WS_PING_PERIOD", 54*time.Second),
+		WriteWait:                getEnvDuration("WS_WRITE_WAIT", 10*time.Second),
+		DeadLetterSize:           getEnvInt("DEAD_LETTER_SIZE", 200),
+		SQLSecurityRules:         parseSQLRuleSet(getEnv("SQL_SECURITY_RULES", "all")),
+		MaxMetricBytes:           int64(getEnvInt("MAX_METRIC_BYTES", 1<<20)),
+		MaxBatchBytes:            int64(getEnvInt("MAX_BATCH_BYTES", 10<<20)),
+		ErrorRateAlertRatio:      getEnvFloat("ERROR_RATE_ALERT_RATIO", 0.1),
+		ErrorRateWindow:          getEnvDuration("ERROR_RATE_WINDOW", time.Minute),
+		ErrorRateMinSamples:      getEnvInt("ERROR_RATE_MIN_SAMPLES", 20),
+		JWTSecret:                getEnv("WS_JWT_SECRET", ""),
+		JWKSURL:                  getEnv("WS_JWKS_URL", ""),
+		BroadcastBuffer:          getEnvInt("BROADCAST_BUFFER", 256),
+		ClientBuffer:             getEnvInt("CLIENT_BUFFER", 256),
+		ClusterID:                getEnv("CLUSTER_ID", ""),
+		Region:                   getEnv("REGION", ""),
+		UpstreamURL:              getEnv("UPSTREAM_WS_URL", ""),
+		UpstreamAPIKey:           getEnv("UPSTREAM_API_KEY", ""),
+		UpstreamBuffer:           getEnvInt("UPSTREAM_BUFFER", 10000),
+		InFlightInterval:         getEnvDuration("IN_FLIGHT_INTERVAL", 2*time.Second),
+		InFlightTTL:              getEnvDuration("IN_FLIGHT_TTL", 5*time.Minute),
+		DeadlockWarnDuration:     getEnvDuration("DEADLOCK_WARN_DURATION", 100*time.Millisecond),
+		DeadlockWarnParticipants: getEnvInt("DEADLOCK_WARN_PARTICIPANTS", 2),
+		RollbackRatioAlert:       getEnvFloat("ROLLBACK_RATIO_ALERT", 0.3),
+		RollbackRatioWindow:      getEnvDuration("ROLLBACK_RATIO_WINDOW", 5*time.Minute),
+		RollbackRatioMinSamples:  getEnvInt("ROLLBACK_RATIO_MIN_SAMPLES", 20),
+		MaxClients:               getEnvInt("MAX_CLIENTS", 0),
+		MaxClientsPerIP:          getEnvInt("MAX_CLIENTS_PER_IP", 0),
+		ClientDegradedLatency:    getEnvDuration("CLIENT_DEGRADED_LATENCY", time.Second),
+		RedactPatterns:           parseRedactPatterns(getEnv("REDACT_PATTERNS", defaultRedactPatterns)),
+		ComplexQueryThreshold:    getEnvInt("COMPLEX_QUERY_THRESHOLD", 10),
+		ComplexQueriesSize:       getEnvInt("COMPLEX_QUERIES_SIZE", 50),
+		QuerySampleRate:          getEnvFloat("QUERY_SAMPLE_RATE", 1.0),
+		QuerySampleSlowThreshold: getEnvDuration("QUERY_SAMPLE_SLOW_THRESHOLD", time.Second),
+		AlertWebhookURL:          getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertWebhookEvents:       getEnv("ALERT_WEBHOOK_EVENTS", "deadlock_event,resource_alert"),
+		AlertWebhookMinSeverity:  getEnv("ALERT_WEBHOOK_MIN_SEVERITY", "critical"),
+		AlertWebhookTimeout:      getEnvDuration("ALERT_WEBHOOK_TIMEOUT", 5*time.Second),
+		WSBatchInterval:          getEnvDuration("WS_BATCH_INTERVAL", 50*time.Millisecond),
+		ShutdownTimeout:          getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		MaxClusters:              getEnvInt("MAX_CLUSTERS", 100),
+		FingerprintCacheSize:     getEnvInt("FINGERPRINT_CACHE_SIZE", 10000),
+		EnableSimulator:          getEnvBool("ENABLE_SIMULATOR", false),
+		SinkBreakerFailures:      getEnvInt("SINK_BREAKER_FAILURES", 5),
+		SinkBreakerCooldown:      getEnvDuration("SINK_BREAKER_COOLDOWN", 30*time.Second),
+		MassMutationThreshold:    int64(getEnvInt("MASS_MUTATION_THRESHOLD", 10000)),
+		LargeMutationsSize:       getEnvInt("LARGE_MUTATIONS_SIZE", 50),
+		WSMessageTTL:             getEnvDuration("WS_MESSAGE_TTL", 10*time.Second),
+		GRPCPort:                 getEnv("GRPC_PORT", ""),
+		AnomalyStddevs:           getEnvFloat("ANOMALY_STDDEVS", 3),
+		AnomalyMinSamples:        getEnvInt("ANOMALY_MIN_SAMPLES", 30),
+		AnomalyWindow:            getEnvInt("ANOMALY_WINDOW", 1000),
+		StaticDir:                getEnv("STATIC_DIR", "./static/"),
+		ClockSkewTolerance:       getEnvDuration("CLOCK_SKEW_TOLERANCE", 5*time.Minute),
+		WSAckTimeout:             getEnvDuration("WS_ACK_TIMEOUT", 5*time.Second),
+		WSAckRetries:             getEnvInt("WS_ACK_RETRIES", 1),
+		WSAckBuffer:              getEnvInt("WS_ACK_BUFFER", 100),
+		SuppressPatterns:         parseSuppressPatterns(getEnv("SUPPRESS_PATTERNS", "")),
+		PoolForecastHorizon:      getEnvDuration("POOL_FORECAST_HORIZON", time.Minute),
+		PoolForecastSamples:      getEnvInt("POOL_FORECAST_SAMPLES", 10),
+		ContentionHalfLife:       getEnvDuration("CONTENTION_HALF_LIFE", 10*time.Minute),
+		FieldAliases:             parseFieldAliases(getEnv("FIELD_ALIASES", "")),
+	}
+}
+
+// validate rejects settings that cannot work together.
+func (c Config) validate() error {
+	if c.PongWait <= 0 || c.WriteWait <= 0 {
+		return fmt.Errorf("WS_PONG_WAIT (%s) and WS_WRITE_WAIT (%s) must be positive", c.PongWait, c.WriteWait)
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		return fmt.Errorf("WS_PING_PERIOD (%s) must be positive and shorter than WS_PONG_WAIT (%s)", c.PingPeriod, c.PongWait)
+	}
+	if c.InFlightInterval <= 0 {
+		return fmt.Errorf("IN_FLIGHT_INTERVAL (%s) must be positive", c.InFlightInterval)
+	}
+	if c.BroadcastBuffer <= 0 || c.ClientBuffer <= 0 {
+		return fmt.Errorf("BROADCAST_BUFFER (%d) and CLIENT_BUFFER (%d) must be positive", c.BroadcastBuffer, c.ClientBuffer)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("SHUTDOWN_TIMEOUT (%s) must be positive", c.ShutdownTimeout)
+	}
+	if c.QuerySampleRate < 0 || c.QuerySampleRate > 1 {
+		return fmt.Errorf("QUERY_SAMPLE_RATE (%g) must be between 0 and 1", c.QuerySampleRate)
+	}
+	return nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("invalid environment value, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("invalid environment value, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("invalid environment value, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("invalid environment value, using default", "key", key, "value", value, "default", fallback.String())
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketTimingsFromEnvironment(t *testing.T) {
+	t.Setenv("WS_PONG_WAIT", "2s")
+	t.Setenv("WS_PING_PERIOD", "1500ms")
+	t.Setenv("WS_WRITE_WAIT", "500ms")
+	cfg := loadConfig()
+	if cfg.PongWait != 2*time.Second || cfg.PingPeriod != 1500*time.Millisecond || cfg.WriteWait != 500*time.Millisecond {
+		t.Errorf("timings = %v/%v/%v, want 2s/1.5s/500ms", cfg.PongWait, cfg.PingPeriod, cfg.WriteWait)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Errorf("validate = %v, want nil", err)
+	}
+}
+
+func TestValidateWebSocketTimings(t *testing.T) {
+	tests := []struct {
+		name       string
+		pongWait   time.Duration
+		pingPeriod time.Duration
+		writeWait  time.Duration
+		wantErr    string
+	}{
+		{"defaults", 60 * time.Second, 54 * time.Second, 10 * time.Second, ""},
+		{"ping equal to pong wait", time.Second, time.Second, time.Second, "WS_PING_PERIOD"},
+		{"ping longer than pong wait", time.Second, 2 * time.Second, time.Second, "WS_PING_PERIOD"},
+		{"zero ping period", time.Second, 0, time.Second, "WS_PING_PERIOD"},
+		{"zero pong wait", 0, 0, time.Second, "WS_PONG_WAIT"},
+		{"zero write wait", time.Second, 500 * time.Millisecond, 0, "WS_WRITE_WAIT"},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.PongWait, cfg.PingPeriod, cfg.WriteWait = tt.pongWait, tt.pingPeriod, tt.writeWait
+		err := cfg.validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: validate = %v, want nil", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: validate = %v, want an error about %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Contention added per occurrence. A deadlock is the strongest sign of
+// contention on a table; a long running transaction touching it is a weaker
+// one.
+const (
+	deadlockContention = 1.0
+	longWaitContention = 0.25
+)
+
+// TableContention is a table's entry on /api/contention. Score decays with
+// CONTENTION_HALF_LIFE; the counts are totals since the table was first
+// seen.
+type TableContention struct {
+	Table     string           `json:"table"`
+	Score     float64          `json:"score"`
+	Deadlocks int64            `json:"deadlocks"`
+	LongWaits int64            `json:"long_waits"`
+	LockTypes map[string]int64 `json:"lock_types,omitempty"`
+	LastSeen  time.Time        `json:"last_seen"`
+}
+
+// contentionTracker scores how contended each table is from the deadlocks
+// and long running transactions it appears in, for the dashboard's hot
+// table heatmap. Scores halve every halfLife so past incidents fade.
+type contentionTracker struct {
+	mu        sync.Mutex
+	halfLife  time.Duration
+	maxTables int
+	tables    map[string]*TableContention
+}
+
+func newContentionTracker(halfLife time.Duration, maxTables int) *contentionTracker {
+	return &contentionTracker{
+		halfLife:  halfLife,
+		maxTables: maxTables,
+		tables:    make(map[string]*TableContention),
+	}
+}
+
+// decayed returns an entry's score as of now. A non-positive half-life
+// never decays.
+func (t *contentionTracker) decayed(entry *TableContention, now time.Time) float64 {
+	if t.halfLife <= 0 {
+		return entry.Score
+	}
+	return entry.Score * math.Pow(0.5, now.Sub(entry.LastSeen).Seconds()/t.halfLife.Seconds())
+}
+
+// entry returns a table's entry with its score decayed to now, making room
+// by evicting the least contended table when the tracker is full. Callers
+// hold t.mu.
+func (t *contentionTracker) entry(table string, now time.Time) *TableContention {
+	if entry, ok := t.tables[table]; ok {
+		entry.Score = t.decayed(entry, now)
+		entry.LastSeen = now
+		return entry
+	}
+	if t.maxTables > 0 && len(t.tables) >= t.maxTables {
+		coolest, lowest := "", math.Inf(1)
+		for name, entry := range t.tables {
+			if score := t.decayed(entry, now); score < lowest {
+				coolest, lowest = name, score
+			}
+		}
+		delete(t.tables, coolest)
+	}
+	entry := &TableContention{Table: table, LockTypes: make(map[string]int64), LastSeen: now}
+	t.tables[table] = entry
+	return entry
+}
+
+// recordDeadlock scores the tables a deadlock was reported on (see
+// reportedLocks), each once however many locks name it.
+func (t *contentionTracker) recordDeadlock(locks []tableLock, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seen := make(map[string]bool, len(locks))
+	for _, lock := range locks {
+		entry := t.entry(lock.Table, now)
+		if lock.LockType != "" {
+			entry.LockTypes[lock.LockType]++
+		}
+		if seen[lock.Table] {
+			continue
+		}
+		seen[lock.Table] = true
+		entry.Score += deadlockContention
+		entry.Deadlocks++
+	}
+}
+
+// recordLongWait scores the tables touched by a long running transaction.
+func (t *contentionTracker) recordLongWait(tables []string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, table := range tables {
+		if table == "" {
+			continue
+		}
+		entry := t.entry(table, now)
+		entry.Score += longWaitContention
+		entry.LongWaits++
+	}
+}
+
+// hottest returns up to limit tables by decayed score, highest first.
+func (t *contentionTracker) hottest(limit int, now time.Time) []TableContention {
+	t.mu.Lock()
+	result := make([]TableContention, 0, len(t.tables))
+	for _, entry := range t.tables {
+		snapshot := *entry
+		snapshot.Score = t.decayed(entry, now)
+		snapshot.LockTypes = make(map[string]int64, len(entry.LockTypes))
+		for lockType, count := range entry.LockTypes {
+			snapshot.LockTypes[lockType] = count
+		}
+		result = append(result, snapshot)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Table < result[j].Table
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// contentionHandler serves GET /api/contention?limit=50.
+func (h *Hub) contentionHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	tables := h.contention.hottest(limit, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tables":            tables,
+		"count":             len(tables),
+		"half_life_seconds": h.contention.halfLife.Seconds(),
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContentionScoresAndDecay(t *testing.T) {
+	tracker := newContentionTracker(time.Minute, 10)
+	now := time.Now()
+	tracker.recordDeadlock([]tableLock{{"orders", "row"}, {"orders", "row"}, {"users", "table"}}, now)
+	tracker.recordDeadlock([]tableLock{{"orders", "row"}}, now)
+	tracker.recordLongWait([]string{"users", "audit", ""}, now)
+
+	hottest := tracker.hottest(0, now)
+	want := []struct {
+		table     string
+		score     float64
+		deadlocks int64
+		longWaits int64
+	}{
+		// A table named by several locks of one deadlock scores it once.
+		{"orders", 2, 2, 0},
+		{"users", 1.25, 1, 1},
+		{"audit", 0.25, 0, 1},
+	}
+	if len(hottest) != len(want) {
+		t.Fatalf("hottest = %+v, want %d tables", hottest, len(want))
+	}
+	for i, w := range want {
+		got := hottest[i]
+		if got.Table != w.table || got.Score != w.score || got.Deadlocks != w.deadlocks || got.LongWaits != w.longWaits {
+			t.Errorf("hottest[%d] = %+v, want %s scoring %v", i, got, w.table, w.score)
+		}
+	}
+	if got := hottest[0].LockTypes["row"]; got != 3 {
+		t.Errorf("orders row locks = %d, want 3", got)
+	}
+
+	// Two half-lives later the scores are a quarter, and fresh contention
+	// adds to the decayed score.
+	later := now.Add(2 * time.Minute)
+	if got := tracker.hottest(1, later); len(got) != 1 || math.Abs(got[0].Score-0.5) > 1e-9 {
+		t.Errorf("orders after two half-lives = %+v, want a score of 0.5", got)
+	}
+	tracker.recordDeadlock([]tableLock{{Table: "audit"}}, later)
+	if got := tracker.hottest(1, later); got[0].Table != "audit" || math.Abs(got[0].Score-1.0625) > 1e-9 {
+		t.Errorf("hottest after a new deadlock = %+v, want audit scoring 1.0625", got)
+	}
+
+	if forever := newContentionTracker(0, 10); forever.decayed(&TableContention{Score: 3, LastSeen: now}, now.Add(time.Hour)) != 3 {
+		t.Error("score decayed with no half-life")
+	}
+}
+
+func TestContentionEvictsCoolestTable(t *testing.T) {
+	tracker := newContentionTracker(time.Minute, 2)
+	now := time.Now()
+	tracker.recordDeadlock([]tableLock{{Table: "orders"}}, now)
+	tracker.recordDeadlock([]tableLock{{Table: "orders"}}, now)
+	tracker.recordLongWait([]string{"users"}, now)
+	tracker.recordLongWait([]string{"audit"}, now)
+
+	hottest := tracker.hottest(0, now)
+	if len(hottest) != 2 || hottest[0].Table != "orders" || hottest[1].Table != "audit" {
+		t.Errorf("hottest = %+v, want orders and audit with users evicted", hottest)
+	}
+}
+
+func TestContentionIgnoresPlaceholderTables(t *testing.T) {
+	h := startTestHub(t, testConfig())
+
+	// Without wait-for edges, the metric's table names are scored, not the
+	// table_1, table_2, ... resources invented for the graph.
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+	withEdges := testDeadlock("pod-a", "PgConnection@c:PgConnection@d")
+	withEdges.Data.WaitForEdges = []WaitForEdge{{Holder: "PgConnection@c", Waiter: "PgConnection@d", Resource: "orders", LockType: "row"}}
+	postTestMetric(t, h, withEdges)
+	unnamed := testDeadlock("pod-a", "PgConnection@e:PgConnection@f")
+	unnamed.Data.TableNames = nil
+	postTestMetric(t, h, unnamed)
+	waitForHistory(t, h, 3)
+
+	rec := httptest.NewRecorder()
+	h.contentionHandler(rec, httptest.NewRequest(http.MethodGet, "/api/contention", nil))
+	var body struct {
+		Tables []TableContention `json:"tables"`
+		Count  int               `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 2 || body.Tables[0].Table != "orders" || body.Tables[1].Table != "users" {
+		t.Fatalf("contention = %+v, want only the reported orders and users", body.Tables)
+	}
+	if body.Tables[0].LockTypes["row"] != 1 || len(body.Tables[1].LockTypes) != 0 {
+		t.Errorf("lock types = %v and %v, want the edge's row lock only", body.Tables[0].LockTypes, body.Tables[1].LockTypes)
+	}
+
+	rec = httptest.NewRecorder()
+	h.contentionHandler(rec, httptest.NewRequest(http.MethodGet, "/api/contention?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for limit=0 = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ControlMessage is a JSON frame sent by a dashboard over /ws to drive the
+// control protocol, e.g. {"action":"subscribe","types":["deadlock_event"]}.
+type ControlMessage struct {
+	Action string   `json:"action"`
+	Types  []string `json:"types,omitempty"`
+	// Backfill optionally asks for retained messages from this far back
+	// (a Go duration such as "5m") to be sent before live ones.
+	Backfill string `json:"backfill,omitempty"`
+	// ID is the AckID of the message acknowledged by an ack action.
+	ID uint64 `json:"id,omitempty"`
+}
+
+// clientMessage is a message addressed to a single client rather than
+// broadcast. It is delivered by the hub goroutine, which owns client.send.
+type clientMessage struct {
+	client  *Client
+	message WebSocketMessage
+}
+
+// subscription replaces a client's message type filter and optionally
+// requests a backfill. It is applied by the hub goroutine so that backfilled
+// messages are queued strictly before any live broadcast.
+type subscription struct {
+	client   *Client
+	types    []string
+	backfill time.Duration
+}
+
+// handleControlMessage processes one inbound frame. It returns false when the
+// client should be disconnected.
+func (c *Client) handleControlMessage(payload []byte) bool {
+	var msg ControlMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return c.controlViolation("", fmt.Sprintf("malformed control message: %v", err))
+	}
+
+	switch msg.Action {
+	case "ping":
+		c.reply(newMessage("pong", map[string]string{"action": msg.Action}))
+	case "subscribe":
+		var backfill time.Duration
+		if msg.Backfill != "" {
+			parsed, err := time.ParseDuration(msg.Backfill)
+			if err != nil || parsed < 0 {
+				return c.controlViolation(msg.Action, fmt.Sprintf("invalid backfill %q", msg.Backfill))
+			}
+			backfill = parsed
+		}
+		select {
+		case c.hub.subscribe <- subscription{client: c, types: msg.Types, backfill: backfill}:
+		case <-c.hub.done:
+		}
+	case "ack":
+		if c.acks == nil {
+			return c.controlViolation(msg.Action, "acknowledgements were not requested with /ws?ack=")
+		}
+		// Acks for messages already given up on, or repeated ones, are
+		// harmless and ignored.
+		c.acks.ack(msg.ID)
+	case "":
+		return c.controlViolation(msg.Action, "missing action")
+	default:
+		return c.controlViolation(msg.Action, fmt.Sprintf("unknown action %q", msg.Action))
+	}
+	return true
+}
+
+// controlViolation answers a protocol violation with a control_error message.
+// In strict mode the client is closed once it exceeds the violation budget.
+func (c *Client) controlViolation(action, problem string) bool {
+	c.violations++
+	slog.Warn("control protocol violation", "remote_addr", c.conn.RemoteAddr().String(), "violations", c.violations, "problem", problem)
+
+	cfg := c.hub.cfg
+	if cfg.StrictControl && c.violations > cfg.MaxControlViolations {
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many control protocol violations"),
+			time.Now().Add(cfg.WriteWait))
+		return false
+	}
+
+	c.reply(newMessage("control_error", map[string]interface{}{
+		"action":     action,
+		"error":      problem,
+		"violations": c.violations,
+	}))
+	return true
+}
+
+// reply queues a message for this client only.
+func (c *Client) reply(message WebSocketMessage) {
+	select {
+	case c.hub.reply <- clientMessage{client: c, message: message}:
+	case <-c.hub.done:
+	}
+}
+
+// applySubscription runs on the hub goroutine.
+func (h *Hub) applySubscription(sub subscription) {
+	client := sub.client
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	client.subscriptions = nil
+	if len(sub.types) > 0 {
+		client.subscriptions = make(map[string]bool, len(sub.types))
+		for _, messageType := range sub.types {
+			client.subscriptions[messageType] = true
+		}
+	}
+
+	backfilled := 0
+	if sub.backfill > 0 {
+		entries := h.history.since(time.Now().Add(-sub.backfill))
+		matching := make([]WebSocketMessage, 0, len(entries))
+		for _, entry := range entries {
+			if client.wants(entry.message) {
+				matching = append(matching, entry.message)
+			}
+		}
+		// Keep the most recent messages, bounded so a backfill can never
+		// overflow the client's send buffer.
+		limit := min(h.cfg.BackfillLimit, cap(client.send)-len(client.send)-1)
+		if len(matching) > limit {
+			matching = matching[len(matching)-max(limit, 0):]
+		}
+		for _, message := range matching {
+			message.IsBackfill = true
+			client.send <- message
+			backfilled++
+		}
+	}
+
+	select {
+	case client.send <- newMessage("subscribed", map[string]interface{}{
+		"types":      sub.types,
+		"backfilled": backfilled,
+	}):
+	default:
+	}
+}
+
+// parseSubscriptions turns a comma-separated list of message types, as given
+// in /ws?types=deadlock_event,transaction_event, into a subscription set. An
+// empty list subscribes to everything.
+func parseSubscriptions(types string) map[string]bool {
+	var subscriptions map[string]bool
+	for _, messageType := range strings.Split(types, ",") {
+		if messageType = strings.TrimSpace(messageType); messageType == "" {
+			continue
+		}
+		if subscriptions == nil {
+			subscriptions = make(map[string]bool)
+		}
+		subscriptions[messageType] = true
+	}
+	return subscriptions
+}
+
+// wants reports whether the client is subscribed to the message's type and
+// namespace. A client without subscriptions receives every type, and one
+// without a namespace every namespace its token allows; messages without a
+// namespace go to everyone.
+func (c *Client) wants(message WebSocketMessage) bool {
+	if message.Namespace != "" {
+		if c.namespace != "" && message.Namespace != c.namespace {
+			return false
+		}
+		if c.allowedNamespaces != nil && !c.allowedNamespaces[message.Namespace] {
+			return false
+		}
+	}
+	return len(c.subscriptions) == 0 || c.subscriptions[message.Type]
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestUnknownControlMessageGetsControlError(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "")
+
+	if err := conn.WriteJSON(ControlMessage{Action: "rewind"}); err != nil {
+		t.Fatal(err)
+	}
+	message := readTestMessageOfType(t, conn, "control_error")
+	data := message.Data.(map[string]interface{})
+	if data["action"] != "rewind" || data["violations"] != float64(1) {
+		t.Errorf("control_error data = %v, want action rewind and 1 violation", data)
+	}
+
+	// The connection stays usable in the default lenient mode.
+	if err := conn.WriteJSON(ControlMessage{Action: "ping"}); err != nil {
+		t.Fatal(err)
+	}
+	readTestMessageOfType(t, conn, "pong")
+}
+
+func TestStrictControlClosesAfterViolationBudget(t *testing.T) {
+	cfg := testConfig()
+	cfg.StrictControl = true
+	cfg.MaxControlViolations = 1
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	readTestMessageOfType(t, conn, "control_error")
+
+	conn.WriteJSON(ControlMessage{})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("read error = %v, want policy violation close", err)
+			}
+			return
+		}
+	}
+}
+
+// waitForHistory waits until the hub has broadcast n messages into its
+// history.
+func waitForHistory(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(testReadTimeout)
+	for len(h.history.since(time.Time{})) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("history holds %d messages, want %d", len(h.history.since(time.Time{})), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscribeBackfillPrecedesLiveMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  []float64
+	}{
+		{"all", 200, []float64{1, 2, 3}},
+		{"bounded", 2, []float64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BackfillLimit = tt.limit
+			h := startTestHub(t, cfg)
+			// Subscribed to nothing retained, so connecting replays nothing.
+			conn := dialTestHub(t, h, "types=none")
+
+			for i := 1; i <= 3; i++ {
+				h.publish(newMessage("slow_query", map[string]interface{}{"n": i}))
+				h.publish(newMessage("other", nil))
+			}
+			waitForHistory(t, h, 6)
+
+			if err := conn.WriteJSON(ControlMessage{Action: "subscribe", Types: []string{"slow_query"}, Backfill: "5m"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range tt.want {
+				message := readTestMessage(t, conn)
+				if message.Type != "slow_query" || !message.IsBackfill || message.Data.(map[string]interface{})["n"] != n {
+					t.Fatalf("message = %+v, want backfilled slow_query %v", message, n)
+				}
+			}
+			subscribed := readTestMessage(t, conn)
+			if subscribed.Type != "subscribed" || subscribed.Data.(map[string]interface{})["backfilled"] != float64(len(tt.want)) {
+				t.Fatalf("message = %+v, want subscribed with %d backfilled", subscribed, len(tt.want))
+			}
+
+			h.publish(newMessage("slow_query", map[string]interface{}{"n": 4}))
+			if live := readTestMessage(t, conn); live.Type != "slow_query" || live.IsBackfill {
+				t.Errorf("message = %+v, want a live slow_query", live)
+			}
+		})
+	}
+}
+
+func TestSubscribeRejectsInvalidBackfill(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "")
+
+	conn.WriteJSON(ControlMessage{Action: "subscribe", Backfill: "yesterday"})
+	message := readTestMessageOfType(t, conn, "control_error")
+	if data := message.Data.(map[string]interface{}); data["action"] != "subscribe" {
+		t.Errorf("control_error data = %v, want action subscribe", data)
+	}
+}
+
+func TestBroadcastsFollowSubscriptions(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	deadlocks := dialTestHub(t, h, "types=deadlock_event")
+	transactions := dialTestHub(t, h, "types=transaction_event,long_running_transaction")
+	everything := dialTestHub(t, h, "")
+
+	sent := []string{"query_metrics", "deadlock_event", "transaction_event", "long_running_transaction", "deadlock_event"}
+	for _, messageType := range sent {
+		h.publish(newMessage(messageType, nil))
+	}
+
+	for _, tt := range []struct {
+		conn *websocket.Conn
+		want []string
+	}{
+		{deadlocks, []string{"deadlock_event", "deadlock_event"}},
+		{transactions, []string{"transaction_event", "long_running_transaction"}},
+		{everything, sent},
+	} {
+		for i, want := range tt.want {
+			if got := readTestMessage(t, tt.conn).Type; got != want {
+				t.Errorf("message %d = %q, want %q (expecting %v)", i, got, want, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseSubscriptions(t *testing.T) {
+	if got := parseSubscriptions(""); got != nil {
+		t.Errorf("parseSubscriptions(\"\") = %v, want nil for everything", got)
+	}
+	got := parseSubscriptions(" deadlock_event, ,transaction_event ")
+	if len(got) != 2 || !got["deadlock_event"] || !got["transaction_event"] {
+		t.Errorf("parseSubscriptions = %v, want deadlock_event and transaction_event", got)
+	}
+}
+
+func TestLargeSubscribeUpdatesSubscriptionsLive(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	// Well over the old 512 byte read limit.
+	types := []string{"deadlock_event"}
+	for i := 0; i < 40; i++ {
+		types = append(types, fmt.Sprintf("custom_event_type_%02d", i))
+	}
+	if err := conn.WriteJSON(ControlMessage{Action: "subscribe", Types: types}); err != nil {
+		t.Fatal(err)
+	}
+	readTestMessageOfType(t, conn, "subscribed")
+
+	h.publish(newMessage("query_metrics", nil))
+	h.publish(newMessage("deadlock_event", nil))
+	if message := readTestMessage(t, conn); message.Type != "deadlock_event" {
+		t.Errorf("message type = %q, want deadlock_event only", message.Type)
+	}
+}
+
+func TestFrameOverReadLimitClosesConnection(t *testing.T) {
+	cfg := testConfig()
+	cfg.ReadLimit = 1024
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "")
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"action":"ping","pad":"`+strings.Repeat("x", 2048)+`"}`))
+	if closeErr := readTestClose(t, conn); closeErr.Code != websocket.CloseMessageTooBig {
+		t.Errorf("close code = %d, want %d", closeErr.Code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestNamespaceScopedClients(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	teamA := dialTestHub(t, h, "namespace=team-a&types=query_metrics,done")
+	teamB := dialTestHub(t, h, "namespace=team-b&types=query_metrics,done")
+	everyone := dialTestHub(t, h, "types=query_metrics,done")
+
+	for _, namespace := range []string{"team-a", "team-b", "team-a", "team-c"} {
+		metric := testMetric("pod-"+namespace, 10)
+		metric.Namespace = namespace
+		postTestMetric(t, h, metric)
+	}
+	// Messages without a namespace reach every client.
+	h.publish(newMessage("done", nil))
+
+	for _, tt := range []struct {
+		name string
+		conn *websocket.Conn
+		want []string
+	}{
+		{"team-a", teamA, []string{"team-a", "team-a"}},
+		{"team-b", teamB, []string{"team-b"}},
+		{"all", everyone, []string{"team-a", "team-b", "team-a", "team-c"}},
+	} {
+		var got []string
+		for {
+			message := readTestMessage(t, tt.conn)
+			if message.Type == "done" {
+				break
+			}
+			got = append(got, message.Namespace)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s client got namespaces %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// corsAllowedHeaders are the request headers the dashboard and agents send
+// when origins are restricted.
+var corsAllowedHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-Requested-With"}
+
+// parseCORSOrigins parses CORS_ALLOWED_ORIGINS. An empty value allows every
+// origin.
+func parseCORSOrigins(raw string) []string {
+	var origins []string
+	for _, origin := range strings.Split(raw, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return []string{"*"}
+	}
+	return origins
+}
+
+// newCORS allows every origin without credentials for demo setups, and
+// credentials with a fixed header list once specific origins are configured.
+func newCORS(cfg Config) *cors.Cors {
+	options := cors.Options{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+		MaxAge:         cfg.CORSMaxAge,
+	}
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			return cors.New(options)
+		}
+	}
+	options.AllowCredentials = true
+	options.AllowedHeaders = corsAllowedHeaders
+	return cors.New(options)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreflightCarriesMaxAge(t *testing.T) {
+	cfg := testConfig()
+	if cfg.CORSMaxAge != 600 {
+		t.Errorf("default CORSMaxAge = %d, want 600", cfg.CORSMaxAge)
+	}
+	cfg.CORSMaxAge = 900
+	handler := newCORS(cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight reached the wrapped handler")
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/metrics", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "900" {
+		t.Errorf("Access-Control-Max-Age = %q, want %q", got, "900")
+	}
+}
+
+func TestParseCORSOrigins(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", "*"},
+		{" , ", "*"},
+		{"https://a.example.com", "https://a.example.com"},
+		{" https://a.example.com , https://b.example.com ,", "https://a.example.com|https://b.example.com"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(parseCORSOrigins(tt.raw), "|"); got != tt.want {
+			t.Errorf("parseCORSOrigins(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed         []string
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"wildcard", []string{"*"}, "https://anywhere.example.com", "*", ""},
+		{"listed origin", []string{"https://dashboard.example.com"}, "https://dashboard.example.com", "https://dashboard.example.com", "true"},
+		{"second listed origin", []string{"https://a.example.com", "https://b.example.com"}, "https://b.example.com", "https://b.example.com", "true"},
+		{"unlisted origin", []string{"https://dashboard.example.com"}, "https://evil.example.com", "", ""},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.CORSAllowedOrigins = tt.allowed
+		handler := newCORS(cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+		req.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.wantOrigin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want %q", tt.name, got, tt.wantCredentials)
+		}
+	}
+}
+
+func TestRestrictedCORSAllowsOnlyListedHeaders(t *testing.T) {
+	cfg := testConfig()
+	cfg.CORSAllowedOrigins = []string{"https://dashboard.example.com"}
+	handler := newCORS(cfg).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{"X-API-Key", true},
+		{"Authorization", true},
+		{"X-Custom-Header", false},
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/api/metrics", nil)
+		req.Header.Set("Origin", "https://dashboard.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", tt.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		allowed := rec.Header().Get("Access-Control-Allow-Origin") != ""
+		if allowed != tt.want {
+			t.Errorf("preflight for %s allowed = %v, want %v", tt.header, allowed, tt.want)
+		}
+	}
+}
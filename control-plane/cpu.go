@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cpuTracker keeps a short CPU usage trend per pod and decides when to raise
+// or clear cpu_alert. Samples older than staleAfter are ignored, so a pod that
+// reports intermittently does not show an outdated value as current.
+type cpuTracker struct {
+	mu         sync.Mutex
+	trendSize  int
+	staleAfter time.Duration
+	trends     map[string][]ratioSample
+	monitor    *thresholdMonitor
+}
+
+func newCPUTracker(high, low float64, trendSize int, staleAfter time.Duration) *cpuTracker {
+	return &cpuTracker{
+		trendSize:  trendSize,
+		staleAfter: staleAfter,
+		trends:     make(map[string][]ratioSample),
+		monitor:    newThresholdMonitor(high, low),
+	}
+}
+
+func (t *cpuTracker) record(podName string, ratio float64, now time.Time) thresholdTransition {
+	t.mu.Lock()
+	samples := append(t.fresh(t.trends[podName], now), ratioSample{Value: ratio, At: now})
+	if t.trendSize > 0 && len(samples) > t.trendSize {
+		samples = samples[len(samples)-t.trendSize:]
+	}
+	t.trends[podName] = samples
+	t.mu.Unlock()
+
+	return t.monitor.observe(podName, ratio, now)
+}
+
+func (t *cpuTracker) forget(podName string) {
+	t.mu.Lock()
+	delete(t.trends, podName)
+	t.mu.Unlock()
+	t.monitor.forget(podName)
+}
+
+// fresh drops samples that have gone stale. Callers hold t.mu.
+func (t *cpuTracker) fresh(samples []ratioSample, now time.Time) []ratioSample {
+	if t.staleAfter <= 0 {
+		return samples
+	}
+	cutoff := now.Add(-t.staleAfter)
+	for len(samples) > 0 && samples[0].At.Before(cutoff) {
+		samples = samples[1:]
+	}
+	return samples
+}
+
+// trend returns the pod's non-stale samples, oldest first.
+func (t *cpuTracker) trend(podName string, now time.Time) []ratioSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	samples := t.fresh(t.trends[podName], now)
+	result := make([]ratioSample, len(samples))
+	copy(result, samples)
+	return result
+}
+
+func (t *cpuTracker) pods() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.trends))
+	for name := range t.trends {
+		names = append(names, name)
+	}
+	return names
+}
+
+// analyzeCPU feeds a metric's CPU usage to the tracker and broadcasts a
+// cpu_alert when the pod crosses into or out of the alert band.
+func (h *Hub) analyzeCPU(metric QueryMetrics) {
+	if metric.Metrics == nil || metric.Metrics.CPUUsageRatio == nil {
+		return
+	}
+	ratio := *metric.Metrics.CPUUsageRatio
+
+	var state string
+	switch h.cpu.record(metric.PodName, ratio, time.Now()) {
+	case thresholdFired:
+		state = "firing"
+		h.alerts.fire("cpu_alert", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+			"cpu_usage_ratio": ratio,
+		})
+	case thresholdRecovered:
+		state = "resolved"
+		h.alerts.resolve("cpu_alert", metric.PodName)
+	default:
+		return
+	}
+
+	h.publish(newNamespacedMessage("cpu_alert", metric.Namespace, map[string]interface{}{
+		"pod_name":        metric.PodName,
+		"namespace":       metric.Namespace,
+		"cpu_usage_ratio": ratio,
+		"state":           state,
+		"severity":        "warning",
+		"high_threshold":  h.cpu.monitor.high,
+		"low_threshold":   h.cpu.monitor.low,
+	}))
+}
+
+// cpuHandler serves GET /api/cpu?pod=, returning the CPU trend for one pod
+// or, without a pod, for every pod seen.
+func (h *Hub) cpuHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	podNames := h.cpu.pods()
+	if pod := r.URL.Query().Get("pod"); pod != "" {
+		podNames = []string{pod}
+	}
+
+	result := make(map[string]interface{}, len(podNames))
+	for _, podName := range podNames {
+		trend := h.cpu.trend(podName, now)
+		var current *float64
+		if len(trend) > 0 {
+			current = &trend[len(trend)-1].Value
+		}
+		result[podName] = map[string]interface{}{
+			"current": current,
+			"trend":   trend,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pods":      result,
+		"timestamp": now.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCPUAlertHysteresis(t *testing.T) {
+	tracker := newCPUTracker(0.9, 0.75, 10, time.Minute)
+	now := time.Now()
+	steps := []struct {
+		ratio float64
+		want  thresholdTransition
+	}{
+		{0.5, thresholdUnchanged},
+		{0.92, thresholdFired},
+		{0.95, thresholdUnchanged},
+		// Between the thresholds the alert holds.
+		{0.8, thresholdUnchanged},
+		{0.76, thresholdUnchanged},
+		{0.7, thresholdRecovered},
+		{0.85, thresholdUnchanged},
+		{0.9, thresholdFired},
+	}
+	for i, step := range steps {
+		if got := tracker.record("pod-a", step.ratio, now); got != step.want {
+			t.Errorf("step %d (%.2f): transition = %v, want %v", i, step.ratio, got, step.want)
+		}
+	}
+}
+
+func TestCPUTrendDropsStaleSamples(t *testing.T) {
+	tracker := newCPUTracker(0.9, 0.75, 3, time.Minute)
+	start := time.Now()
+	for i, ratio := range []float64{0.1, 0.2, 0.3, 0.4} {
+		tracker.record("pod-a", ratio, start.Add(time.Duration(i)*time.Second))
+	}
+	trend := tracker.trend("pod-a", start.Add(4*time.Second))
+	if len(trend) != 3 || trend[0].Value != 0.2 || trend[2].Value != 0.4 {
+		t.Errorf("trend = %+v, want the last 3 samples", trend)
+	}
+
+	if trend := tracker.trend("pod-a", start.Add(2*time.Minute)); len(trend) != 0 {
+		t.Errorf("trend of a pod silent for 2m = %+v, want empty", trend)
+	}
+}
+
+func TestCPUAlertBroadcastAndTrend(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=cpu_alert")
+
+	for _, ratio := range []float64{0.95, 0.5} {
+		metric := testMetric("pod-a", 10)
+		metric.Metrics = &SystemMetrics{CPUUsageRatio: ptr(ratio)}
+		postTestMetric(t, h, metric)
+	}
+	for _, want := range []string{"firing", "resolved"} {
+		message := readTestMessageOfType(t, conn, "cpu_alert")
+		if state := message.Data.(map[string]interface{})["state"]; state != want {
+			t.Errorf("cpu_alert state = %v, want %s", state, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.cpuHandler(rec, httptest.NewRequest(http.MethodGet, "/api/cpu?pod=pod-a", nil))
+	var body struct {
+		Pods map[string]struct {
+			Current *float64      `json:"current"`
+			Trend   []ratioSample `json:"trend"`
+		} `json:"pods"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	pod := body.Pods["pod-a"]
+	if pod.Current == nil || *pod.Current != 0.5 || len(pod.Trend) != 2 {
+		t.Errorf("/api/cpu pod-a = %+v, want current 0.5 over 2 samples", pod)
+	}
+}
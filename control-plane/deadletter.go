@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Reasons a metric or broadcast ends up in the dead-letter buffer.
+const (
+	deadLetterDecode     = "decode_failed"
+	deadLetterInvalid    = "invalid_metric"
+	deadLetterSlowClient = "slow_client"
+	deadLetterSink       = "sink_unavailable"
+	deadLetterUnacked    = "unacknowledged"
+)
+
+// deadLetterPayloadBytes caps how much of a rejected payload is kept.
+const deadLetterPayloadBytes = 1024
+
+// DeadLetter is one metric or message that was rejected or never delivered.
+type DeadLetter struct {
+	Reason      string    `json:"reason"`
+	Detail      string    `json:"detail,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	MessageType string    `json:"message_type,omitempty"`
+	Payload     string    `json:"payload,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// deadLetters keeps the most recent failures so that missing dashboard
+// updates can be traced back to a cause. Once full, the oldest entry is
+// overwritten.
+type deadLetters struct {
+	mu      sync.Mutex
+	entries []DeadLetter
+	next    int
+	count   int
+}
+
+func newDeadLetters(size int) *deadLetters {
+	return &deadLetters{entries: make([]DeadLetter, max(size, 0))}
+}
+
+func (d *deadLetters) add(letter DeadLetter) {
+	if len(letter.Payload) > deadLetterPayloadBytes {
+		letter.Payload = letter.Payload[:deadLetterPayloadBytes]
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) == 0 {
+		return
+	}
+	d.entries[d.next] = letter
+	d.next = (d.next + 1) % len(d.entries)
+	if d.count < len(d.entries) {
+		d.count++
+	}
+}
+
+// recent returns up to limit entries, newest first.
+func (d *deadLetters) recent(limit int) []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if limit <= 0 || limit > d.count {
+		limit = d.count
+	}
+	result := make([]DeadLetter, 0, limit)
+	for i := 1; i <= limit; i++ {
+		result = append(result, d.entries[(d.next-i+len(d.entries))%len(d.entries)])
+	}
+	return result
+}
+
+// rejectMetric records a metric rejected by validation.
+func (d *deadLetters) rejectMetric(metric QueryMetrics, source string, err error) {
+	payload, _ := json.Marshal(metric)
+	d.add(DeadLetter{
+		Reason:      deadLetterInvalid,
+		Detail:      err.Error(),
+		Source:      source,
+		MessageType: metric.EventType,
+		Payload:     string(payload),
+		At:          time.Now(),
+	})
+}
+
+// unpersisted records a metric the sink failed to store or was not asked to
+// store because its circuit breaker was open.
+func (d *deadLetters) unpersisted(metric QueryMetrics, err error) {
+	payload, _ := json.Marshal(metric)
+	d.add(DeadLetter{
+		Reason:      deadLetterSink,
+		Detail:      err.Error(),
+		Source:      "sink",
+		MessageType: metric.EventType,
+		Payload:     string(payload),
+		At:          time.Now(),
+	})
+}
+
+// deadLettersHandler serves GET /api/dead-letters?limit=50.
+func (h *Hub) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	letters := h.dlq.recent(limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
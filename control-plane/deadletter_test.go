@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getDeadLetters calls the /api/dead-letters handler.
+func getDeadLetters(t *testing.T, h *Hub, query string) (int, []DeadLetter) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.deadLettersHandler(rec, httptest.NewRequest(http.MethodGet, "/api/dead-letters"+query, nil))
+	var body struct {
+		DeadLetters []DeadLetter `json:"dead_letters"`
+		Count       int          `json:"count"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body.Count != len(body.DeadLetters) {
+		t.Errorf("count = %d for %d dead letters", body.Count, len(body.DeadLetters))
+	}
+	return rec.Code, body.DeadLetters
+}
+
+func TestDeadLettersRecordFailures(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowClientPolicy = slowClientDisconnect
+	h := newHub(cfg)
+	h.ingest = newIngestPipeline(1, 16, time.Second, h.processMetric)
+
+	invalid := testMetric("pod-a", 10)
+	invalid.EventType = ""
+	if rec := postTestBody(h, testBatch(t, invalid)); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	client := stalledTestClient(h, 1)
+	h.deliver(client, newMessage("query_metrics", nil))
+	h.deliver(client, newMessage("deadlock_event", nil))
+
+	code, letters := getDeadLetters(t, h, "")
+	if code != http.StatusOK || len(letters) != 2 {
+		t.Fatalf("dead letters = %d %+v, want 2", code, letters)
+	}
+	// Newest first.
+	if letters[0].Reason != deadLetterSlowClient || letters[0].MessageType != "deadlock_event" {
+		t.Errorf("newest = %+v, want the slow client drop of deadlock_event", letters[0])
+	}
+	if letters[1].Reason != deadLetterInvalid || letters[1].Detail != "event_type is required" || letters[1].At.IsZero() {
+		t.Errorf("oldest = %+v, want the invalid metric", letters[1])
+	}
+
+	if _, letters := getDeadLetters(t, h, "?limit=1"); len(letters) != 1 || letters[0].Reason != deadLetterSlowClient {
+		t.Errorf("limit=1: %+v, want only the newest", letters)
+	}
+	if code, _ := getDeadLetters(t, h, "?limit=none"); code != http.StatusBadRequest {
+		t.Errorf("limit=none: status = %d, want 400", code)
+	}
+}
+
+func TestDeadLettersAreBounded(t *testing.T) {
+	letters := newDeadLetters(3)
+	for _, reason := range []string{"a", "b", "c", "d", "e"} {
+		letters.add(DeadLetter{Reason: reason, Payload: string(make([]byte, 2*deadLetterPayloadBytes))})
+	}
+	recent := letters.recent(0)
+	if len(recent) != 3 || recent[0].Reason != "e" || recent[2].Reason != "c" {
+		t.Errorf("recent = %v, want e, d, c", recent)
+	}
+	if len(recent[0].Payload) != deadLetterPayloadBytes {
+		t.Errorf("payload kept %d bytes, want %d", len(recent[0].Payload), deadLetterPayloadBytes)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// deadlockStore retains recent deadlock_event payloads by id so they can be
+// fetched after the live broadcast has passed.
+type deadlockStore struct {
+	mu       sync.RWMutex
+	capacity int
+	order    []string
+	byID     map[string]map[string]interface{}
+}
+
+func newDeadlockStore(capacity int) *deadlockStore {
+	return &deadlockStore{
+		capacity: capacity,
+		byID:     make(map[string]map[string]interface{}),
+	}
+}
+
+// add stores the payload of a message built by createDeadlockMessage.
+func (s *deadlockStore) add(message WebSocketMessage) {
+	data, ok := message.Data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	id := fmt.Sprintf("%v", data["id"])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.byID[id]; !exists {
+		s.order = append(s.order, id)
+	}
+	s.byID[id] = data
+	for len(s.order) > s.capacity {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// recent returns up to limit retained deadlocks, newest first.
+func (s *deadlockStore) recent(limit int) []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]map[string]interface{}, 0, min(limit, len(s.order)))
+	for i := len(s.order) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, s.byID[s.order[i]])
+	}
+	return result
+}
+
+func (s *deadlockStore) get(id string) (map[string]interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.byID[id]
+	return data, ok
+}
+
+// deadlockSeverity classifies a deadlock from how long it lasted and how many
+// transactions its cycle involved. Short two-party deadlocks are usually
+// benign retry races; anything longer or wider is critical. A deadlock of
+// unknown duration is treated as critical.
+func deadlockSeverity(durationMs *int64, cycleLength int, warnBelow time.Duration, warnParticipants int) string {
+	if durationMs != nil && time.Duration(*durationMs)*time.Millisecond < warnBelow && cycleLength <= warnParticipants {
+		return "warning"
+	}
+	return "critical"
+}
+
+// participantsOf returns the participant list of a stored deadlock.
+func participantsOf(data map[string]interface{}) []map[string]interface{} {
+	participants, _ := data["participants"].([]map[string]interface{})
+	return participants
+}
+
+// edgesOf returns the wait-for edges of a stored deadlock.
+func edgesOf(data map[string]interface{}) []lockEdge {
+	if edges, ok := data["lockEdges"].([]lockEdge); ok {
+		return edges
+	}
+	return createLockEdges(participantsOf(data))
+}
+
+var mermaidUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func mermaidNodeID(id string) string {
+	return mermaidUnsafe.ReplaceAllString(id, "_")
+}
+
+func mermaidLabel(text string) string {
+	return strings.ReplaceAll(text, `"`, "#quot;")
+}
+
+// renderMermaid draws a deadlock's lock chain as a Mermaid flowchart.
+func renderMermaid(participants []map[string]interface{}, edges []lockEdge) string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for _, participant := range participants {
+		id := fmt.Sprintf("%v", participant["id"])
+		label := id
+		if connection, ok := participant["connection"]; ok {
+			label = fmt.Sprintf("%s<br/>%v", id, connection)
+		}
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", mermaidNodeID(id), mermaidLabel(label))
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&b, "    %s -->|\"%s\"| %s\n",
+			mermaidNodeID(edge.From),
+			mermaidLabel(fmt.Sprintf("%s, %s", edge.Resource, edge.LockType)),
+			mermaidNodeID(edge.To))
+	}
+	return b.String()
+}
+
+// deadlockMermaidHandler serves GET /api/deadlocks/{id}/mermaid.
+func (h *Hub) deadlockMermaidHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.deadlocks.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Deadlock not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(renderMermaid(participantsOf(data), edgesOf(data))))
+}
+
+// dotQuote quotes text as a Graphviz ID.
+func dotQuote(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(text) + `"`
+}
+
+// renderDOT draws a deadlock's wait-for graph in Graphviz DOT: one node per
+// participant and an edge from each waiter to the participant holding the
+// lock it waits for. lockEdge runs the other way, from holder (From) to
+// waiter (To), so each edge is drawn To -> From.
+func renderDOT(id string, participants []map[string]interface{}, edges []lockEdge) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(id))
+	b.WriteString("    rankdir=LR;\n")
+	b.WriteString("    node [shape=box];\n")
+	for _, participant := range participants {
+		id := fmt.Sprintf("%v", participant["id"])
+		label := id
+		if connection, ok := participant["connection"]; ok {
+			label = fmt.Sprintf("%s\n%v", id, connection)
+		}
+		fmt.Fprintf(&b, "    %s [label=%s];\n", dotQuote(id), dotQuote(label))
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&b, "    %s -> %s [label=%s];\n",
+			dotQuote(edge.To),
+			dotQuote(edge.From),
+			dotQuote(fmt.Sprintf("%s, %s", edge.Resource, edge.LockType)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// deadlockGraphHandler serves GET /api/deadlocks/{id}/graph.
+func (h *Hub) deadlockGraphHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	data, ok := h.deadlocks.get(id)
+	if !ok {
+		http.Error(w, "Deadlock not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	w.Write([]byte(renderDOT(id, participantsOf(data), edgesOf(data))))
+}
+
+// tableLock is a table a deadlock is known to involve, with the lock taken
+// on it when the agent reported one.
+type tableLock struct {
+	Table    string
+	LockType string
+}
+
+// reportedLocks returns the tables of a deadlock as the agent reported them:
+// the resources of its wait-for edges or, without those, the metric's table
+// names. The placeholder resources parseConnectionsToParticipants invents
+// for display (table_1, table_unknown, ...) are never among them.
+func reportedLocks(data *QueryData) []tableLock {
+	var locks []tableLock
+	for _, edge := range data.WaitForEdges {
+		if edge.Resource != "" {
+			locks = append(locks, tableLock{Table: edge.Resource, LockType: edge.LockType})
+		}
+	}
+	if len(locks) > 0 {
+		return locks
+	}
+	for _, table := range data.TableNames {
+		if table != "" {
+			locks = append(locks, tableLock{Table: table})
+		}
+	}
+	return locks
+}
+
+// deadlockSignature identifies the shape of a deadlock independently of the
+// connections involved: the sorted set of reported tables and lock types
+// taken or, when the agent named no tables, the normalized SQL. It reports
+// false when neither is known, as every such deadlock would otherwise share
+// one signature.
+func deadlockSignature(data *QueryData) (string, []string, bool) {
+	var locks []string
+	for _, lock := range reportedLocks(data) {
+		if lock.LockType == "" {
+			locks = append(locks, lock.Table)
+			continue
+		}
+		locks = append(locks, lock.Table+":"+lock.LockType)
+	}
+	if len(locks) == 0 {
+		pattern := normalizeSQLPattern(data.SQLPattern)
+		if pattern == "" {
+			return "", nil, false
+		}
+		locks = append(locks, pattern)
+	}
+	sort.Strings(locks)
+	locks = slices.Compact(locks)
+	sum := sha1.Sum([]byte(strings.Join(locks, "|")))
+	return hex.EncodeToString(sum[:8]), locks, true
+}
+
+// DeadlockSignature summarises the occurrences of one deadlock shape within
+// the tracking window.
+type DeadlockSignature struct {
+	Signature   string    `json:"signature"`
+	Locks       []string  `json:"locks"`
+	Occurrences int       `json:"occurrences"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// signatureTracker counts deadlock occurrences per signature so recurring
+// design problems can be told apart from one-off races.
+type signatureTracker struct {
+	mu         sync.Mutex
+	window     time.Duration
+	seen       map[string][]time.Time
+	signatures map[string][]string
+}
+
+func newSignatureTracker(window time.Duration) *signatureTracker {
+	return &signatureTracker{
+		window:     window,
+		seen:       make(map[string][]time.Time),
+		signatures: make(map[string][]string),
+	}
+}
+
+// record notes an occurrence and returns how many times the signature has now
+// been seen within the window, including this one.
+func (t *signatureTracker) record(signature string, locks []string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	occurrences := append(t.prune(signature, now), now)
+	t.seen[signature] = occurrences
+	t.signatures[signature] = locks
+	return len(occurrences)
+}
+
+// prune drops occurrences outside the window. Callers hold t.mu.
+func (t *signatureTracker) prune(signature string, now time.Time) []time.Time {
+	occurrences := t.seen[signature]
+	cutoff := now.Add(-t.window)
+	for len(occurrences) > 0 && occurrences[0].Before(cutoff) {
+		occurrences = occurrences[1:]
+	}
+	if len(occurrences) == 0 {
+		delete(t.seen, signature)
+		delete(t.signatures, signature)
+	}
+	return occurrences
+}
+
+// recurring lists signatures seen more than once in the window, most
+// frequent first.
+func (t *signatureTracker) recurring(now time.Time) []DeadlockSignature {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]DeadlockSignature, 0)
+	for signature := range t.seen {
+		locks := t.signatures[signature]
+		occurrences := t.prune(signature, now)
+		if len(occurrences) < 2 {
+			continue
+		}
+		result = append(result, DeadlockSignature{
+			Signature:   signature,
+			Locks:       locks,
+			Occurrences: len(occurrences),
+			FirstSeen:   occurrences[0],
+			LastSeen:    occurrences[len(occurrences)-1],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Occurrences > result[j].Occurrences
+	})
+	return result
+}
+
+// deadlockSignaturesHandler serves GET /api/deadlocks/signatures.
+func (h *Hub) deadlockSignaturesHandler(w http.ResponseWriter, r *http.Request) {
+	signatures := h.signatures.recurring(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"signatures": signatures,
+		"window":     h.cfg.DeadlockSignatureWindow.String(),
+	})
+}
+
+// deadlockDeduper suppresses repeat reports of the same deadlock, identified
+// by pod and the set of participating connections, for window after the
+// report that was broadcast.
+type deadlockDeduper struct {
+	mu         sync.Mutex
+	window     time.Duration
+	broadcast  map[string]time.Time
+	suppressed map[string]int
+}
+
+func newDeadlockDeduper(window time.Duration) *deadlockDeduper {
+	return &deadlockDeduper{
+		window:     window,
+		broadcast:  make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// deadlockDedupKey hashes the pod and the sorted participant connections.
+func deadlockDedupKey(podName string, participants []map[string]interface{}) string {
+	connections := make([]string, 0, len(participants))
+	for _, participant := range participants {
+		connections = append(connections, fmt.Sprintf("%v", participant["connection"]))
+	}
+	sort.Strings(connections)
+	sum := sha1.Sum([]byte(podName + "|" + strings.Join(connections, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// duplicate reports whether key was broadcast within the window, along with
+// how many reports of it have been suppressed so far. A key that is not a
+// duplicate is recorded as broadcast at now.
+func (d *deadlockDeduper) duplicate(key string, now time.Time) (bool, int) {
+	if d.window <= 0 {
+		return false, 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, at := range d.broadcast {
+		if now.Sub(at) >= d.window {
+			delete(d.broadcast, k)
+			delete(d.suppressed, k)
+		}
+	}
+	if _, ok := d.broadcast[key]; ok {
+		d.suppressed[key]++
+		return true, d.suppressed[key]
+	}
+	d.broadcast[key] = now
+	return false, 0
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// testDeadlock returns a deadlock_detected metric between connections.
+func testDeadlock(podName, connections string) QueryMetrics {
+	metric := testMetric(podName, 10)
+	metric.EventType = "deadlock_detected"
+	metric.Data.DeadlockConnections = &connections
+	return metric
+}
+
+// getDeadlockView calls a /api/deadlocks/{id}/... handler.
+func getDeadlockView(handler http.HandlerFunc, id string) *httptest.ResponseRecorder {
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/deadlocks/"+id, nil), map[string]string{"id": id})
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestDeadlockMermaid(t *testing.T) {
+	h := newHub(testConfig())
+	message := createDeadlockMessage(testDeadlock("pod-a", "PgConnection@a:PgConnection@b:PgConnection@c"), h.cfg)
+	h.deadlocks.add(message)
+	id := message.Data.(map[string]interface{})["id"].(string)
+
+	rec := getDeadlockView(h.deadlockMermaidHandler, id)
+	want := `graph LR
+    connection_1["connection-1<br/>PgConnection@a"]
+    connection_2["connection-2<br/>PgConnection@b"]
+    connection_3["connection-3<br/>PgConnection@c"]
+    connection_1 -->|"table_1, exclusive"| connection_2
+    connection_2 -->|"table_2, shared"| connection_3
+    connection_3 -->|"table_3, exclusive"| connection_1
+`
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("status %d, body:\n%s\nwant:\n%s", rec.Code, rec.Body, want)
+	}
+
+	if rec := getDeadlockView(h.deadlockMermaidHandler, "deadlock-unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestMermaidEscapesLabels(t *testing.T) {
+	participants := []map[string]interface{}{{"id": "tx 1", "connection": `conn "a"`}}
+	got := renderMermaid(participants, nil)
+	want := "graph LR\n    tx_1[\"tx 1<br/>conn #quot;a#quot;\"]\n"
+	if got != want {
+		t.Errorf("renderMermaid = %q, want %q", got, want)
+	}
+}
+
+func TestDeadlockGraphDOT(t *testing.T) {
+	h := newHub(testConfig())
+	metric := testDeadlock("pod-a", "PgConnection@a:PgConnection@b")
+	metric.Data.WaitForEdges = []WaitForEdge{
+		{Holder: "PgConnection@a", Waiter: "PgConnection@b", Resource: "users", LockType: "row"},
+		{Holder: "PgConnection@b", Waiter: "PgConnection@a", Resource: "orders", LockType: "table"},
+	}
+	message := createDeadlockMessage(metric, h.cfg)
+	h.deadlocks.add(message)
+	id := message.Data.(map[string]interface{})["id"].(string)
+
+	// Each edge points from the waiter to the holder of the lock it wants.
+	rec := getDeadlockView(h.deadlockGraphHandler, id)
+	want := `digraph "` + id + `" {
+    rankdir=LR;
+    node [shape=box];
+    "connection-1" [label="connection-1\nPgConnection@a"];
+    "connection-2" [label="connection-2\nPgConnection@b"];
+    "connection-2" -> "connection-1" [label="users, row"];
+    "connection-1" -> "connection-2" [label="orders, table"];
+}
+`
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Errorf("status %d, body:\n%s\nwant:\n%s", rec.Code, rec.Body, want)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/vnd.graphviz; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/vnd.graphviz", got)
+	}
+
+	if rec := getDeadlockView(h.deadlockGraphHandler, "deadlock-unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDOTQuotesIDs(t *testing.T) {
+	if got, want := dotQuote("tx \"1\"\\\nnext"), `"tx \"1\"\\\nnext"`; got != want {
+		t.Errorf("dotQuote = %s, want %s", got, want)
+	}
+}
+
+func TestDeadlockSignature(t *testing.T) {
+	edges := func(pairs ...string) []WaitForEdge {
+		var result []WaitForEdge
+		for i := 0; i < len(pairs); i += 2 {
+			result = append(result, WaitForEdge{Holder: "c1", Waiter: "c2", Resource: pairs[i], LockType: pairs[i+1]})
+		}
+		return result
+	}
+	base, locks, ok := deadlockSignature(&QueryData{WaitForEdges: edges("orders", "exclusive", "users", "shared")})
+	if !ok || len(locks) != 2 || locks[0] != "orders:exclusive" || locks[1] != "users:shared" {
+		t.Fatalf("deadlockSignature = %s %v %v, want orders:exclusive and users:shared", base, locks, ok)
+	}
+
+	tests := []struct {
+		name string
+		data *QueryData
+		same bool
+	}{
+		{"edges in another order", &QueryData{WaitForEdges: edges("users", "shared", "orders", "exclusive", "orders", "exclusive")}, true},
+		{"other lock type", &QueryData{WaitForEdges: edges("orders", "shared", "users", "shared")}, false},
+		{"other table", &QueryData{WaitForEdges: edges("orders", "exclusive", "accounts", "shared")}, false},
+		{"table names only", &QueryData{TableNames: []string{"users", "orders"}}, false},
+	}
+	for _, tt := range tests {
+		signature, _, ok := deadlockSignature(tt.data)
+		if !ok || (signature == base) != tt.same {
+			t.Errorf("%s: signature %s (ok %v), same as base = %v, want %v", tt.name, signature, ok, signature == base, tt.same)
+		}
+	}
+
+	// Without tables the SQL identifies the deadlock, and without either
+	// there is no signature rather than one shared by every such deadlock.
+	bySQL, _, ok := deadlockSignature(&QueryData{SQLPattern: "UPDATE accounts SET balance = 1 WHERE id = 7"})
+	other, _, _ := deadlockSignature(&QueryData{SQLPattern: "UPDATE accounts SET balance = 2 WHERE id = 9"})
+	if !ok || bySQL != other {
+		t.Errorf("SQL signatures %s and %s differ, want the same normalized one", bySQL, other)
+	}
+	if _, _, ok := deadlockSignature(&QueryData{}); ok {
+		t.Error("signature for a deadlock with neither tables nor SQL")
+	}
+}
+
+func TestSignatureTrackerWindow(t *testing.T) {
+	tracker := newSignatureTracker(time.Minute)
+	start := time.Now()
+	for i, want := range []int{1, 2, 3} {
+		if got := tracker.record("sig", []string{"users"}, start.Add(time.Duration(i)*10*time.Second)); got != want {
+			t.Errorf("occurrence %d: recurrence = %d, want %d", i, got, want)
+		}
+	}
+	tracker.record("once", []string{"orders"}, start)
+
+	recurring := tracker.recurring(start.Add(20 * time.Second))
+	if len(recurring) != 1 || recurring[0].Signature != "sig" || recurring[0].Occurrences != 3 {
+		t.Errorf("recurring = %+v, want sig seen 3 times", recurring)
+	}
+	if got := tracker.record("sig", []string{"users"}, start.Add(75*time.Second)); got != 2 {
+		t.Errorf("recurrence after the window moved = %d, want 2", got)
+	}
+}
+
+func TestRecurringDeadlockCountsUp(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=deadlock_event")
+
+	for i, connections := range []string{"PgConnection@a:PgConnection@b", "PgConnection@c:PgConnection@d"} {
+		postTestMetric(t, h, testDeadlock("pod-a", connections))
+		data := readTestMessage(t, conn).Data.(map[string]interface{})
+		if data["recurrence"] != float64(i+1) || data["signature"] == nil {
+			t.Errorf("deadlock %d: recurrence = %v, signature = %v, want recurrence %d", i, data["recurrence"], data["signature"], i+1)
+		}
+	}
+}
+
+func TestRecommendVictim(t *testing.T) {
+	tests := []struct {
+		name        string
+		connections string
+		knownCosts  map[string]int64
+		want        string
+	}{
+		{"youngest transaction", "PgConnection@a=1200:PgConnection@b=300:PgConnection@c=900", nil, "connection-2"},
+		{"ms suffix", "PgConnection@a=40ms:PgConnection@b=1500ms", nil, "connection-1"},
+		{"known cost from the metric", "PgConnection@a=1200:PgConnection@b", map[string]int64{"PgConnection@b": 50}, "connection-2"},
+		{"explicit age beats known cost", "PgConnection@a=100:PgConnection@b=900", map[string]int64{"PgConnection@b": 5}, "connection-1"},
+		{"only some costs", "PgConnection@a:PgConnection@b:PgConnection@c=700", nil, "connection-3"},
+		{"invalid ages ignored", "PgConnection@a=soon:PgConnection@b=-4", nil, "connection-1"},
+		{"no costs", "PgConnection@a:PgConnection@b", nil, "connection-1"},
+		{"no connections", "", nil, "connection-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			participants := parseConnectionsToParticipants(tt.connections, tt.knownCosts)
+			if got := recommendVictim(participants); got != tt.want {
+				t.Errorf("recommendVictim = %q, want %q (participants %v)", got, tt.want, participants)
+			}
+		})
+	}
+}
+
+func TestDeadlockMessageUsesReportedTransactionAge(t *testing.T) {
+	metric := testDeadlock("pod-a", "PgConnection@a=800:PgConnection@b")
+	metric.Data.ConnectionID = "PgConnection@b"
+	metric.Data.TransactionDuration = ptr(int64(200))
+
+	data := createDeadlockMessage(metric, testConfig()).Data.(map[string]interface{})
+	if data["recommendedVictim"] != "connection-2" {
+		t.Errorf("recommendedVictim = %v, want connection-2", data["recommendedVictim"])
+	}
+}
+
+func TestDeadlockDeduper(t *testing.T) {
+	dedup := newDeadlockDeduper(5 * time.Second)
+	start := time.Now()
+	key := deadlockDedupKey("pod-a", parseConnectionsToParticipants("PgConnection@a:PgConnection@b", nil))
+
+	if reordered := deadlockDedupKey("pod-a", parseConnectionsToParticipants("PgConnection@b:PgConnection@a", nil)); reordered != key {
+		t.Error("key depends on the order of the connections")
+	}
+	if other := deadlockDedupKey("pod-b", parseConnectionsToParticipants("PgConnection@a:PgConnection@b", nil)); other == key {
+		t.Error("key does not depend on the pod")
+	}
+
+	steps := []struct {
+		after      time.Duration
+		duplicate  bool
+		suppressed int
+	}{
+		{0, false, 0},
+		{time.Second, true, 1},
+		{2 * time.Second, true, 2},
+		{5 * time.Second, false, 0},
+		{6 * time.Second, true, 1},
+	}
+	for _, step := range steps {
+		duplicate, suppressed := dedup.duplicate(key, start.Add(step.after))
+		if duplicate != step.duplicate || suppressed != step.suppressed {
+			t.Errorf("after %v: duplicate = %v (%d suppressed), want %v (%d)", step.after, duplicate, suppressed, step.duplicate, step.suppressed)
+		}
+	}
+
+	if duplicate, _ := newDeadlockDeduper(0).duplicate(key, start); duplicate {
+		t.Error("a zero window suppressed a deadlock")
+	}
+}
+
+func TestDuplicateDeadlocksAreSuppressed(t *testing.T) {
+	cfg := testConfig()
+	cfg.DeadlockDedupWindow = 200 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=deadlock_event,done")
+
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@b:PgConnection@a"))
+	time.Sleep(cfg.DeadlockDedupWindow)
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+	h.publish(newMessage("done", nil))
+
+	broadcasts := 0
+	for readTestMessage(t, conn).Type != "done" {
+		broadcasts++
+	}
+	if broadcasts != 2 {
+		t.Errorf("got %d deadlock broadcasts, want 2", broadcasts)
+	}
+}
+
+func TestLockChainFromWaitForEdges(t *testing.T) {
+	metric := testDeadlock("pod-a", "PgConnection@a:PgConnection@b:PgConnection@c")
+	metric.Data.WaitForEdges = []WaitForEdge{
+		{Holder: "PgConnection@a", Waiter: "PgConnection@b", Resource: "orders", LockType: "RowExclusiveLock"},
+		{Holder: "PgConnection@b", Waiter: "PgConnection@a", Resource: "users", LockType: "ShareLock"},
+		// c waits on the cycle without being part of it.
+		{Holder: "PgConnection@a", Waiter: "PgConnection@c", Resource: "orders", LockType: "RowExclusiveLock"},
+	}
+
+	data := createDeadlockMessage(metric, testConfig()).Data.(map[string]interface{})
+	want := []string{
+		"connection-1 → connection-2 (orders, RowExclusiveLock)",
+		"connection-2 → connection-1 (users, ShareLock)",
+		"connection-1 → connection-3 (orders, RowExclusiveLock)",
+	}
+	chain := data["lockChain"].([]string)
+	if len(chain) != len(want) {
+		t.Fatalf("lockChain = %v, want %v", chain, want)
+	}
+	for i := range want {
+		if chain[i] != want[i] {
+			t.Errorf("lockChain[%d] = %q, want %q", i, chain[i], want[i])
+		}
+	}
+	if data["cycleLength"] != 2 {
+		t.Errorf("cycleLength = %v, want 2", data["cycleLength"])
+	}
+}
+
+func TestLockChainFallsBackToRing(t *testing.T) {
+	data := createDeadlockMessage(testDeadlock("pod-a", "PgConnection@a:PgConnection@b:PgConnection@c"), testConfig()).Data.(map[string]interface{})
+	chain := data["lockChain"].([]string)
+	if len(chain) != 3 || chain[2] != "connection-3 → connection-1 (table_3, exclusive)" || data["cycleLength"] != 3 {
+		t.Errorf("lockChain = %v, cycleLength = %v, want a ring of 3", chain, data["cycleLength"])
+	}
+}
+
+func TestDeadlockEdgesKeepUnknownConnections(t *testing.T) {
+	participants := parseConnectionsToParticipants("PgConnection@a", nil)
+	edges := deadlockEdges([]WaitForEdge{{Holder: "PgConnection@a", Waiter: " PgConnection@z "}}, participants)
+	if len(edges) != 1 || edges[0].From != "connection-1" || edges[0].To != "PgConnection@z" {
+		t.Errorf("edges = %+v, want connection-1 → PgConnection@z", edges)
+	}
+}
+
+func TestCycleLength(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []lockEdge
+		want  int
+	}{
+		{"two-party", []lockEdge{{From: "a", To: "b"}, {From: "b", To: "a"}}, 2},
+		{"shortest of two cycles", []lockEdge{{From: "a", To: "b"}, {From: "b", To: "c"}, {From: "c", To: "a"}, {From: "c", To: "b"}}, 2},
+		{"self wait", []lockEdge{{From: "a", To: "a"}}, 1},
+		// Without a cycle every node is counted.
+		{"chain", []lockEdge{{From: "a", To: "b"}, {From: "b", To: "c"}}, 3},
+	}
+	for _, tt := range tests {
+		if got := cycleLength(tt.edges); got != tt.want {
+			t.Errorf("%s: cycleLength = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeadlockSeverity(t *testing.T) {
+	tests := []struct {
+		durationMs   *int64
+		participants int
+		want         string
+	}{
+		{ptr(int64(50)), 2, "warning"},
+		{ptr(int64(0)), 1, "warning"},
+		{ptr(int64(99)), 2, "warning"},
+		{ptr(int64(100)), 2, "critical"},
+		{ptr(int64(5000)), 2, "critical"},
+		{ptr(int64(50)), 3, "critical"},
+		{ptr(int64(5000)), 4, "critical"},
+		// An unknown duration cannot be shown to be short.
+		{nil, 2, "critical"},
+	}
+	for _, tt := range tests {
+		if got := deadlockSeverity(tt.durationMs, tt.participants, 100*time.Millisecond, 2); got != tt.want {
+			duration := "unknown"
+			if tt.durationMs != nil {
+				duration = time.Duration(*tt.durationMs * int64(time.Millisecond)).String()
+			}
+			t.Errorf("deadlockSeverity(%s, %d) = %q, want %q", duration, tt.participants, got, tt.want)
+		}
+	}
+}
+
+func TestDeadlockSeverityThresholdsFromEnvironment(t *testing.T) {
+	defaults := testConfig()
+	t.Setenv("DEADLOCK_WARN_DURATION", "1s")
+	t.Setenv("DEADLOCK_WARN_PARTICIPANTS", "3")
+	cfg := loadConfig()
+
+	metric := testDeadlock("pod-a", "PgConnection@a:PgConnection@b:PgConnection@c")
+	metric.Data.DeadlockDuration = ptr(int64(500))
+	if severity := createDeadlockMessage(metric, cfg).Data.(map[string]interface{})["severity"]; severity != "warning" {
+		t.Errorf("severity = %v, want warning for a 500ms three-party deadlock", severity)
+	}
+	if severity := createDeadlockMessage(metric, defaults).Data.(map[string]interface{})["severity"]; severity != "critical" {
+		t.Errorf("severity = %v with the default thresholds, want critical", severity)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Outbound encodings a WebSocket client can ask for with /ws?format=.
+const (
+	formatJSON    = "json"
+	formatMsgpack = "msgpack"
+)
+
+// negotiateFormat normalizes the requested encoding and reports whether the
+// server can produce it. JSON is the default.
+func negotiateFormat(requested string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(requested)) {
+	case "", formatJSON:
+		return formatJSON, true
+	case formatMsgpack:
+		return formatMsgpack, true
+	}
+	return requested, false
+}
+
+// unsupportedFormatClose is the close frame sent to a client that asked for
+// an encoding the server does not produce.
+func unsupportedFormatClose(requested string) []byte {
+	return websocket.FormatCloseMessage(websocket.ClosePolicyViolation,
+		fmt.Sprintf("unsupported message format %q; supported: %s, %s", requested, formatJSON, formatMsgpack))
+}
+
+// encode serializes a message in the client's format. MessagePack uses the
+// json struct tags, so both formats carry the same field names.
+func (c *Client) encode(message WebSocketMessage) ([]byte, error) {
+	if c.format != formatMsgpack {
+		return json.Marshal(message)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(message); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// frameType is the WebSocket frame type for the client's format.
+func (c *Client) frameType() int {
+	if c.format == formatMsgpack {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// writeEncoded encodes and writes a message without the outbound size limit.
+func (c *Client) writeEncoded(message WebSocketMessage) error {
+	payload, err := c.encode(message)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(c.frameType(), payload)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+		ok        bool
+	}{
+		{"", formatJSON, true},
+		{"json", formatJSON, true},
+		{" MsgPack ", formatMsgpack, true},
+		{"protobuf", "protobuf", false},
+	}
+	for _, tt := range tests {
+		if got, ok := negotiateFormat(tt.requested); got != tt.want || ok != tt.ok {
+			t.Errorf("negotiateFormat(%q) = %q, %v, want %q, %v", tt.requested, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// readTestFrame reads the next frame of a query_metrics message from conn
+// and decodes it into generic JSON values, whatever its encoding.
+func readTestFrame(t *testing.T, conn *websocket.Conn, wantFrame int) map[string]interface{} {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(testReadTimeout))
+		frame, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+		if frame != wantFrame {
+			t.Fatalf("frame type = %d, want %d", frame, wantFrame)
+		}
+		if frame == websocket.BinaryMessage {
+			var decoded interface{}
+			if err := msgpack.NewDecoder(bytes.NewReader(payload)).Decode(&decoded); err != nil {
+				t.Fatalf("decode msgpack frame: %v", err)
+			}
+			// Round trip through JSON so numbers compare as float64.
+			if payload, err = json.Marshal(decoded); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatalf("decode %s: %v", payload, err)
+		}
+		if message["type"] == "query_metrics" {
+			return message
+		}
+	}
+}
+
+func TestMsgpackMatchesJSON(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	jsonConn := dialTestHub(t, h, "types=query_metrics")
+	msgpackConn, _, err := dialTestHubWithHeader(t, h, "types=query_metrics&format=msgpack", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForClientCount(t, h, 2)
+
+	metric := testMetric("pod-a", 42)
+	metric.Data.RowsAffected = ptr(int64(3))
+	metric.Data.ComplexityScore = ptr(7)
+	postTestMetric(t, h, metric)
+
+	want := readTestFrame(t, jsonConn, websocket.TextMessage)
+	got := readTestFrame(t, msgpackConn, websocket.BinaryMessage)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("msgpack message = %v\nwant the JSON one %v", got, want)
+	}
+	data := got["data"].(map[string]interface{})["data"].(map[string]interface{})
+	if data["execution_time_ms"] != float64(42) || data["rows_affected"] != float64(3) {
+		t.Errorf("query data = %v, want 42ms and 3 rows", data)
+	}
+}
+
+func TestUnsupportedFormatIsClosed(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn, _, err := dialTestHubWithHeader(t, h, "format=xml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeErr := readTestClose(t, conn)
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != `unsupported message format "xml"; supported: json, msgpack` {
+		t.Errorf("close = %d %q, want a policy violation naming the formats", closeErr.Code, closeErr.Text)
+	}
+}
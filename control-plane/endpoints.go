@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// overflowEndpoint collects traffic once the endpoint cardinality limit is
+// reached.
+const overflowEndpoint = "__other__"
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexIDSegment   = regexp.MustCompile(`^[0-9a-fA-F]*\d[0-9a-fA-F]*$`)
+)
+
+// templatizeEndpoint collapses identifiers in an API path so that
+// "GET /api/courses/42?x=1" and "GET /api/courses/43" aggregate together as
+// "GET /api/courses/{id}".
+func templatizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	method := ""
+	if i := strings.IndexByte(endpoint, ' '); i > 0 {
+		method, endpoint = endpoint[:i+1], strings.TrimSpace(endpoint[i+1:])
+	}
+	if i := strings.IndexAny(endpoint, "?#"); i >= 0 {
+		endpoint = endpoint[:i]
+	}
+
+	segments := strings.Split(endpoint, "/")
+	for i, segment := range segments {
+		switch {
+		case numericSegment.MatchString(segment),
+			uuidSegment.MatchString(segment),
+			len(segment) >= 8 && hexIDSegment.MatchString(segment):
+			segments[i] = "{id}"
+		}
+	}
+	return method + strings.Join(segments, "/")
+}
+
+// endpointBucket holds one minute of query activity for an endpoint.
+type endpointBucket struct {
+	minute  int64
+	queries int64
+	errors  int64
+	totalMs int64
+}
+
+// EndpointStats is the rolling-window summary served by /api/endpoints.
+type EndpointStats struct {
+	Endpoint    string  `json:"endpoint"`
+	QueryCount  int64   `json:"query_count"`
+	ErrorCount  int64   `json:"error_count"`
+	ErrorRate   float64 `json:"error_rate"`
+	TotalDBTime int64   `json:"total_db_time_ms"`
+	AvgDBTime   float64 `json:"avg_db_time_ms"`
+}
+
+// endpointAggregator tracks per-API-endpoint database load over a rolling
+// window of one-minute buckets.
+type endpointAggregator struct {
+	mu           sync.Mutex
+	window       time.Duration
+	maxEndpoints int
+	endpoints    map[string][]endpointBucket
+}
+
+func newEndpointAggregator(window time.Duration, maxEndpoints int) *endpointAggregator {
+	return &endpointAggregator{
+		window:       window,
+		maxEndpoints: maxEndpoints,
+		endpoints:    make(map[string][]endpointBucket),
+	}
+}
+
+func (a *endpointAggregator) record(metric QueryMetrics, now time.Time) {
+	if metric.Context == nil || metric.Context.APIEndpoint == "" || metric.Data == nil {
+		return
+	}
+	endpoint := templatizeEndpoint(metric.Context.APIEndpoint)
+	minute := now.Unix() / 60
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	buckets, ok := a.endpoints[endpoint]
+	if !ok && a.maxEndpoints > 0 && len(a.endpoints) >= a.maxEndpoints {
+		endpoint = overflowEndpoint
+		buckets = a.endpoints[endpoint]
+	}
+	if len(buckets) == 0 || buckets[len(buckets)-1].minute != minute {
+		buckets = append(a.prune(buckets, now), endpointBucket{minute: minute})
+	}
+
+	bucket := &buckets[len(buckets)-1]
+	bucket.queries++
+	if metric.Data.failed() {
+		bucket.errors++
+	}
+	if metric.Data.ExecutionTimeMs != nil {
+		bucket.totalMs += *metric.Data.ExecutionTimeMs
+	}
+	a.endpoints[endpoint] = buckets
+}
+
+// prune drops buckets that fell out of the window. Callers hold a.mu.
+func (a *endpointAggregator) prune(buckets []endpointBucket, now time.Time) []endpointBucket {
+	oldest := now.Add(-a.window).Unix() / 60
+	for len(buckets) > 0 && buckets[0].minute <= oldest {
+		buckets = buckets[1:]
+	}
+	return buckets
+}
+
+// summary returns the windowed stats per endpoint, heaviest DB time first.
+func (a *endpointAggregator) summary(now time.Time) []EndpointStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]EndpointStats, 0, len(a.endpoints))
+	for endpoint, buckets := range a.endpoints {
+		buckets = a.prune(buckets, now)
+		if len(buckets) == 0 {
+			delete(a.endpoints, endpoint)
+			continue
+		}
+		a.endpoints[endpoint] = buckets
+
+		stats := EndpointStats{Endpoint: endpoint}
+		for _, bucket := range buckets {
+			stats.QueryCount += bucket.queries
+			stats.ErrorCount += bucket.errors
+			stats.TotalDBTime += bucket.totalMs
+		}
+		if stats.QueryCount > 0 {
+			stats.ErrorRate = float64(stats.ErrorCount) / float64(stats.QueryCount)
+			stats.AvgDBTime = float64(stats.TotalDBTime) / float64(stats.QueryCount)
+		}
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TotalDBTime > result[j].TotalDBTime
+	})
+	return result
+}
+
+// endpointsHandler serves GET /api/endpoints.
+func (h *Hub) endpointsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoints": h.endpoints.summary(time.Now()),
+		"window":    h.cfg.EndpointWindow.String(),
+	})
+}
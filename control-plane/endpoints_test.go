@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplatizeEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"GET /api/courses/42?page=2", "GET /api/courses/{id}"},
+		{"GET /api/courses/43", "GET /api/courses/{id}"},
+		{"/api/users/3f2504e0-4f89-11d3-9a0c-0305e82c3301/orders", "/api/users/{id}/orders"},
+		{"POST /api/sessions/5f1d7a2b9c", "POST /api/sessions/{id}"},
+		// Words made of hex letters alone, or too short to be ids, are kept.
+		{"GET /api/feed/deadbeef", "GET /api/feed/deadbeef"},
+		{"GET /api/v2/health#top", "GET /api/v2/health"},
+		{"  GET   /api/courses  ", "GET /api/courses"},
+	}
+	for _, tt := range tests {
+		if got := templatizeEndpoint(tt.endpoint); got != tt.want {
+			t.Errorf("templatizeEndpoint(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+// endpointMetric returns a query from endpoint taking executionMs.
+func endpointMetric(endpoint string, executionMs int64, status string) QueryMetrics {
+	metric := testMetric("pod-a", executionMs)
+	metric.Data.Status = status
+	metric.Context = &ExecutionContext{APIEndpoint: endpoint}
+	return metric
+}
+
+func TestEndpointAggregation(t *testing.T) {
+	aggregator := newEndpointAggregator(5*time.Minute, 10)
+	now := time.Now()
+	aggregator.record(endpointMetric("GET /api/courses/1", 100, "SUCCESS"), now)
+	aggregator.record(endpointMetric("GET /api/courses/2", 300, "ERROR"), now)
+	aggregator.record(endpointMetric("GET /api/health", 5, "SUCCESS"), now)
+	aggregator.record(testMetric("pod-a", 50), now)
+
+	summary := aggregator.summary(now)
+	if len(summary) != 2 {
+		t.Fatalf("got %d endpoints, want 2: %+v", len(summary), summary)
+	}
+	want := EndpointStats{Endpoint: "GET /api/courses/{id}", QueryCount: 2, ErrorCount: 1, ErrorRate: 0.5, TotalDBTime: 400, AvgDBTime: 200}
+	if summary[0] != want {
+		t.Errorf("heaviest endpoint = %+v, want %+v", summary[0], want)
+	}
+
+	if summary := aggregator.summary(now.Add(6 * time.Minute)); len(summary) != 0 {
+		t.Errorf("summary after the window = %+v, want empty", summary)
+	}
+}
+
+func TestEndpointCardinalityLimit(t *testing.T) {
+	aggregator := newEndpointAggregator(5*time.Minute, 2)
+	now := time.Now()
+	for _, endpoint := range []string{"GET /a", "GET /b", "GET /c", "GET /d", "GET /a"} {
+		aggregator.record(endpointMetric(endpoint, 10, "SUCCESS"), now)
+	}
+
+	counts := make(map[string]int64)
+	for _, stats := range aggregator.summary(now) {
+		counts[stats.Endpoint] = stats.QueryCount
+	}
+	want := map[string]int64{"GET /a": 2, "GET /b": 1, overflowEndpoint: 2}
+	if len(counts) != len(want) {
+		t.Fatalf("endpoints = %v, want %v", counts, want)
+	}
+	for endpoint, count := range want {
+		if counts[endpoint] != count {
+			t.Errorf("%s: %d queries, want %d", endpoint, counts[endpoint], count)
+		}
+	}
+}
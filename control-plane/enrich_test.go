@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestEnrichFillsOnlyMissingIdentity(t *testing.T) {
+	cfg := testConfig()
+	cfg.ClusterID = "prod-eu"
+	cfg.Region = "eu-west-1"
+	h := newHub(cfg)
+
+	tests := []struct {
+		name        string
+		cluster     string
+		region      string
+		wantCluster string
+		wantRegion  string
+	}{
+		{"empty", "", "", "prod-eu", "eu-west-1"},
+		{"agent cluster", "prod-us", "", "prod-us", "eu-west-1"},
+		{"agent region", "", "us-east-1", "prod-eu", "us-east-1"},
+		{"both supplied", "prod-us", "us-east-1", "prod-us", "us-east-1"},
+	}
+	for _, tt := range tests {
+		metric := testMetric("pod-a", 10)
+		metric.ClusterID, metric.Region = tt.cluster, tt.region
+		got := h.enrich(metric)
+		if got.ClusterID != tt.wantCluster || got.Region != tt.wantRegion {
+			t.Errorf("%s: enrich = %q/%q, want %q/%q", tt.name, got.ClusterID, got.Region, tt.wantCluster, tt.wantRegion)
+		}
+	}
+}
+
+func TestIngestedMetricsCarryClusterIdentity(t *testing.T) {
+	cfg := testConfig()
+	cfg.ClusterID = "prod-eu"
+	cfg.Region = "eu-west-1"
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	tagged := testMetric("pod-b", 10)
+	tagged.Region = "eu-central-1"
+	postTestMetric(t, h, tagged)
+
+	want := map[string]string{"pod-a": "eu-west-1", "pod-b": "eu-central-1"}
+	records := h.recent.query(metricFilter{})
+	if len(records) != 2 {
+		t.Fatalf("stored %d metrics, want 2", len(records))
+	}
+	for _, record := range records {
+		if record.Metric.ClusterID != "prod-eu" || record.Metric.Region != want[record.Metric.PodName] {
+			t.Errorf("stored %s as %q/%q, want prod-eu/%s", record.Metric.PodName, record.Metric.ClusterID, record.Metric.Region, want[record.Metric.PodName])
+		}
+	}
+	data := readTestMessage(t, conn).Data.(map[string]interface{})
+	if data["cluster_id"] != "prod-eu" || data["region"] != "eu-west-1" {
+		t.Errorf("broadcast data = %v, want cluster prod-eu in eu-west-1", data)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// errorRateAlertRepeat is how often a pod whose error rate stays high is
+// warned about again.
+const errorRateAlertRepeat = 30 * time.Second
+
+// errorRateRecentMessages is how many recent error messages are kept per pod
+// to pick the most common one.
+const errorRateRecentMessages = 50
+
+// errorRateTracker computes the per-pod share of failed query executions over
+// a sliding window, counted in one-second buckets.
+type errorRateTracker struct {
+	mu         sync.Mutex
+	window     int64
+	minSamples int64
+	pods       map[string]*podErrors
+	monitor    *thresholdMonitor
+}
+
+type podErrors struct {
+	buckets  []errorBucket
+	messages []errorMessage
+	next     int
+}
+
+type errorBucket struct {
+	second int64
+	total  int64
+	failed int64
+}
+
+type errorMessage struct {
+	at      time.Time
+	message string
+}
+
+func newErrorRateTracker(ratio float64, window time.Duration, minSamples int) *errorRateTracker {
+	monitor := newThresholdMonitor(ratio, ratio)
+	monitor.repeat = errorRateAlertRepeat
+	return &errorRateTracker{
+		window:     max(int64(window/time.Second), 1),
+		minSamples: int64(max(minSamples, 1)),
+		pods:       make(map[string]*podErrors),
+		monitor:    monitor,
+	}
+}
+
+// record counts one query execution and returns the pod's error rate over the
+// window, the number of executions it covers and the most common recent
+// error message.
+func (t *errorRateTracker) record(podName string, failed bool, message string, now time.Time) (float64, int64, string) {
+	second := now.Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pod, ok := t.pods[podName]
+	if !ok {
+		pod = &podErrors{buckets: make([]errorBucket, t.window)}
+		t.pods[podName] = pod
+	}
+	bucket := &pod.buckets[second%t.window]
+	if bucket.second != second {
+		*bucket = errorBucket{second: second}
+	}
+	bucket.total++
+	if failed {
+		bucket.failed++
+		if message != "" {
+			if len(pod.messages) < errorRateRecentMessages {
+				pod.messages = append(pod.messages, errorMessage{at: now, message: message})
+			} else {
+				pod.messages[pod.next] = errorMessage{at: now, message: message}
+				pod.next = (pod.next + 1) % errorRateRecentMessages
+			}
+		}
+	}
+
+	var total, failures int64
+	for _, b := range pod.buckets {
+		if second-b.second < t.window {
+			total += b.total
+			failures += b.failed
+		}
+	}
+	return float64(failures) / float64(total), total, t.commonMessage(pod, now)
+}
+
+func (t *errorRateTracker) forget(podName string) {
+	t.mu.Lock()
+	delete(t.pods, podName)
+	t.mu.Unlock()
+	t.monitor.forget(podName)
+}
+
+// commonMessage returns the most frequent error message seen within the
+// window. Callers hold t.mu.
+func (t *errorRateTracker) commonMessage(pod *podErrors, now time.Time) string {
+	cutoff := now.Add(-time.Duration(t.window) * time.Second)
+	counts := make(map[string]int)
+	common := ""
+	for _, m := range pod.messages {
+		if m.at.Before(cutoff) {
+			continue
+		}
+		counts[m.message]++
+		if counts[m.message] > counts[common] {
+			common = m.message
+		}
+	}
+	return common
+}
+
+// analyzeErrorRate broadcasts an error_rate_alert once a pod's share of
+// failed query executions over the window reaches the configured ratio with
+// at least the minimum number of executions, repeats it every
+// errorRateAlertRepeat while that lasts, and broadcasts error_rate_recovered
+// when the rate drops below it.
+func (h *Hub) analyzeErrorRate(metric QueryMetrics) {
+	if metric.EventType != "query_execution" || metric.Data == nil {
+		return
+	}
+	now := time.Now()
+	rate, samples, common := h.errRates.record(metric.PodName, metric.Data.failed(), metric.Data.ErrorMessage, now)
+	if samples < h.errRates.minSamples {
+		return
+	}
+
+	data := map[string]interface{}{
+		"pod_name":          metric.PodName,
+		"namespace":         metric.Namespace,
+		"error_rate":        rate,
+		"sample_size":       samples,
+		"window_seconds":    h.errRates.window,
+		"threshold":         h.errRates.monitor.high,
+		"top_error_message": common,
+	}
+
+	var messageType string
+	switch h.errRates.monitor.observe(metric.PodName, rate, now) {
+	case thresholdFired, thresholdRepeated:
+		messageType = "error_rate_alert"
+		data["severity"] = "warning"
+		h.alerts.fire("error_rate_alert", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+			"error_rate": rate,
+		})
+	case thresholdRecovered:
+		messageType = "error_rate_recovered"
+		h.alerts.resolve("error_rate_alert", metric.PodName)
+	default:
+		return
+	}
+
+	h.publish(newNamespacedMessage(messageType, metric.Namespace, data))
+}
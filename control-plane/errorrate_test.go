@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorRateSlidingWindow(t *testing.T) {
+	tracker := newErrorRateTracker(0.1, 10*time.Second, 1)
+	start := time.Unix(1_700_000_000, 0)
+	tracker.record("pod-a", true, "timeout", start)
+	tracker.record("pod-a", true, "timeout", start.Add(time.Second))
+	tracker.record("pod-a", false, "", start.Add(2*time.Second))
+
+	rate, samples, common := tracker.record("pod-a", true, "deadlock", start.Add(3*time.Second))
+	if rate != 0.75 || samples != 4 || common != "timeout" {
+		t.Errorf("rate = %v over %d, common %q, want 0.75 over 4 with timeout", rate, samples, common)
+	}
+	// The first two failures have left the window.
+	rate, samples, common = tracker.record("pod-a", false, "", start.Add(12*time.Second))
+	if rate != 0.5 || samples != 2 || common != "deadlock" {
+		t.Errorf("rate = %v over %d, common %q, want 0.5 over 2 with deadlock", rate, samples, common)
+	}
+	if rate, samples, _ := tracker.record("pod-b", false, "", start); rate != 0 || samples != 1 {
+		t.Errorf("pod-b: rate = %v over %d, want its own window", rate, samples)
+	}
+}
+
+func TestErrorRateAlertNeedsRatioAndSamples(t *testing.T) {
+	cfg := testConfig()
+	cfg.ErrorRateMinSamples = 10
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=error_rate_alert,done")
+
+	// All failures, but too few to alert on.
+	for _, message := range []string{"timeout", "deadlock", "timeout", "timeout", "deadlock"} {
+		postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.Data.Status = "ERROR"
+			m.Data.ErrorMessage = message
+		}))
+	}
+	// Enough executions, but a 5% error rate is below the ratio.
+	for i := 0; i < 19; i++ {
+		postTestMetric(t, h, testMetric("pod-b", 10))
+	}
+	postTestMetric(t, h, testMetric("pod-b", 10, func(m *QueryMetrics) {
+		m.Data.Status = "ERROR"
+		m.Data.ErrorMessage = "timeout"
+	}))
+	// The tenth execution reaches the minimum at a 50% error rate.
+	for i := 0; i < 5; i++ {
+		postTestMetric(t, h, testMetric("pod-a", 10))
+	}
+	h.publish(newMessage("done", nil))
+
+	alert := readTestMessage(t, conn)
+	data, _ := alert.Data.(map[string]interface{})
+	if alert.Type != "error_rate_alert" || data["pod_name"] != "pod-a" || data["error_rate"] != 0.5 ||
+		data["sample_size"] != float64(10) || data["top_error_message"] != "timeout" {
+		t.Errorf("message = %s %v, want pod-a alerting at 0.5 over 10 with timeout", alert.Type, data)
+	}
+	if next := readTestMessage(t, conn); next.Type != "done" {
+		t.Errorf("message = %s %v, want no other alert", next.Type, next.Data)
+	}
+}
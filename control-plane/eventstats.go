@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventCountWindow is the span of the recent counts on /api/stats/events.
+const eventCountWindow = 60
+
+// eventCounters counts processed metrics per event type since startup and
+// over the last minute, for deployments that do not scrape Prometheus.
+// Event types are bounded like the Prometheus label, so the map is built
+// once and only read afterwards.
+type eventCounters struct {
+	started time.Time
+	types   map[string]*eventCounter
+}
+
+type eventCounter struct {
+	total atomic.Uint64
+
+	mu      sync.Mutex
+	buckets [eventCountWindow]eventCountBucket
+}
+
+type eventCountBucket struct {
+	second int64
+	count  uint64
+}
+
+func newEventCounters(now time.Time) *eventCounters {
+	types := make(map[string]*eventCounter, len(knownEventTypes)+1)
+	for eventType := range knownEventTypes {
+		types[eventType] = &eventCounter{}
+	}
+	types[eventTypeLabel("")] = &eventCounter{}
+	return &eventCounters{started: now, types: types}
+}
+
+func (e *eventCounters) record(eventType string, now time.Time) {
+	counter := e.types[eventTypeLabel(eventType)]
+	counter.total.Add(1)
+
+	second := now.Unix()
+	counter.mu.Lock()
+	bucket := &counter.buckets[second%eventCountWindow]
+	if bucket.second != second {
+		*bucket = eventCountBucket{second: second}
+	}
+	bucket.count++
+	counter.mu.Unlock()
+}
+
+// recent sums the counter's buckets within the window ending at now.
+func (c *eventCounter) recent(now time.Time) uint64 {
+	second := now.Unix()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sum uint64
+	for _, bucket := range c.buckets {
+		if second-bucket.second < eventCountWindow {
+			sum += bucket.count
+		}
+	}
+	return sum
+}
+
+// EventCount is one event type's entry on /api/stats/events.
+type EventCount struct {
+	Total      uint64 `json:"total"`
+	LastMinute uint64 `json:"last_minute"`
+}
+
+// eventStatsHandler serves GET /api/stats/events.
+func (h *Hub) eventStatsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	events := make(map[string]EventCount, len(h.events.types))
+	var total, lastMinute uint64
+	for eventType, counter := range h.events.types {
+		count := EventCount{Total: counter.total.Load(), LastMinute: counter.recent(now)}
+		events[eventType] = count
+		total += count.Total
+		lastMinute += count.LastMinute
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events":         events,
+		"total":          EventCount{Total: total, LastMinute: lastMinute},
+		"uptime_seconds": int64(now.Sub(h.events.started).Seconds()),
+		"timestamp":      now.Format(time.RFC3339),
+	})
+}
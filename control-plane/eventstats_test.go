@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventCountersWindow(t *testing.T) {
+	start := time.Now()
+	counters := newEventCounters(start)
+	counters.record("query_execution", start)
+	counters.record("query_execution", start.Add(30*time.Second))
+	counters.record("cache_miss", start.Add(30*time.Second))
+
+	later := start.Add(70 * time.Second)
+	counters.record("query_execution", later)
+	queries := counters.types["query_execution"]
+	if total, recent := queries.total.Load(), queries.recent(later); total != 3 || recent != 2 {
+		t.Errorf("query_execution = %d total, %d in the last minute, want 3 and 2", total, recent)
+	}
+	// Unknown event types share the other counter.
+	if other := counters.types[eventTypeLabel("cache_miss")]; other.total.Load() != 1 || other.recent(start.Add(2*time.Minute)) != 0 {
+		t.Errorf("other = %d total, want 1 and nothing recent after two minutes", other.total.Load())
+	}
+}
+
+func TestEventStatsHandler(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	h.events.started = time.Now().Add(-90 * time.Second)
+
+	for i := 0; i < 3; i++ {
+		postTestMetric(t, h, testMetric("pod-a", 10))
+	}
+	postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+		m.EventType = "transaction_event"
+		m.Data.TransactionId = ptr("tx-1")
+		m.Data.TransactionDuration = ptr(int64(10))
+		m.Data.Status = "ACTIVE"
+	}))
+	unknown := testMetric("pod-a", 10)
+	unknown.EventType = "cache_miss"
+	postTestMetric(t, h, unknown)
+
+	rec := httptest.NewRecorder()
+	h.eventStatsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/stats/events", nil))
+	var body struct {
+		Events        map[string]EventCount `json:"events"`
+		Total         EventCount            `json:"total"`
+		UptimeSeconds int64                 `json:"uptime_seconds"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	for eventType, want := range map[string]uint64{"query_execution": 3, "transaction_event": 1, "other": 1, "deadlock_detected": 0} {
+		if got := body.Events[eventType]; got.Total != want || got.LastMinute != want {
+			t.Errorf("%s = %+v, want %d total and in the last minute", eventType, got, want)
+		}
+	}
+	if body.Total.Total != 5 || body.Total.LastMinute != 5 {
+		t.Errorf("total = %+v, want 5", body.Total)
+	}
+	if body.UptimeSeconds < 90 {
+		t.Errorf("uptime_seconds = %d, want at least 90", body.UptimeSeconds)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"container/list"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// sqlFingerprint is the normalized pattern of a SQL statement and the hash
+// that identifies it.
+type sqlFingerprint struct {
+	pattern string
+	hash    string
+}
+
+// fingerprintSQL normalizes a statement and hashes the result, so statements
+// differing only in literals share a hash.
+func fingerprintSQL(sql string) sqlFingerprint {
+	pattern := normalizeSQLPattern(sql)
+	hash := fnv.New64a()
+	hash.Write([]byte(pattern))
+	return sqlFingerprint{pattern: pattern, hash: strconv.FormatUint(hash.Sum64(), 16)}
+}
+
+// fingerprintCache remembers the fingerprints of the capacity most recently
+// seen statements, evicting the least recently used one to make room.
+// Agents report the same few statements over and over, so most lookups
+// skip normalization.
+type fingerprintCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+	hits     uint64
+	misses   uint64
+	// agentRatios sums the cache hit ratios agents reported alongside the
+	// statements, so the two can be compared on /api/stats.
+	agentRatios float64
+	agentCount  uint64
+}
+
+type fingerprintEntry struct {
+	sql         string
+	fingerprint sqlFingerprint
+}
+
+// FingerprintCacheStats is the fingerprint cache's state on /api/stats.
+// AgentHitRatio is the mean of the cache_hit_ratio agents reported, if any.
+type FingerprintCacheStats struct {
+	Size          int      `json:"size"`
+	Capacity      int      `json:"capacity"`
+	Hits          uint64   `json:"hits"`
+	Misses        uint64   `json:"misses"`
+	HitRatio      float64  `json:"hit_ratio"`
+	AgentHitRatio *float64 `json:"agent_hit_ratio,omitempty"`
+}
+
+// newFingerprintCache returns nil, which fingerprints every statement afresh,
+// when capacity is not positive.
+func newFingerprintCache(capacity int) *fingerprintCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &fingerprintCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the statement's fingerprint, computing and caching it on a
+// miss.
+func (c *fingerprintCache) get(sql string) sqlFingerprint {
+	if c == nil {
+		return fingerprintSQL(sql)
+	}
+	c.mu.Lock()
+	if element, ok := c.entries[sql]; ok {
+		c.order.MoveToFront(element)
+		c.hits++
+		c.mu.Unlock()
+		return element.Value.(*fingerprintEntry).fingerprint
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// Normalize outside the lock; a concurrent miss for the same statement
+	// computes the same fingerprint.
+	fingerprint := fingerprintSQL(sql)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[sql]; ok {
+		return fingerprint
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*fingerprintEntry).sql)
+	}
+	c.entries[sql] = c.order.PushFront(&fingerprintEntry{sql: sql, fingerprint: fingerprint})
+	return fingerprint
+}
+
+// recordAgentRatio notes a cache hit ratio reported by an agent.
+func (c *fingerprintCache) recordAgentRatio(ratio float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.agentRatios += ratio
+	c.agentCount++
+	c.mu.Unlock()
+}
+
+func (c *fingerprintCache) stats() FingerprintCacheStats {
+	if c == nil {
+		return FingerprintCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := FingerprintCacheStats{
+		Size:     c.order.Len(),
+		Capacity: c.capacity,
+		Hits:     c.hits,
+		Misses:   c.misses,
+	}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		result.HitRatio = float64(c.hits) / float64(lookups)
+	}
+	if c.agentCount > 0 {
+		mean := c.agentRatios / float64(c.agentCount)
+		result.AgentHitRatio = &mean
+	}
+	return result
+}
+
+// fingerprint stamps the SQL hash on metrics whose agent did not report one.
+// It copies the query data rather than changing it in place.
+func (h *Hub) fingerprint(metric QueryMetrics) QueryMetrics {
+	if metric.Data == nil || metric.Data.SQLPattern == "" {
+		return metric
+	}
+	if metric.Data.CacheHitRatio != nil {
+		h.patterns.recordAgentRatio(*metric.Data.CacheHitRatio)
+	}
+	if metric.Data.SQLHash != "" {
+		return metric
+	}
+	data := *metric.Data
+	data.SQLHash = h.patterns.get(data.SQLPattern).hash
+	metric.Data = &data
+	return metric
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFingerprintCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newFingerprintCache(2)
+	for _, sql := range []string{"SELECT 1", "SELECT 2", "SELECT 1", "SELECT 3", "SELECT 1", "SELECT 2"} {
+		cache.get(sql)
+	}
+	// SELECT 3 evicted SELECT 2, which had been used least recently, so
+	// SELECT 1 stayed a hit and SELECT 2 missed again.
+	stats := cache.stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.Size != 2 || stats.Capacity != 2 {
+		t.Errorf("stats = %+v, want 2 hits, 4 misses and 2 entries", stats)
+	}
+	if stats.HitRatio != 2.0/6 {
+		t.Errorf("hit ratio = %v, want 2/6", stats.HitRatio)
+	}
+	if _, ok := cache.entries["SELECT 3"]; ok {
+		t.Error("SELECT 3 still cached, want it evicted by SELECT 2")
+	}
+}
+
+func TestFingerprintCacheMatchesUncached(t *testing.T) {
+	cache := newFingerprintCache(10)
+	var none *fingerprintCache
+	for _, sql := range []string{
+		"select * from users where id=5",
+		"SELECT * FROM users WHERE id = 6",
+		"UPDATE orders SET status = 'shipped' WHERE id IN (1, 2, 3)",
+	} {
+		want := fingerprintSQL(sql)
+		for i := 0; i < 2; i++ {
+			if got := cache.get(sql); got != want {
+				t.Errorf("cached fingerprint of %q = %+v, want %+v", sql, got, want)
+			}
+		}
+		if got := none.get(sql); got != want {
+			t.Errorf("uncached fingerprint of %q = %+v, want %+v", sql, got, want)
+		}
+	}
+	if a, b := cache.get("select * from users where id=5"), cache.get("SELECT * FROM users WHERE id = 6"); a.hash != b.hash {
+		t.Errorf("hashes %s and %s differ, want statements differing in literals to share one", a.hash, b.hash)
+	}
+	if newFingerprintCache(0) != nil {
+		t.Error("cache with no capacity is not nil, want fingerprinting uncached")
+	}
+}
+
+func TestStatsReportFingerprintCache(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	for _, ratio := range []float64{0.5, 0.9} {
+		metric := testMetric("pod-a", 10)
+		metric.Data.CacheHitRatio = ptr(ratio)
+		postTestMetric(t, h, metric)
+	}
+	hashed := testMetric("pod-a", 10)
+	hashed.Data.SQLHash = "agent-hash"
+	postTestMetric(t, h, hashed)
+
+	want := fingerprintSQL("SELECT * FROM users WHERE id = ?").hash
+	for _, hash := range []string{want, want, "agent-hash"} {
+		message := readTestMessage(t, conn)
+		if got := message.Data.(map[string]interface{})["data"].(map[string]interface{})["sql_hash"]; got != hash {
+			t.Errorf("sql_hash = %v, want %s", got, hash)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.statsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	var body struct {
+		FingerprintCache FingerprintCacheStats `json:"fingerprint_cache"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	stats := body.FingerprintCache
+	if stats.Size != 1 || stats.Misses != 1 || stats.Hits == 0 || stats.Capacity != testConfig().FingerprintCacheSize {
+		t.Errorf("fingerprint_cache = %+v, want one statement normalized once", stats)
+	}
+	if stats.AgentHitRatio == nil || *stats.AgentHitRatio != 0.7 {
+		t.Errorf("agent_hit_ratio = %v, want the mean of 0.5 and 0.9", stats.AgentHitRatio)
+	}
+}
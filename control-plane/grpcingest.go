@@ -0,0 +1,207 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ingestpb/ingest.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"kubedb-monitor-control-plane/ingestpb"
+)
+
+// grpcSummaryErrors caps the rejection reasons returned in an IngestSummary.
+const grpcSummaryErrors = 10
+
+// grpcIngest serves the MetricIngest gRPC service next to the HTTP server.
+// Metrics take the same path as those posted to /api/metrics: validation,
+// then the ingestion pipeline.
+type grpcIngest struct {
+	ingestpb.UnimplementedMetricIngestServer
+	hub    *Hub
+	server *grpc.Server
+}
+
+// startGRPCIngest listens on port and serves in the background. A non-empty
+// apiKey must be sent as x-api-key metadata, as with X-API-Key over HTTP.
+func startGRPCIngest(h *Hub, port, apiKey string) (*grpcIngest, error) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	ingest := &grpcIngest{hub: h, server: grpc.NewServer(grpc.StreamInterceptor(requireGRPCAPIKey(apiKey)))}
+	ingestpb.RegisterMetricIngestServer(ingest.server, ingest)
+	go func() {
+		if err := ingest.server.Serve(listener); err != nil {
+			slog.Error("grpc server stopped", "error", err)
+		}
+	}()
+	slog.Info("grpc ingestion listening", "port", port)
+	return ingest, nil
+}
+
+// stop lets open streams finish until ctx expires, then closes them.
+func (g *grpcIngest) stop(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		g.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		g.server.Stop()
+	}
+}
+
+// requireGRPCAPIKey rejects streams without the ingestion API key. An empty
+// key disables the check.
+func requireGRPCAPIKey(key string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if key != "" {
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			provided := ""
+			if values := md.Get("x-api-key"); len(values) > 0 {
+				provided = values[0]
+			}
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+				slog.Warn("rejected grpc stream with missing or invalid API key", "method", info.FullMethod, "remote_addr", grpcPeer(stream.Context()))
+				return status.Error(codes.Unauthenticated, "missing or invalid API key")
+			}
+		}
+		return handler(srv, stream)
+	}
+}
+
+func grpcPeer(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// SendMetrics ingests metrics until the agent closes its side of the
+// stream. Invalid metrics are counted and skipped; a full or stopped
+// pipeline ends the stream so the agent can retry the rest.
+func (g *grpcIngest) SendMetrics(stream ingestpb.MetricIngest_SendMetricsServer) error {
+	source := "grpc:" + grpcPeer(stream.Context())
+	summary := &ingestpb.IngestSummary{}
+	for {
+		message, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(summary)
+		}
+		if err != nil {
+			return err
+		}
+
+		metric := metricFromProto(message)
+		metricsReceivedTotal.WithLabelValues(eventTypeLabel(metric.EventType)).Inc()
+		if err := validateMetric(metric); err != nil {
+			g.hub.dlq.rejectMetric(metric, source, err)
+			summary.Rejected++
+			if len(summary.Errors) < grpcSummaryErrors {
+				summary.Errors = append(summary.Errors, err.Error())
+			}
+			continue
+		}
+		switch err := g.hub.ingest.submit(metric, false); {
+		case errors.Is(err, errQueueFull):
+			return status.Errorf(codes.ResourceExhausted, "%v after %d metrics", err, summary.Accepted)
+		case errors.Is(err, errPipelineClosed):
+			return status.Errorf(codes.Unavailable, "%v after %d metrics", err, summary.Accepted)
+		case err != nil:
+			return status.Error(codes.Internal, err.Error())
+		}
+		summary.Accepted++
+	}
+}
+
+// metricFromProto maps a protobuf metric onto the JSON-shaped QueryMetrics.
+func metricFromProto(m *ingestpb.QueryMetric) QueryMetrics {
+	metric := QueryMetrics{
+		Timestamp: m.GetTimestamp(),
+		PodName:   m.GetPodName(),
+		Namespace: m.GetNamespace(),
+		EventType: m.GetEventType(),
+		ClusterID: m.GetClusterId(),
+		Region:    m.GetRegion(),
+	}
+	if d := m.GetData(); d != nil {
+		data := &QueryData{
+			QueryID:             d.GetQueryId(),
+			SQLHash:             d.GetSqlHash(),
+			SQLPattern:          d.GetSqlPattern(),
+			SQLType:             d.GetSqlType(),
+			TableNames:          d.GetTableNames(),
+			ExecutionTimeMs:     d.ExecutionTimeMs,
+			RowsAffected:        d.RowsAffected,
+			ConnectionID:        d.GetConnectionId(),
+			ThreadName:          d.GetThreadName(),
+			MemoryUsedBytes:     d.MemoryUsedBytes,
+			Status:              d.GetStatus(),
+			ErrorMessage:        d.GetErrorMessage(),
+			CacheHitRatio:       d.CacheHitRatio,
+			TpsValue:            d.TpsValue,
+			TransactionDuration: d.TransactionDuration,
+			TransactionId:       d.TransactionId,
+			DeadlockDuration:    d.DeadlockDuration,
+			DeadlockConnections: d.DeadlockConnections,
+			TransactionOutcome:  d.GetTransactionOutcome(),
+		}
+		if d.ComplexityScore != nil {
+			score := int(*d.ComplexityScore)
+			data.ComplexityScore = &score
+		}
+		for _, edge := range d.GetWaitForEdges() {
+			data.WaitForEdges = append(data.WaitForEdges, WaitForEdge{
+				Holder:   edge.GetHolder(),
+				Waiter:   edge.GetWaiter(),
+				Resource: edge.GetResource(),
+				LockType: edge.GetLockType(),
+			})
+		}
+		metric.Data = data
+	}
+	if c := m.GetContext(); c != nil {
+		metric.Context = &ExecutionContext{
+			RequestID:         c.GetRequestId(),
+			UserSession:       c.GetUserSession(),
+			APIEndpoint:       c.GetApiEndpoint(),
+			BusinessOperation: c.GetBusinessOperation(),
+			UserID:            c.GetUserId(),
+		}
+	}
+	if s := m.GetMetrics(); s != nil {
+		metric.Metrics = &SystemMetrics{
+			ConnectionPoolActive:     protoInt(s.ConnectionPoolActive),
+			ConnectionPoolIdle:       protoInt(s.ConnectionPoolIdle),
+			ConnectionPoolMax:        protoInt(s.ConnectionPoolMax),
+			ConnectionPoolUsageRatio: s.ConnectionPoolUsageRatio,
+			HeapUsedMb:               s.HeapUsedMb,
+			HeapMaxMb:                s.HeapMaxMb,
+			HeapUsageRatio:           s.HeapUsageRatio,
+			CPUUsageRatio:            s.CpuUsageRatio,
+			GCCount:                  s.GcCount,
+			GCTimeMs:                 s.GcTimeMs,
+		}
+	}
+	return metric
+}
+
+func protoInt(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
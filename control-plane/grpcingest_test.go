@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"kubedb-monitor-control-plane/ingestpb"
+)
+
+// dialTestGRPCIngest serves the hub's MetricIngest service in memory and
+// returns a client for it.
+func dialTestGRPCIngest(t *testing.T, h *Hub, apiKey string) ingestpb.MetricIngestClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	ingest := &grpcIngest{hub: h, server: grpc.NewServer(grpc.StreamInterceptor(requireGRPCAPIKey(apiKey)))}
+	ingestpb.RegisterMetricIngestServer(ingest.server, ingest)
+	go ingest.server.Serve(listener)
+	t.Cleanup(ingest.server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ingestpb.NewMetricIngestClient(conn)
+}
+
+// protoTestMetric is testMetric as a protobuf message.
+func protoTestMetric(podName string, executionMs int64) *ingestpb.QueryMetric {
+	return &ingestpb.QueryMetric{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		PodName:   podName,
+		Namespace: "default",
+		EventType: "query_execution",
+		Data: &ingestpb.QueryData{
+			QueryId:         "q-1",
+			SqlPattern:      "SELECT * FROM users WHERE id = ?",
+			SqlType:         "SELECT",
+			TableNames:      []string{"users"},
+			ExecutionTimeMs: proto.Int64(executionMs),
+			Status:          "SUCCESS",
+		},
+	}
+}
+
+// sendTestMetrics streams metrics and returns the summary or error.
+func sendTestMetrics(ctx context.Context, client ingestpb.MetricIngestClient, metrics ...*ingestpb.QueryMetric) (*ingestpb.IngestSummary, error) {
+	stream, err := client.SendMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, metric := range metrics {
+		if err := stream.Send(metric); err != nil {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestGRPCIngestStreamsMetrics(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+	client := dialTestGRPCIngest(t, h, "")
+
+	invalid := protoTestMetric("pod-a", 10)
+	invalid.EventType = ""
+	summary, err := sendTestMetrics(context.Background(), client, protoTestMetric("pod-a", 10), invalid, protoTestMetric("pod-a", 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Accepted != 2 || summary.Rejected != 1 || len(summary.Errors) != 1 {
+		t.Errorf("summary = %v, want 2 accepted and 1 rejected with its reason", summary)
+	}
+
+	for _, want := range []float64{10, 20} {
+		data := readTestMessage(t, conn).Data.(map[string]interface{})["data"].(map[string]interface{})
+		if data["execution_time_ms"] != want || data["sql_type"] != "SELECT" {
+			t.Errorf("broadcast data = %v, want the %vms SELECT", data, want)
+		}
+	}
+	if _, letters := getDeadLetters(t, h, ""); len(letters) != 1 || !strings.HasPrefix(letters[0].Source, "grpc:") {
+		t.Errorf("dead letters = %+v, want the invalid metric from grpc", letters)
+	}
+}
+
+func TestGRPCIngestRequiresAPIKey(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	client := dialTestGRPCIngest(t, h, "secret")
+
+	_, err := sendTestMetrics(context.Background(), client, protoTestMetric("pod-a", 10))
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("stream without a key = %v, want Unauthenticated", err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "secret")
+	if summary, err := sendTestMetrics(ctx, client, protoTestMetric("pod-a", 10)); err != nil || summary.Accepted != 1 {
+		t.Errorf("stream with the key = %v, %v, want 1 accepted", summary, err)
+	}
+}
+
+func TestGRPCIngestEndsStreamWhenPipelineIsFull(t *testing.T) {
+	h := newHub(testConfig())
+	pipeline, _ := blockedTestPipeline(t, 10*time.Millisecond)
+	h.ingest = pipeline
+	client := dialTestGRPCIngest(t, h, "")
+
+	_, err := sendTestMetrics(context.Background(), client, protoTestMetric("pod-a", 10))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("stream into a full pipeline = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestMetricFromProto(t *testing.T) {
+	message := protoTestMetric("pod-a", 10)
+	message.ClusterId = "east"
+	message.Data.ComplexityScore = proto.Int32(7)
+	message.Data.WaitForEdges = []*ingestpb.WaitForEdge{{Holder: "tx-1", Waiter: "tx-2", Resource: "users", LockType: "row"}}
+	message.Context = &ingestpb.ExecutionContext{RequestId: "req-1"}
+	message.Metrics = &ingestpb.SystemMetrics{ConnectionPoolActive: proto.Int32(8), HeapUsageRatio: proto.Float64(0.5)}
+
+	metric := metricFromProto(message)
+	if metric.ClusterID != "east" || metric.PodName != "pod-a" || *metric.Data.ExecutionTimeMs != 10 || *metric.Data.ComplexityScore != 7 {
+		t.Errorf("metric = %+v, data = %+v, want the fields carried over", metric, metric.Data)
+	}
+	if edges := metric.Data.WaitForEdges; len(edges) != 1 || edges[0] != (WaitForEdge{Holder: "tx-1", Waiter: "tx-2", Resource: "users", LockType: "row"}) {
+		t.Errorf("wait-for edges = %+v, want the one sent", edges)
+	}
+	if metric.Context.RequestID != "req-1" || *metric.Metrics.ConnectionPoolActive != 8 || *metric.Metrics.HeapUsageRatio != 0.5 {
+		t.Errorf("context = %+v, metrics = %+v, want them carried over", metric.Context, metric.Metrics)
+	}
+	// Unset optional fields stay unset rather than becoming zero.
+	if metric.Data.RowsAffected != nil || metric.Metrics.ConnectionPoolMax != nil {
+		t.Error("unset optional fields were filled in")
+	}
+	if bare := metricFromProto(&ingestpb.QueryMetric{EventType: "query_execution"}); bare.Data != nil || bare.Context != nil || bare.Metrics != nil {
+		t.Errorf("bare metric = %+v, want no nested sections", bare)
+	}
+}
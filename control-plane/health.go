@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// readyzHandler serves GET /api/readyz. It reports 503 with the failing
+// check as reason while the hub is not running, the broadcast channel is
+// backed up past ReadyBroadcastSaturation, or the metric sink is unreachable.
+// /api/livez and /api/health only report that the process is up and its hub
+// running.
+func (h *Hub) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status, reason := http.StatusOK, ""
+	saturation := float64(len(h.broadcast)) / float64(cap(h.broadcast))
+	switch {
+	case !h.running.Load():
+		status, reason = http.StatusServiceUnavailable, "hub not running"
+	case saturation >= h.cfg.ReadyBroadcastSaturation:
+		status, reason = http.StatusServiceUnavailable, "broadcast channel saturated"
+	default:
+		if err := h.sink.ping(ctx); err != nil {
+			status, reason = http.StatusServiceUnavailable, "metric sink unreachable: "+err.Error()
+		}
+	}
+
+	body := map[string]interface{}{
+		"status":               "ready",
+		"broadcast_saturation": saturation,
+		"timestamp":            time.Now().Format(time.RFC3339),
+	}
+	if state := h.sink.breakerState(); state != "" {
+		body["sink_breaker"] = state
+	}
+	if status != http.StatusOK {
+		body["status"] = "not_ready"
+		body["reason"] = reason
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unreachableSink fails every ping.
+type unreachableSink struct{ NullSink }
+
+func (unreachableSink) Ping(context.Context) error { return errors.New("connection refused") }
+
+// getReadyz calls readyzHandler and returns its status and reason.
+func getReadyz(t *testing.T, h *Hub) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/api/readyz", nil))
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	reason, _ := body["reason"].(string)
+	return rec.Code, reason
+}
+
+// waitForRunning waits until the hub goroutine has started.
+func waitForRunning(t *testing.T, h *Hub) {
+	t.Helper()
+	deadline := time.Now().Add(testReadTimeout)
+	for !h.running.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("hub did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		h := startTestHub(t, testConfig())
+		waitForRunning(t, h)
+		if status, reason := getReadyz(t, h); status != http.StatusOK {
+			t.Errorf("status = %d (%s), want 200", status, reason)
+		}
+	})
+
+	t.Run("sink unreachable", func(t *testing.T) {
+		h := startTestHub(t, testConfig())
+		waitForRunning(t, h)
+		h.sink = newSinkWriter(unreachableSink{}, 1)
+		status, reason := getReadyz(t, h)
+		if status != http.StatusServiceUnavailable || !strings.HasPrefix(reason, "metric sink unreachable") {
+			t.Errorf("readyz = %d %q, want 503 for the sink", status, reason)
+		}
+	})
+
+	t.Run("hub not running", func(t *testing.T) {
+		h := newHub(testConfig())
+		if status, reason := getReadyz(t, h); status != http.StatusServiceUnavailable || reason != "hub not running" {
+			t.Errorf("readyz = %d %q, want 503 hub not running", status, reason)
+		}
+	})
+
+	t.Run("broadcast saturated", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.BroadcastBuffer = 4
+		cfg.ReadyBroadcastSaturation = 0.75
+		// Not started, so nothing drains the broadcast channel.
+		h := newHub(cfg)
+		h.running.Store(true)
+		for i := 0; i < 3; i++ {
+			h.broadcast <- newMessage("test", nil)
+		}
+		if status, reason := getReadyz(t, h); status != http.StatusServiceUnavailable || reason != "broadcast channel saturated" {
+			t.Errorf("readyz = %d %q, want 503 broadcast channel saturated", status, reason)
+		}
+	})
+}
+
+func TestLivez(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	waitForRunning(t, h)
+
+	rec := httptest.NewRecorder()
+	h.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/api/livez", nil))
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["status"] != "healthy" {
+		t.Errorf("livez = %d %v, want 200 healthy", rec.Code, body)
+	}
+
+	// Liveness ignores the sink, unlike readiness.
+	h.sink = newSinkWriter(unreachableSink{}, 1)
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec = httptest.NewRecorder()
+	h.healthHandler(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "OK\n" {
+		t.Errorf("plain text health = %d %q, want 200 OK", rec.Code, rec.Body)
+	}
+}
+
+func TestPrefersPlainText(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/plain", true},
+		{"application/json", false},
+		{"text/plain, application/json", false},
+		{"application/json;q=0.5, text/plain", true},
+		{"text/plain;q=0.9, application/json;q=0.8", true},
+		{"text/plain;q=0", false},
+		{"text/html, text/plain;q=0.1", true},
+	}
+	for _, tt := range tests {
+		if got := prefersPlainText(tt.accept); got != tt.want {
+			t.Errorf("prefersPlainText(%q) = %v, want %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestHealthReportsBuildAndStoppedHub(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	waitForRunning(t, h)
+	rec := httptest.NewRecorder()
+	h.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	var body struct {
+		Status string    `json:"status"`
+		Build  BuildInfo `json:"build"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Build != buildInfo() || body.Build.Version != "dev" || body.Build.GoVersion == "" {
+		t.Errorf("build = %+v, want the unstamped build info", body.Build)
+	}
+
+	// A hub that is not running fails both representations.
+	stopped := newHub(testConfig())
+	rec = httptest.NewRecorder()
+	stopped.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusServiceUnavailable || body.Status != "not_ready" {
+		t.Errorf("health of a stopped hub = %d %q, want 503 not_ready", rec.Code, body.Status)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec = httptest.NewRecorder()
+	stopped.healthHandler(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "NOT READY\n" || rec.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("plain text health of a stopped hub = %d %q, want 503 NOT READY", rec.Code, rec.Body)
+	}
+}
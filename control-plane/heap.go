@@ -0,0 +1,63 @@
+package main
+
+import (
+	"time"
+)
+
+// heapAlertRepeat is how often a pod that stays above the heap threshold is
+// alerted again.
+const heapAlertRepeat = 30 * time.Second
+
+func newHeapMonitor(ratio float64) *thresholdMonitor {
+	monitor := newThresholdMonitor(ratio, ratio)
+	monitor.repeat = heapAlertRepeat
+	return monitor
+}
+
+// analyzeHeap broadcasts a resource_alert when a pod's heap usage reaches the
+// configured ratio, repeats it every heapAlertRepeat while the pod stays
+// there, and broadcasts resource_recovered once usage drops below it.
+func (h *Hub) analyzeHeap(metric QueryMetrics) {
+	if metric.Metrics == nil || metric.Metrics.HeapUsageRatio == nil {
+		return
+	}
+	ratio := *metric.Metrics.HeapUsageRatio
+	now := time.Now()
+
+	data := map[string]interface{}{
+		"pod_name":         metric.PodName,
+		"namespace":        metric.Namespace,
+		"resource":         "heap",
+		"heap_usage_ratio": ratio,
+		"threshold":        h.heap.high,
+		"heap_used_mb":     metric.Metrics.HeapUsedMb,
+		"heap_max_mb":      metric.Metrics.HeapMaxMb,
+	}
+
+	var messageType string
+	switch h.heap.observe(metric.PodName, ratio, now) {
+	case thresholdFired, thresholdRepeated:
+		messageType = "resource_alert"
+		severity := heapSeverity(ratio, h.heap.high)
+		data["severity"] = severity
+		h.alerts.fire("resource_alert", severity, metric.PodName, metric.Namespace, map[string]interface{}{
+			"heap_usage_ratio": ratio,
+		})
+	case thresholdRecovered:
+		messageType = "resource_recovered"
+		h.alerts.resolve("resource_alert", metric.PodName)
+	default:
+		return
+	}
+
+	h.publish(newNamespacedMessage(messageType, metric.Namespace, data))
+}
+
+// heapSeverity escalates to critical once usage is past the midpoint between
+// the threshold and a full heap.
+func heapSeverity(ratio, threshold float64) string {
+	if ratio >= threshold+(1-threshold)/2 {
+		return "critical"
+	}
+	return "warning"
+}
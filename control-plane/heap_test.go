@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeapMonitorDebouncesWhileHigh(t *testing.T) {
+	monitor := newHeapMonitor(0.9)
+	start := time.Now()
+	steps := []struct {
+		at    time.Duration
+		ratio float64
+		want  thresholdTransition
+	}{
+		{0, 0.5, thresholdUnchanged},
+		{time.Second, 0.92, thresholdFired},
+		// Staying high is alerted again only once heapAlertRepeat passed.
+		{10 * time.Second, 0.95, thresholdUnchanged},
+		{29 * time.Second, 0.93, thresholdUnchanged},
+		{31 * time.Second, 0.93, thresholdRepeated},
+		{40 * time.Second, 0.94, thresholdUnchanged},
+		{45 * time.Second, 0.85, thresholdRecovered},
+		{46 * time.Second, 0.8, thresholdUnchanged},
+	}
+	for _, step := range steps {
+		if got := monitor.observe("pod-a", step.ratio, start.Add(step.at)); got != step.want {
+			t.Errorf("+%v (%.2f): transition = %v, want %v", step.at, step.ratio, got, step.want)
+		}
+	}
+}
+
+func TestHeapSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		ratio float64
+		want  string
+	}{
+		{0.9, "warning"},
+		{0.94, "warning"},
+		{0.95, "critical"},
+		{0.99, "critical"},
+	} {
+		if got := heapSeverity(tt.ratio, 0.9); got != tt.want {
+			t.Errorf("heapSeverity(%v) = %s, want %s", tt.ratio, got, tt.want)
+		}
+	}
+}
+
+func TestHeapAlertAndRecovery(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=resource_alert,resource_recovered")
+
+	for _, ratio := range []float64{0.96, 0.97, 0.4} {
+		metric := testMetric("pod-a", 10)
+		metric.Metrics = &SystemMetrics{HeapUsageRatio: ptr(ratio)}
+		postTestMetric(t, h, metric)
+	}
+
+	alert := readTestMessage(t, conn)
+	data := alert.Data.(map[string]interface{})
+	if alert.Type != "resource_alert" || data["severity"] != "critical" || data["heap_usage_ratio"] != 0.96 || data["pod_name"] != "pod-a" {
+		t.Errorf("first message = %s %v, want a critical resource_alert at 0.96", alert.Type, data)
+	}
+	// The second high sample is within the debounce, so recovery follows.
+	if recovered := readTestMessage(t, conn); recovered.Type != "resource_recovered" {
+		t.Errorf("second message = %s, want resource_recovered", recovered.Type)
+	}
+}
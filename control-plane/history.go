@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// historyEntry is a broadcast message together with when it was broadcast.
+type historyEntry struct {
+	message WebSocketMessage
+	at      time.Time
+}
+
+// messageHistory is a fixed-size ring of the most recently broadcast
+// messages. Once full, the oldest entry is overwritten.
+type messageHistory struct {
+	mu      sync.Mutex
+	entries []historyEntry
+	next    int
+	count   int
+	// evicted is the sequence number of the newest message that is no
+	// longer retained; resuming from before it would leave a gap.
+	evicted uint64
+}
+
+func newMessageHistory(size int) *messageHistory {
+	if size < 0 {
+		size = 0
+	}
+	return &messageHistory{entries: make([]historyEntry, size)}
+}
+
+func (m *messageHistory) add(message WebSocketMessage, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.entries) == 0 {
+		m.evicted = message.Seq
+		return
+	}
+	if m.count == len(m.entries) {
+		m.evicted = m.entries[m.next].message.Seq
+	}
+	m.entries[m.next] = historyEntry{message: message, at: at}
+	m.next = (m.next + 1) % len(m.entries)
+	if m.count < len(m.entries) {
+		m.count++
+	}
+}
+
+// since returns the retained entries broadcast at or after cutoff, oldest
+// first.
+func (m *messageHistory) since(cutoff time.Time) []historyEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]historyEntry, 0, m.count)
+	start := (m.next - m.count + len(m.entries)) % max(len(m.entries), 1)
+	for i := 0; i < m.count; i++ {
+		entry := m.entries[(start+i)%len(m.entries)]
+		if !entry.at.Before(cutoff) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// resumeFor returns the retained messages after seq the client is subscribed
+// to, oldest first, for a client reconnecting with /ws?since=. It reports
+// false when messages after seq have already been evicted. Messages kept out
+// of the history, such as tps_update, are superseded anyway and not
+// replayed.
+func (m *messageHistory) resumeFor(client *Client, seq uint64) ([]WebSocketMessage, bool) {
+	m.mu.Lock()
+	evicted := m.evicted
+	m.mu.Unlock()
+	if seq < evicted {
+		return nil, false
+	}
+	var messages []WebSocketMessage
+	for _, entry := range m.since(time.Time{}) {
+		if entry.message.Seq > seq && client.wants(entry.message) {
+			messages = append(messages, entry.message)
+		}
+	}
+	return messages, true
+}
+
+// replayFor returns the retained messages the client is subscribed to,
+// oldest first and marked as backfill.
+func (m *messageHistory) replayFor(client *Client) []WebSocketMessage {
+	entries := m.since(time.Time{})
+	messages := make([]WebSocketMessage, 0, len(entries))
+	for _, entry := range entries {
+		if client.wants(entry.message) {
+			message := entry.message
+			message.IsBackfill = true
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// replayFor picks what a registering client is sent after connected: the
+// whole retained history, or for a resuming client the messages it missed.
+// A resuming client whose position is no longer covered, for example
+// because it was evicted or the control plane restarted, gets a
+// resync_required instead and should reload /api/snapshot. It runs on the
+// hub goroutine.
+func (h *Hub) replayFor(client *Client) []WebSocketMessage {
+	if !client.resuming {
+		return h.history.replayFor(client)
+	}
+	if client.resumeAfter <= h.seq {
+		if messages, ok := h.history.resumeFor(client, client.resumeAfter); ok {
+			slog.Debug("client resumed", "remote_addr", client.remoteAddr, "since", client.resumeAfter, "replayed", len(messages))
+			return messages
+		}
+	}
+	slog.Info("client must resync", "remote_addr", client.remoteAddr, "since", client.resumeAfter, "seq", h.seq)
+	return []WebSocketMessage{newMessage("resync_required", map[string]interface{}{
+		"since": client.resumeAfter,
+		"seq":   h.seq,
+	})}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seqMessage returns a broadcast message numbered seq.
+func seqMessage(seq uint64) WebSocketMessage {
+	message := newMessage("query_metrics", nil)
+	message.Seq = seq
+	return message
+}
+
+func TestMessageHistoryKeepsNewest(t *testing.T) {
+	history := newMessageHistory(500)
+	now := time.Now()
+	for seq := uint64(1); seq <= 600; seq++ {
+		history.add(seqMessage(seq), now)
+	}
+
+	entries := history.since(time.Time{})
+	if len(entries) != 500 {
+		t.Fatalf("retained %d messages, want 500", len(entries))
+	}
+	for i, entry := range entries {
+		if want := uint64(101 + i); entry.message.Seq != want {
+			t.Fatalf("entry %d has seq %d, want %d", i, entry.message.Seq, want)
+		}
+	}
+	if history.evicted != 100 {
+		t.Errorf("evicted = %d, want 100", history.evicted)
+	}
+}
+
+func TestReplayOnConnect(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	for i := 0; i < 600; i++ {
+		postTestMetric(t, h, testMetric("pod-a", int64(i)))
+	}
+	// Processed metrics can still sit in the broadcast channel; wait until
+	// the last one is in the history.
+	deadline := time.Now().Add(testReadTimeout)
+	for {
+		entries := h.history.since(time.Time{})
+		if n := len(entries); n > 0 {
+			if last, ok := entries[n-1].message.Data.(QueryMetrics); ok && *last.Data.ExecutionTimeMs == 599 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the last metric never reached the history")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	conn := dialTestHub(t, h, "")
+	for i := 100; i < 600; i++ {
+		message := readTestMessage(t, conn)
+		data, _ := message.Data.(map[string]interface{})
+		if message.Type != "query_metrics" || !message.IsBackfill {
+			t.Fatalf("message %d = %s (backfill %v), want backfilled query_metrics", i, message.Type, message.IsBackfill)
+		}
+		if got := data["data"].(map[string]interface{})["execution_time_ms"]; got != float64(i) {
+			t.Fatalf("replayed metric %v, want %d", got, i)
+		}
+	}
+	// Replay is over: the next message is live.
+	h.publish(newMessage("live", nil))
+	if message := readTestMessageOfType(t, conn, "live"); message.IsBackfill {
+		t.Errorf("message after replay = %+v, want it live", message)
+	}
+}
+
+func TestSequenceNumbersAreGapFree(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	for i := 0; i < 3; i++ {
+		h.publish(newMessage("before", nil))
+	}
+	waitForHistory(t, h, 3)
+
+	conn, _, err := dialTestHubWithHeader(t, h, "types=none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connected := readTestMessage(t, conn)
+	if connected.Type != "connected" || connected.Data.(map[string]interface{})["seq"] != float64(3) {
+		t.Fatalf("first message = %s %v, want connected at seq 3", connected.Type, connected.Data)
+	}
+	conn.WriteJSON(ControlMessage{Action: "subscribe"})
+	readTestMessageOfType(t, conn, "subscribed")
+
+	var wg sync.WaitGroup
+	for poster := 0; poster < 8; poster++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if rec := postTestBody(h, testBatch(t, testMetric("pod-a", int64(i)))); rec.Code != http.StatusOK {
+					t.Errorf("status = %d, want 200", rec.Code)
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		h.publish(newMessage("done", nil))
+	}()
+
+	previous := uint64(3)
+	posted := 0
+	for {
+		message := readTestMessage(t, conn)
+		if message.Seq != previous+1 {
+			t.Fatalf("%s has seq %d after %d", message.Type, message.Seq, previous)
+		}
+		previous = message.Seq
+		if message.Type == "query_metrics" {
+			posted++
+		}
+		if message.Type == "done" {
+			break
+		}
+	}
+	if posted != 200 {
+		t.Errorf("got %d query_metrics, want 200", posted)
+	}
+}
+
+func TestResumeEdgeCases(t *testing.T) {
+	cfg := testConfig()
+	cfg.HistorySize = 5
+	h := newHub(cfg)
+	for seq := uint64(1); seq <= 10; seq++ {
+		h.seq = seq
+		h.history.add(seqMessage(seq), time.Now())
+	}
+	// Messages 6 to 10 are retained.
+
+	tests := []struct {
+		name   string
+		since  uint64
+		replay []uint64 // nil when the client must resync
+	}{
+		{"up to date", 10, []uint64{}},
+		{"within history", 7, []uint64{8, 9, 10}},
+		{"at the last evicted message", 5, []uint64{6, 7, 8, 9, 10}},
+		{"before the last evicted message", 4, nil},
+		{"ahead of the hub", 11, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := h.replayFor(&Client{resuming: true, resumeAfter: tt.since})
+			if tt.replay == nil {
+				if len(messages) != 1 || messages[0].Type != "resync_required" {
+					t.Fatalf("replay = %+v, want resync_required", messages)
+				}
+				data := messages[0].Data.(map[string]interface{})
+				if data["since"] != tt.since || data["seq"] != uint64(10) {
+					t.Errorf("resync_required data = %v, want since %d and seq 10", data, tt.since)
+				}
+				return
+			}
+			if len(messages) != len(tt.replay) {
+				t.Fatalf("replayed %d messages, want %v", len(messages), tt.replay)
+			}
+			for i, message := range messages {
+				if message.Seq != tt.replay[i] || message.IsBackfill {
+					t.Errorf("message %d = seq %d (backfill %v), want live seq %d", i, message.Seq, message.IsBackfill, tt.replay[i])
+				}
+			}
+		})
+	}
+
+	// A client that is not resuming gets the whole history as backfill.
+	if messages := h.replayFor(&Client{}); len(messages) != 5 || messages[0].Seq != 6 || !messages[0].IsBackfill {
+		t.Errorf("replay on connect = %+v, want 6 to 10 as backfill", messages)
+	}
+}
+
+func TestResumeOverWebSocket(t *testing.T) {
+	cfg := testConfig()
+	cfg.HistorySize = 5
+	h := startTestHub(t, cfg)
+	for i := 1; i <= 8; i++ {
+		messageType := "deadlock_event"
+		if i%2 == 0 {
+			messageType = "query_metrics"
+		}
+		h.publish(newMessage(messageType, map[string]interface{}{"n": i}))
+	}
+	h.publish(newMessage("marker", nil))
+	// Messages 5 to 9 are retained once the marker is in.
+	deadline := time.Now().Add(testReadTimeout)
+	for entries := h.history.since(time.Time{}); len(entries) == 0 || entries[len(entries)-1].message.Seq != 9; entries = h.history.since(time.Time{}) {
+		if time.Now().After(deadline) {
+			t.Fatal("the marker never reached the history")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"in range", "since=5", []string{"query_metrics 6", "deadlock_event 7", "query_metrics 8", "marker 9"}},
+		{"in range and filtered", "since=5&types=query_metrics", []string{"query_metrics 6", "query_metrics 8"}},
+		{"out of range", "since=2", []string{"resync_required 0"}},
+		{"fresh", "", []string{"backfill 5", "backfill 6", "backfill 7", "backfill 8", "backfill 9"}},
+		{"unparsable token", "since=soon", []string{"backfill 5", "backfill 6", "backfill 7", "backfill 8", "backfill 9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialTestHub(t, h, tt.query)
+			var got []string
+			for range tt.want {
+				message := readTestMessage(t, conn)
+				label := message.Type
+				if message.IsBackfill {
+					label = "backfill"
+				}
+				got = append(got, label+" "+strconv.FormatUint(message.Seq, 10))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("after connecting with %q got %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clusterHubDrainTimeout bounds how long a torn down cluster hub waits for
+// its last messages to reach clients.
+const clusterHubDrainTimeout = 5 * time.Second
+
+// HubRegistry keeps one Hub per cluster for a control plane that serves
+// several, so stream clients only see the cluster they ask for with
+// ?cluster=. The root hub serves the control plane's own cluster
+// (CLUSTER_ID) and metrics that name none; it owns ingestion, persistence,
+// forwarding and the alert webhook, which every cluster hub shares.
+//
+// Every aggregation and analyzer, deadlocks included, is the hub's own, so
+// one cluster's state never shows in another's. What is shared is either
+// keyed by cluster or cluster-neutral: the alert history files each alert
+// under its hub's cluster, the sink, recorder and upstream forwarder store
+// metrics that carry their cluster_id, and the suppress list, JWT verifier
+// and oversized payload store are configuration or addressed by unique id.
+// Webhook notifications are sent for every hub's broadcasts alike.
+//
+// Cluster hubs are created when a cluster first reports or is first asked
+// for, and torn down once they have had neither clients nor reporting pods
+// for two sweeps in a row. Client limits apply per hub.
+type HubRegistry struct {
+	root *Hub
+	max  int
+	// mu is held for reading while a cluster hub processes a metric or
+	// serves a request, so teardown never races either.
+	mu   sync.RWMutex
+	hubs map[string]*Hub
+	done chan struct{}
+}
+
+func newHubRegistry(root *Hub, maxClusters int) *HubRegistry {
+	return &HubRegistry{
+		root: root,
+		max:  maxClusters,
+		hubs: make(map[string]*Hub),
+		done: make(chan struct{}),
+	}
+}
+
+// isRoot reports whether a cluster id belongs to the root hub.
+func (r *HubRegistry) isRoot(cluster string) bool {
+	return cluster == "" || cluster == r.root.cfg.ClusterID
+}
+
+// acquire returns the hub for a cluster, creating it when create is set,
+// and holds r.mu for reading until release is called. It returns nil when
+// the cluster has no hub and none may be created.
+func (r *HubRegistry) acquire(cluster string, create bool) (*Hub, func()) {
+	if r.isRoot(cluster) {
+		return r.root, func() {}
+	}
+	for {
+		r.mu.RLock()
+		if hub, ok := r.hubs[cluster]; ok {
+			return hub, r.mu.RUnlock
+		}
+		r.mu.RUnlock()
+		if !create || !r.create(cluster) {
+			return nil, func() {}
+		}
+	}
+}
+
+// create starts a hub for a cluster unless the registry is full or
+// stopped. It reports whether the cluster has a hub.
+func (r *HubRegistry) create(cluster string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hubs[cluster]; ok {
+		return true
+	}
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+	if r.max > 0 && len(r.hubs) >= r.max {
+		slog.Warn("cluster limit reached, not creating hub", "cluster_id", cluster, "max_clusters", r.max)
+		return false
+	}
+
+	hub := newHub(r.root.cfg)
+	hub.sink = r.root.sink
+	hub.upstream = r.root.upstream
+	hub.webhook = r.root.webhook
+	hub.recorder = r.root.recorder
+	hub.alerts = r.root.alerts.forCluster(cluster)
+	hub.jwt = r.root.jwt
+	hub.oversized = r.root.oversized
+	hub.suppress = r.root.suppress
+	hub.start()
+	r.hubs[cluster] = hub
+	slog.Info("cluster hub created", "cluster_id", cluster, "cluster_count", len(r.hubs))
+	return true
+}
+
+// process hands a metric to its cluster's hub. Metrics from clusters past
+// MAX_CLUSTERS are processed by the root hub.
+func (r *HubRegistry) process(metric QueryMetrics) error {
+	hub, release := r.acquire(metric.ClusterID, true)
+	defer release()
+	if hub == nil {
+		hub = r.root
+	}
+	return hub.processMetric(metric)
+}
+
+// route serves a hub handler from the hub of the ?cluster= query parameter,
+// answering 404 for clusters without one.
+func (r *HubRegistry) route(handler func(*Hub, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		hub, release := r.acquire(req.URL.Query().Get("cluster"), false)
+		defer release()
+		if hub == nil {
+			http.Error(w, "Unknown cluster", http.StatusNotFound)
+			return
+		}
+		handler(hub, w, req)
+	}
+}
+
+// routeStream is route for stream endpoints, which create the cluster's
+// hub so clients can connect before the cluster first reports. SSE streams
+// last as long as the client stays, so the handler runs without holding
+// r.mu; a hub is only torn down after staying idle for two sweeps, long
+// after the client has registered.
+func (r *HubRegistry) routeStream(handler func(*Hub, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		hub, release := r.acquire(req.URL.Query().Get("cluster"), true)
+		release()
+		if hub == nil {
+			http.Error(w, "Too many clusters", http.StatusServiceUnavailable)
+			return
+		}
+		handler(hub, w, req)
+	}
+}
+
+// run tears down idle cluster hubs until the registry stops.
+func (r *HubRegistry) run() {
+	ticker := time.NewTicker(max(r.root.cfg.PodTTL/4, time.Second))
+	defer ticker.Stop()
+	idle := make(map[*Hub]bool)
+	for {
+		select {
+		case <-ticker.C:
+			idle = r.sweep(idle)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// sweep tears down the hubs that were idle at the previous sweep and still
+// are, and returns the hubs idle now.
+func (r *HubRegistry) sweep(wasIdle map[*Hub]bool) map[*Hub]bool {
+	idle := make(map[*Hub]bool)
+	var removed []*Hub
+	r.mu.Lock()
+	for cluster, hub := range r.hubs {
+		if hub.clientCount() > 0 || len(hub.pods.active()) > 0 {
+			continue
+		}
+		if !wasIdle[hub] {
+			idle[hub] = true
+			continue
+		}
+		delete(r.hubs, cluster)
+		removed = append(removed, hub)
+		slog.Info("cluster hub removed", "cluster_id", cluster, "cluster_count", len(r.hubs))
+	}
+	r.mu.Unlock()
+
+	for _, hub := range removed {
+		ctx, cancel := context.WithTimeout(context.Background(), clusterHubDrainTimeout)
+		hub.shutdown(ctx)
+		cancel()
+	}
+	return idle
+}
+
+// drain shuts the root hub down as Hub.drain does and then the cluster
+// hubs, once nothing can feed them any more.
+func (r *HubRegistry) drain(ctx context.Context) error {
+	close(r.done)
+	err := r.root.drain(ctx)
+
+	r.mu.Lock()
+	hubs := r.hubs
+	r.hubs = make(map[string]*Hub)
+	r.mu.Unlock()
+	for cluster, hub := range hubs {
+		if hubErr := hub.shutdown(ctx); hubErr != nil {
+			slog.Warn("timed out draining cluster hub", "cluster_id", cluster, "error", hubErr)
+			err = hubErr
+		}
+	}
+	return err
+}
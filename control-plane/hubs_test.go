@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestRegistry starts a root hub for cluster "home" whose pipeline
+// feeds a registry, as main wires them.
+func startTestRegistry(t *testing.T, cfg Config) *HubRegistry {
+	t.Helper()
+	cfg.ClusterID = "home"
+	root := newHub(cfg)
+	root.alerts = openTestAlertHistory(t, filepath.Join(t.TempDir(), "alerts.jsonl"), 100).forCluster(cfg.ClusterID)
+	registry := newHubRegistry(root, cfg.MaxClusters)
+	root.ingest = newIngestPipeline(cfg.IngestWorkers, cfg.IngestQueueSize, cfg.IngestSubmitTimeout, registry.process)
+	root.sink.start()
+	root.start()
+	root.ingest.start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		registry.drain(ctx)
+	})
+	return registry
+}
+
+// dialTestCluster connects a stream client through the registry to the
+// hub of cluster, and reads the connected message.
+func dialTestCluster(t *testing.T, registry *HubRegistry, cluster string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(registry.routeStream((*Hub).handleWebSocket))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?types=query_metrics,done&cluster=" + cluster
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial cluster %q: %v (response %v)", cluster, err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if message := readTestMessage(t, conn); message.Type != "connected" {
+		t.Fatalf("first message = %q, want connected", message.Type)
+	}
+	return conn
+}
+
+func TestClustersAreIsolated(t *testing.T) {
+	registry := startTestRegistry(t, testConfig())
+	conns := map[string]*websocket.Conn{
+		"home": dialTestCluster(t, registry, ""),
+		"east": dialTestCluster(t, registry, "east"),
+		"west": dialTestCluster(t, registry, "west"),
+	}
+
+	for cluster, podName := range map[string]string{"east": "pod-east", "west": "pod-west", "": "pod-home"} {
+		postTestMetric(t, registry.root, testMetric(podName, 10, func(m *QueryMetrics) { m.ClusterID = cluster }))
+	}
+
+	for cluster, conn := range conns {
+		hub, release := registry.acquire(cluster, false)
+		hub.publish(newMessage("done", nil))
+		release()
+
+		var pods []string
+		for {
+			message := readTestMessage(t, conn)
+			if message.Type == "done" {
+				break
+			}
+			pods = append(pods, message.Data.(map[string]interface{})["pod_name"].(string))
+		}
+		if want := "pod-" + cluster; len(pods) != 1 || pods[0] != want {
+			t.Errorf("cluster %s client got metrics from %v, want only %s", cluster, pods, want)
+		}
+	}
+
+	for _, cluster := range []string{"east", "west"} {
+		hub, release := registry.acquire(cluster, false)
+		if hub == nil || hub == registry.root {
+			t.Fatalf("cluster %s has no hub of its own", cluster)
+		}
+		if pods := hub.pods.active(); len(pods) != 1 || pods[0].PodName != "pod-"+cluster {
+			t.Errorf("cluster %s pods = %+v, want only its own", cluster, pods)
+		}
+		release()
+	}
+}
+
+func TestClusterHubsShareTheRootsServices(t *testing.T) {
+	registry := startTestRegistry(t, testConfig())
+	root := registry.root
+	hub, release := registry.acquire("east", true)
+	defer release()
+
+	// Ingestion goes through the root's pipeline only.
+	if hub.ingest != nil {
+		t.Error("cluster hub has a pipeline of its own, want nil")
+	}
+	if hub.sink != root.sink || hub.upstream != root.upstream || hub.webhook != root.webhook || hub.recorder != root.recorder {
+		t.Error("cluster hub does not share the root's sink and forwarders")
+	}
+	if hub.alerts == nil || hub.alerts.history != root.alerts.history || hub.alerts.cluster != "east" {
+		t.Errorf("cluster hub alerts = %+v, want the root's history filed under east", hub.alerts)
+	}
+	if hub.pods == root.pods || hub.deadlocks == root.deadlocks {
+		t.Error("cluster hub shares the root's aggregations, want its own")
+	}
+}
+
+func TestAlertsAreFiledPerCluster(t *testing.T) {
+	registry := startTestRegistry(t, testConfig())
+
+	// The same pod name deadlocks in two clusters.
+	postTestMetric(t, registry.root, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+	east := testDeadlock("pod-a", "PgConnection@a:PgConnection@b")
+	east.ClusterID = "east"
+	postTestMetric(t, registry.root, east)
+
+	for _, cluster := range []string{"home", "east"} {
+		hub, release := registry.acquire(cluster, false)
+		alerts := hub.alerts.query(time.Time{}, time.Time{}, "deadlock_event")
+		release()
+		if len(alerts) != 1 || alerts[0].ClusterID != cluster || alerts[0].PodName != "pod-a" {
+			t.Errorf("cluster %s alerts = %+v, want its own deadlock alert", cluster, alerts)
+		}
+	}
+
+	// Resolving one cluster's alert leaves the other's active.
+	history := registry.root.alerts.history
+	history.forCluster("east").resolve("deadlock_event", "pod-a")
+	if alerts := history.forCluster("home").query(time.Time{}, time.Time{}, ""); len(alerts) != 1 || alerts[0].ResolvedAt != nil {
+		t.Errorf("home alerts = %+v, want still active", alerts)
+	}
+	if alerts := history.forCluster("east").query(time.Time{}, time.Time{}, ""); len(alerts) != 1 || alerts[0].ResolvedAt == nil {
+		t.Errorf("east alerts = %+v, want resolved", alerts)
+	}
+
+	var none *alertHistory
+	if view := none.forCluster("east"); view != nil || view.forCluster("west") != nil {
+		t.Error("views of a nil history are not nil")
+	}
+	none.forCluster("east").fire("deadlock_event", "critical", "pod-a", "default", nil)
+}
+
+func TestIdleClusterHubsAreTornDown(t *testing.T) {
+	registry := startTestRegistry(t, testConfig())
+	_, release := registry.acquire("east", true)
+	release()
+
+	registered := func() bool {
+		hub, release := registry.acquire("east", false)
+		release()
+		return hub != nil
+	}
+
+	idle := registry.sweep(nil)
+	if len(idle) != 1 || !registered() {
+		t.Fatalf("first sweep marked %d hubs idle, want the hub marked but kept", len(idle))
+	}
+	registry.sweep(idle)
+	if registered() {
+		t.Error("hub still registered after two idle sweeps")
+	}
+}
+
+func TestClusterLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxClusters = 1
+	registry := startTestRegistry(t, cfg)
+	dialTestCluster(t, registry, "east")
+
+	// Metrics from a cluster past the limit are served by the root hub.
+	postTestMetric(t, registry.root, testMetric("pod-west", 10, func(m *QueryMetrics) { m.ClusterID = "west" }))
+	if pods := registry.root.pods.active(); len(pods) != 1 || pods[0].PodName != "pod-west" {
+		t.Errorf("root pods = %+v, want the overflow cluster's pod", pods)
+	}
+
+	server := httptest.NewServer(registry.routeStream((*Hub).handleWebSocket))
+	defer server.Close()
+	if resp, err := http.Get(server.URL + "/ws?cluster=north"); err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("stream for a new cluster past the limit = %v, %v, want 503", resp, err)
+	}
+	rec := httptest.NewRecorder()
+	registry.route((*Hub).podsHandler)(rec, httptest.NewRequest(http.MethodGet, "/api/pods?cluster=north", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status for an unknown cluster = %d, want 404", rec.Code)
+	}
+}
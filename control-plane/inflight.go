@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InFlightQuery is a query an agent reported as started but not yet as
+// completed.
+type InFlightQuery struct {
+	QueryID      string    `json:"query_id"`
+	PodName      string    `json:"pod_name"`
+	Namespace    string    `json:"namespace,omitempty"`
+	SQLPattern   string    `json:"sql_pattern,omitempty"`
+	SQLType      string    `json:"sql_type,omitempty"`
+	ConnectionID string    `json:"connection_id,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	AgeMs        int64     `json:"age_ms"`
+}
+
+// inFlightTracker pairs query_start events with the query_execution that
+// completes them. Queries still open after ttl are assumed lost, for example
+// because the pod restarted, and forgotten.
+type inFlightTracker struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	queries map[string]*InFlightQuery
+}
+
+func newInFlightTracker(ttl time.Duration) *inFlightTracker {
+	return &inFlightTracker{ttl: ttl, queries: make(map[string]*InFlightQuery)}
+}
+
+// inFlightKey scopes query ids to their pod, since agents only guarantee
+// uniqueness within one process.
+func inFlightKey(podName, queryID string) string {
+	return podName + "/" + queryID
+}
+
+func (t *inFlightTracker) start(metric QueryMetrics, now time.Time) {
+	query := &InFlightQuery{
+		QueryID:      metric.Data.QueryID,
+		PodName:      metric.PodName,
+		Namespace:    metric.Namespace,
+		SQLPattern:   metric.Data.SQLPattern,
+		SQLType:      metric.Data.SQLType,
+		ConnectionID: metric.Data.ConnectionID,
+		StartedAt:    now,
+	}
+	t.mu.Lock()
+	t.queries[inFlightKey(metric.PodName, metric.Data.QueryID)] = query
+	t.mu.Unlock()
+}
+
+func (t *inFlightTracker) complete(podName, queryID string) {
+	t.mu.Lock()
+	delete(t.queries, inFlightKey(podName, queryID))
+	t.mu.Unlock()
+}
+
+// forgetPod drops every query still open on the pod.
+func (t *inFlightTracker) forgetPod(podName string) {
+	t.mu.Lock()
+	for key, query := range t.queries {
+		if query.PodName == podName {
+			delete(t.queries, key)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// list expires queries open for longer than ttl and returns the rest, oldest
+// first, with their age at now.
+func (t *inFlightTracker) list(now time.Time) []InFlightQuery {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make([]InFlightQuery, 0, len(t.queries))
+	for key, query := range t.queries {
+		age := now.Sub(query.StartedAt)
+		if t.ttl > 0 && age > t.ttl {
+			slog.Debug("expired in-flight query", "pod_name", query.PodName, "query_id", query.QueryID)
+			delete(t.queries, key)
+			continue
+		}
+		entry := *query
+		entry.AgeMs = age.Milliseconds()
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result
+}
+
+// runInFlight broadcasts an in_flight_update per namespace every
+// InFlightInterval until the hub stops. A namespace whose last query
+// completed gets one update with an empty list so dashboards can clear it.
+func (h *Hub) runInFlight() {
+	ticker := time.NewTicker(h.cfg.InFlightInterval)
+	defer ticker.Stop()
+	previous := map[string]bool{}
+	for {
+		select {
+		case now := <-ticker.C:
+			byNamespace := make(map[string][]InFlightQuery)
+			for _, query := range h.inFlight.list(now) {
+				byNamespace[query.Namespace] = append(byNamespace[query.Namespace], query)
+			}
+			for namespace := range previous {
+				if _, ok := byNamespace[namespace]; !ok {
+					byNamespace[namespace] = []InFlightQuery{}
+				}
+			}
+			previous = make(map[string]bool, len(byNamespace))
+			for namespace, queries := range byNamespace {
+				if len(queries) > 0 {
+					previous[namespace] = true
+				}
+				if err := h.publish(newNamespacedMessage("in_flight_update", namespace, queries)); err != nil {
+					return
+				}
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// inFlightHandler serves GET /api/in-flight.
+func (h *Hub) inFlightHandler(w http.ResponseWriter, r *http.Request) {
+	queries := h.inFlight.list(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queries": queries,
+		"count":   len(queries),
+	})
+}
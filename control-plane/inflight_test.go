@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInFlightTrackerExpiresStuckQueries(t *testing.T) {
+	tracker := newInFlightTracker(time.Minute)
+	now := time.Now()
+	for _, query := range []struct {
+		podName, queryID string
+		age              time.Duration
+	}{
+		{"pod-a", "q-1", 2 * time.Minute},
+		{"pod-a", "q-2", 30 * time.Second},
+		{"pod-b", "q-2", 10 * time.Second},
+	} {
+		tracker.start(testMetric(query.podName, 0, func(m *QueryMetrics) {
+			m.EventType = "query_start"
+			m.Data.QueryID = query.queryID
+			m.Data.ExecutionTimeMs = nil
+		}), now.Add(-query.age))
+	}
+
+	queries := tracker.list(now)
+	if len(queries) != 2 {
+		t.Fatalf("list = %+v, want the two queries younger than the TTL", queries)
+	}
+	if queries[0].PodName != "pod-a" || queries[0].AgeMs != 30000 || queries[1].PodName != "pod-b" || queries[1].AgeMs != 10000 {
+		t.Errorf("list = %+v, want pod-a aged 30s then pod-b aged 10s", queries)
+	}
+	if len(tracker.queries) != 2 {
+		t.Errorf("tracker keeps %d queries, want the expired one forgotten", len(tracker.queries))
+	}
+}
+
+func TestInFlightTrackerCompletion(t *testing.T) {
+	tracker := newInFlightTracker(time.Minute)
+	now := time.Now()
+	for _, podName := range []string{"pod-a", "pod-b"} {
+		tracker.start(testMetric(podName, 0, func(m *QueryMetrics) {
+			m.EventType = "query_start"
+			m.Data.QueryID = "q-1"
+			m.Data.ExecutionTimeMs = nil
+		}), now)
+	}
+
+	// Query ids are only unique per pod.
+	tracker.complete("pod-a", "q-1")
+	if queries := tracker.list(now); len(queries) != 1 || queries[0].PodName != "pod-b" {
+		t.Errorf("list = %+v, want only pod-b's query", queries)
+	}
+	tracker.forgetPod("pod-b")
+	if queries := tracker.list(now); len(queries) != 0 {
+		t.Errorf("list = %+v, want nothing after the pod left", queries)
+	}
+}
+
+func TestInFlightEndpointAndUpdates(t *testing.T) {
+	cfg := testConfig()
+	cfg.InFlightInterval = 50 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=in_flight_update")
+
+	for _, queryID := range []string{"q-1", "q-2"} {
+		postTestMetric(t, h, testMetric("pod-a", 0, func(m *QueryMetrics) {
+			m.EventType = "query_start"
+			m.Data.QueryID = queryID
+			m.Data.ExecutionTimeMs = nil
+		}))
+	}
+	completed := testMetric("pod-a", 10)
+	completed.Data.QueryID = "q-1"
+	postTestMetric(t, h, completed)
+
+	rec := httptest.NewRecorder()
+	h.inFlightHandler(rec, httptest.NewRequest(http.MethodGet, "/api/in-flight", nil))
+	var body struct {
+		Queries []InFlightQuery `json:"queries"`
+		Count   int             `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || len(body.Queries) != 1 || body.Queries[0].QueryID != "q-2" {
+		t.Errorf("/api/in-flight = %+v, want only q-2", body)
+	}
+
+	update := readTestMessage(t, conn)
+	queries, _ := update.Data.([]interface{})
+	if update.Namespace != "default" || len(queries) != 1 {
+		t.Fatalf("in_flight_update = %+v, want q-2 for namespace default", update)
+	}
+
+	// Once the last query completes, one empty update clears the namespace.
+	completed.Data.QueryID = "q-2"
+	postTestMetric(t, h, completed)
+	for {
+		update = readTestMessage(t, conn)
+		if queries, _ := update.Data.([]interface{}); len(queries) == 0 {
+			break
+		}
+	}
+	if update.Namespace != "default" {
+		t.Errorf("empty update for namespace %q, want default", update.Namespace)
+	}
+}
@@ -0,0 +1,150 @@
+// Streaming metric ingestion for agents that send more than the HTTP API
+// comfortably handles. Fields mirror the JSON accepted on /api/metrics.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ingestpb/ingest.proto
+
+package ingestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MetricIngest_SendMetrics_FullMethodName = "/kubedb.monitor.ingest.v1.MetricIngest/SendMetrics"
+)
+
+// MetricIngestClient is the client API for MetricIngest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MetricIngestClient interface {
+	// SendMetrics accepts metrics until the agent closes the stream, then
+	// reports how many were accepted and rejected.
+	SendMetrics(ctx context.Context, opts ...grpc.CallOption) (MetricIngest_SendMetricsClient, error)
+}
+
+type metricIngestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMetricIngestClient(cc grpc.ClientConnInterface) MetricIngestClient {
+	return &metricIngestClient{cc}
+}
+
+func (c *metricIngestClient) SendMetrics(ctx context.Context, opts ...grpc.CallOption) (MetricIngest_SendMetricsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MetricIngest_ServiceDesc.Streams[0], MetricIngest_SendMetrics_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricIngestSendMetricsClient{stream}
+	return x, nil
+}
+
+type MetricIngest_SendMetricsClient interface {
+	Send(*QueryMetric) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type metricIngestSendMetricsClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricIngestSendMetricsClient) Send(m *QueryMetric) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *metricIngestSendMetricsClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MetricIngestServer is the server API for MetricIngest service.
+// All implementations must embed UnimplementedMetricIngestServer
+// for forward compatibility
+type MetricIngestServer interface {
+	// SendMetrics accepts metrics until the agent closes the stream, then
+	// reports how many were accepted and rejected.
+	SendMetrics(MetricIngest_SendMetricsServer) error
+	mustEmbedUnimplementedMetricIngestServer()
+}
+
+// UnimplementedMetricIngestServer must be embedded to have forward compatible implementations.
+type UnimplementedMetricIngestServer struct {
+}
+
+func (UnimplementedMetricIngestServer) SendMetrics(MetricIngest_SendMetricsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SendMetrics not implemented")
+}
+func (UnimplementedMetricIngestServer) mustEmbedUnimplementedMetricIngestServer() {}
+
+// UnsafeMetricIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MetricIngestServer will
+// result in compilation errors.
+type UnsafeMetricIngestServer interface {
+	mustEmbedUnimplementedMetricIngestServer()
+}
+
+func RegisterMetricIngestServer(s grpc.ServiceRegistrar, srv MetricIngestServer) {
+	s.RegisterService(&MetricIngest_ServiceDesc, srv)
+}
+
+func _MetricIngest_SendMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricIngestServer).SendMetrics(&metricIngestSendMetricsServer{stream})
+}
+
+type MetricIngest_SendMetricsServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*QueryMetric, error)
+	grpc.ServerStream
+}
+
+type metricIngestSendMetricsServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricIngestSendMetricsServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *metricIngestSendMetricsServer) Recv() (*QueryMetric, error) {
+	m := new(QueryMetric)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MetricIngest_ServiceDesc is the grpc.ServiceDesc for MetricIngest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MetricIngest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kubedb.monitor.ingest.v1.MetricIngest",
+	HandlerType: (*MetricIngestServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendMetrics",
+			Handler:       _MetricIngest_SendMetrics_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingestpb/ingest.proto",
+}
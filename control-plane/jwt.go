@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefresh bounds how long fetched signing keys are trusted, and
+// jwksMinRefetch how often an unknown key id may trigger a refetch.
+const (
+	jwksRefresh    = time.Hour
+	jwksMinRefetch = 30 * time.Second
+)
+
+var (
+	errTokenMissing   = errors.New("missing token")
+	errTokenMalformed = errors.New("malformed token")
+	errTokenSignature = errors.New("invalid token signature")
+	errTokenExpired   = errors.New("token expired")
+)
+
+// streamClaims are the JWT claims honoured on /ws and /api/stream.
+// Namespaces, when set, limits the client to those namespaces.
+type streamClaims struct {
+	Subject    string   `json:"sub"`
+	Role       string   `json:"role"`
+	Namespaces []string `json:"namespaces"`
+	ExpiresAt  *int64   `json:"exp"`
+	NotBefore  *int64   `json:"nbf"`
+}
+
+// jwtVerifier validates HS256 tokens against a shared secret and RS256 tokens
+// against the keys published at a JWKS URL.
+type jwtVerifier struct {
+	secret []byte
+	jwks   *jwksCache
+}
+
+// newJWTVerifier returns nil when neither a secret nor a JWKS URL is
+// configured, which leaves the streams open.
+func newJWTVerifier(secret, jwksURL string) *jwtVerifier {
+	if secret == "" && jwksURL == "" {
+		return nil
+	}
+	verifier := &jwtVerifier{secret: []byte(secret)}
+	if jwksURL != "" {
+		verifier.jwks = &jwksCache{url: jwksURL, client: &http.Client{Timeout: 5 * time.Second}}
+	}
+	return verifier
+}
+
+// bearerToken returns the token from the Authorization header or, since
+// browsers cannot set headers on WebSocket upgrades, the token query
+// parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+func (v *jwtVerifier) verify(token string, now time.Time) (*streamClaims, error) {
+	if token == "" {
+		return nil, errTokenMissing
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errTokenMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errTokenMalformed
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && len(v.secret) > 0:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errTokenSignature
+		}
+	case header.Alg == "RS256" && v.jwks != nil:
+		key, err := v.jwks.key(header.Kid, now)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errTokenSignature
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims streamClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errTokenMalformed
+	}
+	if claims.ExpiresAt != nil && now.Unix() >= *claims.ExpiresAt {
+		return nil, errTokenExpired
+	}
+	if claims.NotBefore != nil && now.Unix() < *claims.NotBefore {
+		return nil, errors.New("token not yet valid")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// jwksCache holds the RSA keys published at a JWKS URL by key id.
+type jwksCache struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func (c *jwksCache) key(kid string, now time.Time) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	stale := now.Sub(c.fetched) > jwksRefresh
+	if (!ok || stale) && now.Sub(c.fetched) > jwksMinRefetch {
+		keys, err := c.fetch()
+		if err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, fmt.Errorf("fetch jwks: %w", err)
+		}
+		c.keys, c.fetched = keys, now
+		key, ok = keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch loads the key set. Callers hold c.mu.
+func (c *jwksCache) fetch() (map[string]*rsa.PublicKey, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// allows reports whether the claims permit watching namespace. An empty
+// namespace is always allowed; the client then sees every namespace its
+// token grants.
+func (c *streamClaims) allows(namespace string) bool {
+	if len(c.Namespaces) == 0 {
+		return true
+	}
+	for _, allowed := range c.Namespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return namespace == ""
+}
+
+// authorizeStream validates the request's token when stream authentication
+// is configured. It answers the request itself and returns false when the
+// client is refused; the claims are nil when authentication is off.
+func (h *Hub) authorizeStream(w http.ResponseWriter, r *http.Request) (*streamClaims, bool) {
+	if h.jwt == nil {
+		return nil, true
+	}
+	claims, err := h.jwt.verify(bearerToken(r), time.Now())
+	if err != nil {
+		slog.Warn("rejected stream client: invalid token", "remote_addr", r.RemoteAddr, "error", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return nil, false
+	}
+	if namespace := r.URL.Query().Get("namespace"); !claims.allows(namespace) {
+		slog.Warn("rejected stream client: namespace not allowed", "remote_addr", r.RemoteAddr,
+			"subject", claims.Subject, "namespace", namespace)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return nil, false
+	}
+	slog.Debug("stream client authenticated", "remote_addr", r.RemoteAddr, "subject", claims.Subject, "role", claims.Role)
+	return claims, true
+}
+
+// applyClaims attaches the token's role and namespace restriction to the
+// client. It is a no-op without claims.
+func (c *Client) applyClaims(claims *streamClaims) {
+	if claims == nil {
+		return
+	}
+	c.role = claims.Role
+	if len(claims.Namespaces) > 0 {
+		c.allowedNamespaces = make(map[string]bool, len(claims.Namespaces))
+		for _, namespace := range claims.Namespaces {
+			c.allowedNamespaces[namespace] = true
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "test-secret"
+
+// encodeTestSegment encodes a JWT header or claims segment.
+func encodeTestSegment(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// signTestToken returns an HS256 token for claims.
+func signTestToken(secret string, claims map[string]interface{}) string {
+	signed := encodeTestSegment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeTestSegment(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHS256Tokens(t *testing.T) {
+	verifier := newJWTVerifier(testJWTSecret, "")
+	now := time.Now()
+	valid := signTestToken(testJWTSecret, map[string]interface{}{"sub": "dashboard", "role": "viewer", "exp": now.Add(time.Hour).Unix()})
+	// The valid token's signature over escalated claims.
+	segments := strings.Split(valid, ".")
+	tampered := segments[0] + "." + encodeTestSegment(map[string]interface{}{"sub": "dashboard", "role": "admin", "exp": now.Add(time.Hour).Unix()}) + "." + segments[2]
+
+	tests := []struct {
+		name  string
+		token string
+		want  error // nil for a valid token
+	}{
+		{"valid", valid, nil},
+		{"no expiry", signTestToken(testJWTSecret, map[string]interface{}{"sub": "dashboard"}), nil},
+		{"missing", "", errTokenMissing},
+		{"expired", signTestToken(testJWTSecret, map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), errTokenExpired},
+		{"wrong secret", signTestToken("other-secret", map[string]interface{}{"sub": "dashboard"}), errTokenSignature},
+		{"tampered", tampered, errTokenSignature},
+		{"malformed", "not-a-token", errTokenMalformed},
+	}
+	for _, tt := range tests {
+		claims, err := verifier.verify(tt.token, now)
+		if tt.want == nil && (err != nil || claims.Subject != "dashboard") {
+			t.Errorf("%s: verify = %+v, %v, want the dashboard claims", tt.name, claims, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: verify error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := verifier.verify(signTestToken(testJWTSecret, map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}), now); err == nil {
+		t.Error("token that is not yet valid was accepted")
+	}
+	if newJWTVerifier("", "") != nil {
+		t.Error("verifier without a secret or JWKS URL is not nil")
+	}
+}
+
+func TestVerifyRS256TokensFromJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+
+	sign := func(kid string) string {
+		signed := encodeTestSegment(map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeTestSegment(map[string]string{"sub": "dashboard"})
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	verifier := newJWTVerifier("", jwks.URL)
+	if claims, err := verifier.verify(sign("key-1"), time.Now()); err != nil || claims.Subject != "dashboard" {
+		t.Errorf("verify = %+v, %v, want the dashboard claims", claims, err)
+	}
+	if _, err := verifier.verify(sign("key-2"), time.Now()); err == nil {
+		t.Error("token signed with an unknown key id was accepted")
+	}
+	// HS256 is refused when only a JWKS URL is configured.
+	if _, err := verifier.verify(signTestToken(testJWTSecret, nil), time.Now()); err == nil {
+		t.Error("HS256 token was accepted without a secret")
+	}
+}
+
+func TestWebSocketRequiresValidToken(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	h.jwt = newJWTVerifier(testJWTSecret, "")
+	teamA := signTestToken(testJWTSecret, map[string]interface{}{"sub": "dashboard", "namespaces": []string{"team-a"}})
+	expired := signTestToken(testJWTSecret, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+
+	tests := []struct {
+		name   string
+		query  string
+		header http.Header
+		status int // 0 when the upgrade succeeds
+	}{
+		{"missing", "", nil, http.StatusUnauthorized},
+		{"expired", "token=" + expired, nil, http.StatusUnauthorized},
+		{"query parameter", "token=" + teamA, nil, 0},
+		{"authorization header", "", http.Header{"Authorization": {"Bearer " + teamA}}, 0},
+		{"allowed namespace", "namespace=team-a&token=" + teamA, nil, 0},
+		{"other namespace", "namespace=team-b&token=" + teamA, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		conn, resp, err := dialTestHubWithHeader(t, h, tt.query, tt.header)
+		if tt.status == 0 {
+			if err != nil {
+				t.Errorf("%s: dial = %v, want the upgrade to succeed", tt.name, err)
+			} else if message := readTestMessage(t, conn); message.Type != "connected" {
+				t.Errorf("%s: first message = %s, want connected", tt.name, message.Type)
+			}
+			continue
+		}
+		if err == nil || resp == nil || resp.StatusCode != tt.status {
+			t.Errorf("%s: dial = %v (response %v), want %d", tt.name, err, resp, tt.status)
+		}
+	}
+}
+
+func TestTokenNamespacesLimitBroadcasts(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	h.jwt = newJWTVerifier(testJWTSecret, "")
+	token := signTestToken(testJWTSecret, map[string]interface{}{"namespaces": []string{"team-a"}})
+	conn, _, err := dialTestHubWithHeader(t, h, "types=query_metrics,tps_update&token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readTestMessageOfType(t, conn, "connected")
+
+	for _, namespace := range []string{"team-b", "team-a"} {
+		metric := testMetric("pod-"+namespace, 10)
+		metric.Namespace = namespace
+		postTestMetric(t, h, metric)
+	}
+	if message := readTestMessage(t, conn); message.Type != "query_metrics" || message.Namespace != "team-a" {
+		t.Errorf("message = %s from %q, want only team-a's query_metrics", message.Type, message.Namespace)
+	}
+	// Rates are split by namespace, so team-b's pods are not revealed either.
+	tps := readTestMessageOfType(t, conn, "tps_update")
+	rates := tps.Data.(map[string]interface{})
+	if tps.Namespace != "team-a" || len(rates) != 1 || rates["pod-team-a"] == nil {
+		t.Errorf("tps_update = %q %v, want pod-team-a only", tps.Namespace, rates)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaReader is the part of *kafka.Reader the consumer uses.
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// KafkaConsumer ingests metrics from a Kafka topic. A message's offset is
+// only committed once its metrics have been processed, so metrics still in
+// flight at a crash are redelivered on restart.
+type KafkaConsumer struct {
+	hub    *Hub
+	reader kafkaReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newKafkaConsumer(h *Hub, reader kafkaReader) *KafkaConsumer {
+	return &KafkaConsumer{hub: h, reader: reader, done: make(chan struct{})}
+}
+
+// startKafkaConsumer consumes topic from the comma-separated brokers as the
+// kubedb-monitor-control-plane consumer group.
+func startKafkaConsumer(h *Hub, brokers, topic string) *KafkaConsumer {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: strings.Split(brokers, ","),
+		Topic:   topic,
+		GroupID: "kubedb-monitor-control-plane",
+	})
+	consumer := newKafkaConsumer(h, reader)
+	consumer.start()
+	slog.Info("consuming metrics from kafka", "brokers", brokers, "topic", topic)
+	return consumer
+}
+
+func (c *KafkaConsumer) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(ctx)
+}
+
+func (c *KafkaConsumer) run(ctx context.Context) {
+	defer close(c.done)
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("failed to fetch kafka message", "error", err)
+			}
+			return
+		}
+		if !c.process(ctx, msg) {
+			return
+		}
+		if err := c.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			slog.Error("failed to commit kafka offset", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		}
+		kafkaConsumerLagGauge.Set(float64(c.reader.Stats().Lag))
+	}
+}
+
+// process ingests one message, retrying from the first metric not yet
+// accepted while the pipeline is backed up. A metric that fails to process
+// is logged and skipped, as it would fail again and stall the partition. It
+// returns false if the consumer is stopping before the message went
+// through, in which case its offset must not be committed.
+func (c *KafkaConsumer) process(ctx context.Context, msg kafka.Message) bool {
+	next := 0
+	for {
+		stopped, err := c.hub.ingestPayloadFrom(msg.Value, "kafka", next, true)
+		if err == nil {
+			return true
+		}
+		next = stopped
+		if ctx.Err() != nil || errors.Is(err, errPipelineClosed) || errors.Is(err, errHubClosed) {
+			return false
+		}
+		if !errors.Is(err, errQueueFull) {
+			slog.Error("failed to ingest kafka metric", "partition", msg.Partition, "offset", msg.Offset,
+				"index", stopped, "error", err)
+			next++
+			continue
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// stop finishes the message being processed and closes the reader. It must
+// run before the ingestion pipeline is stopped.
+func (c *KafkaConsumer) stop() {
+	c.cancel()
+	<-c.done
+	if err := c.reader.Close(); err != nil {
+		slog.Warn("failed to close kafka reader", "error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeKafkaReader hands out queued messages and records commits.
+type fakeKafkaReader struct {
+	messages chan kafka.Message
+	mu       sync.Mutex
+	commits  []int64
+	closed   bool
+}
+
+func newFakeKafkaReader(values ...string) *fakeKafkaReader {
+	reader := &fakeKafkaReader{messages: make(chan kafka.Message, len(values))}
+	for i, value := range values {
+		reader.messages <- kafka.Message{Offset: int64(i), Value: []byte(value)}
+	}
+	return reader
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeKafkaReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		r.commits = append(r.commits, msg.Offset)
+	}
+	return nil
+}
+
+func (r *fakeKafkaReader) Stats() kafka.ReaderStats {
+	return kafka.ReaderStats{Lag: 7}
+}
+
+func (r *fakeKafkaReader) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *fakeKafkaReader) committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.commits...)
+}
+
+// waitForCommits waits until reader has committed n offsets.
+func waitForCommits(t *testing.T, reader *fakeKafkaReader, n int) []int64 {
+	t.Helper()
+	deadline := time.Now().Add(testReadTimeout)
+	for len(reader.committed()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("committed %v, want %d offsets", reader.committed(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return reader.committed()
+}
+
+// recordingTestHub returns a hub whose pipeline records the execution time
+// of each processed metric instead of processing it, failing those in fail.
+func recordingTestHub(t *testing.T, fail ...int64) (*Hub, func() []int64) {
+	t.Helper()
+	var mu sync.Mutex
+	var processed []int64
+	h := newHub(testConfig())
+	h.ingest = newIngestPipeline(1, 16, time.Second, func(metric QueryMetrics) error {
+		mu.Lock()
+		defer mu.Unlock()
+		value := *metric.Data.ExecutionTimeMs
+		processed = append(processed, value)
+		for _, failing := range fail {
+			if value == failing {
+				return errors.New("processing failed")
+			}
+		}
+		return nil
+	})
+	h.ingest.start()
+	t.Cleanup(h.ingest.stop)
+	return h, func() []int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int64(nil), processed...)
+	}
+}
+
+func TestKafkaConsumerCommitsAfterProcessing(t *testing.T) {
+	h, processed := recordingTestHub(t)
+	reader := newFakeKafkaReader(
+		testBatch(t, testMetric("pod-a", 1), testMetric("pod-a", 2)),
+		`{"event_type":`,
+		testBatch(t, testMetric("pod-a", 3)),
+	)
+	consumer := newKafkaConsumer(h, reader)
+	consumer.start()
+
+	commits := waitForCommits(t, reader, 3)
+	consumer.stop()
+
+	// The undecodable message is dead-lettered and committed, not retried.
+	if len(commits) != 3 || commits[0] != 0 || commits[1] != 1 || commits[2] != 2 {
+		t.Errorf("commits = %v, want offsets 0, 1, 2", commits)
+	}
+	if got := processed(); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("processed = %v, want 1, 2, 3", got)
+	}
+	var lag dto.Metric
+	kafkaConsumerLagGauge.Write(&lag)
+	if lag.GetGauge().GetValue() != 7 {
+		t.Errorf("lag gauge = %v, want 7", lag.GetGauge().GetValue())
+	}
+	if !reader.closed {
+		t.Error("stop did not close the reader")
+	}
+}
+
+func TestKafkaConsumerSkipsFailedMetricOnce(t *testing.T) {
+	h, processed := recordingTestHub(t, 2)
+	reader := newFakeKafkaReader(testBatch(t, testMetric("pod-a", 1), testMetric("pod-a", 2), testMetric("pod-a", 3)))
+	consumer := newKafkaConsumer(h, reader)
+	consumer.start()
+
+	waitForCommits(t, reader, 1)
+	consumer.stop()
+
+	// Processing resumes after the failed metric without resubmitting the
+	// ones before it.
+	if got := processed(); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("processed = %v, want each metric once", got)
+	}
+}
+
+func TestIngestPayloadFromResumesAtSkip(t *testing.T) {
+	h := newHub(testConfig())
+	h.ingest, _ = blockedTestPipeline(t, 50*time.Millisecond)
+
+	// A retry skips the metrics an earlier attempt already submitted and
+	// reports where it stopped.
+	batch := testBatch(t, testMetric("pod-a", 3), testMetric("pod-a", 4), testMetric("pod-a", 5))
+	if stopped, err := h.ingestPayloadFrom([]byte(batch), "kafka", 1, true); stopped != 1 || !errors.Is(err, errQueueFull) {
+		t.Errorf("ingestPayloadFrom = %d, %v, want errQueueFull at 1", stopped, err)
+	}
+}
+
+func TestKafkaConsumerDoesNotCommitWhileBackedUp(t *testing.T) {
+	h := newHub(testConfig())
+	pipeline, unblock := blockedTestPipeline(t, 50*time.Millisecond)
+	h.ingest = pipeline
+
+	reader := newFakeKafkaReader(testBatch(t, testMetric("pod-a", 3)))
+	consumer := newKafkaConsumer(h, reader)
+	consumer.start()
+	time.Sleep(100 * time.Millisecond)
+	// Stopping while the queue is still full leaves the offset uncommitted,
+	// so the message is redelivered on restart.
+	consumer.stop()
+	if commits := reader.committed(); len(commits) != 0 {
+		t.Errorf("commits = %v, want none for a message not ingested", commits)
+	}
+	unblock()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logBuffer collects log output written from any goroutine.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends slog's default logger to a buffer until the test ends.
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	logs := &logBuffer{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return logs
+}
+
+// findLogRecord returns the first JSON log record with msg.
+func findLogRecord(t *testing.T, logs *logBuffer, msg string) map[string]interface{} {
+	t.Helper()
+	scanner := bufio.NewScanner(strings.NewReader(logs.String()))
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("log line is not JSON: %s", scanner.Text())
+		}
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	t.Fatalf("no %q log record in:\n%s", msg, logs)
+	return nil
+}
+
+func TestDecodeFailureIsLoggedWithFields(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	logs := captureLogs(t)
+
+	if rec := postTestBody(h, `{"event_type": "query_execution",`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	record := findLogRecord(t, logs, "failed to decode metrics")
+	if record["level"] != "WARN" || record["remote_addr"] == nil || record["error"] == nil || record["batch"] != false {
+		t.Errorf("log record = %v, want WARN with remote_addr, error and batch", record)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  slog.Level
+		ok    bool
+	}{
+		{"", slog.LevelInfo, true},
+		{"debug", slog.LevelDebug, true},
+		{" WARN ", slog.LevelWarn, true},
+		{"warning", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"verbose", slog.LevelInfo, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseLogLevel(tt.value); got != tt.want || ok != tt.ok {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"github.com/rs/cors"
 )
 
 type QueryMetrics struct {
@@ -25,6 +32,16 @@ type QueryMetrics struct {
 	Data      *QueryData             `json:"data,omitempty"`
 	Context   *ExecutionContext      `json:"context,omitempty"`
 	Metrics   *SystemMetrics         `json:"metrics,omitempty"`
+	// ClusterID and Region identify the cluster the metric came from. The
+	// control plane fills them from CLUSTER_ID and REGION when the agent
+	// leaves them empty.
+	ClusterID string `json:"cluster_id,omitempty"`
+	Region    string `json:"region,omitempty"`
+	// ClockSkew marks a metric whose timestamp was too far from server
+	// time and was replaced with the receive time; AgentTimestamp keeps
+	// the one the agent sent.
+	ClockSkew      bool   `json:"clock_skew,omitempty"`
+	AgentTimestamp string `json:"agent_timestamp,omitempty"`
 }
 
 type QueryData struct {
@@ -49,6 +66,25 @@ type QueryData struct {
 	TransactionId         *string  `json:"transaction_id,omitempty"`         // For transaction events
 	DeadlockDuration      *int64   `json:"deadlock_duration,omitempty"`      // For deadlock events
 	DeadlockConnections   *string  `json:"deadlock_connections,omitempty"`   // For deadlock events
+	TransactionOutcome    string   `json:"transaction_outcome,omitempty"`    // "commit" or "rollback" for completed transaction events
+	// WaitForEdges is the wait-for graph of a deadlock when the agent can
+	// report it; without it the lock chain is inferred from connection order.
+	WaitForEdges []WaitForEdge `json:"wait_for_edges,omitempty"`
+}
+
+// WaitForEdge is one agent-reported wait-for relation: Waiter is blocked on
+// a lock of LockType on Resource held by Holder. Holder and Waiter name
+// connections as they appear in deadlock_connections.
+type WaitForEdge struct {
+	Holder   string `json:"holder"`
+	Waiter   string `json:"waiter"`
+	Resource string `json:"resource,omitempty"`
+	LockType string `json:"lock_type,omitempty"`
+}
+
+// failed reports whether the agent marked the query as unsuccessful.
+func (d *QueryData) failed() bool {
+	return strings.EqualFold(d.Status, "ERROR") || d.ErrorMessage != ""
 }
 
 type ExecutionContext struct {
@@ -76,25 +112,175 @@ type WebSocketMessage struct {
 	Type      string      `json:"type"`
 	Data      interface{} `json:"data"`
 	Timestamp string      `json:"timestamp"`
+	// IsBackfill marks retained messages replayed on subscribe.
+	IsBackfill bool `json:"is_backfill,omitempty"`
+	// Version is the envelope version, so dashboards can detect shapes
+	// they do not understand.
+	Version string `json:"version"`
+	// Seq numbers broadcasts in the order the hub sent them, so clients
+	// can detect gaps; numbering spans all types, so a filtered client
+	// also skips the numbers of types it did not subscribe to. Direct
+	// replies carry no sequence number.
+	Seq uint64 `json:"seq,omitempty"`
+	// Namespace is the namespace of the pod the message is about, used to
+	// scope /ws?namespace= clients. Cluster-wide messages leave it empty.
+	Namespace string `json:"namespace,omitempty"`
+	// AckID is set on messages the client asked to acknowledge with
+	// /ws?ack=; it is the id to send back in an ack control message.
+	AckID uint64 `json:"ack_id,omitempty"`
+	// queuedAt is when the hub queued a broadcast for a client; writePump
+	// skips it once it is older than WS_MESSAGE_TTL. Direct replies leave
+	// it zero and never expire.
+	queuedAt time.Time
+}
+
+// newMessage builds an outbound message stamped with the current time and
+// envelope version. Every message sent to clients is created through it.
+func newMessage(messageType string, data interface{}) WebSocketMessage {
+	return WebSocketMessage{
+		Type:      messageType,
+		Data:      data,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Version:   messageVersion,
+	}
+}
+
+// newNamespacedMessage builds a message about a pod in namespace, delivered
+// only to clients watching all namespaces or that one.
+func newNamespacedMessage(messageType, namespace string, data interface{}) WebSocketMessage {
+	message := newMessage(messageType, data)
+	message.Namespace = namespace
+	return message
 }
 
 type Hub struct {
+	cfg        Config
 	clients    map[*Client]bool
 	broadcast  chan WebSocketMessage
+	reply      chan clientMessage
+	subscribe  chan subscription
 	register   chan *Client
 	unregister chan *Client
+	admit      chan admission
+	inspect    chan chan []ClientInfo
+	release    chan string
+	// admissions enforces MAX_CLIENTS and MAX_CLIENTS_PER_IP. It is only
+	// touched by the hub goroutine.
+	admissions *admissionCounts
+
+	// mu guards closing. Senders hold it for reading while writing to
+	// broadcast so the channel cannot be closed underneath them.
+	mu      sync.RWMutex
+	closing bool
+	// done is closed once run has returned.
+	done chan struct{}
+	// running is set while run is processing messages.
+	running atomic.Bool
+	// connected mirrors len(clients) for readers outside the hub goroutine.
+	connected atomic.Int64
+	// state is held for reading while a metric is applied to the
+	// aggregations and for writing by snapshot, so a snapshot never sees
+	// a metric half applied.
+	state sync.RWMutex
+	// writers counts running writePumps and SSE streams. It is only
+	// incremented by run, so waiting on it after done is closed is safe.
+	writers sync.WaitGroup
+	// seq is the sequence number of the last broadcast. It is only
+	// touched by the hub goroutine.
+	seq uint64
+
+	// alerts is nil unless alert history persistence is enabled.
+	alerts  *clusterAlerts
+	slowest *slowestQueries
+	latest  *latestQueries
+	system  *systemMetricsDecimator
+	history *messageHistory
+	cpu     *cpuTracker
+	heap    *thresholdMonitor
+	pool    *thresholdMonitor
+	// oversized holds outbound messages that exceeded the size limit.
+	oversized *payloadStore
+	deadlocks *deadlockStore
+	endpoints *endpointAggregator
+	recent    *metricStore
+	// ingest is the root hub's pipeline, which feeds every cluster hub
+	// through HubRegistry.process; it is nil on cluster hubs.
+	ingest *ingestPipeline
+	// queryStats groups executions by normalized SQL pattern.
+	queryStats *queryStatsAggregator
+	// patterns caches the fingerprints of recently seen SQL statements.
+	patterns *fingerprintCache
+	// tables keeps execution time histograms per table.
+	tables *tableLatencyTracker
+	// limiter is nil unless ingestion rate limiting is enabled.
+	limiter *ingestLimiter
+	// txns follows open transactions for long_transaction_warning.
+	txns *transactionTracker
+	// recorder is nil unless RECORD_FILE is set.
+	recorder *metricRecorder
+	// signatures counts recurring deadlock shapes.
+	signatures *signatureTracker
+	// dedup drops repeat reports of a deadlock that was just broadcast.
+	dedup *deadlockDeduper
+	// tps counts query executions per pod for tps_update broadcasts.
+	tps *tpsTracker
+	// sink persists every processed metric in the background.
+	sink *sinkWriter
+	// pods lists the pods that are actively reporting.
+	pods *podRegistry
+	// dlq keeps recent rejected metrics and undelivered broadcasts.
+	dlq *deadLetters
+	// errRates follows each pod's share of failed query executions.
+	errRates *errorRateTracker
+	// events counts processed metrics per event type for /api/stats/events.
+	events *eventCounters
+	// complexity keeps the most complex SQL patterns seen.
+	complexity *complexQueryTracker
+	// mutations keeps the UPDATEs and DELETEs that touched the most rows.
+	mutations *massMutationTracker
+	// anomalies follows each SQL pattern's execution times for
+	// anomaly_detected.
+	anomalies *anomalyDetector
+	// suppress lists the SQL patterns whose executions are not broadcast.
+	suppress *suppressList
+	// poolTrend forecasts connection pool exhaustion from usage trends.
+	poolTrend *poolForecaster
+	// contention scores how often each table is caught up in lock waits.
+	contention *contentionTracker
+	// txOutcomes follows each pod's share of rolled back transactions, and
+	// ratios holds the ratio updates not yet broadcast.
+	txOutcomes *errorRateTracker
+	ratios     *ratioUpdates
+	// jwt is nil unless stream authentication is configured.
+	jwt *jwtVerifier
+	// webhook is nil unless ALERT_WEBHOOK_URL is set.
+	webhook *alertWebhook
+	// upstream is nil unless UPSTREAM_WS_URL is set.
+	upstream *upstreamForwarder
+	// inFlight lists queries that started but have not completed.
+	inFlight *inFlightTracker
+	// sim is nil unless ENABLE_SIMULATOR is set.
+	sim *simulator
 }
 
 // createDeadlockMessage creates a dashboard-compatible deadlock message
-func createDeadlockMessage(metric QueryMetrics) WebSocketMessage {
+func createDeadlockMessage(metric QueryMetrics, cfg Config) WebSocketMessage {
 	// Extract connection information from deadlock_connections field
 	connections := ""
 	if metric.Data.DeadlockConnections != nil {
 		connections = *metric.Data.DeadlockConnections
 	}
 	
-	// Parse connections to create participants
-	participants := parseConnectionsToParticipants(connections)
+	// Parse connections to create participants. The reporting connection's
+	// own transaction age is known from the metric itself.
+	knownCosts := map[string]int64{}
+	if metric.Data.ConnectionID != "" && metric.Data.TransactionDuration != nil {
+		knownCosts[metric.Data.ConnectionID] = *metric.Data.TransactionDuration
+	}
+	participants := parseConnectionsToParticipants(connections, knownCosts)
+	edges := deadlockEdges(metric.Data.WaitForEdges, participants)
+	cycle := cycleLength(edges)
+	severity := deadlockSeverity(metric.Data.DeadlockDuration, cycle, cfg.DeadlockWarnDuration, cfg.DeadlockWarnParticipants)
 	
 	// Create deadlock event data in the format expected by dashboard
 	// Include pod name and transaction ID in the unique identifier to avoid duplicates
@@ -112,25 +298,26 @@ func createDeadlockMessage(metric QueryMetrics) WebSocketMessage {
 		"id":             uniqueId,
 		"participants":   participants,
 		"detectionTime":  time.Now().Format(time.RFC3339),
-		"recommendedVictim": "connection-1",
-		"lockChain":      createLockChain(participants),
-		"severity":       "critical",
+		"recommendedVictim": recommendVictim(participants),
+		"lockChain":      createLockChain(edges),
+		"lockEdges":      edges,
+		"severity":       severity,
 		"status":         "active",
 		"pod_name":       metric.PodName,
 		"namespace":      "production",
-		"cycleLength":    len(participants),
+		"cycleLength":    cycle,
 		"duration_ms":    metric.Data.DeadlockDuration,
 		"connections":    connections,
 	}
 	
-	return WebSocketMessage{
-		Type:      "deadlock_event",
-		Data:      deadlockData,
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
+	return newNamespacedMessage("deadlock_event", metric.Namespace, deadlockData)
 }
 
-func parseConnectionsToParticipants(connections string) []map[string]interface{} {
+// parseConnectionsToParticipants turns the agent's deadlock_connections into
+// participants. Each entry may carry its transaction age in milliseconds as
+// "PgConnection@ac889df=1200"; that age, or one from knownCosts, becomes the
+// participant's "cost" of being rolled back.
+func parseConnectionsToParticipants(connections string, knownCosts map[string]int64) []map[string]interface{} {
 	if connections == "" {
 		return []map[string]interface{}{
 			{"id": "connection-1", "resource": "table_unknown", "lockType": "exclusive"},
@@ -148,12 +335,20 @@ func parseConnectionsToParticipants(connections string) []map[string]interface{}
 			if i%2 == 0 {
 				lockType = "exclusive"
 			}
-			participants = append(participants, map[string]interface{}{
+			connection, cost, hasCost := parseConnectionCost(part)
+			if known, ok := knownCosts[connection]; ok && !hasCost {
+				cost, hasCost = known, true
+			}
+			participant := map[string]interface{}{
 				"id":         fmt.Sprintf("connection-%d", i+1),
 				"resource":   fmt.Sprintf("table_%d", i+1),
 				"lockType":   lockType,
-				"connection": strings.TrimSpace(part),
-			})
+				"connection": connection,
+			}
+			if hasCost {
+				participant["cost"] = cost
+			}
+			participants = append(participants, participant)
 		}
 	}
 	
@@ -167,168 +362,816 @@ func parseConnectionsToParticipants(connections string) []map[string]interface{}
 	return participants
 }
 
-func createLockChain(participants []map[string]interface{}) []string {
-	lockChain := make([]string, 0, len(participants))
+// parseConnectionCost splits an optional "=<ms>" transaction age off a
+// deadlock connection entry.
+func parseConnectionCost(part string) (string, int64, bool) {
+	connection, age, found := strings.Cut(strings.TrimSpace(part), "=")
+	if !found {
+		return connection, 0, false
+	}
+	cost, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(age), "ms"), 10, 64)
+	if err != nil || cost < 0 {
+		return connection, 0, false
+	}
+	return connection, cost, true
+}
+
+// recommendVictim picks the participant whose transaction is youngest and so
+// cheapest to roll back. Without any known cost it falls back to the first
+// connection.
+func recommendVictim(participants []map[string]interface{}) string {
+	victim := "connection-1"
+	var lowest int64 = -1
+	for _, participant := range participants {
+		cost, ok := participant["cost"].(int64)
+		if ok && (lowest < 0 || cost < lowest) {
+			lowest = cost
+			victim = fmt.Sprintf("%v", participant["id"])
+		}
+	}
+	return victim
+}
+
+// lockEdge is one wait-for relation in a deadlock cycle: From holds a lock
+// of LockType on Resource that To is waiting for.
+type lockEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Resource string `json:"resource"`
+	LockType string `json:"lockType"`
+}
+
+// deadlockEdges returns the agent-reported wait-for edges with connections
+// replaced by their participant ids, or a ring in participant order when the
+// agent reported none.
+func deadlockEdges(reported []WaitForEdge, participants []map[string]interface{}) []lockEdge {
+	if len(reported) == 0 {
+		return createLockEdges(participants)
+	}
+
+	ids := make(map[string]string, len(participants))
+	for _, participant := range participants {
+		if connection, ok := participant["connection"].(string); ok {
+			ids[connection] = fmt.Sprintf("%v", participant["id"])
+		}
+	}
+	idOf := func(connection string) string {
+		connection = strings.TrimSpace(connection)
+		if id, ok := ids[connection]; ok {
+			return id
+		}
+		return connection
+	}
+
+	edges := make([]lockEdge, 0, len(reported))
+	for _, edge := range reported {
+		edges = append(edges, lockEdge{
+			From:     idOf(edge.Holder),
+			To:       idOf(edge.Waiter),
+			Resource: edge.Resource,
+			LockType: edge.LockType,
+		})
+	}
+	return edges
+}
+
+// cycleLength returns the number of transactions in the shortest cycle of
+// the wait-for graph, or the number of transactions involved when the edges
+// do not close a cycle.
+func cycleLength(edges []lockEdge) int {
+	next := make(map[string][]string)
+	nodes := make(map[string]bool)
+	for _, edge := range edges {
+		next[edge.From] = append(next[edge.From], edge.To)
+		nodes[edge.From] = true
+		nodes[edge.To] = true
+	}
+
+	shortest := 0
+	for start := range nodes {
+		// Breadth-first search for the first path back to start.
+		depth := map[string]int{start: 0}
+		queue := []string{start}
+		for len(queue) > 0 && (shortest == 0 || depth[queue[0]] < shortest) {
+			node := queue[0]
+			queue = queue[1:]
+			for _, to := range next[node] {
+				if to == start {
+					if length := depth[node] + 1; shortest == 0 || length < shortest {
+						shortest = length
+					}
+					continue
+				}
+				if _, seen := depth[to]; !seen {
+					depth[to] = depth[node] + 1
+					queue = append(queue, to)
+				}
+			}
+		}
+	}
+	if shortest == 0 {
+		return len(nodes)
+	}
+	return shortest
+}
+
+func createLockEdges(participants []map[string]interface{}) []lockEdge {
+	edges := make([]lockEdge, 0, len(participants))
 	
 	for i, participant := range participants {
 		nextIndex := (i + 1) % len(participants)
-		from := fmt.Sprintf("%v", participant["id"])
-		to := fmt.Sprintf("%v", participants[nextIndex]["id"])
-		resource := fmt.Sprintf("%v", participant["resource"])
-		lockType := fmt.Sprintf("%v", participant["lockType"])
-		
-		lockDescription := fmt.Sprintf("%s → %s (%s, %s)", from, to, resource, lockType)
+		edges = append(edges, lockEdge{
+			From:     fmt.Sprintf("%v", participant["id"]),
+			To:       fmt.Sprintf("%v", participants[nextIndex]["id"]),
+			Resource: fmt.Sprintf("%v", participant["resource"]),
+			LockType: fmt.Sprintf("%v", participant["lockType"]),
+		})
+	}
+	
+	return edges
+}
+
+func createLockChain(edges []lockEdge) []string {
+	lockChain := make([]string, 0, len(edges))
+	
+	for _, edge := range edges {
+		lockDescription := fmt.Sprintf("%s → %s (%s, %s)", edge.From, edge.To, edge.Resource, edge.LockType)
 		lockChain = append(lockChain, lockDescription)
 	}
 	
 	return lockChain
 }
 
+// Client is one subscriber to the broadcast stream: a WebSocket connection
+// served by readPump and writePump, or an SSE stream (conn is nil) served by
+// streamHandler.
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan WebSocketMessage
+	// remoteAddr identifies the client in logs.
+	remoteAddr string
+
+	// violations counts malformed or unknown control messages; it is only
+	// touched by readPump.
+	violations int
+	// subscriptions limits the message types sent to this client; empty
+	// means everything. It is only touched by the hub goroutine.
+	subscriptions map[string]bool
+	// chunking is set when the client asked for oversized messages to be
+	// split into message_chunk frames (/ws?chunking=1).
+	chunking bool
+	// batching is set when the client asked for messages arriving close
+	// together to be sent as one batch frame (/ws?batch=1).
+	batching bool
+	// closeReason is set by the hub goroutine before it closes send, and
+	// is read by writePump once it sees the channel closed.
+	closeReason string
+	// replay receives the history snapshot taken at registration, which
+	// writePump sends before any live message.
+	replay chan []WebSocketMessage
+	// dropped counts messages discarded under the drop_oldest slow client
+	// policy. It is only touched by the hub goroutine.
+	dropped int
+	// version is the envelope version negotiated with /ws?v=. Only v1
+	// exists so far; later versions translate messages for older clients.
+	version string
+	// namespace limits the client to messages about that namespace
+	// (/ws?namespace=); empty means every namespace.
+	namespace string
+	// role and allowedNamespaces come from the client's token when stream
+	// authentication is enabled; a nil allowedNamespaces means unrestricted.
+	role              string
+	allowedNamespaces map[string]bool
+	// resuming is set when the client reconnected with /ws?since=, asking
+	// for only the messages after resumeAfter.
+	resuming    bool
+	resumeAfter uint64
+	// format is the outbound encoding negotiated with /ws?format=: JSON
+	// text frames by default or MessagePack binary frames. Inbound control
+	// messages are JSON either way.
+	format string
+	// sourceIP is set when the client holds a slot under a client limit,
+	// which the hub frees when it unregisters.
+	sourceIP string
+	// connectedAt is set by the hub goroutine on registration.
+	connectedAt time.Time
+	// stale counts broadcasts skipped for outliving WS_MESSAGE_TTL, and
+	// staleRun those skipped since the last one sent. Both are only
+	// touched by writePump.
+	stale    int
+	staleRun int
+	// acks is nil unless the client asked to acknowledge some message types
+	// (/ws?ack=). It is shared by readPump and writePump.
+	acks *ackTracker
+	// latency is the round trip of the last answered ping in nanoseconds,
+	// and lastPong when it arrived; both are written by readPump.
+	latency  atomic.Int64
+	lastPong atomic.Int64
 }
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for demo
+		return true // Origins are checked against ALLOWED_WS_ORIGINS in handleWebSocket
 	},
+	Error: upgradeError,
 }
 
-func newHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan WebSocketMessage, 256),
+func newHub(cfg Config) *Hub {
+	patterns := newFingerprintCache(cfg.FingerprintCacheSize)
+	h := &Hub{
+		cfg:        cfg,
+		broadcast:  make(chan WebSocketMessage, cfg.BroadcastBuffer),
+		reply:      make(chan clientMessage),
+		subscribe:  make(chan subscription),
+		slowest:    newSlowestQueries(cfg.SlowestCapacity, cfg.SlowestRetention),
+		latest:     newLatestQueries(),
+		system:     newSystemMetricsDecimator(cfg.SystemMetricsInterval),
+		history:    newMessageHistory(cfg.HistorySize),
+		cpu:        newCPUTracker(cfg.CPUAlertHigh, cfg.CPUAlertLow, cfg.CPUTrendSize, cfg.CPUStaleAfter),
+		heap:       newHeapMonitor(cfg.HeapAlertRatio),
+		pool:       newPoolMonitor(cfg.PoolAlertRatio, cfg.PoolAlertConsecutive),
+		oversized:  newPayloadStore(64),
+		deadlocks:  newDeadlockStore(cfg.DeadlockStoreSize),
+		endpoints:  newEndpointAggregator(cfg.EndpointWindow, cfg.MaxEndpoints),
+		queryStats: newQueryStatsAggregator(cfg.MaxQueryPatterns, patterns),
+		patterns:   patterns,
+		tables:     newTableLatencyTracker(cfg.TableLatencyRetention, cfg.MaxTables),
+		limiter:    newIngestLimiter(cfg.IngestRateLimit, cfg.IngestBurst, cfg.IngestLimiterKeys),
+		txns:       newTransactionTracker(cfg.LongTransactionThreshold, cfg.LongTransactionTTL),
+		recent:     newMetricStore(cfg.RecentMetricsSize),
+		signatures: newSignatureTracker(cfg.DeadlockSignatureWindow),
+		dedup:      newDeadlockDeduper(cfg.DeadlockDedupWindow),
+		tps:        newTPSTracker(),
+		pods:       newPodRegistry(cfg.PodTTL),
+		dlq:        newDeadLetters(cfg.DeadLetterSize),
+		inFlight:   newInFlightTracker(cfg.InFlightTTL),
+		jwt:        newJWTVerifier(cfg.JWTSecret, cfg.JWKSURL),
+		errRates:   newErrorRateTracker(cfg.ErrorRateAlertRatio, cfg.ErrorRateWindow, cfg.ErrorRateMinSamples),
+		events:     newEventCounters(time.Now()),
+		complexity: newComplexQueryTracker(cfg.ComplexQueryThreshold, cfg.ComplexQueriesSize),
+		mutations:  newMassMutationTracker(cfg.MassMutationThreshold, cfg.LargeMutationsSize),
+		suppress:   newSuppressList(cfg.SuppressPatterns),
+		poolTrend:  newPoolForecaster(cfg.PoolForecastHorizon, cfg.PoolForecastSamples),
+		contention: newContentionTracker(cfg.ContentionHalfLife, cfg.MaxTables),
+		anomalies:  newAnomalyDetector(cfg.AnomalyStddevs, cfg.AnomalyMinSamples, cfg.AnomalyWindow, cfg.MaxQueryPatterns),
+		txOutcomes: newErrorRateTracker(cfg.RollbackRatioAlert, cfg.RollbackRatioWindow, cfg.RollbackRatioMinSamples),
+		ratios:     newRatioUpdates(),
+		sink:       newSinkWriter(NullSink{}, cfg.SinkQueueSize),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		admit:      make(chan admission),
+		inspect:    make(chan chan []ClientInfo),
+		release:    make(chan string),
+		admissions: newAdmissionCounts(cfg.MaxClients, cfg.MaxClientsPerIP),
 		clients:    make(map[*Client]bool),
+		done:       make(chan struct{}),
+	}
+	return h
+}
+
+// start runs the hub goroutine and the periodic broadcasts until the hub
+// shuts down.
+func (h *Hub) start() {
+	go h.run()
+	go h.runTPS()
+	go h.runPodExpiry()
+	go h.runAlertExpiry()
+	go h.runSystemMetricsFlush()
+	go h.runTransactionRatios()
+	go h.runInFlight()
+}
+
+var errHubClosed = errors.New("hub is shutting down")
+
+// publish queues a message for broadcast. It fails once the hub has started
+// shutting down instead of sending on a closed channel.
+func (h *Hub) publish(message WebSocketMessage) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closing {
+		return errHubClosed
+	}
+	h.broadcast <- message
+	broadcastQueueDepthGauge.Set(float64(len(h.broadcast)))
+	h.webhook.notify(message)
+	return nil
+}
+
+func (h *Hub) isClosing() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.closing
+}
+
+// close stops accepting broadcasts. run delivers what is already queued,
+// disconnects every client and returns.
+func (h *Hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closing {
+		h.closing = true
+		close(h.broadcast)
+	}
+}
+
+// shutdown closes the hub and waits until every client's writePump has sent
+// its drain close frame, or ctx expires.
+func (h *Hub) shutdown(ctx context.Context) error {
+	h.close()
+	flushed := make(chan struct{})
+	go func() {
+		<-h.done
+		h.writers.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (h *Hub) run() {
+	h.running.Store(true)
+	defer close(h.done)
+	defer h.running.Store(false)
 	for {
 		select {
 		case client := <-h.register:
+			client.connectedAt = time.Now()
 			h.clients[client] = true
-			log.Printf("✅ Client connected. Total clients: %d", len(h.clients))
+			h.writers.Add(1)
+			h.clientsChanged()
+			slog.Info("client connected", "client_count", len(h.clients))
+			// Hand the retained history to writePump rather than queueing it
+			// on send, so a large replay can never block the hub. It opens
+			// with the current sequence number so the client knows where
+			// live messages start.
+			connected := newMessage("connected", map[string]interface{}{"seq": h.seq})
+			client.replay <- append([]WebSocketMessage{connected}, h.replayFor(client)...)
 
 		case client := <-h.unregister:
+			if client.sourceIP != "" {
+				h.admissions.release(client.sourceIP)
+				client.sourceIP = ""
+			}
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
 				close(client.send)
-				log.Printf("🔌 Client disconnected. Total clients: %d", len(h.clients))
+				h.clientsChanged()
+				slog.Info("client disconnected", "client_count", len(h.clients))
 			}
 
-		case message := <-h.broadcast:
-			log.Printf("📡 Broadcasting message to %d clients", len(h.clients))
+		case request := <-h.admit:
+			request.result <- h.admissions.reserve(request.ip)
+
+		case ip := <-h.release:
+			h.admissions.release(ip)
+
+		case result := <-h.inspect:
+			clients := make([]ClientInfo, 0, len(h.clients))
 			for client := range h.clients {
+				clients = append(clients, client.info(h.cfg.ClientDegradedLatency))
+			}
+			result <- clients
+
+		case sub := <-h.subscribe:
+			h.applySubscription(sub)
+
+		case m := <-h.reply:
+			if _, ok := h.clients[m.client]; ok {
 				select {
-				case client.send <- message:
+				case m.client.send <- m.message:
 				default:
+				}
+			}
+
+		case message, ok := <-h.broadcast:
+			broadcastQueueDepthGauge.Set(float64(len(h.broadcast)))
+			if !ok {
+				for client := range h.clients {
+					client.closeReason = closeReasonDrain
 					close(client.send)
 					delete(h.clients, client)
 				}
+				h.clientsChanged()
+				slog.Info("hub stopped")
+				return
+			}
+			h.seq++
+			message.Seq = h.seq
+			// Periodic snapshots and running ratios are superseded within
+			// seconds; keeping them would crowd real events out of the
+			// replay history.
+			if message.Type != "tps_update" && message.Type != "in_flight_update" && message.Type != "transaction_ratio_update" {
+				h.history.add(message, time.Now())
+			}
+			slog.Debug("broadcasting message", "message_type", message.Type, "client_count", len(h.clients))
+			for client := range h.clients {
+				if client.wants(message) {
+					h.deliver(client, message)
+				}
 			}
 		}
 	}
 }
 
+// clientsChanged publishes the client count. It must be called from the hub
+// goroutine after h.clients changes.
+func (h *Hub) clientsChanged() {
+	// Every cluster's hub shares the gauge, so each adds its change.
+	previous := h.connected.Swap(int64(len(h.clients)))
+	websocketClientsGauge.Add(float64(int64(len(h.clients)) - previous))
+}
+
+// clientCount is safe to call from any goroutine.
+func (h *Hub) clientCount() int {
+	return int(h.connected.Load())
+}
+
 func (h *Hub) receiveMetrics(w http.ResponseWriter, r *http.Request) {
-	var metric QueryMetrics
-	if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
-		log.Printf("❌ Failed to decode metrics: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if h.isClosing() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
 		return
 	}
+	ctx, span := startIngestSpan(r)
+	defer span.End()
 
-	// Extract Pod and Namespace information from the request and JSON payload
-	// First try to get from the JSON payload itself (Agent sends these in the payload)
-	if metric.PodName == "" {
-		podName := extractPodNameFromRequest(r)
-		if podName != "" {
-			metric.PodName = podName
+	// Whether the body is a batch is only known once it is read, so read up
+	// to the larger limit and apply the single-metric one afterwards.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, max(h.cfg.MaxMetricBytes, h.cfg.MaxBatchBytes)))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && !isBatchBody(body) && int64(len(body)) > h.cfg.MaxMetricBytes) {
+		slog.Warn("rejected oversized metrics body", "remote_addr", r.RemoteAddr, "content_length", r.ContentLength)
+		failSpan(span, errors.New("request body too large"))
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to read metrics body", "remote_addr", r.RemoteAddr, "error", err)
+		failSpan(span, err)
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	metrics, batch, err := decodeMetrics(body, h.cfg.FieldAliases)
+	if err != nil {
+		slog.Warn("failed to decode metrics", "remote_addr", r.RemoteAddr, "batch", batch, "error", err)
+		h.dlq.add(DeadLetter{Reason: deadLetterDecode, Detail: err.Error(), Source: r.RemoteAddr, Payload: string(body), At: time.Now()})
+		failSpan(span, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(decodeErrorBody(err))
+		return
+	}
+
+	source := ingestSourceKey(r, metrics)
+	if ok, retryAfter := h.limiter.allow(source, time.Now()); !ok {
+		slog.Warn("rate limited metrics", "source", source, "retry_after", retryAfter.String())
+		failSpan(span, errors.New("rate limited"))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+
+	for i := range metrics {
+		metric := &metrics[i]
+		metricsReceivedTotal.WithLabelValues(eventTypeLabel(metric.EventType)).Inc()
+
+		// Extract Pod and Namespace information from the request and JSON payload
+		// First try to get from the JSON payload itself (Agent sends these in the payload)
+		if metric.PodName == "" {
+			podName := extractPodNameFromRequest(r)
+			if podName != "" {
+				metric.PodName = podName
+			}
+		}
+		
+		if metric.Namespace == "" {
+			namespace := extractNamespaceFromRequest(r)
+			if namespace != "" {
+				metric.Namespace = namespace
+			}
 		}
 	}
-	
-	if metric.Namespace == "" {
-		namespace := extractNamespaceFromRequest(r)
-		if namespace != "" {
-			metric.Namespace = namespace
+	annotateIngestSpan(span, metrics, batch)
+
+	for i, metric := range metrics {
+		err := validateMetric(metric)
+		if err == nil && batch {
+			err = validateClockSkew(metric, time.Now(), h.cfg.ClockSkewTolerance)
 		}
+		if err != nil {
+			slog.Warn("rejected invalid metric", "event_type", metric.EventType, "pod_name", metric.PodName, "rule", err.Error())
+			h.dlq.rejectMetric(metric, r.RemoteAddr, err)
+			failSpan(span, err)
+			body := map[string]interface{}{"error": "Invalid metric", "rule": err.Error()}
+			if batch {
+				body["index"] = i
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(body)
+			return
+		}
+	}
+
+	// Processing happens on the ingestion pipeline. Callers that need to know
+	// the metrics were broadcast can ask to wait with ?sync=true.
+	wait, _ := strconv.ParseBool(r.URL.Query().Get("sync"))
+	accepted := 0
+	for _, metric := range metrics {
+		if err := h.ingest.submitContext(ctx, metric, wait); err != nil {
+			failSpan(span, err)
+			switch {
+			case errors.Is(err, errQueueFull):
+				w.Header().Set("Retry-After", "1")
+				writeIngestError(w, http.StatusServiceUnavailable, "Ingestion queue full", accepted, batch)
+			case errors.Is(err, errPipelineClosed), errors.Is(err, errHubClosed):
+				writeIngestError(w, http.StatusServiceUnavailable, "Shutting down", accepted, batch)
+			default:
+				writeIngestError(w, http.StatusInternalServerError, err.Error(), accepted, batch)
+			}
+			return
+		}
+		accepted++
+	}
+
+	// The bundled agent treats anything but 200 as a failed send, so queued
+	// metrics are acknowledged with 200 rather than 202.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if batch {
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "received", "count": accepted})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+}
+
+// decodeMetrics decodes a single metric or a JSON array of them, accepting
+// the query data keys in aliases for their canonical names. A batch is
+// decoded as a whole, so one malformed element rejects all of it.
+func decodeMetrics(body []byte, aliases map[string]string) ([]QueryMetrics, bool, error) {
+	batch := isBatchBody(body)
+	var metrics []QueryMetrics
+	var err error
+	if batch {
+		err = json.Unmarshal(body, &metrics)
+	} else {
+		metrics = make([]QueryMetrics, 1)
+		err = json.Unmarshal(body, &metrics[0])
+	}
+	if err == nil {
+		err = applyFieldAliases(body, metrics, aliases)
+	}
+	return metrics, batch, err
+}
+
+// decodeErrorBody describes why a metrics body failed to decode: the byte
+// offset of a syntax error, or the field, expected type and offending JSON
+// value of a type mismatch, with the offset unless the value was sent under
+// a field alias.
+func decodeErrorBody(err error) map[string]interface{} {
+	body := map[string]interface{}{"error": "Invalid JSON: " + err.Error()}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var aliasErr *aliasTypeError
+	switch {
+	case errors.As(err, &aliasErr):
+		body["field"] = aliasErr.Field
+		body["expected"] = aliasErr.Type.String()
+		body["got"] = aliasErr.Value
+	case errors.As(err, &syntaxErr):
+		body["offset"] = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		body["offset"] = typeErr.Offset
+		body["field"] = typeErr.Field
+		body["expected"] = typeErr.Type.String()
+		body["got"] = typeErr.Value
+	}
+	return body
+}
+
+// enrich stamps the control plane's cluster identity on metrics whose agent
+// did not report one.
+func (h *Hub) enrich(metric QueryMetrics) QueryMetrics {
+	if metric.ClusterID == "" {
+		metric.ClusterID = h.cfg.ClusterID
+	}
+	if metric.Region == "" {
+		metric.Region = h.cfg.Region
+	}
+	return metric
+}
+
+// isBatchBody reports whether the body holds a JSON array of metrics.
+func isBatchBody(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// writeIngestError reports a failed submission. For batches it also says how
+// many metrics were accepted before the failure.
+func writeIngestError(w http.ResponseWriter, status int, message string, accepted int, batch bool) {
+	if !batch {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": message, "count": accepted})
+}
+
+// processMetric runs a metric through the aggregations and broadcasts it to
+// the WebSocket clients. It is called by the ingestion pipeline workers.
+func (h *Hub) processMetric(metric QueryMetrics) error {
+	h.state.RLock()
+	defer h.state.RUnlock()
+
+	metric = h.enrich(metric)
+	metric = h.correctClockSkew(metric, time.Now())
+	metric = h.redact(metric)
+	metric = h.fingerprint(metric)
+	h.events.record(metric.EventType, time.Now())
+	h.recorder.record(metric, time.Now())
+	h.trackPod(metric, time.Now())
+
+	h.analyzeCPU(metric)
+	h.analyzeHeap(metric)
+	h.analyzePoolMetrics(metric)
+	h.analyzePoolTrend(metric)
+	h.analyzeTransaction(metric)
+	h.analyzeSQL(metric)
+	h.analyzeComplexity(metric)
+	h.analyzeMutation(metric)
+	h.analyzeAnomaly(metric)
+	h.analyzeErrorRate(metric)
+	h.analyzeTransactionOutcome(metric)
+
+	// The analyzers see every sample, but within a burst SystemMetrics are
+	// only forwarded once per interval; the query data itself still flows
+	// for every event.
+	if metric.Metrics != nil && !h.system.admit(metric.PodName, metric.Namespace, metric.Metrics, time.Now()) {
+		metric.Metrics = nil
 	}
+	h.recent.add(metric, time.Now())
+	h.sink.enqueue(metric)
+	h.upstream.enqueue(metric)
 
 	// Safe logging to avoid panic
 	sqlType := "unknown"
 	if metric.Data != nil {
 		sqlType = metric.Data.SQLType
 	}
-	log.Printf("📊 Received real JDBC metric: %s - %s from Pod: %s, Namespace: %s", 
-		metric.EventType, sqlType, metric.PodName, metric.Namespace)
+	slog.Debug("processing metric", "event_type", metric.EventType, "sql_type", sqlType,
+		"pod_name", metric.PodName, "namespace", metric.Namespace)
 	
 	// Broadcast the real metric to all connected WebSocket clients with proper type
 	var messageType string
 	switch metric.EventType {
 	case "query_execution":
 		messageType = "query_metrics"
+		h.slowest.record(metric, time.Now())
+		h.latest.record(metric)
+		h.endpoints.record(metric, time.Now())
+		h.tps.record(metric.PodName, metric.Namespace, time.Now())
+		h.queryStats.record(metric)
+		observeQueryDuration(metric)
+		h.tables.record(metric, time.Now())
+		h.inFlight.complete(metric.PodName, metric.Data.QueryID)
+	case "query_start":
+		// Starts are only tracked; in_flight_update reports them in bulk.
+		h.inFlight.start(metric, time.Now())
+		return nil
 	case "transaction_event":
 		messageType = "transaction_event"
 	case "deadlock_event":
 		messageType = "deadlock_event"
 	case "deadlock_detected":
 		messageType = "deadlock_event"
-		log.Printf("💀 Converting deadlock_detected to deadlock_event for WebSocket broadcast")
+		slog.Info("deadlock detected", "pod_name", metric.PodName, "namespace", metric.Namespace)
 		
 		// Create special deadlock message with dashboard-compatible structure
-		deadlockMessage := createDeadlockMessage(metric)
-		h.broadcast <- deadlockMessage
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "received"})
-		return // Early return for deadlock events
+		deadlockMessage := createDeadlockMessage(metric, h.cfg)
+		deadlockData := deadlockMessage.Data.(map[string]interface{})
+		dedupKey := deadlockDedupKey(metric.PodName, participantsOf(deadlockData))
+		if duplicate, suppressed := h.dedup.duplicate(dedupKey, time.Now()); duplicate {
+			slog.Info("suppressed duplicate deadlock", "pod_name", metric.PodName, "suppressed_count", suppressed)
+			return nil
+		}
+		if signature, locks, ok := deadlockSignature(metric.Data); ok {
+			deadlockData["signature"] = signature
+			deadlockData["recurrence"] = h.signatures.record(signature, locks, time.Now())
+		}
+		h.deadlocks.add(deadlockMessage)
+		h.contention.recordDeadlock(reportedLocks(metric.Data), time.Now())
+		if err := h.publish(deadlockMessage); err != nil {
+			return err
+		}
+		h.alerts.fire("deadlock_event", deadlockData["severity"].(string), metric.PodName, metric.Namespace, map[string]interface{}{
+			"deadlock_id": deadlockData["id"],
+			"connections": deadlockData["connections"],
+		})
+		return nil // Early return for deadlock events
 	case "long_running_transaction":
 		messageType = "long_running_transaction"
-		log.Printf("🐌 Processing long_running_transaction event for WebSocket broadcast")
-		log.Printf("🔍 DEBUG: Full long_running_transaction message: %+v", metric)
+		slog.Info("long running transaction", "pod_name", metric.PodName, "namespace", metric.Namespace)
 		if metric.Data != nil {
-			log.Printf("🔍 DEBUG: Long running transaction data: %+v", *metric.Data)
+			h.contention.recordLongWait(metric.Data.TableNames, time.Now())
+			slog.Debug("long running transaction data", "pod_name", metric.PodName, "data", metric.Data)
 		}
 	default:
 		messageType = "query_metrics" // default fallback
 	}
-	
-	message := WebSocketMessage{
-		Type: messageType,
-		Data: metric,
-		Timestamp: time.Now().Format(time.RFC3339),
+	if metric.EventType == "query_execution" && (h.suppressed(metric) || h.sampledOut(metric)) {
+		return nil
 	}
-
-	h.broadcast <- message
 	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+	message := newNamespacedMessage(messageType, metric.Namespace, metric)
+
+	return h.publish(message)
 }
 
 func (h *Hub) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	log.Printf("🔗 WebSocket connection attempt from %s", r.RemoteAddr)
-	log.Printf("🔍 Headers: %+v", r.Header)
+	slog.Debug("websocket connection attempt", "remote_addr", r.RemoteAddr, "headers", r.Header)
+
+	if origin := r.Header.Get("Origin"); origin != "" && !h.cfg.AllowedWSOrigins.allows(origin) {
+		slog.Warn("rejected websocket upgrade: origin not allowed", "remote_addr", r.RemoteAddr, "origin", origin)
+		stats.recordUpgradeFailure(upgradeFailureOrigin)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	claims, ok := h.authorizeStream(w, r)
+	if !ok {
+		stats.recordUpgradeFailure(upgradeFailureAuth)
+		return
+	}
+	sourceIP, ok := h.admitClient(w, r)
+	if !ok {
+		return
+	}
 	
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("❌ WebSocket upgrade error: %v", err)
+		slog.Warn("websocket upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
+		h.releaseAdmission(sourceIP)
+		return
+	}
+
+	requested := r.URL.Query().Get("v")
+	version, ok := negotiateVersion(requested)
+	if !ok {
+		slog.Warn("rejected websocket client: unsupported message version", "remote_addr", r.RemoteAddr, "version", requested)
+		conn.WriteControl(websocket.CloseMessage, unsupportedVersionClose(requested), time.Now().Add(time.Second))
+		conn.Close()
+		h.releaseAdmission(sourceIP)
+		return
+	}
+	requestedFormat := r.URL.Query().Get("format")
+	format, ok := negotiateFormat(requestedFormat)
+	if !ok {
+		slog.Warn("rejected websocket client: unsupported message format", "remote_addr", r.RemoteAddr, "format", requestedFormat)
+		conn.WriteControl(websocket.CloseMessage, unsupportedFormatClose(requestedFormat), time.Now().Add(time.Second))
+		conn.Close()
+		h.releaseAdmission(sourceIP)
 		return
 	}
 	
-	log.Printf("✅ WebSocket upgrade successful")
+	slog.Debug("websocket upgrade succeeded", "remote_addr", r.RemoteAddr)
+	if h.cfg.WSCompression {
+		enableCompression(conn)
+	}
 
 	client := &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan WebSocketMessage, 256),
+		hub:        h,
+		conn:       conn,
+		send:       make(chan WebSocketMessage, h.cfg.ClientBuffer),
+		replay:     make(chan []WebSocketMessage, 1),
+		version:    version,
+		remoteAddr: r.RemoteAddr,
+		sourceIP:   sourceIP,
+		format:     format,
+	}
+	client.chunking, _ = strconv.ParseBool(r.URL.Query().Get("chunking"))
+	client.batching, _ = strconv.ParseBool(r.URL.Query().Get("batch"))
+	client.subscriptions = parseSubscriptions(r.URL.Query().Get("types"))
+	client.namespace = r.URL.Query().Get("namespace")
+	client.acks = newAckTracker(parseSubscriptions(r.URL.Query().Get("ack")), h.cfg.WSAckTimeout, h.cfg.WSAckRetries, h.cfg.WSAckBuffer)
+	if since := r.URL.Query().Get("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			client.resuming, client.resumeAfter = true, seq
+		}
 	}
+	client.applyClaims(claims)
 
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.done:
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -336,56 +1179,168 @@ func (h *Hub) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetReadLimit(c.hub.cfg.ReadLimit)
+	c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
+	c.conn.SetPongHandler(func(payload string) error {
+		c.recordPong(payload, time.Now())
+		c.conn.SetReadDeadline(time.Now().Add(c.hub.cfg.PongWait))
 		return nil
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, payload, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				slog.Warn("websocket read failed", "remote_addr", c.conn.RemoteAddr().String(), "error", err)
 			}
 			break
 		}
+		if !c.handleControlMessage(payload) {
+			break
+		}
 	}
 }
 
+// writePump is the only writer to the connection. Frames that time out are
+// retried by writeFrame; any other failed write ends the pump, which tries
+// to close the connection with closeReasonWriteFailed. Dashboards ride out a
+// network blip by reconnecting with /ws?since=, which resends what they
+// missed.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
+	ticker := time.NewTicker(c.hub.cfg.PingPeriod)
+	var lifetime <-chan time.Time
+	if c.hub.cfg.MaxConnectionLifetime > 0 {
+		lifetimeTimer := time.NewTimer(c.hub.cfg.MaxConnectionLifetime)
+		defer lifetimeTimer.Stop()
+		lifetime = lifetimeTimer.C
+	}
+	var resend <-chan time.Time
+	if c.acks != nil {
+		resendTicker := time.NewTicker(max(c.hub.cfg.WSAckTimeout/2, 100*time.Millisecond))
+		defer resendTicker.Stop()
+		resend = resendTicker.C
+	}
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.writers.Done()
 	}()
 
+	for _, message := range <-c.replay {
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+		if err := c.writeMessage(c.trackAck(message)); err != nil {
+			slog.Warn("websocket write failed during replay", "remote_addr", c.conn.RemoteAddr().String(), "error", err)
+			c.closeWriteFailed()
+			return
+		}
+	}
+
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.hub.cfg.closeMessage(c.closeReason))
+				return
+			}
+
+			if c.expired(message, time.Now()) {
+				continue
+			}
+			if c.batched() {
+				messages, open := c.collectBatch(message)
+				c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+				if err := c.writeBatch(messages); err != nil {
+					slog.Warn("websocket write failed", "remote_addr", c.conn.RemoteAddr().String(), "error", err)
+					c.closeWriteFailed()
+					return
+				}
+				if !open {
+					c.conn.WriteMessage(websocket.CloseMessage, c.hub.cfg.closeMessage(c.closeReason))
+					return
+				}
+				continue
+			}
+
+			if err := c.writeMessage(c.trackAck(message)); err != nil {
+				slog.Warn("websocket write failed", "remote_addr", c.conn.RemoteAddr().String(), "error", err)
+				c.closeWriteFailed()
 				return
 			}
 
-			if err := c.conn.WriteJSON(message); err != nil {
-				log.Printf("WebSocket write error: %v", err)
+		case <-resend:
+			if err := c.resendUnacked(); err != nil {
+				slog.Warn("websocket write failed", "remote_addr", c.conn.RemoteAddr().String(), "error", err)
+				c.closeWriteFailed()
 				return
 			}
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			if err := c.writeFrame(websocket.PingMessage, pingPayload(time.Now())); err != nil {
+				c.closeWriteFailed()
 				return
 			}
+
+		case <-lifetime:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+			c.conn.WriteMessage(websocket.CloseMessage, c.hub.cfg.closeMessage(closeReasonLifetime))
+			return
+		}
+	}
+}
+
+// writeRetries bounds how often writeFrame retries a frame that timed out,
+// waiting writeRetryBackoff longer before each attempt.
+const (
+	writeRetries      = 3
+	writeRetryBackoff = 50 * time.Millisecond
+)
+
+// writeFrame writes one frame, retrying with a growing backoff while the
+// write times out. Only a timeout that left the connection usable succeeds
+// on retry: gorilla/websocket keeps any error from the network and returns
+// it from every later write, so those retries fail at once and writePump
+// gives up on the connection.
+func (c *Client) writeFrame(messageType int, payload []byte) error {
+	return retryWrite(c.hub.done, func() error {
+		c.conn.SetWriteDeadline(time.Now().Add(c.hub.cfg.WriteWait))
+		return c.conn.WriteMessage(messageType, payload)
+	})
+}
+
+// retryWrite runs write and retries it up to writeRetries times while it
+// fails with a timeout, until done is closed.
+func retryWrite(done <-chan struct{}, write func() error) error {
+	err := write()
+	for attempt := 1; attempt <= writeRetries && writeTimedOut(err); attempt++ {
+		select {
+		case <-time.After(time.Duration(attempt) * writeRetryBackoff):
+		case <-done:
+			return err
 		}
+		err = write()
 	}
+	return err
+}
+
+func writeTimedOut(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// closeWriteFailed asks the dashboard to reconnect with /ws?since= after
+// writePump gave up on a write. The failed write has usually broken the
+// connection, in which case the dashboard sees it drop instead.
+func (c *Client) closeWriteFailed() {
+	c.conn.WriteControl(websocket.CloseMessage, c.hub.cfg.closeMessage(closeReasonWriteFailed), time.Now().Add(c.hub.cfg.WriteWait))
 }
 
 // Mock metrics generator removed - using real JDBC data from /api/metrics endpoint
@@ -434,46 +1389,178 @@ func extractNamespaceFromRequest(r *http.Request) string {
 	return "kubedb-monitor-test"
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
+// healthHandler serves GET /api/health and /api/livez. queue_depth is the
+// number of messages waiting in the broadcast channel. Probes asking for
+// text/plain get a bare OK, or NOT READY with a 503 once the hub has stopped.
+func (h *Hub) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status, body := http.StatusOK, "healthy"
+	if !h.running.Load() {
+		status, body = http.StatusServiceUnavailable, "not_ready"
+	}
+	if prefersPlainText(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			io.WriteString(w, "OK\n")
+		} else {
+			io.WriteString(w, "NOT READY\n")
+		}
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":    "healthy",
-		"service":   "kubedb-monitor-control-plane",
-		"timestamp": time.Now().Format(time.RFC3339),
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         body,
+		"service":        "kubedb-monitor-control-plane",
+		"build":          buildInfo(),
+		"queue_depth":    len(h.broadcast),
+		"queue_capacity": cap(h.broadcast),
+		"timestamp":      time.Now().Format(time.RFC3339),
 	})
 }
 
 func main() {
-	log.Printf("🎉 KubeDB Monitor Control Plane starting...")
+	setupLogging()
 	
-	// Get port from environment variable, default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg := loadConfig()
+	if err := cfg.validate(); err != nil {
+		fatal("invalid configuration", "error", err)
+	}
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		fatal("failed to set up tracing", "error", err)
 	}
+	port := cfg.Port
 	
-	hub := newHub()
-	go hub.run()
+	hub := newHub(cfg)
+	upgrader.EnableCompression = cfg.WSCompression
+	if cfg.AlertHistoryFile != "" {
+		alerts, err := openAlertHistory(cfg.AlertHistoryFile, cfg.AlertHistorySize)
+		if err != nil {
+			fatal("failed to open alert history", "path", cfg.AlertHistoryFile, "error", err)
+		}
+		hub.alerts = alerts.forCluster(cfg.ClusterID)
+		defer alerts.close()
+		slog.Info("persisting alert history", "path", cfg.AlertHistoryFile)
+	}
+	if cfg.DatabaseURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		sink, err := openPostgresSink(ctx, cfg.DatabaseURL)
+		cancel()
+		if err != nil {
+			fatal("failed to open metrics database", "error", err)
+		}
+		hub.sink = newSinkWriter(sink, cfg.SinkQueueSize)
+		hub.sink.breaker = newCircuitBreaker(cfg.SinkBreakerFailures, cfg.SinkBreakerCooldown)
+		hub.sink.dlq = hub.dlq
+		defer sink.Close()
+		slog.Info("persisting metrics to PostgreSQL")
+	}
+	if cfg.RecordFile != "" {
+		if cfg.RecordFile == cfg.ReplayFile {
+			fatal("RECORD_FILE and REPLAY_FILE must differ", "path", cfg.RecordFile)
+		}
+		recorder, err := openMetricRecorder(cfg.RecordFile, cfg.RecordMaxBytes)
+		if err != nil {
+			fatal("failed to open metric recording", "path", cfg.RecordFile, "error", err)
+		}
+		hub.recorder = recorder
+		defer recorder.close()
+		slog.Info("recording metrics", "path", cfg.RecordFile)
+	}
+	if cfg.UpstreamURL != "" {
+		hub.upstream = newUpstreamForwarder(cfg.UpstreamURL, cfg.UpstreamAPIKey, cfg.UpstreamBuffer)
+		hub.upstream.start()
+	}
+	if cfg.AlertWebhookURL != "" {
+		hub.webhook = newAlertWebhook(cfg)
+		hub.webhook.start()
+	}
+	hubs := newHubRegistry(hub, cfg.MaxClusters)
+	hub.sim = newSimulator(hub, cfg.EnableSimulator)
+	hub.ingest = newIngestPipeline(cfg.IngestWorkers, cfg.IngestQueueSize, cfg.IngestSubmitTimeout, hubs.process)
+	hub.sink.start()
+	go hubs.run()
+	hub.start()
+	hub.ingest.start()
+
+	var natsSub *natsSubscriber
+	if cfg.NATSURL != "" && cfg.NATSSubject != "" {
+		sub, err := startNATSSubscriber(hub, cfg.NATSURL, cfg.NATSSubject)
+		if err != nil {
+			fatal("failed to subscribe to nats", "url", cfg.NATSURL, "error", err)
+		}
+		natsSub = sub
+	}
+	replayCtx, stopReplay := context.WithCancel(context.Background())
+	defer stopReplay()
+	if cfg.ReplayFile != "" {
+		go func() {
+			if err := hub.replayFile(replayCtx, cfg.ReplayFile, cfg.ReplaySpeed); err != nil {
+				slog.Error("failed to replay recording", "path", cfg.ReplayFile, "error", err)
+			}
+		}()
+	}
+	var kafkaConsumer *KafkaConsumer
+	if cfg.KafkaBrokers != "" && cfg.KafkaTopic != "" {
+		kafkaConsumer = startKafkaConsumer(hub, cfg.KafkaBrokers, cfg.KafkaTopic)
+	}
+	var grpcIngest *grpcIngest
+	if cfg.GRPCPort != "" {
+		grpcIngest, err = startGRPCIngest(hub, cfg.GRPCPort, cfg.IngestAPIKey)
+		if err != nil {
+			fatal("failed to start grpc ingestion", "port", cfg.GRPCPort, "error", err)
+		}
+	}
 
 	// Mock metrics generation disabled - using real JDBC data from /api/metrics endpoint
 
 	router := mux.NewRouter()
 	
 	// API routes
-	router.HandleFunc("/ws", hub.handleWebSocket)
-	router.HandleFunc("/api/health", healthHandler).Methods("GET")
-	router.HandleFunc("/api/metrics", hub.receiveMetrics).Methods("POST")
+	router.HandleFunc("/ws", hubs.routeStream((*Hub).handleWebSocket))
+	router.Handle("/ws/ingest", requireAPIKey(cfg.IngestAPIKey, http.HandlerFunc(hub.ingestWebSocket)))
+	router.HandleFunc("/api/stream", hubs.routeStream((*Hub).streamHandler)).Methods("GET")
+	router.HandleFunc("/api/health", hub.healthHandler).Methods("GET")
+	router.HandleFunc("/api/livez", hub.healthHandler).Methods("GET")
+	router.HandleFunc("/api/readyz", hub.readyzHandler).Methods("GET")
+	router.HandleFunc("/api/snapshot", hubs.route((*Hub).snapshotHandler)).Methods("GET")
+	router.HandleFunc("/api/stats", hubs.route((*Hub).statsHandler)).Methods("GET")
+	router.HandleFunc("/api/stats/events", hubs.route((*Hub).eventStatsHandler)).Methods("GET")
+	router.HandleFunc("/api/history", hub.historyHandler).Methods("GET")
+	router.HandleFunc("/api/clients", hubs.route((*Hub).clientsHandler)).Methods("GET")
+	router.Handle("/metrics", metricsHandler()).Methods("GET")
+	router.HandleFunc("/api/alerts/history", hubs.route((*Hub).alertHistoryHandler)).Methods("GET")
+	router.HandleFunc("/api/slowest", hubs.route((*Hub).slowestHandler)).Methods("GET")
+	router.HandleFunc("/api/complex-queries", hubs.route((*Hub).complexQueriesHandler)).Methods("GET")
+	router.HandleFunc("/api/large-mutations", hubs.route((*Hub).largeMutationsHandler)).Methods("GET")
+	router.HandleFunc("/api/slow-queries", hubs.route((*Hub).slowQueriesHandler)).Methods("GET")
+	router.HandleFunc("/api/pods", hubs.route((*Hub).podsHandler)).Methods("GET")
+	router.HandleFunc("/api/pods/{pod}/latest", hubs.route((*Hub).latestQueryHandler)).Methods("GET")
+	router.HandleFunc("/api/cpu", hubs.route((*Hub).cpuHandler)).Methods("GET")
+	router.HandleFunc("/api/messages/{id}", hubs.route((*Hub).oversizedMessageHandler)).Methods("GET")
+	router.HandleFunc("/api/deadlocks/signatures", hubs.route((*Hub).deadlockSignaturesHandler)).Methods("GET")
+	router.HandleFunc("/api/deadlocks/{id}/mermaid", hubs.route((*Hub).deadlockMermaidHandler)).Methods("GET")
+	router.HandleFunc("/api/deadlocks/{id}/graph", hubs.route((*Hub).deadlockGraphHandler)).Methods("GET")
+	router.HandleFunc("/api/endpoints", hubs.route((*Hub).endpointsHandler)).Methods("GET")
+	router.HandleFunc("/api/query-stats", hubs.route((*Hub).queryStatsHandler)).Methods("GET")
+	router.HandleFunc("/api/table-latency", hubs.route((*Hub).tableLatencyHandler)).Methods("GET")
+	router.HandleFunc("/api/contention", hubs.route((*Hub).contentionHandler)).Methods("GET")
+	router.HandleFunc("/api/dead-letters", hubs.route((*Hub).deadLettersHandler)).Methods("GET")
+	router.HandleFunc("/api/in-flight", hubs.route((*Hub).inFlightHandler)).Methods("GET")
+	router.HandleFunc("/api/metrics/recent", hubs.route((*Hub).recentMetricsHandler)).Methods("GET")
+	router.HandleFunc("/api/simulate", hub.simulateHandler).Methods("POST", "DELETE")
+	router.Handle("/api/config/suppress", requireAPIKey(cfg.IngestAPIKey, http.HandlerFunc(hub.suppressHandler))).Methods("POST")
+	router.Handle("/api/metrics", requireAPIKey(cfg.IngestAPIKey, http.HandlerFunc(hub.receiveMetrics))).Methods("POST")
+	router.Handle("/api/metrics/stream", requireAPIKey(cfg.IngestAPIKey, http.HandlerFunc(hub.receiveMetricStream))).Methods("POST")
+	router.Handle("/api/metrics/bulk", requireAPIKey(cfg.IngestAPIKey, http.HandlerFunc(hub.receiveMetricStream))).Methods("POST")
 	
-	// Serve static files for dashboard (if needed)
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
+	// Serve the dashboard, falling back to index.html for its own routes
+	router.PathPrefix("/").Handler(spaHandler(cfg.StaticDir))
 
 	// CORS middleware
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"}, // Allow all origins for demo
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"*"},
-	})
+	c := newCORS(cfg)
 
 	handler := c.Handler(router)
 
@@ -486,9 +1573,9 @@ func main() {
 
 	// Graceful shutdown
 	go func() {
-		log.Printf("KubeDB Monitor Control Plane starting on :%s", port)
+		fmt.Fprintf(os.Stderr, "KubeDB Monitor Control Plane starting on :%s\n", port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			fatal("server failed to start", "error", err)
 		}
 	}()
 
@@ -497,14 +1584,35 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Stop ingestion and the hub first so requests still in flight get a 503
+	// rather than racing the broadcast channel being closed. Metrics already
+	// queued are processed before the hub stops, and WebSocket clients are
+	// sent a going-away close frame before the process exits. The whole
+	// shutdown is bounded by SHUTDOWN_TIMEOUT.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
+	if natsSub != nil {
+		natsSub.stop()
+	}
+	if kafkaConsumer != nil {
+		kafkaConsumer.stop()
+	}
+	if grpcIngest != nil {
+		grpcIngest.stop(ctx)
+	}
+	stopReplay()
+	hub.sim.stop()
+	hubs.drain(ctx)
+
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("server forced to shutdown", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
 	}
 
-	log.Println("Server gracefully stopped")
+	slog.Info("server gracefully stopped")
 }
\ No newline at end of file
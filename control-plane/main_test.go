@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// testReadTimeout bounds how long a test waits for a WebSocket message.
+const testReadTimeout = 3 * time.Second
+
+// testConfig returns the default configuration.
+func testConfig() Config {
+	return loadConfig()
+}
+
+// startTestHub runs a hub fed by its own ingestion pipeline until the test
+// ends, recording alerts when cfg.AlertHistoryFile is set.
+func startTestHub(t *testing.T, cfg Config) *Hub {
+	t.Helper()
+	h := newHub(cfg)
+	if cfg.AlertHistoryFile != "" {
+		h.alerts = openTestAlertHistory(t, cfg.AlertHistoryFile, cfg.AlertHistorySize).forCluster(cfg.ClusterID)
+	}
+	h.ingest = newIngestPipeline(cfg.IngestWorkers, cfg.IngestQueueSize, cfg.IngestSubmitTimeout, h.processMetric)
+	h.start()
+	h.ingest.start()
+	t.Cleanup(func() {
+		h.ingest.stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.shutdown(ctx)
+	})
+	return h
+}
+
+// dialTestHub connects a WebSocket client to the hub with query as the /ws
+// query string, and reads the connected message.
+func dialTestHub(t *testing.T, h *Hub, query string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := dialTestHubWithHeader(t, h, query, nil)
+	if err != nil {
+		t.Fatalf("dial /ws?%s: %v (response %v)", query, err, resp)
+	}
+	if message := readTestMessage(t, conn); message.Type != "connected" {
+		t.Fatalf("first message = %q, want connected", message.Type)
+	}
+	return conn
+}
+
+// dialTestHubWithHeader dials /ws without reading anything, for tests of
+// the handshake itself.
+func dialTestHubWithHeader(t *testing.T, h *Hub, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	return dialTestHubWith(t, websocket.DefaultDialer, h, query, header)
+}
+
+// dialTestHubWith is dialTestHubWithHeader with a custom dialer.
+func dialTestHubWith(t *testing.T, dialer *websocket.Dialer, h *Hub, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(h.handleWebSocket))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	conn, resp, err := dialer.Dial(url, header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readTestMessage reads the next JSON message from conn.
+func readTestMessage(t *testing.T, conn *websocket.Conn) WebSocketMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(testReadTimeout))
+	_, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	var message WebSocketMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("decode message %s: %v", payload, err)
+	}
+	return message
+}
+
+// readTestMessageOfType skips messages until one of messageType arrives.
+func readTestMessageOfType(t *testing.T, conn *websocket.Conn, messageType string) WebSocketMessage {
+	t.Helper()
+	for {
+		if message := readTestMessage(t, conn); message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// testMetric returns a valid query_execution metric from podName, with
+// options applied in order.
+func testMetric(podName string, executionMs int64, options ...func(*QueryMetrics)) QueryMetrics {
+	metric := QueryMetrics{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		PodName:   podName,
+		Namespace: "default",
+		EventType: "query_execution",
+		Data: &QueryData{
+			QueryID:         "q-1",
+			SQLPattern:      "SELECT * FROM users WHERE id = ?",
+			SQLType:         "SELECT",
+			TableNames:      []string{"users"},
+			ExecutionTimeMs: &executionMs,
+			Status:          "SUCCESS",
+		},
+	}
+	for _, option := range options {
+		option(&metric)
+	}
+	return metric
+}
+
+// postTestMetric posts metric to the hub's /api/metrics handler, waiting for
+// it to be processed, and returns the response status.
+func postTestMetric(t *testing.T, h *Hub, metric QueryMetrics) int {
+	t.Helper()
+	body, err := json.Marshal(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return postTestBody(h, string(body)).Code
+}
+
+// postTestBody posts a raw body to the hub's /api/metrics handler, waiting
+// for the metrics to be processed.
+func postTestBody(h *Hub, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.receiveMetrics(rec, httptest.NewRequest(http.MethodPost, "/api/metrics?sync=true", strings.NewReader(body)))
+	return rec
+}
+
+// counterValue reads a Prometheus counter. Counters are process-wide, so
+// tests compare values before and after rather than absolute ones.
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+// ptr returns a pointer to v, for the optional fields of QueryData and
+// SystemMetrics.
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// testBatch encodes metrics as a batch body.
+func testBatch(t *testing.T, metrics ...QueryMetrics) string {
+	t.Helper()
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestBatchIngestion(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "")
+
+	transaction := testMetric("pod-a", 10)
+	transaction.EventType = "transaction_event"
+	longRunning := testMetric("pod-a", 10)
+	longRunning.EventType = "long_running_transaction"
+	rec := postTestBody(h, testBatch(t, testMetric("pod-a", 10), transaction, longRunning))
+
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["status"] != "received" || body["count"] != float64(3) {
+		t.Fatalf("response = %d %v, want 200 with count 3", rec.Code, body)
+	}
+	for _, want := range []string{"query_metrics", "transaction_event", "long_running_transaction"} {
+		if got := readTestMessageOfType(t, conn, want); got.Type != want {
+			t.Errorf("message type = %q, want %q", got.Type, want)
+		}
+	}
+}
+
+func TestMalformedBatchIsRejectedWhole(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	batch := testBatch(t, testMetric("pod-a", 10), testMetric("pod-b", 20))
+	// The second element's execution time is not a number.
+	malformed := strings.Replace(batch, `"execution_time_ms":20`, `"execution_time_ms":"slow"`, 1)
+
+	if rec := postTestBody(h, malformed); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if records := h.recent.query(metricFilter{}); len(records) != 0 {
+		t.Errorf("%d metrics of the rejected batch were processed", len(records))
+	}
+}
+
+func TestSingleMetricResponse(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	body, _ := json.Marshal(testMetric("pod-a", 10))
+	rec := postTestBody(h, string(body))
+
+	var response map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusOK || response["status"] != "received" || response["count"] != nil {
+		t.Errorf("response = %d %v, want 200 status received without a count", rec.Code, response)
+	}
+}
+
+func TestSilentClientIsDroppedAfterPongWait(t *testing.T) {
+	cfg := testConfig()
+	cfg.PongWait = 300 * time.Millisecond
+	cfg.PingPeriod = 100 * time.Millisecond
+	h := startTestHub(t, cfg)
+
+	// A client that keeps reading answers the pings and stays connected.
+	responsive := dialTestHub(t, h, "")
+	go func() {
+		for {
+			if _, _, err := responsive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	// This one never reads, so it never answers a ping.
+	dialTestHub(t, h, "")
+	waitForClientCount(t, h, 2)
+
+	start := time.Now()
+	waitForClientCount(t, h, 1)
+	if elapsed := time.Since(start); elapsed < cfg.PongWait/2 {
+		t.Errorf("silent client dropped after %v, before the %v pong wait", elapsed, cfg.PongWait)
+	}
+	time.Sleep(3 * cfg.PongWait)
+	if n := h.clientCount(); n != 1 {
+		t.Errorf("clientCount = %d, want the responsive client kept", n)
+	}
+}
+
+func TestOversizedBodiesAre413(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxMetricBytes = 2048
+	cfg.MaxBatchBytes = 8192
+	h := startTestHub(t, cfg)
+
+	padded := func(size int) QueryMetrics {
+		metric := testMetric("pod-a", 10)
+		metric.Data.SQLPattern = "SELECT * FROM users WHERE name = '" + strings.Repeat("x", size) + "'"
+		return metric
+	}
+	single := func(metric QueryMetrics) string {
+		body, _ := json.Marshal(metric)
+		return string(body)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"single within limit", single(padded(1000)), http.StatusOK},
+		{"single over limit", single(padded(3000)), http.StatusRequestEntityTooLarge},
+		{"batch over the single limit", testBatch(t, padded(1500), padded(1500)), http.StatusOK},
+		{"batch over limit", testBatch(t, padded(3000), padded(3000), padded(3000)), http.StatusRequestEntityTooLarge},
+		{"malformed", `{"event_type":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := postTestBody(h, tt.body); rec.Code != tt.want {
+			t.Errorf("%s (%d bytes): status = %d, want %d", tt.name, len(tt.body), rec.Code, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrorsReportPosition(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	single, _ := json.Marshal(testMetric("pod-a", 10))
+	typeMismatch := strings.Replace(string(single), `"execution_time_ms":10`, `"execution_time_ms":"slow"`, 1)
+	batchMismatch := strings.Replace(testBatch(t, testMetric("pod-a", 10), testMetric("pod-b", 20)), `"execution_time_ms":20`, `"execution_time_ms":true`, 1)
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]interface{}
+	}{
+		{"syntax", `{"event_type": "query_execution", "pod_name": }`, map[string]interface{}{
+			"offset": float64(strings.Index(`{"event_type": "query_execution", "pod_name": }`, "}") + 1),
+		}},
+		{"truncated", `{"event_type": "query_execution"`, map[string]interface{}{
+			"offset": float64(len(`{"event_type": "query_execution"`)),
+		}},
+		{"type mismatch", typeMismatch, map[string]interface{}{
+			"field":    "data.execution_time_ms",
+			"expected": "int64",
+			"got":      "string",
+			"offset":   float64(strings.Index(typeMismatch, `"slow"`) + len(`"slow"`)),
+		}},
+		{"type mismatch in a batch", batchMismatch, map[string]interface{}{
+			// The path names the batch element.
+			"field":    "1.data.execution_time_ms",
+			"expected": "int64",
+			"got":      "bool",
+			"offset":   float64(strings.Index(batchMismatch, "true") + len("true")),
+		}},
+	}
+	for _, tt := range tests {
+		rec := postTestBody(h, tt.body)
+		var body map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&body)
+		if rec.Code != http.StatusBadRequest || !strings.HasPrefix(fmt.Sprint(body["error"]), "Invalid JSON: ") {
+			t.Errorf("%s: response = %d %v, want 400 with the decode error", tt.name, rec.Code, body)
+			continue
+		}
+		for key, want := range tt.want {
+			if body[key] != want {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, body[key], want)
+			}
+		}
+	}
+}
+
+// temporaryError is a network error that claims to be worth retrying.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "network blip" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// blippingConn fails writes with a temporary error while blip is set.
+type blippingConn struct {
+	net.Conn
+	blip *atomic.Bool
+}
+
+func (c blippingConn) Write(p []byte) (int, error) {
+	if c.blip.Load() {
+		return 0, temporaryError{}
+	}
+	return c.Conn.Write(p)
+}
+
+// TestWriteErrorsArePermanent pins the gorilla/websocket behavior writeFrame
+// relies on in giving up on network errors: once a write fails, every later
+// write fails with the same error, which no longer reports itself as
+// temporary.
+func TestWriteErrorsArePermanent(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	var blip atomic.Bool
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return blippingConn{Conn: conn, blip: &blip}, nil
+	}
+	conn, _, err := dialTestHubWith(t, &dialer, h, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blip.Store(true)
+	first := conn.WriteJSON(ControlMessage{Action: "ping"})
+	if first == nil {
+		t.Fatal("write during the blip succeeded")
+	}
+	var netErr net.Error
+	if errors.As(first, &netErr) && netErr.Temporary() {
+		t.Errorf("write error %v is temporary, want it reported as permanent", first)
+	}
+	blip.Store(false)
+	if err := conn.WriteJSON(ControlMessage{Action: "ping"}); err != first {
+		t.Errorf("write after the blip = %v, want the first error %v again", err, first)
+	}
+	if writeTimedOut(first) {
+		t.Errorf("write error %v is a timeout, want writeFrame not to retry it", first)
+	}
+}
+
+func TestRetryWrite(t *testing.T) {
+	timeout := &net.OpError{Op: "write", Err: os.ErrDeadlineExceeded}
+	tests := []struct {
+		name      string
+		failures  []error
+		wantErr   error
+		wantCalls int
+	}{
+		{"success", nil, nil, 1},
+		{"timeouts then success", []error{timeout, timeout}, nil, 3},
+		{"permanent error", []error{io.ErrClosedPipe}, io.ErrClosedPipe, 1},
+		{"timeouts past the bound", []error{timeout, timeout, timeout, timeout, timeout}, timeout, writeRetries + 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := retryWrite(nil, func() error {
+			calls++
+			if calls <= len(tt.failures) {
+				return tt.failures[calls-1]
+			}
+			return nil
+		})
+		if err != tt.wantErr || calls != tt.wantCalls {
+			t.Errorf("%s: err = %v after %d calls, want %v after %d", tt.name, err, calls, tt.wantErr, tt.wantCalls)
+		}
+	}
+
+	done := make(chan struct{})
+	close(done)
+	calls := 0
+	if err := retryWrite(done, func() error { calls++; return timeout }); err != timeout || calls != 1 {
+		t.Errorf("stopped hub: err = %v after %d calls, want no retry", err, calls)
+	}
+}
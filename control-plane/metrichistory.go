@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxHistoryLimit caps the page size of /api/history.
+const maxHistoryLimit = 1000
+
+// HistoryQuery selects stored metrics by receive time, pod and event type.
+// Zero values leave that filter open.
+type HistoryQuery struct {
+	From      time.Time
+	To        time.Time
+	PodName   string
+	EventType string
+	Limit     int
+	Offset    int
+}
+
+// parseHistoryQuery reads /api/history's parameters.
+func parseHistoryQuery(r *http.Request) (HistoryQuery, error) {
+	params := r.URL.Query()
+	query := HistoryQuery{
+		PodName:   params.Get("pod"),
+		EventType: params.Get("event_type"),
+		Limit:     100,
+	}
+	var err error
+	if value := params.Get("from"); value != "" {
+		if query.From, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, errors.New("Invalid from")
+		}
+	}
+	if value := params.Get("to"); value != "" {
+		if query.To, err = time.Parse(time.RFC3339, value); err != nil {
+			return query, errors.New("Invalid to")
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return query, errors.New("to must not be before from")
+	}
+	if value := params.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 {
+			return query, errors.New("Invalid limit")
+		}
+		query.Limit = min(query.Limit, maxHistoryLimit)
+	}
+	if value := params.Get("offset"); value != "" {
+		if query.Offset, err = strconv.Atoi(value); err != nil || query.Offset < 0 {
+			return query, errors.New("Invalid offset")
+		}
+	}
+	return query, nil
+}
+
+// historyHandler serves GET /api/history?from=&to=&pod=&event_type=&limit=&offset=
+// from the persistent store, oldest first. It answers 501 when no queryable
+// sink is configured.
+func (h *Hub) historyHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseHistoryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	metrics, err := h.sink.queryRange(ctx, query)
+	if errors.Is(err, errHistoryUnsupported) {
+		http.Error(w, "No metric store configured", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to query metric history", "error", err)
+		http.Error(w, "Failed to query metric history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metrics": metrics,
+		"count":   len(metrics),
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
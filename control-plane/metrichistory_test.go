@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// queryingSink answers history queries with its stored metrics, recording
+// the last query it was asked.
+type queryingSink struct {
+	NullSink
+	stored []StoredMetric
+	err    error
+	query  HistoryQuery
+}
+
+func (s *queryingSink) QueryRange(ctx context.Context, query HistoryQuery) ([]StoredMetric, error) {
+	s.query = query
+	return s.stored, s.err
+}
+
+func TestParseHistoryQuery(t *testing.T) {
+	from := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	to := from.Add(time.Hour)
+	tests := []struct {
+		params string
+		want   HistoryQuery
+		err    string
+	}{
+		{"", HistoryQuery{Limit: 100}, ""},
+		{
+			"from=2024-01-02T03:04:05Z&to=2024-01-02T04:04:05Z&pod=pod-a&event_type=query_execution&limit=20&offset=40",
+			HistoryQuery{From: from, To: to, PodName: "pod-a", EventType: "query_execution", Limit: 20, Offset: 40},
+			"",
+		},
+		{"limit=5000", HistoryQuery{Limit: maxHistoryLimit}, ""},
+		{"from=yesterday", HistoryQuery{}, "Invalid from"},
+		{"to=2024-01-02", HistoryQuery{}, "Invalid to"},
+		{"from=2024-01-02T04:04:05Z&to=2024-01-02T03:04:05Z", HistoryQuery{}, "to must not be before from"},
+		{"limit=0", HistoryQuery{}, "Invalid limit"},
+		{"limit=ten", HistoryQuery{}, "Invalid limit"},
+		{"offset=-1", HistoryQuery{}, "Invalid offset"},
+	}
+	for _, tt := range tests {
+		query, err := parseHistoryQuery(httptest.NewRequest(http.MethodGet, "/api/history?"+tt.params, nil))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: error = %v, want %q", tt.params, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.params, err)
+			continue
+		}
+		if !query.From.Equal(tt.want.From) || !query.To.Equal(tt.want.To) || query.PodName != tt.want.PodName ||
+			query.EventType != tt.want.EventType || query.Limit != tt.want.Limit || query.Offset != tt.want.Offset {
+			t.Errorf("%q: query = %+v, want %+v", tt.params, query, tt.want)
+		}
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	h := newHub(testConfig())
+	get := func(params string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.historyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+params, nil))
+		return rec
+	}
+
+	if rec := get(""); rec.Code != http.StatusNotImplemented {
+		t.Errorf("status without a queryable sink = %d, want 501", rec.Code)
+	}
+
+	received := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sink := &queryingSink{stored: []StoredMetric{
+		{Seq: 7, ReceivedAt: received, Metric: testMetric("pod-a", 10)},
+		{Seq: 8, ReceivedAt: received.Add(time.Second), Metric: testMetric("pod-a", 20)},
+	}}
+	h.sink = newSinkWriter(sink, 1)
+
+	rec := get("pod=pod-a&limit=2&offset=6")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if sink.query.PodName != "pod-a" || sink.query.Limit != 2 || sink.query.Offset != 6 {
+		t.Errorf("sink queried with %+v, want the request's filters", sink.query)
+	}
+	var body struct {
+		Metrics []StoredMetric `json:"metrics"`
+		Count   int            `json:"count"`
+		Limit   int            `json:"limit"`
+		Offset  int            `json:"offset"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 2 || body.Limit != 2 || body.Offset != 6 || len(body.Metrics) != 2 {
+		t.Fatalf("body = %+v, want two metrics with the page echoed", body)
+	}
+	if got := body.Metrics[1]; got.Seq != 8 || !got.ReceivedAt.Equal(received.Add(time.Second)) || *got.Metric.Data.ExecutionTimeMs != 20 {
+		t.Errorf("second metric = %+v, want seq 8 received a second later", got)
+	}
+
+	sink.query = HistoryQuery{}
+	if rec := get("offset=-1"); rec.Code != http.StatusBadRequest || sink.query.Limit != 0 {
+		t.Errorf("bad offset: status = %d, want 400 without querying the sink", rec.Code)
+	}
+	sink.err = errors.New("connection refused")
+	if rec := get(""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("status on a failed query = %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LargeMutation is a single UPDATE or DELETE execution and the rows it
+// touched.
+type LargeMutation struct {
+	QueryID      string    `json:"query_id"`
+	SQLPattern   string    `json:"sql_pattern,omitempty"`
+	SQLType      string    `json:"sql_type"`
+	TableNames   []string  `json:"table_names,omitempty"`
+	RowsAffected int64     `json:"rows_affected"`
+	PodName      string    `json:"pod_name,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Timestamp    string    `json:"timestamp"`
+	ReceivedAt   time.Time `json:"received_at"`
+}
+
+// largeMutationHeap is a min-heap on rows affected, so the root is the
+// smallest retained mutation and the first to be evicted.
+type largeMutationHeap []LargeMutation
+
+func (h largeMutationHeap) Len() int            { return len(h) }
+func (h largeMutationHeap) Less(i, j int) bool  { return h[i].RowsAffected < h[j].RowsAffected }
+func (h largeMutationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *largeMutationHeap) Push(x interface{}) { *h = append(*h, x.(LargeMutation)) }
+func (h *largeMutationHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// massMutationTracker retains the capacity largest mutations seen and
+// decides which of them are warned about.
+type massMutationTracker struct {
+	mu        sync.Mutex
+	threshold int64
+	capacity  int
+	mutations largeMutationHeap
+}
+
+func newMassMutationTracker(threshold int64, capacity int) *massMutationTracker {
+	return &massMutationTracker{
+		threshold: threshold,
+		capacity:  capacity,
+		mutations: make(largeMutationHeap, 0, max(capacity, 0)),
+	}
+}
+
+// isMutation reports whether a SQL type can change many rows at once.
+func isMutation(sqlType string) bool {
+	switch strings.ToUpper(sqlType) {
+	case "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+// record offers a mutation to the top list and reports whether it affected
+// more rows than the threshold.
+func (t *massMutationTracker) record(mutation LargeMutation) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.capacity > 0 {
+		if len(t.mutations) < t.capacity {
+			heap.Push(&t.mutations, mutation)
+		} else if mutation.RowsAffected > t.mutations[0].RowsAffected {
+			t.mutations[0] = mutation
+			heap.Fix(&t.mutations, 0)
+		}
+	}
+	return t.threshold > 0 && mutation.RowsAffected > t.threshold
+}
+
+// largest returns up to limit retained mutations, largest first.
+func (t *massMutationTracker) largest(limit int) []LargeMutation {
+	t.mu.Lock()
+	result := append([]LargeMutation(nil), t.mutations...)
+	t.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].RowsAffected > result[j].RowsAffected })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// analyzeMutation tracks the rows touched by UPDATE and DELETE executions
+// and broadcasts and records a mass_mutation_warning for those over the
+// threshold, which usually means a missing or too broad WHERE clause. A
+// mutation is over once it ran, so there is nothing to resolve the alert on.
+func (h *Hub) analyzeMutation(metric QueryMetrics) {
+	if metric.EventType != "query_execution" || metric.Data == nil || metric.Data.RowsAffected == nil || !isMutation(metric.Data.SQLType) {
+		return
+	}
+	mutation := LargeMutation{
+		QueryID:      metric.Data.QueryID,
+		SQLPattern:   metric.Data.SQLPattern,
+		SQLType:      strings.ToUpper(metric.Data.SQLType),
+		TableNames:   metric.Data.TableNames,
+		RowsAffected: *metric.Data.RowsAffected,
+		PodName:      metric.PodName,
+		Namespace:    metric.Namespace,
+		Timestamp:    metric.Timestamp,
+		ReceivedAt:   time.Now(),
+	}
+	if !h.mutations.record(mutation) {
+		return
+	}
+
+	table := ""
+	if len(mutation.TableNames) > 0 {
+		table = mutation.TableNames[0]
+	}
+	severity := "warning"
+	if mutation.RowsAffected >= 10*h.mutations.threshold {
+		severity = "high"
+	}
+	h.alerts.fire("mass_mutation_warning", severity, metric.PodName, metric.Namespace, map[string]interface{}{
+		"sql_type":      mutation.SQLType,
+		"table":         table,
+		"rows_affected": mutation.RowsAffected,
+	})
+	h.publish(newNamespacedMessage("mass_mutation_warning", metric.Namespace, map[string]interface{}{
+		"pod_name":      metric.PodName,
+		"namespace":     metric.Namespace,
+		"query_id":      mutation.QueryID,
+		"sql_type":      mutation.SQLType,
+		"sql_pattern":   mutation.SQLPattern,
+		"table":         table,
+		"table_names":   mutation.TableNames,
+		"rows_affected": mutation.RowsAffected,
+		"threshold":     h.mutations.threshold,
+		"severity":      severity,
+	}))
+}
+
+// largeMutationsHandler serves GET /api/large-mutations?limit=20.
+func (h *Hub) largeMutationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	mutations := h.mutations.largest(limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mutations": mutations,
+		"count":     len(mutations),
+		"threshold": h.mutations.threshold,
+	})
+}
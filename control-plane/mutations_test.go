@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMassMutationTrackerKeepsLargest(t *testing.T) {
+	tracker := newMassMutationTracker(100, 3)
+	for _, rows := range []int64{50, 500, 5, 2000, 80, 150} {
+		over := tracker.record(LargeMutation{RowsAffected: rows})
+		if want := rows > 100; over != want {
+			t.Errorf("record(%d rows) = %v, want %v", rows, over, want)
+		}
+	}
+	var got []int64
+	for _, mutation := range tracker.largest(0) {
+		got = append(got, mutation.RowsAffected)
+	}
+	if len(got) != 3 || got[0] != 2000 || got[1] != 500 || got[2] != 150 {
+		t.Errorf("largest = %v, want [2000 500 150]", got)
+	}
+	if largest := tracker.largest(1); len(largest) != 1 || largest[0].RowsAffected != 2000 {
+		t.Errorf("largest(1) = %+v, want the 2000 row mutation", largest)
+	}
+
+	if newMassMutationTracker(0, 3).record(LargeMutation{RowsAffected: 1 << 40}) {
+		t.Error("a zero threshold warned, want the warning disabled")
+	}
+}
+
+func TestMassMutationWarning(t *testing.T) {
+	cfg := testConfig()
+	cfg.MassMutationThreshold = 1000
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=mass_mutation_warning,done")
+
+	for _, mutation := range []struct {
+		sqlType string
+		rows    int64
+	}{{"update", 1000}, {"SELECT", 50000}, {"DELETE", 1500}, {"UPDATE", 10000}} {
+		metric := testMetric("pod-a", 10)
+		metric.Data.SQLType = mutation.sqlType
+		metric.Data.SQLPattern = mutation.sqlType + " users SET active = ?"
+		metric.Data.RowsAffected = ptr(mutation.rows)
+		postTestMetric(t, h, metric)
+	}
+	h.publish(newMessage("done", nil))
+
+	var warnings []map[string]interface{}
+	for {
+		message := readTestMessage(t, conn)
+		if message.Type == "done" {
+			break
+		}
+		warnings = append(warnings, message.Data.(map[string]interface{}))
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("warnings = %v, want the DELETE and the large UPDATE", warnings)
+	}
+	for i, want := range []struct {
+		sqlType  string
+		rows     float64
+		severity string
+	}{{"DELETE", 1500, "warning"}, {"UPDATE", 10000, "high"}} {
+		got := warnings[i]
+		if got["sql_type"] != want.sqlType || got["rows_affected"] != want.rows || got["severity"] != want.severity ||
+			got["table"] != "users" || got["threshold"] != float64(1000) {
+			t.Errorf("warning %d = %v, want a %s %s of %v rows on users", i, got, want.severity, want.sqlType, want.rows)
+		}
+	}
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "mass_mutation_warning")
+	if len(alerts) != 1 || alerts[0].Severity != "high" || alerts[0].Details["sql_type"] != "UPDATE" {
+		t.Errorf("alert history = %+v, want one alert updated to the high UPDATE", alerts)
+	}
+
+	rec := httptest.NewRecorder()
+	h.largeMutationsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/large-mutations", nil))
+	var body struct {
+		Mutations []LargeMutation `json:"mutations"`
+		Count     int             `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	// Mutations under the threshold are still ranked; SELECTs never are.
+	if body.Count != 3 || body.Mutations[0].RowsAffected != 10000 || body.Mutations[1].RowsAffected != 1500 || body.Mutations[2].RowsAffected != 1000 {
+		t.Errorf("large mutations = %+v, want the three UPDATEs and DELETEs, largest first", body.Mutations)
+	}
+	if got := body.Mutations[0]; got.SQLType != "UPDATE" || got.PodName != "pod-a" || got.ReceivedAt.IsZero() {
+		t.Errorf("largest mutation = %+v, want the UPDATE from pod-a", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.largeMutationsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/large-mutations?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for limit=0 = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSubscriber ingests metrics published by agents to a NATS subject.
+type natsSubscriber struct {
+	conn   *nats.Conn
+	closed chan struct{}
+}
+
+// startNATSSubscriber connects to url and feeds every message on subject to
+// the hub. The connection reconnects indefinitely after a disconnect.
+func startNATSSubscriber(h *Hub, url, subject string) (*natsSubscriber, error) {
+	closed := make(chan struct{})
+	conn, err := nats.Connect(url,
+		nats.Name("kubedb-monitor-control-plane"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			slog.Warn("nats disconnected", "error", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("nats reconnected", "url", c.ConnectedUrl())
+		}),
+		nats.ClosedHandler(func(*nats.Conn) {
+			close(closed)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Subscribe(subject, func(msg *nats.Msg) {
+		if err := h.ingestPayload(msg.Data, "nats", false); err != nil {
+			slog.Error("failed to ingest nats message", "subject", msg.Subject, "error", err)
+		}
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	slog.Info("subscribed to nats", "url", url, "subject", subject)
+	return &natsSubscriber{conn: conn, closed: closed}, nil
+}
+
+// stop lets already delivered messages finish and closes the connection.
+// It must run before the ingestion pipeline is stopped.
+func (s *natsSubscriber) stop() {
+	if err := s.conn.Drain(); err != nil {
+		slog.Warn("failed to drain nats connection", "error", err)
+		s.conn.Close()
+	}
+	<-s.closed
+}
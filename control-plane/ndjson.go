@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// streamSubmitRetry is how long a streaming upload waits before retrying a
+// metric the ingestion pipeline had no room for.
+const streamSubmitRetry = 100 * time.Millisecond
+
+// receiveMetricStream serves POST /api/metrics/stream (and /api/metrics/bulk),
+// newline-delimited JSON metrics over one long-lived request. Each line is
+// ingested as it arrives; lines that do not decode or validate are counted
+// and skipped rather than ending the stream. Instead of rejecting, the
+// stream is slowed down while the source is rate limited or the pipeline is
+// full. The response reports the counts once the body ends.
+func (h *Hub) receiveMetricStream(w http.ResponseWriter, r *http.Request) {
+	if h.isClosing() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	// The server's ReadTimeout would otherwise cut long uploads short, and
+	// its WriteTimeout, counted from the end of the request headers, would
+	// drop the summary written once the body ends.
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+
+	// The scanner's limit is the larger of its buffer's capacity and the
+	// maximum, so the buffer must not start out larger than a metric may be.
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, min(64*1024, int(h.cfg.MaxMetricBytes))), int(h.cfg.MaxMetricBytes))
+	accepted, invalid := 0, 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var metric QueryMetrics
+		err := json.Unmarshal(line, &metric)
+		if err == nil {
+			err = applyFieldAliases(line, []QueryMetrics{metric}, h.cfg.FieldAliases)
+		}
+		if err != nil {
+			invalid++
+			h.dlq.add(DeadLetter{Reason: deadLetterDecode, Detail: err.Error(), Source: r.RemoteAddr, Payload: string(line), At: time.Now()})
+			continue
+		}
+		metricsReceivedTotal.WithLabelValues(eventTypeLabel(metric.EventType)).Inc()
+		if metric.PodName == "" {
+			metric.PodName = extractPodNameFromRequest(r)
+		}
+		if metric.Namespace == "" {
+			metric.Namespace = extractNamespaceFromRequest(r)
+		}
+		err = validateMetric(metric)
+		if err == nil {
+			err = validateClockSkew(metric, time.Now(), h.cfg.ClockSkewTolerance)
+		}
+		if err != nil {
+			invalid++
+			h.dlq.rejectMetric(metric, r.RemoteAddr, err)
+			continue
+		}
+
+		if err := h.submitStreamed(r, metric); err != nil {
+			slog.Warn("metric stream ended early", "remote_addr", r.RemoteAddr, "accepted", accepted, "error", err)
+			writeStreamResult(w, http.StatusServiceUnavailable, accepted, invalid, err)
+			return
+		}
+		accepted++
+	}
+
+	status := http.StatusOK
+	err := scanner.Err()
+	switch {
+	case errors.Is(err, bufio.ErrTooLong):
+		status = http.StatusRequestEntityTooLarge
+	case err != nil:
+		// Most likely the client went away; there may be nobody left to
+		// read the response.
+		status = http.StatusBadRequest
+	}
+	slog.Info("metric stream finished", "remote_addr", r.RemoteAddr, "accepted", accepted, "invalid", invalid, "error", err)
+	writeStreamResult(w, status, accepted, invalid, err)
+}
+
+// submitStreamed hands one streamed metric to the pipeline, waiting out the
+// source's rate limit and a full queue. It fails once the request is gone or
+// the control plane is shutting down.
+func (h *Hub) submitStreamed(r *http.Request, metric QueryMetrics) error {
+	source := ingestSourceKey(r, []QueryMetrics{metric})
+	for {
+		wait := streamSubmitRetry
+		if ok, retryAfter := h.limiter.allow(source, time.Now()); !ok {
+			wait = retryAfter
+		} else {
+			err := h.ingest.submit(metric, false)
+			if !errors.Is(err, errQueueFull) {
+				return err
+			}
+		}
+		select {
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
+
+func writeStreamResult(w http.ResponseWriter, status, accepted, invalid int, err error) {
+	body := map[string]interface{}{"count": accepted, "errors": invalid}
+	if err != nil {
+		body["error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postTestStream streams body to the hub's /api/metrics/stream handler and
+// returns the status and decoded summary.
+func postTestStream(t *testing.T, h *Hub, body io.Reader) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.receiveMetricStream(rec, httptest.NewRequest(http.MethodPost, "/api/metrics/stream", body))
+	var summary map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, summary
+}
+
+// ndjsonLine encodes metric as one NDJSON line.
+func ndjsonLine(t *testing.T, metric QueryMetrics) string {
+	t.Helper()
+	line, err := json.Marshal(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(line) + "\n"
+}
+
+func TestMetricStreamSkipsBadLines(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+	before := len(h.dlq.recent(100))
+
+	invalid := testMetric("pod-c", 10)
+	invalid.EventType = ""
+	body := ndjsonLine(t, testMetric("pod-a", 10)) +
+		"{\"pod_name\": \"pod-x\", \n" +
+		"\n" +
+		ndjsonLine(t, invalid) +
+		ndjsonLine(t, testMetric("pod-b", 20))
+
+	status, summary := postTestStream(t, h, strings.NewReader(body))
+	if status != http.StatusOK || summary["count"] != float64(2) || summary["errors"] != float64(2) {
+		t.Fatalf("response = %d %v, want 200 with 2 accepted and 2 errors", status, summary)
+	}
+	// Pipeline workers may broadcast the two in either order.
+	broadcast := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		broadcast[readTestMessage(t, conn).Data.(map[string]interface{})["pod_name"]] = true
+	}
+	if !broadcast["pod-a"] || !broadcast["pod-b"] {
+		t.Errorf("broadcast pods %v, want pod-a and pod-b", broadcast)
+	}
+	if got := len(h.dlq.recent(100)) - before; got != 2 {
+		t.Errorf("%d dead letters recorded, want one per bad line", got)
+	}
+}
+
+func TestMetricStreamIngestsLinesAsTheyArrive(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+	reader, writer := io.Pipe()
+
+	done := make(chan map[string]interface{}, 1)
+	go func() {
+		_, summary := postTestStream(t, h, reader)
+		done <- summary
+	}()
+
+	// Each metric is broadcast while the request is still open.
+	for _, pod := range []string{"pod-a", "pod-b"} {
+		io.WriteString(writer, ndjsonLine(t, testMetric(pod, 10)))
+		if data := readTestMessage(t, conn).Data.(map[string]interface{}); data["pod_name"] != pod {
+			t.Errorf("broadcast %v, want %s", data["pod_name"], pod)
+		}
+	}
+	writer.Close()
+	if summary := <-done; summary["count"] != float64(2) {
+		t.Errorf("summary = %v, want 2 accepted", summary)
+	}
+}
+
+func TestMetricStreamLineOverLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxMetricBytes = 1024
+	h := startTestHub(t, cfg)
+
+	oversized := testMetric("pod-b", 10)
+	oversized.Data.SQLPattern = strings.Repeat("x", 2048)
+	status, summary := postTestStream(t, h, strings.NewReader(ndjsonLine(t, testMetric("pod-a", 10))+ndjsonLine(t, oversized)))
+	if status != http.StatusRequestEntityTooLarge || summary["count"] != float64(1) {
+		t.Errorf("response = %d %v, want 413 after 1 accepted", status, summary)
+	}
+}
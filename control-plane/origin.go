@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// originAllowlist restricts WebSocket upgrades to a fixed set of origins,
+// compared by scheme and host. An empty allowlist allows every origin.
+type originAllowlist map[string]bool
+
+// parseOriginAllowlist parses a comma-separated list of origins such as
+// "https://dashboard.example.com,http://localhost:3000". Entries that are
+// not absolute URLs are ignored.
+func parseOriginAllowlist(raw string) originAllowlist {
+	allowed := make(originAllowlist)
+	for _, entry := range strings.Split(raw, ",") {
+		if key, ok := originKey(strings.TrimSpace(entry)); ok {
+			allowed[key] = true
+		}
+	}
+	return allowed
+}
+
+func (a originAllowlist) allows(origin string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	key, ok := originKey(origin)
+	return ok && a[key]
+}
+
+// originKey reduces an origin to its lower-cased scheme://host form.
+func originKey(origin string) (string, bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host), true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOriginAllowlist(t *testing.T) {
+	allowlist := parseOriginAllowlist("https://dashboard.example.com, http://localhost:3000,not-a-url")
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://dashboard.example.com", true},
+		{"https://Dashboard.Example.com", true},
+		{"http://localhost:3000", true},
+		{"http://dashboard.example.com", false},
+		{"https://dashboard.example.com:8443", false},
+		{"http://localhost:3001", false},
+		{"https://evil.example.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.allows(tt.origin); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	if len(allowlist) != 2 {
+		t.Errorf("allowlist has %d entries, want 2 with the invalid one ignored", len(allowlist))
+	}
+
+	if !parseOriginAllowlist("").allows("https://anywhere.example.com") {
+		t.Error("empty allowlist refused an origin")
+	}
+}
+
+func TestUpgradeFromAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist string
+		origin    string
+		want      int
+	}{
+		{"allowed", "https://dashboard.example.com", "https://dashboard.example.com", http.StatusSwitchingProtocols},
+		{"disallowed", "https://dashboard.example.com", "https://evil.example.com", http.StatusForbidden},
+		{"no allowlist", "", "https://evil.example.com", http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AllowedWSOrigins = parseOriginAllowlist(tt.allowlist)
+			h := startTestHub(t, cfg)
+
+			_, resp, _ := dialTestHubWithHeader(t, h, "", http.Header{"Origin": {tt.origin}})
+			if resp == nil || resp.StatusCode != tt.want {
+				t.Errorf("response = %v, want status %d", resp, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// chunkOverhead is the room left in each chunk frame for its envelope.
+const chunkOverhead = 256
+
+// compressMinBytes is the smallest payload worth deflating; below it the
+// compression overhead outweighs the savings.
+const compressMinBytes = 512
+
+// payloadStore keeps the most recent oversized outbound messages so that
+// clients which were sent a reference can fetch them over HTTP.
+type payloadStore struct {
+	mu       sync.Mutex
+	capacity int
+	nextID   uint64
+	order    []string
+	payloads map[string][]byte
+}
+
+func newPayloadStore(capacity int) *payloadStore {
+	return &payloadStore{
+		capacity: capacity,
+		payloads: make(map[string][]byte),
+	}
+}
+
+func (s *payloadStore) put(payload []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := fmt.Sprintf("msg-%d-%d", time.Now().Unix(), s.nextID)
+	s.payloads[id] = payload
+	s.order = append(s.order, id)
+	for len(s.order) > s.capacity {
+		delete(s.payloads, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+func (s *payloadStore) get(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload, ok := s.payloads[id]
+	return payload, ok
+}
+
+// enableCompression prepares a connection for permessage-deflate. It is a
+// no-op when the client did not negotiate the extension, in which case every
+// frame is sent uncompressed.
+func enableCompression(conn *websocket.Conn) {
+	conn.SetCompressionLevel(flate.BestSpeed)
+	conn.EnableWriteCompression(true)
+}
+
+// writeMessage encodes and writes one message in the client's format.
+// Messages larger than the configured outbound limit are chunked for clients
+// that negotiated chunking and replaced by a message_ref pointing at
+// /api/messages/{id} otherwise.
+func (c *Client) writeMessage(message WebSocketMessage) error {
+	payload, err := c.encode(message)
+	if err != nil {
+		slog.Error("failed to encode outbound message", "message_type", message.Type, "error", err)
+		return nil
+	}
+
+	if c.hub.cfg.WSCompression {
+		c.conn.EnableWriteCompression(len(payload) >= compressMinBytes)
+	}
+
+	limit := c.hub.cfg.MaxMessageBytes
+	if limit <= 0 || len(payload) <= limit {
+		return c.writeFrame(c.frameType(), payload)
+	}
+
+	slog.Info("outbound message over size limit", "message_type", message.Type, "size_bytes", len(payload), "limit_bytes", limit, "chunking", c.chunking)
+	if c.chunking {
+		return c.writeChunks(message.Type, payload, limit)
+	}
+
+	// /api/messages serves JSON whatever the client's format.
+	if c.format == formatMsgpack {
+		if payload, err = json.Marshal(message); err != nil {
+			return nil
+		}
+	}
+	id := c.hub.oversized.put(payload)
+	return c.writeEncoded(newMessage("message_ref", map[string]interface{}{
+		"id":           id,
+		"message_type": message.Type,
+		"size_bytes":   len(payload),
+		"url":          "/api/messages/" + id,
+	}))
+}
+
+// writeChunks splits an encoded message into message_chunk frames that the
+// client reassembles by id and index. MessagePack chunks carry their slice of
+// the payload as binary rather than a string.
+func (c *Client) writeChunks(messageType string, payload []byte, limit int) error {
+	chunkSize := max(limit-chunkOverhead, limit/2, 1)
+	total := (len(payload) + chunkSize - 1) / chunkSize
+	id := fmt.Sprintf("chunk-%d", time.Now().UnixNano())
+
+	for index := 0; index < total; index++ {
+		end := min((index+1)*chunkSize, len(payload))
+		var part interface{} = string(payload[index*chunkSize : end])
+		if c.format == formatMsgpack {
+			part = payload[index*chunkSize : end]
+		}
+		chunk := newMessage("message_chunk", map[string]interface{}{
+			"id":           id,
+			"message_type": messageType,
+			"index":        index,
+			"total":        total,
+			"payload":      part,
+		})
+		if err := c.writeEncoded(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oversizedMessageHandler serves GET /api/messages/{id}.
+func (h *Hub) oversizedMessageHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := h.oversized.get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Message not found or expired", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// bigTestMessage returns a message whose encoding is well over size bytes.
+func bigTestMessage(size int) WebSocketMessage {
+	return newMessage("deadlock_event", map[string]interface{}{"graph": strings.Repeat("x", size)})
+}
+
+func TestOversizedMessageBecomesReference(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxMessageBytes = 1024
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=deadlock_event")
+
+	h.publish(bigTestMessage(4096))
+	message := readTestMessage(t, conn)
+	if message.Type != "message_ref" {
+		t.Fatalf("message type = %q, want message_ref", message.Type)
+	}
+	ref := message.Data.(map[string]interface{})
+	if ref["message_type"] != "deadlock_event" || ref["url"] != "/api/messages/"+ref["id"].(string) {
+		t.Fatalf("message_ref data = %v", ref)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, ref["url"].(string), nil), map[string]string{"id": ref["id"].(string)})
+	rec := httptest.NewRecorder()
+	h.oversizedMessageHandler(rec, req)
+	var original WebSocketMessage
+	if err := json.NewDecoder(rec.Body).Decode(&original); err != nil {
+		t.Fatalf("fetch %s: status %d: %v", ref["url"], rec.Code, err)
+	}
+	if original.Type != "deadlock_event" || len(original.Data.(map[string]interface{})["graph"].(string)) != 4096 {
+		t.Errorf("fetched message type %q, want the original deadlock_event", original.Type)
+	}
+}
+
+func TestOversizedMessageIsChunked(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxMessageBytes = 1024
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=deadlock_event&chunking=1")
+
+	h.publish(bigTestMessage(4096))
+	var payload strings.Builder
+	for index := 0; ; index++ {
+		message := readTestMessage(t, conn)
+		chunk := message.Data.(map[string]interface{})
+		if message.Type != "message_chunk" || chunk["index"] != float64(index) {
+			t.Fatalf("message %d = %q %v, want message_chunk %d", index, message.Type, chunk["index"], index)
+		}
+		payload.WriteString(chunk["payload"].(string))
+		if index+1 == int(chunk["total"].(float64)) {
+			break
+		}
+	}
+
+	var original WebSocketMessage
+	if err := json.Unmarshal([]byte(payload.String()), &original); err != nil {
+		t.Fatalf("reassembled chunks: %v", err)
+	}
+	if original.Type != "deadlock_event" {
+		t.Errorf("reassembled message type = %q, want deadlock_event", original.Type)
+	}
+}
+
+func TestPayloadStoreEvictsOldest(t *testing.T) {
+	store := newPayloadStore(2)
+	first := store.put([]byte("1"))
+	store.put([]byte("2"))
+	store.put([]byte("3"))
+	if _, ok := store.get(first); ok {
+		t.Error("oldest payload kept past capacity")
+	}
+}
+
+func TestCompressedLargeMessageRoundTrips(t *testing.T) {
+	previous := upgrader.EnableCompression
+	upgrader.EnableCompression = true
+	t.Cleanup(func() { upgrader.EnableCompression = previous })
+
+	graph := strings.Repeat("connection-1 waits for connection-2; ", 4000)
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"negotiated", true},
+		// Clients without the extension get the same message uncompressed.
+		{"not offered", false},
+	}
+	for _, tt := range tests {
+		h := startTestHub(t, testConfig())
+		dialer := &websocket.Dialer{EnableCompression: tt.compress}
+		conn, resp, err := dialTestHubWith(t, dialer, h, "types=deadlock_event", nil)
+		if err != nil {
+			t.Fatalf("%s: dial: %v", tt.name, err)
+		}
+		negotiated := strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+		if negotiated != tt.compress {
+			t.Errorf("%s: permessage-deflate negotiated = %v, want %v", tt.name, negotiated, tt.compress)
+		}
+		readTestMessage(t, conn)
+
+		h.publish(newMessage("deadlock_event", map[string]interface{}{"graph": graph}))
+		message := readTestMessage(t, conn)
+		if got := message.Data.(map[string]interface{})["graph"]; got != graph {
+			t.Errorf("%s: large message did not round-trip intact", tt.name)
+		}
+	}
+}
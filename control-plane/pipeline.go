@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	errQueueFull      = errors.New("ingestion queue is full")
+	errPipelineClosed = errors.New("ingestion pipeline is stopped")
+)
+
+// ingestJob is one metric waiting to be processed. done is non-nil for
+// synchronous submissions and receives the processing result. ctx carries
+// the submitting request's span, if any.
+type ingestJob struct {
+	ctx    context.Context
+	metric QueryMetrics
+	done   chan error
+}
+
+// ingestPipeline decouples the HTTP handlers from metric processing. Metrics
+// are sharded onto per-worker queues by pod name, so every pod's metrics are
+// processed in the order they were accepted while different pods proceed in
+// parallel.
+//
+// Workers block while the broadcast channel is full, so a slow hub backs up
+// the queues and, after submitTimeout, turns into errQueueFull for callers.
+type ingestPipeline struct {
+	mu            sync.RWMutex
+	closed        bool
+	queues        []chan ingestJob
+	process       func(QueryMetrics) error
+	submitTimeout time.Duration
+	wg            sync.WaitGroup
+}
+
+func newIngestPipeline(workers, queueSize int, submitTimeout time.Duration, process func(QueryMetrics) error) *ingestPipeline {
+	workers = max(workers, 1)
+	perWorker := max(queueSize/workers, 1)
+	queues := make([]chan ingestJob, workers)
+	for i := range queues {
+		queues[i] = make(chan ingestJob, perWorker)
+	}
+	return &ingestPipeline{queues: queues, process: process, submitTimeout: submitTimeout}
+}
+
+func (p *ingestPipeline) start() {
+	for _, queue := range p.queues {
+		p.wg.Add(1)
+		go p.work(queue)
+	}
+	slog.Info("ingestion pipeline started", "workers", len(p.queues))
+}
+
+func (p *ingestPipeline) work(queue chan ingestJob) {
+	defer p.wg.Done()
+	for job := range queue {
+		err := p.processTraced(job)
+		if job.done != nil {
+			job.done <- err
+		} else if err != nil {
+			slog.Error("failed to process metric", "event_type", job.metric.EventType, "pod_name", job.metric.PodName, "error", err)
+		}
+	}
+}
+
+// processTraced processes a job inside a child span of the request that
+// submitted it. Metrics submitted without a span, such as those consumed
+// from NATS or Kafka, are processed untraced.
+func (p *ingestPipeline) processTraced(job ingestJob) error {
+	if !trace.SpanContextFromContext(job.ctx).IsValid() {
+		return p.process(job.metric)
+	}
+	_, span := tracer.Start(job.ctx, "process metric", trace.WithAttributes(metricAttributes(job.metric)...))
+	defer span.End()
+	err := p.process(job.metric)
+	if err != nil {
+		failSpan(span, err)
+	}
+	return err
+}
+
+// submit enqueues a metric and fails with errQueueFull when its worker stays
+// backed up for longer than submitTimeout. With wait set it returns only
+// after the metric has been processed, reporting the processing error.
+func (p *ingestPipeline) submit(metric QueryMetrics, wait bool) error {
+	return p.submitContext(context.Background(), metric, wait)
+}
+
+// submitContext is submit for a metric whose processing should be traced
+// as part of the span in ctx.
+func (p *ingestPipeline) submitContext(ctx context.Context, metric QueryMetrics, wait bool) error {
+	job := ingestJob{ctx: ctx, metric: metric}
+	if wait {
+		job.done = make(chan error, 1)
+	}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return errPipelineClosed
+	}
+	if !p.enqueue(p.queueFor(metric.PodName), job) {
+		p.mu.RUnlock()
+		ingestBackpressureTotal.Inc()
+		return errQueueFull
+	}
+	p.mu.RUnlock()
+
+	if wait {
+		return <-job.done
+	}
+	return nil
+}
+
+// enqueue waits up to submitTimeout for room in queue, so a momentarily full
+// queue does not reject the metric. Callers hold p.mu for reading.
+func (p *ingestPipeline) enqueue(queue chan ingestJob, job ingestJob) bool {
+	select {
+	case queue <- job:
+		return true
+	default:
+	}
+	if p.submitTimeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(p.submitTimeout)
+	defer timer.Stop()
+	select {
+	case queue <- job:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (p *ingestPipeline) queueFor(podName string) chan ingestJob {
+	hash := fnv.New32a()
+	hash.Write([]byte(podName))
+	return p.queues[hash.Sum32()%uint32(len(p.queues))]
+}
+
+// pending counts the metrics waiting in the worker queues.
+func (p *ingestPipeline) pending() int {
+	pending := 0
+	for _, queue := range p.queues {
+		pending += len(queue)
+	}
+	return pending
+}
+
+// stop rejects new submissions and waits for queued metrics to be processed.
+func (p *ingestPipeline) stop() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
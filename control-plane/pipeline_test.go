@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipelinePreservesPerPodOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+	pipeline := newIngestPipeline(4, 16, time.Second, func(metric QueryMetrics) error {
+		// Uneven processing times would reorder metrics handed to
+		// different workers.
+		time.Sleep(time.Duration(*metric.Data.ExecutionTimeMs%3) * 100 * time.Microsecond)
+		mu.Lock()
+		seen[metric.PodName] = append(seen[metric.PodName], *metric.Data.ExecutionTimeMs)
+		mu.Unlock()
+		return nil
+	})
+	pipeline.start()
+
+	const perPod = 100
+	for i := 0; i < perPod; i++ {
+		for pod := 0; pod < 6; pod++ {
+			if err := pipeline.submit(testMetric(fmt.Sprintf("pod-%d", pod), int64(i)), false); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	pipeline.stop()
+
+	for podName, order := range seen {
+		if len(order) != perPod {
+			t.Errorf("%s: processed %d metrics, want %d", podName, len(order), perPod)
+			continue
+		}
+		for i, value := range order {
+			if value != int64(i) {
+				t.Errorf("%s: metric %d processed at position %d", podName, value, i)
+				break
+			}
+		}
+	}
+}
+
+// blockedTestPipeline returns a one-worker pipeline whose worker is stuck on
+// a first metric and whose queue is full, and a function to unblock it.
+func blockedTestPipeline(t *testing.T, submitTimeout time.Duration) (*ingestPipeline, func()) {
+	t.Helper()
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	pipeline := newIngestPipeline(1, 1, submitTimeout, func(QueryMetrics) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+	pipeline.start()
+	if err := pipeline.submit(testMetric("pod-a", 1), false); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := pipeline.submit(testMetric("pod-a", 2), false); err != nil {
+		t.Fatal(err)
+	}
+
+	var once sync.Once
+	unblock := func() {
+		once.Do(func() {
+			close(release)
+			pipeline.stop()
+		})
+	}
+	t.Cleanup(unblock)
+	return pipeline, unblock
+}
+
+func TestPipelineFullAfterSubmitTimeout(t *testing.T) {
+	const submitTimeout = 100 * time.Millisecond
+	pipeline, unblock := blockedTestPipeline(t, submitTimeout)
+
+	start := time.Now()
+	err := pipeline.submit(testMetric("pod-a", 3), false)
+	if !errors.Is(err, errQueueFull) {
+		t.Fatalf("submit to a full queue = %v, want errQueueFull", err)
+	}
+	if waited := time.Since(start); waited < submitTimeout {
+		t.Errorf("gave up after %v, want at least %v", waited, submitTimeout)
+	}
+
+	unblock()
+	if err := pipeline.submit(testMetric("pod-a", 4), false); !errors.Is(err, errPipelineClosed) {
+		t.Errorf("submit after stop = %v, want errPipelineClosed", err)
+	}
+}
+
+func TestReceiveMetricsFullQueueIs503(t *testing.T) {
+	const submitTimeout = 100 * time.Millisecond
+	h := newHub(testConfig())
+	h.ingest, _ = blockedTestPipeline(t, submitTimeout)
+
+	body, _ := json.Marshal(testMetric("pod-a", 3))
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.receiveMetrics(rec, httptest.NewRequest(http.MethodPost, "/api/metrics", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("status = %d, Retry-After = %q, want 503 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if waited := time.Since(start); waited < submitTimeout {
+		t.Errorf("answered after %v, want at least the %v submit timeout", waited, submitTimeout)
+	}
+}
+
+func TestReceiveMetricsSyncReportsProcessing(t *testing.T) {
+	h := startTestHub(t, testConfig())
+
+	if code := postTestMetric(t, h, testMetric("pod-a", 10)); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	// With ?sync=true the metric was processed before the response.
+	if _, ok := h.latest.get("pod-a"); !ok {
+		t.Error("metric not processed when the synchronous request returned")
+	}
+}
+
+func TestFullBroadcastChannelBacksUpIngestion(t *testing.T) {
+	cfg := testConfig()
+	cfg.BroadcastBuffer = 1
+	// The hub is not started yet, so nothing drains the broadcast channel.
+	h := newHub(cfg)
+	h.ingest = newIngestPipeline(1, 1, 50*time.Millisecond, h.processMetric)
+	h.ingest.start()
+	t.Cleanup(func() {
+		h.start()
+		h.ingest.stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.shutdown(ctx)
+	})
+	rejected := counterValue(t, ingestBackpressureTotal)
+
+	post := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(testMetric("pod-a", 10))
+		rec := httptest.NewRecorder()
+		h.receiveMetrics(rec, httptest.NewRequest(http.MethodPost, "/api/metrics", bytes.NewReader(body)))
+		return rec
+	}
+	// The first metric's broadcasts fill the channel and block the worker,
+	// the second waits in the queue, so the third has nowhere to go.
+	for i := 0; i < 2; i++ {
+		if rec := post(); rec.Code != http.StatusOK {
+			t.Fatalf("metric %d: status = %d, want 200", i, rec.Code)
+		}
+	}
+	deadline := time.Now().Add(testReadTimeout)
+	for h.ingest.pending() != 1 || len(h.broadcast) != cap(h.broadcast) {
+		if time.Now().After(deadline) {
+			t.Fatal("ingestion did not back up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := post()
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("status = %d, Retry-After = %q, want 503 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := counterValue(t, ingestBackpressureTotal) - rejected; got != 1 {
+		t.Errorf("backpressure counter rose by %v, want 1", got)
+	}
+}
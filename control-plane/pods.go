@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// latestQueries keeps the most recent query_execution reported by each pod.
+type latestQueries struct {
+	mu    sync.RWMutex
+	byPod map[string]QueryMetrics
+}
+
+func newLatestQueries() *latestQueries {
+	return &latestQueries{byPod: make(map[string]QueryMetrics)}
+}
+
+func (l *latestQueries) record(metric QueryMetrics) {
+	l.mu.Lock()
+	l.byPod[metric.PodName] = metric
+	l.mu.Unlock()
+}
+
+func (l *latestQueries) get(podName string) (QueryMetrics, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	metric, ok := l.byPod[podName]
+	return metric, ok
+}
+
+func (l *latestQueries) forget(podName string) {
+	l.mu.Lock()
+	delete(l.byPod, podName)
+	l.mu.Unlock()
+}
+
+// latestQueryHandler serves GET /api/pods/{pod}/latest.
+func (h *Hub) latestQueryHandler(w http.ResponseWriter, r *http.Request) {
+	podName := mux.Vars(r)["pod"]
+	metric, ok := h.latest.get(podName)
+	if !ok {
+		http.Error(w, "No queries reported for pod "+podName, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metric)
+}
+
+// PodInfo describes a pod that has reported metrics within the registry TTL.
+type PodInfo struct {
+	PodName     string    `json:"pod_name"`
+	Namespace   string    `json:"namespace"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	MetricCount int64     `json:"metric_count"`
+}
+
+// podRegistry tracks which pods are actively reporting. A pod is forgotten
+// once it has not been seen for ttl.
+type podRegistry struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	pods map[string]*PodInfo
+}
+
+func newPodRegistry(ttl time.Duration) *podRegistry {
+	return &podRegistry{ttl: ttl, pods: make(map[string]*PodInfo)}
+}
+
+// seen records one metric from the pod and reports whether the pod is new.
+func (r *podRegistry) seen(podName, namespace string, now time.Time) (PodInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pod, ok := r.pods[podName]
+	if !ok {
+		pod = &PodInfo{PodName: podName, FirstSeen: now}
+		r.pods[podName] = pod
+	}
+	if namespace != "" {
+		pod.Namespace = namespace
+	}
+	pod.LastSeen = now
+	pod.MetricCount++
+	return *pod, !ok
+}
+
+// expire removes and returns the pods not seen within ttl of now.
+func (r *podRegistry) expire(now time.Time) []PodInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []PodInfo
+	for podName, pod := range r.pods {
+		if now.Sub(pod.LastSeen) > r.ttl {
+			expired = append(expired, *pod)
+			delete(r.pods, podName)
+		}
+	}
+	return expired
+}
+
+// active returns the registered pods ordered by name.
+func (r *podRegistry) active() []PodInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pods := make([]PodInfo, 0, len(r.pods))
+	for _, pod := range r.pods {
+		pods = append(pods, *pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].PodName < pods[j].PodName })
+	return pods
+}
+
+// trackPod registers the metric's pod and broadcasts pod_joined the first
+// time it is seen.
+func (h *Hub) trackPod(metric QueryMetrics, now time.Time) {
+	if metric.PodName == "" {
+		return
+	}
+	if pod, joined := h.pods.seen(metric.PodName, metric.Namespace, now); joined {
+		slog.Info("pod joined", "pod_name", pod.PodName, "namespace", pod.Namespace)
+		h.publish(newNamespacedMessage("pod_joined", pod.Namespace, pod))
+	}
+}
+
+// forgetPod drops the per-pod aggregation state of a pod that left, so pods
+// churning through CI/CD deployments do not grow it without bound.
+func (h *Hub) forgetPod(podName string) {
+	h.tps.forget(podName)
+	h.latest.forget(podName)
+	h.inFlight.forgetPod(podName)
+	h.system.forget(podName)
+	h.cpu.forget(podName)
+	h.heap.forget(podName)
+	h.pool.forget(podName)
+	h.poolTrend.forget(podName)
+	h.errRates.forget(podName)
+	h.txOutcomes.forget(podName)
+	h.ratios.forget(podName)
+}
+
+// runPodExpiry reaps pods that stopped reporting until the hub stops: it
+// drops their aggregation state and broadcasts pod_left. Expiry holds the
+// state lock so a metric arriving meanwhile cannot have its state wiped;
+// it rejoins the pod instead.
+func (h *Hub) runPodExpiry() {
+	ticker := time.NewTicker(max(h.pods.ttl/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.state.Lock()
+			left := h.pods.expire(now)
+			for _, pod := range left {
+				h.forgetPod(pod.PodName)
+			}
+			h.state.Unlock()
+			for _, pod := range left {
+				slog.Info("pod left", "pod_name", pod.PodName, "namespace", pod.Namespace)
+				if err := h.publish(newNamespacedMessage("pod_left", pod.Namespace, pod)); err != nil {
+					return
+				}
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// podsHandler serves GET /api/pods.
+func (h *Hub) podsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.pods.active())
+}
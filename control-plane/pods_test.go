@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func getLatestQuery(h *Hub, podName string) *httptest.ResponseRecorder {
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/pods/"+podName+"/latest", nil), map[string]string{"pod": podName})
+	rec := httptest.NewRecorder()
+	h.latestQueryHandler(rec, req)
+	return rec
+}
+
+func TestLatestQueryFollowsEachPod(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	for _, metric := range []QueryMetrics{testMetric("pod-a", 10), testMetric("pod-b", 20), testMetric("pod-a", 30)} {
+		if code := postTestMetric(t, h, metric); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+	}
+
+	for podName, want := range map[string]int64{"pod-a": 30, "pod-b": 20} {
+		rec := getLatestQuery(h, podName)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want 200", podName, rec.Code)
+		}
+		var metric QueryMetrics
+		if err := json.NewDecoder(rec.Body).Decode(&metric); err != nil {
+			t.Fatal(err)
+		}
+		if metric.PodName != podName || metric.Data == nil || *metric.Data.ExecutionTimeMs != want {
+			t.Errorf("%s: latest = %+v, want the %dms query", podName, metric, want)
+		}
+	}
+}
+
+func TestLatestQueryUnknownPod(t *testing.T) {
+	h := newHub(testConfig())
+	if rec := getLatestQuery(h, "pod-z"); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestForgetPodDropsLatestQuery(t *testing.T) {
+	h := newHub(testConfig())
+	h.latest.record(testMetric("pod-a", 10))
+	h.forgetPod("pod-a")
+	if _, ok := h.latest.get("pod-a"); ok {
+		t.Error("latest query kept after the pod left")
+	}
+}
+
+func TestPodRegistryExpires(t *testing.T) {
+	registry := newPodRegistry(time.Minute)
+	start := time.Now()
+	for _, step := range []struct {
+		pod    string
+		at     time.Duration
+		joined bool
+	}{
+		{"pod-b", 0, true},
+		{"pod-a", 10 * time.Second, true},
+		{"pod-b", 30 * time.Second, false},
+	} {
+		if _, joined := registry.seen(step.pod, "default", start.Add(step.at)); joined != step.joined {
+			t.Errorf("%s at %v: joined = %v, want %v", step.pod, step.at, joined, step.joined)
+		}
+	}
+
+	if expired := registry.expire(start.Add(80 * time.Second)); len(expired) != 1 || expired[0].PodName != "pod-a" {
+		t.Errorf("expired = %+v, want pod-a", expired)
+	}
+	active := registry.active()
+	if len(active) != 1 || active[0].PodName != "pod-b" || active[0].MetricCount != 2 || !active[0].LastSeen.Equal(start.Add(30*time.Second)) {
+		t.Errorf("active = %+v, want pod-b seen twice", active)
+	}
+}
+
+func TestPodJoinedAndLeft(t *testing.T) {
+	cfg := testConfig()
+	cfg.PodTTL = 100 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=pod_joined,pod_left")
+
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	postTestMetric(t, h, testMetric("pod-a", 20))
+	rec := httptest.NewRecorder()
+	h.podsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/pods", nil))
+	var pods []PodInfo
+	json.NewDecoder(rec.Body).Decode(&pods)
+	if len(pods) != 1 || pods[0].PodName != "pod-a" || pods[0].Namespace != "default" || pods[0].MetricCount != 2 {
+		t.Errorf("/api/pods = %+v, want pod-a with 2 metrics", pods)
+	}
+
+	// The second metric does not announce the pod again.
+	for _, want := range []string{"pod_joined", "pod_left"} {
+		message := readTestMessage(t, conn)
+		if message.Type != want || message.Data.(map[string]interface{})["pod_name"] != "pod-a" {
+			t.Errorf("message = %s %v, want %s for pod-a", message.Type, message.Data, want)
+		}
+	}
+	if active := h.pods.active(); len(active) != 0 {
+		t.Errorf("active pods after expiry = %+v, want none", active)
+	}
+	if _, ok := h.latest.get("pod-a"); ok {
+		t.Error("the latest query of the pod that left was kept")
+	}
+}
+
+// podStateSizes counts the entries each per-pod aggregation holds.
+func podStateSizes(h *Hub) map[string]int {
+	sizes := make(map[string]int)
+	h.tps.mu.Lock()
+	sizes["tps"] = len(h.tps.pods)
+	h.tps.mu.Unlock()
+	h.latest.mu.RLock()
+	sizes["latest"] = len(h.latest.byPod)
+	h.latest.mu.RUnlock()
+	h.inFlight.mu.Lock()
+	sizes["in-flight"] = len(h.inFlight.queries)
+	h.inFlight.mu.Unlock()
+	h.system.mu.Lock()
+	sizes["system"] = len(h.system.pods)
+	h.system.mu.Unlock()
+	h.cpu.mu.Lock()
+	sizes["cpu"] = len(h.cpu.trends)
+	h.cpu.mu.Unlock()
+	for name, monitor := range map[string]*thresholdMonitor{"heap": h.heap, "pool": h.pool} {
+		monitor.mu.Lock()
+		sizes[name] = len(monitor.pods)
+		monitor.mu.Unlock()
+	}
+	h.poolTrend.mu.Lock()
+	sizes["pool trend"] = len(h.poolTrend.trends)
+	h.poolTrend.mu.Unlock()
+	for name, tracker := range map[string]*errorRateTracker{"error rates": h.errRates, "tx outcomes": h.txOutcomes} {
+		tracker.mu.Lock()
+		sizes[name] = len(tracker.pods)
+		tracker.mu.Unlock()
+	}
+	return sizes
+}
+
+func TestExpiredPodsReleaseTheirState(t *testing.T) {
+	cfg := testConfig()
+	cfg.PodTTL = 100 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=pod_left")
+
+	const pods = 20
+	for i := 0; i < pods; i++ {
+		podName := fmt.Sprintf("ci-pod-%d", i)
+		postTestMetric(t, h, testMetric(podName, 10))
+		postTestMetric(t, h, testMetric(podName, 0, func(m *QueryMetrics) {
+			m.EventType = "query_start"
+			m.Data.QueryID = "q-open"
+			m.Data.ExecutionTimeMs = nil
+		}))
+		system := testMetric(podName, 10)
+		system.EventType = "system_metrics"
+		system.Metrics = &SystemMetrics{
+			CPUUsageRatio:            ptr(0.5),
+			HeapUsageRatio:           ptr(0.5),
+			ConnectionPoolUsageRatio: ptr(0.5),
+		}
+		postTestMetric(t, h, system)
+		postTestMetric(t, h, testMetric(podName, 10, func(m *QueryMetrics) {
+			m.EventType = "transaction_event"
+			m.Data.TransactionId = ptr("tx-" + podName)
+			m.Data.TransactionDuration = ptr(int64(10))
+			m.Data.Status = "COMMITTED"
+		}))
+	}
+	for name, size := range podStateSizes(h) {
+		if size == 0 {
+			t.Errorf("%s holds nothing before expiry; the test does not exercise it", name)
+		}
+	}
+
+	for i := 0; i < pods; i++ {
+		readTestMessage(t, conn)
+	}
+	for name, size := range podStateSizes(h) {
+		if size != 0 {
+			t.Errorf("%s still holds %d entries after every pod left", name, size)
+		}
+	}
+}
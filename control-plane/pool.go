@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+)
+
+// poolAlertRepeat is how often a pod whose pool stays exhausted is warned
+// about again.
+const poolAlertRepeat = 30 * time.Second
+
+func newPoolMonitor(ratio float64, consecutive int) *thresholdMonitor {
+	monitor := newThresholdMonitor(ratio, ratio)
+	monitor.repeat = poolAlertRepeat
+	monitor.consecutive = consecutive
+	return monitor
+}
+
+// analyzePoolMetrics broadcasts a pool_exhaustion_warning once a pod's
+// connection pool usage has stayed at or above the threshold for the
+// configured number of consecutive samples, repeats it every poolAlertRepeat
+// while that lasts, and broadcasts pool_exhaustion_recovered when usage
+// drops below the threshold.
+func (h *Hub) analyzePoolMetrics(metric QueryMetrics) {
+	if metric.Metrics == nil || metric.Metrics.ConnectionPoolUsageRatio == nil {
+		return
+	}
+	ratio := *metric.Metrics.ConnectionPoolUsageRatio
+	now := time.Now()
+
+	data := map[string]interface{}{
+		"pod_name":                    metric.PodName,
+		"namespace":                   metric.Namespace,
+		"connection_pool_usage_ratio": ratio,
+		"connection_pool_active":      metric.Metrics.ConnectionPoolActive,
+		"connection_pool_idle":        metric.Metrics.ConnectionPoolIdle,
+		"connection_pool_max":         metric.Metrics.ConnectionPoolMax,
+		"threshold":                   h.pool.high,
+	}
+
+	var messageType string
+	switch h.pool.observe(metric.PodName, ratio, now) {
+	case thresholdFired, thresholdRepeated:
+		messageType = "pool_exhaustion_warning"
+		data["severity"] = "critical"
+		h.alerts.fire("pool_exhaustion_warning", "critical", metric.PodName, metric.Namespace, map[string]interface{}{
+			"connection_pool_usage_ratio": ratio,
+		})
+	case thresholdRecovered:
+		messageType = "pool_exhaustion_recovered"
+		h.alerts.resolve("pool_exhaustion_warning", metric.PodName)
+	default:
+		return
+	}
+
+	h.publish(newNamespacedMessage(messageType, metric.Namespace, data))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoolMonitorNeedsConsecutiveSamples(t *testing.T) {
+	monitor := newPoolMonitor(0.95, 3)
+	start := time.Now()
+	steps := []struct {
+		at    time.Duration
+		ratio float64
+		want  thresholdTransition
+	}{
+		{0, 0.96, thresholdUnchanged},
+		{time.Second, 0.97, thresholdUnchanged},
+		// A dip below the threshold restarts the count.
+		{2 * time.Second, 0.9, thresholdUnchanged},
+		{3 * time.Second, 0.96, thresholdUnchanged},
+		{4 * time.Second, 0.98, thresholdUnchanged},
+		{5 * time.Second, 0.99, thresholdFired},
+		{20 * time.Second, 1.0, thresholdUnchanged},
+		{35 * time.Second, 1.0, thresholdRepeated},
+		{36 * time.Second, 0.5, thresholdRecovered},
+		{37 * time.Second, 0.5, thresholdUnchanged},
+	}
+	for _, step := range steps {
+		if got := monitor.observe("pod-a", step.ratio, start.Add(step.at)); got != step.want {
+			t.Errorf("+%v (%.2f): transition = %v, want %v", step.at, step.ratio, got, step.want)
+		}
+	}
+}
+
+func TestPoolExhaustionWarningAndRecovery(t *testing.T) {
+	cfg := testConfig()
+	cfg.PoolAlertConsecutive = 2
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=pool_exhaustion_warning,pool_exhaustion_recovered")
+
+	for _, ratio := range []float64{0.8, 0.96, 0.98, 0.99, 0.6} {
+		metric := testMetric("pod-a", 10)
+		metric.EventType = "system_metrics"
+		metric.Data = nil
+		metric.Metrics = &SystemMetrics{
+			ConnectionPoolActive:     ptr(int(ratio * 100)),
+			ConnectionPoolIdle:       ptr(100 - int(ratio*100)),
+			ConnectionPoolMax:        ptr(100),
+			ConnectionPoolUsageRatio: ptr(ratio),
+		}
+		postTestMetric(t, h, metric)
+	}
+
+	warning := readTestMessage(t, conn)
+	data := warning.Data.(map[string]interface{})
+	if warning.Type != "pool_exhaustion_warning" || data["connection_pool_usage_ratio"] != 0.98 || data["pod_name"] != "pod-a" {
+		t.Fatalf("first message = %s %v, want a warning at 0.98", warning.Type, data)
+	}
+	if data["connection_pool_active"] != float64(98) || data["connection_pool_idle"] != float64(2) || data["connection_pool_max"] != float64(100) {
+		t.Errorf("warning counts = %v/%v/%v, want 98/2/100", data["connection_pool_active"], data["connection_pool_idle"], data["connection_pool_max"])
+	}
+	if recovered := readTestMessage(t, conn); recovered.Type != "pool_exhaustion_recovered" {
+		t.Errorf("second message = %s, want pool_exhaustion_recovered", recovered.Type)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// poolForecastMinSamples is how many samples a trend needs before it is
+// extrapolated; two points always fit a line exactly.
+const poolForecastMinSamples = 3
+
+// poolForecaster extrapolates each pod's connection pool usage to warn
+// before the pool runs out rather than once it has. It fits a least-squares
+// line through the pod's last samples and forecasts exhaustion when that
+// line reaches 1.0 within the horizon.
+type poolForecaster struct {
+	mu      sync.Mutex
+	samples int
+	horizon time.Duration
+	trends  map[string][]ratioSample
+	// warned is when each pod with a standing forecast was last forecast, so
+	// a steady climb is reported every poolAlertRepeat rather than on every
+	// sample.
+	warned map[string]time.Time
+}
+
+// poolForecast is a projected exhaustion of a pod's pool.
+type poolForecast struct {
+	slope      float64
+	projected  float64
+	exhaustion time.Duration
+	samples    int
+}
+
+// newPoolForecaster returns nil, which forecasts nothing, when the horizon
+// is not positive.
+func newPoolForecaster(horizon time.Duration, samples int) *poolForecaster {
+	if horizon <= 0 {
+		return nil
+	}
+	return &poolForecaster{
+		samples: max(samples, poolForecastMinSamples),
+		horizon: horizon,
+		trends:  make(map[string][]ratioSample),
+		warned:  make(map[string]time.Time),
+	}
+}
+
+// record adds a sample and reports whether the pod's pool started or is
+// still on course to be exhausted within the horizon, repeated at most every
+// poolAlertRepeat, or no longer is. Pools already at or over capacity are
+// left to pool_exhaustion_warning.
+func (f *poolForecaster) record(podName string, ratio float64, now time.Time) (poolForecast, thresholdTransition) {
+	if f == nil {
+		return poolForecast{}, thresholdUnchanged
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	samples := append(f.trends[podName], ratioSample{Value: ratio, At: now})
+	if len(samples) > f.samples {
+		samples = samples[len(samples)-f.samples:]
+	}
+	f.trends[podName] = samples
+	if len(samples) < poolForecastMinSamples {
+		return poolForecast{}, thresholdUnchanged
+	}
+
+	last, warned := f.warned[podName]
+	forecast, ok := extrapolate(samples, now)
+	if ratio >= 1 || !ok || forecast.exhaustion > f.horizon {
+		if !warned {
+			return poolForecast{}, thresholdUnchanged
+		}
+		delete(f.warned, podName)
+		return poolForecast{}, thresholdRecovered
+	}
+	switch {
+	case !warned:
+		f.warned[podName] = now
+		return forecast, thresholdFired
+	case now.Sub(last) >= poolAlertRepeat:
+		f.warned[podName] = now
+		return forecast, thresholdRepeated
+	}
+	return poolForecast{}, thresholdUnchanged
+}
+
+// extrapolate fits a line through the samples and returns when it reaches
+// 1.0, if it is rising.
+func extrapolate(samples []ratioSample, now time.Time) (poolForecast, bool) {
+	origin := samples[0].At
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.At.Sub(origin).Seconds()
+		sumX += x
+		sumY += sample.Value
+		sumXY += x * sample.Value
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return poolForecast{}, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return poolForecast{}, false
+	}
+	intercept := (sumY - slope*sumX) / n
+	projected := intercept + slope*now.Sub(origin).Seconds()
+	seconds := max((1-projected)/slope, 0)
+	return poolForecast{
+		slope:      slope,
+		projected:  projected,
+		exhaustion: time.Duration(seconds * float64(time.Second)),
+		samples:    len(samples),
+	}, true
+}
+
+func (f *poolForecaster) forget(podName string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	delete(f.trends, podName)
+	delete(f.warned, podName)
+	f.mu.Unlock()
+}
+
+// analyzePoolTrend broadcasts a pool_saturation_forecast when a pod's
+// connection pool usage is climbing fast enough to reach capacity within
+// POOL_FORECAST_HORIZON. The pod's alert is resolved once the trend no
+// longer reaches capacity within the horizon or the pool is exhausted, which
+// pool_exhaustion_warning takes over.
+func (h *Hub) analyzePoolTrend(metric QueryMetrics) {
+	if metric.Metrics == nil || metric.Metrics.ConnectionPoolUsageRatio == nil {
+		return
+	}
+	ratio := *metric.Metrics.ConnectionPoolUsageRatio
+	now := time.Now()
+	forecast, transition := h.poolTrend.record(metric.PodName, ratio, now)
+	switch transition {
+	case thresholdFired, thresholdRepeated:
+		h.alerts.fire("pool_saturation_forecast", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+			"connection_pool_usage_ratio": ratio,
+			"seconds_to_exhaustion":       forecast.exhaustion.Seconds(),
+		})
+	case thresholdRecovered:
+		h.alerts.resolve("pool_saturation_forecast", metric.PodName)
+		return
+	default:
+		return
+	}
+
+	h.publish(newNamespacedMessage("pool_saturation_forecast", metric.Namespace, map[string]interface{}{
+		"pod_name":                    metric.PodName,
+		"namespace":                   metric.Namespace,
+		"connection_pool_usage_ratio": ratio,
+		"projected_usage_ratio":       forecast.projected,
+		"growth_per_second":           forecast.slope,
+		"seconds_to_exhaustion":       forecast.exhaustion.Seconds(),
+		"projected_exhaustion_at":     now.Add(forecast.exhaustion).UTC().Format(time.RFC3339),
+		"horizon_seconds":             h.poolTrend.horizon.Seconds(),
+		"samples":                     forecast.samples,
+		"severity":                    "warning",
+	}))
+}
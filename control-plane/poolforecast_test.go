@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolForecasterRisingTrend(t *testing.T) {
+	forecaster := newPoolForecaster(time.Minute, 3)
+	start := time.Now()
+	for i, ratio := range []float64{0.5, 0.6} {
+		if _, got := forecaster.record("pod-a", ratio, start.Add(time.Duration(i)*10*time.Second)); got != thresholdUnchanged {
+			t.Fatalf("forecast from %d samples, want at least %d", i+1, poolForecastMinSamples)
+		}
+	}
+	// 0.01 a second from 0.7 reaches capacity in 30s.
+	forecast, got := forecaster.record("pod-a", 0.7, start.Add(20*time.Second))
+	if got != thresholdFired {
+		t.Fatal("no forecast for a pool filling in 30s with a 60s horizon")
+	}
+	if math.Abs(forecast.slope-0.01) > 1e-9 || math.Abs(forecast.projected-0.7) > 1e-9 ||
+		math.Abs(forecast.exhaustion.Seconds()-30) > 1e-6 || forecast.samples != 3 {
+		t.Errorf("forecast = %+v, want 0.01/s from 0.7, exhausted in 30s", forecast)
+	}
+	// A steady climb is not reported again on every sample.
+	if _, got := forecaster.record("pod-a", 0.71, start.Add(21*time.Second)); got != thresholdUnchanged {
+		t.Errorf("second sample = %v, want the forecast not repeated a second later", got)
+	}
+	if _, got := forecaster.record("pod-a", 0.95, start.Add(20*time.Second+poolAlertRepeat)); got != thresholdRepeated {
+		t.Errorf("sample after poolAlertRepeat = %v, want the forecast repeated", got)
+	}
+	// Falling usage ends the forecast; the history is bounded to the
+	// last samples.
+	var ended []thresholdTransition
+	for i := 0; i < 10; i++ {
+		if _, got := forecaster.record("pod-a", 0.5, start.Add(time.Minute+time.Duration(i)*time.Second)); got != thresholdUnchanged {
+			ended = append(ended, got)
+		}
+	}
+	if len(ended) != 1 || ended[0] != thresholdRecovered {
+		t.Errorf("transitions on falling usage = %v, want one recovery", ended)
+	}
+	if got := len(forecaster.trends["pod-a"]); got != 3 {
+		t.Errorf("kept %d samples, want 3", got)
+	}
+	forecaster.forget("pod-a")
+	if _, ok := forecaster.trends["pod-a"]; ok {
+		t.Error("forgotten pod still has a trend")
+	}
+}
+
+func TestPoolForecasterNoForecast(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name   string
+		ratios []float64
+	}{
+		{"flat", []float64{0.5, 0.5, 0.5, 0.5}},
+		{"falling", []float64{0.9, 0.8, 0.7}},
+		// 0.001 a second from 0.12 takes 880s, past the horizon.
+		{"slow", []float64{0.1, 0.11, 0.12}},
+		{"already exhausted", []float64{0.8, 0.9, 1.0}},
+	}
+	for _, tt := range tests {
+		forecaster := newPoolForecaster(time.Minute, 10)
+		for i, ratio := range tt.ratios {
+			if forecast, got := forecaster.record("pod-a", ratio, start.Add(time.Duration(i)*10*time.Second)); got != thresholdUnchanged {
+				t.Errorf("%s: forecast %+v at sample %d, want none", tt.name, forecast, i)
+			}
+		}
+	}
+
+	if newPoolForecaster(0, 10) != nil {
+		t.Error("forecaster with no horizon is not nil, want forecasting disabled")
+	}
+	var none *poolForecaster
+	if _, got := none.record("pod-a", 0.99, start); got != thresholdUnchanged {
+		t.Error("nil forecaster forecast exhaustion")
+	}
+}
+
+func TestPoolSaturationForecastBroadcast(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=pool_saturation_forecast,done")
+
+	for _, ratio := range []float64{0.5, 0.6, 0.7} {
+		metric := testMetric("pod-a", 10)
+		metric.EventType = "system_metrics"
+		metric.Data = nil
+		metric.Metrics = &SystemMetrics{ConnectionPoolUsageRatio: ptr(ratio)}
+		postTestMetric(t, h, metric)
+	}
+	h.publish(newMessage("done", nil))
+
+	message := readTestMessage(t, conn)
+	if message.Type != "pool_saturation_forecast" {
+		t.Fatalf("message = %q, want a pool_saturation_forecast", message.Type)
+	}
+	data := message.Data.(map[string]interface{})
+	seconds, _ := data["seconds_to_exhaustion"].(float64)
+	if data["pod_name"] != "pod-a" || data["connection_pool_usage_ratio"] != 0.7 || data["samples"] != float64(3) ||
+		data["horizon_seconds"] != float64(60) || seconds < 0 || seconds > 60 {
+		t.Errorf("forecast = %v, want pod-a exhausted within the 60s horizon", data)
+	}
+	if _, err := time.Parse(time.RFC3339, data["projected_exhaustion_at"].(string)); err != nil {
+		t.Errorf("projected_exhaustion_at: %v", err)
+	}
+	if message := readTestMessage(t, conn); message.Type != "done" {
+		t.Errorf("next message = %q, want one forecast", message.Type)
+	}
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "pool_saturation_forecast")
+	if len(alerts) != 1 || alerts[0].PodName != "pod-a" || alerts[0].ResolvedAt != nil {
+		t.Fatalf("alert history = %+v, want an open alert for pod-a", alerts)
+	}
+
+	// Usage dropping resolves the alert.
+	for _, ratio := range []float64{0.3, 0.2} {
+		metric := testMetric("pod-a", 10)
+		metric.EventType = "system_metrics"
+		metric.Data = nil
+		metric.Metrics = &SystemMetrics{ConnectionPoolUsageRatio: ptr(ratio)}
+		postTestMetric(t, h, metric)
+	}
+	if alerts := h.alerts.query(time.Time{}, time.Time{}, "pool_saturation_forecast"); alerts[0].ResolvedAt == nil {
+		t.Error("alert is still open after usage dropped")
+	}
+}
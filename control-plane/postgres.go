@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const createQueryMetricsTable = `
+CREATE TABLE IF NOT EXISTS query_metrics (
+	id                   BIGSERIAL PRIMARY KEY,
+	received_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+	event_timestamp      TEXT,
+	pod_name             TEXT,
+	namespace            TEXT,
+	event_type           TEXT NOT NULL,
+	query_id             TEXT,
+	sql_hash             TEXT,
+	sql_pattern          TEXT,
+	sql_type             TEXT,
+	table_names          TEXT[],
+	execution_time_ms    BIGINT,
+	rows_affected        BIGINT,
+	connection_id        TEXT,
+	thread_name          TEXT,
+	memory_used_bytes    BIGINT,
+	status               TEXT,
+	error_message        TEXT,
+	complexity_score     INTEGER,
+	cache_hit_ratio      DOUBLE PRECISION,
+	tps_value            DOUBLE PRECISION,
+	transaction_duration BIGINT,
+	transaction_id       TEXT,
+	deadlock_duration    BIGINT,
+	deadlock_connections TEXT
+)`
+
+// addClusterColumns upgrades tables created before metrics carried their
+// cluster identity.
+const addClusterColumns = `
+ALTER TABLE query_metrics
+	ADD COLUMN IF NOT EXISTS cluster_id TEXT,
+	ADD COLUMN IF NOT EXISTS region     TEXT`
+
+// addReportColumns upgrades tables created before metrics carried
+// transaction outcomes, deadlock wait-for graphs and clock skew corrections.
+const addReportColumns = `
+ALTER TABLE query_metrics
+	ADD COLUMN IF NOT EXISTS transaction_outcome TEXT,
+	ADD COLUMN IF NOT EXISTS wait_for_edges      JSONB,
+	ADD COLUMN IF NOT EXISTS clock_skew          BOOLEAN NOT NULL DEFAULT false,
+	ADD COLUMN IF NOT EXISTS agent_timestamp     TEXT`
+
+const insertQueryMetric = `
+INSERT INTO query_metrics (
+	event_timestamp, pod_name, namespace, event_type,
+	query_id, sql_hash, sql_pattern, sql_type, table_names,
+	execution_time_ms, rows_affected, connection_id, thread_name,
+	memory_used_bytes, status, error_message, complexity_score,
+	cache_hit_ratio, tps_value, transaction_duration, transaction_id,
+	deadlock_duration, deadlock_connections, cluster_id, region,
+	transaction_outcome, wait_for_edges, clock_skew, agent_timestamp
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+	$16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29)`
+
+// createQueryMetricsIndexes supports /api/history, which filters on the
+// receive time and optionally the pod or event type.
+const createQueryMetricsIndexes = `
+CREATE INDEX IF NOT EXISTS query_metrics_received_at_idx ON query_metrics (received_at);
+CREATE INDEX IF NOT EXISTS query_metrics_pod_received_at_idx ON query_metrics (pod_name, received_at);
+CREATE INDEX IF NOT EXISTS query_metrics_event_type_received_at_idx ON query_metrics (event_type, received_at)`
+
+// selectQueryMetrics reads metrics back in receive order. Unset filters are
+// passed as NULL and match everything.
+const selectQueryMetrics = `
+SELECT id, received_at, COALESCE(event_timestamp, ''), COALESCE(pod_name, ''), COALESCE(namespace, ''), event_type,
+	COALESCE(query_id, ''), COALESCE(sql_hash, ''), COALESCE(sql_pattern, ''), COALESCE(sql_type, ''), table_names,
+	execution_time_ms, rows_affected, COALESCE(connection_id, ''), COALESCE(thread_name, ''),
+	memory_used_bytes, COALESCE(status, ''), COALESCE(error_message, ''), complexity_score,
+	cache_hit_ratio, tps_value, transaction_duration, transaction_id,
+	deadlock_duration, deadlock_connections, COALESCE(cluster_id, ''), COALESCE(region, ''),
+	COALESCE(transaction_outcome, ''), wait_for_edges, clock_skew, COALESCE(agent_timestamp, '')
+FROM query_metrics
+WHERE ($1::timestamptz IS NULL OR received_at >= $1)
+	AND ($2::timestamptz IS NULL OR received_at <= $2)
+	AND ($3::text IS NULL OR pod_name = $3)
+	AND ($4::text IS NULL OR event_type = $4)
+ORDER BY received_at, id
+LIMIT $5 OFFSET $6`
+
+// PostgresSink stores metrics in the query_metrics table, one transaction
+// per batch.
+type PostgresSink struct {
+	db *sql.DB
+}
+
+// openPostgresSink connects to databaseURL and creates the query_metrics
+// table if it does not exist yet.
+func openPostgresSink(ctx context.Context, databaseURL string) (*PostgresSink, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createQueryMetricsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create query_metrics table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, addClusterColumns); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("add cluster columns to query_metrics: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, addReportColumns); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("add report columns to query_metrics: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createQueryMetricsIndexes); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create query_metrics indexes: %w", err)
+	}
+	return &PostgresSink{db: db}, nil
+}
+
+func (s *PostgresSink) Store(ctx context.Context, metric QueryMetrics) error {
+	return s.StoreBatch(ctx, []QueryMetrics{metric})
+}
+
+func (s *PostgresSink) StoreBatch(ctx context.Context, metrics []QueryMetrics) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertQueryMetric)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, metric := range metrics {
+		data := metric.Data
+		if data == nil {
+			data = &QueryData{}
+		}
+		edges, err := waitForEdgesValue(data.WaitForEdges)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx,
+			metric.Timestamp, metric.PodName, metric.Namespace, metric.EventType,
+			data.QueryID, data.SQLHash, data.SQLPattern, data.SQLType, pq.Array(data.TableNames),
+			data.ExecutionTimeMs, data.RowsAffected, data.ConnectionID, data.ThreadName,
+			data.MemoryUsedBytes, data.Status, data.ErrorMessage, data.ComplexityScore,
+			data.CacheHitRatio, data.TpsValue, data.TransactionDuration, data.TransactionId,
+			data.DeadlockDuration, data.DeadlockConnections, metric.ClusterID, metric.Region,
+			data.TransactionOutcome, edges, metric.ClockSkew, metric.AgentTimestamp,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// QueryRange reads stored metrics matching query, oldest first.
+func (s *PostgresSink) QueryRange(ctx context.Context, query HistoryQuery) ([]StoredMetric, error) {
+	rows, err := s.db.QueryContext(ctx, selectQueryMetrics,
+		nullTime(query.From), nullTime(query.To), nullString(query.PodName), nullString(query.EventType),
+		query.Limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := make([]StoredMetric, 0, query.Limit)
+	for rows.Next() {
+		var stored StoredMetric
+		metric := &stored.Metric
+		data := &QueryData{}
+		var edges []byte
+		err := rows.Scan(
+			&stored.Seq, &stored.ReceivedAt, &metric.Timestamp, &metric.PodName, &metric.Namespace, &metric.EventType,
+			&data.QueryID, &data.SQLHash, &data.SQLPattern, &data.SQLType, pq.Array(&data.TableNames),
+			&data.ExecutionTimeMs, &data.RowsAffected, &data.ConnectionID, &data.ThreadName,
+			&data.MemoryUsedBytes, &data.Status, &data.ErrorMessage, &data.ComplexityScore,
+			&data.CacheHitRatio, &data.TpsValue, &data.TransactionDuration, &data.TransactionId,
+			&data.DeadlockDuration, &data.DeadlockConnections, &metric.ClusterID, &metric.Region,
+			&data.TransactionOutcome, &edges, &metric.ClockSkew, &metric.AgentTimestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(edges) > 0 {
+			if err := json.Unmarshal(edges, &data.WaitForEdges); err != nil {
+				return nil, fmt.Errorf("decode wait_for_edges of metric %d: %w", stored.Seq, err)
+			}
+		}
+		metric.Data = data
+		metrics = append(metrics, stored)
+	}
+	return metrics, rows.Err()
+}
+
+// waitForEdgesValue encodes a wait-for graph for the wait_for_edges column,
+// NULL when the agent reported none.
+func waitForEdgesValue(edges []WaitForEdge) (interface{}, error) {
+	if len(edges) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(edges)
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *PostgresSink) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresSink) Close() error {
+	return s.db.Close()
+}
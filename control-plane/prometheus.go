@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsReceivedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubedb_metrics_received_total",
+		Help: "Metrics received from agents, by event type.",
+	}, []string{"event_type"})
+
+	websocketClientsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kubedb_websocket_clients",
+		Help: "Currently connected WebSocket clients.",
+	})
+
+	broadcastDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_broadcast_dropped_total",
+		Help: "WebSocket clients dropped because their send buffer was full.",
+	})
+
+	websocketUpgradeFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubedb_websocket_upgrade_failures_total",
+		Help: "Refused WebSocket upgrades, by reason.",
+	}, []string{"reason"})
+
+	slowClientDroppedMessagesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_websocket_messages_dropped_total",
+		Help: "Messages discarded for slow clients under the drop_oldest policy.",
+	})
+
+	staleMessagesDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_websocket_stale_messages_dropped_total",
+		Help: "Queued messages skipped for outliving WS_MESSAGE_TTL before they could be sent.",
+	})
+
+	kafkaConsumerLagGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kubedb_kafka_consumer_lag",
+		Help: "Messages the Kafka consumer is behind the end of its partition.",
+	})
+
+	sinkDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_sink_dropped_total",
+		Help: "Metrics not persisted because the sink queue was full.",
+	})
+
+	sinkShortCircuitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_sink_short_circuited_total",
+		Help: "Metrics sent to the dead-letter buffer instead of the sink while its circuit breaker was open.",
+	})
+
+	broadcastQueueDepthGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kubedb_broadcast_queue_depth",
+		Help: "Messages waiting in the hub's broadcast channel.",
+	})
+
+	upstreamDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_upstream_dropped_total",
+		Help: "Metrics not forwarded upstream because the forwarding buffer was full.",
+	})
+
+	ingestBackpressureTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_ingest_backpressure_rejected_total",
+		Help: "Metrics rejected because the ingestion queue stayed full.",
+	})
+
+	querySampledOutTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_query_broadcasts_sampled_out_total",
+		Help: "Query executions aggregated but not broadcast under QUERY_SAMPLE_RATE.",
+	})
+
+	querySuppressedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_query_broadcasts_suppressed_total",
+		Help: "Query executions aggregated but not broadcast because their pattern is in SUPPRESS_PATTERNS.",
+	})
+
+	queryDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kubedb_query_duration_seconds",
+		Help:    "Execution time of reported queries. Buckets carry the request id of their latest query as a trace_id exemplar.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	webhookNotificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubedb_alert_webhook_notifications_total",
+		Help: "Alert webhook notifications by result (delivered, failed, dropped).",
+	}, []string{"result"})
+
+	ackRedeliveredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_websocket_ack_redelivered_total",
+		Help: "Messages resent to WebSocket clients that did not acknowledge them within WS_ACK_TIMEOUT.",
+	})
+
+	ackAbandonedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kubedb_websocket_ack_abandoned_total",
+		Help: "Messages never acknowledged by a WebSocket client after WS_ACK_RETRIES resends, or evicted from a full ack buffer.",
+	})
+
+	clockSkewTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubedb_clock_skew_metrics_total",
+		Help: "Metrics with timestamps outside CLOCK_SKEW_TOLERANCE, by direction (future, past) and action (rewritten, rejected).",
+	}, []string{"direction", "action"})
+)
+
+// metricsHandler serves /metrics in the Prometheus text format, or in
+// OpenMetrics, which is the only one that carries exemplars, for scrapers
+// that ask for it in Accept.
+func metricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+}
+
+// observeQueryDuration adds a query execution to the duration histogram,
+// with its request id as the exemplar so a slow bucket leads to a trace.
+// Request ids too long for an exemplar are left out.
+func observeQueryDuration(metric QueryMetrics) {
+	if metric.Data == nil || metric.Data.ExecutionTimeMs == nil {
+		return
+	}
+	seconds := (time.Duration(*metric.Data.ExecutionTimeMs) * time.Millisecond).Seconds()
+	if metric.Context != nil && validExemplarValue(metric.Context.RequestID) {
+		queryDurationSeconds.(prometheus.ExemplarObserver).ObserveWithExemplar(seconds, prometheus.Labels{"trace_id": metric.Context.RequestID})
+		return
+	}
+	queryDurationSeconds.Observe(seconds)
+}
+
+// validExemplarValue reports whether a trace_id label value fits an
+// exemplar; ObserveWithExemplar panics on one that does not.
+func validExemplarValue(value string) bool {
+	return value != "" && utf8.ValidString(value) &&
+		utf8.RuneCountInString("trace_id")+utf8.RuneCountInString(value) <= prometheus.ExemplarMaxRunes
+}
+
+// knownEventTypes bounds the event_type label so a misbehaving agent cannot
+// create unbounded series.
+var knownEventTypes = map[string]bool{
+	"query_execution":          true,
+	"query_start":              true,
+	"transaction_event":        true,
+	"deadlock_event":           true,
+	"deadlock_detected":        true,
+	"long_running_transaction": true,
+}
+
+func eventTypeLabel(eventType string) string {
+	if knownEventTypes[eventType] {
+		return eventType
+	}
+	return "other"
+}
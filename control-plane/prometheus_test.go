@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceivedMetricsCountedByEventType(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	queries := metricsReceivedTotal.WithLabelValues("query_execution")
+	other := metricsReceivedTotal.WithLabelValues("other")
+	queriesBefore, otherBefore := counterValue(t, queries), counterValue(t, other)
+
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	postTestMetric(t, h, testMetric("pod-a", 20))
+	unknown := testMetric("pod-a", 10)
+	unknown.EventType = "cache_miss"
+	postTestMetric(t, h, unknown)
+
+	if got := counterValue(t, queries) - queriesBefore; got != 2 {
+		t.Errorf("query_execution counted %v times, want 2", got)
+	}
+	if got := counterValue(t, other) - otherBefore; got != 1 {
+		t.Errorf("unknown event type counted %v times as other, want 1", got)
+	}
+}
+
+// waitForClientCount waits until the hub reports n connected clients.
+func waitForClientCount(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(testReadTimeout)
+	for h.clientCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("clientCount = %d, want %d", h.clientCount(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientCountFollowsConnections(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	if h.clientCount() != 0 {
+		t.Fatalf("clientCount = %d before any connection", h.clientCount())
+	}
+	first := dialTestHub(t, h, "")
+	dialTestHub(t, h, "")
+	waitForClientCount(t, h, 2)
+
+	first.Close()
+	waitForClientCount(t, h, 1)
+}
+
+func TestSlowClientDropIsCounted(t *testing.T) {
+	h := newHub(testConfig())
+	client := &Client{hub: h, send: make(chan WebSocketMessage, 1), remoteAddr: "192.0.2.1:1234"}
+	h.clients[client] = true
+	before := counterValue(t, broadcastDroppedTotal)
+
+	h.deliver(client, newMessage("test", nil))
+	h.deliver(client, newMessage("test", nil))
+
+	if got := counterValue(t, broadcastDroppedTotal) - before; got != 1 {
+		t.Errorf("broadcast drops counted %v times, want 1", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, name := range []string{"kubedb_websocket_clients", "kubedb_broadcast_queue_depth"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("/metrics does not expose %s", name)
+		}
+	}
+}
+
+func TestQueryDurationExemplars(t *testing.T) {
+	metric := testMetric("pod-a", 7)
+	metric.Context = &ExecutionContext{RequestID: "req-exemplar-1"}
+	observeQueryDuration(metric)
+
+	scrape := func(accept string) string {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		metricsHandler().ServeHTTP(rec, req)
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+	var bucket string
+	for _, line := range strings.Split(scrape("application/openmetrics-text; version=1.0.0"), "\n") {
+		if strings.HasPrefix(line, `kubedb_query_duration_seconds_bucket{le="0.01"}`) {
+			bucket = line
+		}
+	}
+	if !strings.Contains(bucket, ` # {trace_id="req-exemplar-1"} 0.007 `) {
+		t.Errorf("OpenMetrics bucket = %q, want the request id as its exemplar", bucket)
+	}
+	if body := scrape("text/plain"); !strings.Contains(body, "kubedb_query_duration_seconds_bucket") || strings.Contains(body, "req-exemplar-1") {
+		t.Error("text format should expose the histogram without exemplars")
+	}
+}
+
+func TestValidExemplarValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"req-1", true},
+		{"", false},
+		{"\xff", false},
+		{strings.Repeat("a", 128-len("trace_id")), true},
+		{strings.Repeat("a", 129-len("trace_id")), false},
+	}
+	for _, tt := range tests {
+		if got := validExemplarValue(tt.value); got != tt.want {
+			t.Errorf("validExemplarValue(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	// An oversized request id is observed without an exemplar rather than panicking.
+	metric := testMetric("pod-a", 7)
+	metric.Context = &ExecutionContext{RequestID: strings.Repeat("a", 200)}
+	observeQueryDuration(metric)
+}
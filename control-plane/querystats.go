@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// overflowPattern collects executions once the pattern cardinality limit is
+// reached.
+const overflowPattern = "__other__"
+
+// querySampleSize is how many recent execution times are kept per pattern
+// for the p95.
+const querySampleSize = 1000
+
+var (
+	sqlKeywords = map[string]bool{
+		"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true,
+		"NOT": true, "IN": true, "IS": true, "NULL": true, "LIKE": true,
+		"BETWEEN": true, "EXISTS": true, "INSERT": true, "INTO": true,
+		"VALUES": true, "UPDATE": true, "SET": true, "DELETE": true,
+		"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "OUTER": true,
+		"FULL": true, "CROSS": true, "ON": true, "AS": true, "GROUP": true,
+		"BY": true, "ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true,
+		"ASC": true, "DESC": true, "DISTINCT": true, "UNION": true, "ALL": true,
+		"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+		"FOR": true, "WITH": true, "RETURNING": true, "COUNT": true,
+		"TRUE": true, "FALSE": true,
+	}
+	inListPattern = regexp.MustCompile(`\bIN\(\?(?:, \?)+\)`)
+)
+
+// normalizeSQLPattern reduces a SQL statement to a grouping key: string and
+// numeric literals become ?, IN-lists of placeholders collapse to a single
+// one, keywords are uppercased and spacing is made uniform. So
+// "select * from users where id=5" and "SELECT * FROM users WHERE id = 6"
+// share a key.
+func normalizeSQLPattern(sql string) string {
+	var tokens []string
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			// Skip the literal, treating '' as an escaped quote.
+			i++
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			tokens = append(tokens, "?")
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, "?")
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			word := string(runes[start:i])
+			if upper := strings.ToUpper(word); sqlKeywords[upper] {
+				word = upper
+			}
+			tokens = append(tokens, word)
+		case strings.ContainsRune(sqlOperatorChars, r):
+			start := i
+			for i < len(runes) && strings.ContainsRune(sqlOperatorChars, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 && !tightBefore(tokens[i-1], token) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(token)
+	}
+	return inListPattern.ReplaceAllString(b.String(), "IN(?)")
+}
+
+// sqlOperatorChars are merged into multi-character operators such as <=.
+const sqlOperatorChars = "=<>!+-*/%|"
+
+// tightBefore reports whether token is written without a space after prev.
+func tightBefore(prev, token string) bool {
+	switch {
+	case token == ")" || token == "," || token == ";":
+		return true
+	case prev == "(":
+		return true
+	case token == "(":
+		r := []rune(prev)[0]
+		return unicode.IsLetter(r) || r == '_'
+	}
+	return false
+}
+
+// QueryStats summarises executions of one normalized SQL pattern.
+type QueryStats struct {
+	Pattern   string  `json:"pattern"`
+	Count     int64   `json:"count"`
+	AvgTimeMs float64 `json:"avg_execution_time_ms"`
+	P95TimeMs int64   `json:"p95_execution_time_ms"`
+}
+
+type patternStats struct {
+	count   int64
+	totalMs int64
+	samples []int64
+	next    int
+}
+
+// queryStatsAggregator groups query executions by normalized SQL pattern.
+type queryStatsAggregator struct {
+	mu           sync.Mutex
+	maxPatterns  int
+	patterns     map[string]*patternStats
+	fingerprints *fingerprintCache
+}
+
+func newQueryStatsAggregator(maxPatterns int, fingerprints *fingerprintCache) *queryStatsAggregator {
+	return &queryStatsAggregator{
+		maxPatterns:  maxPatterns,
+		patterns:     make(map[string]*patternStats),
+		fingerprints: fingerprints,
+	}
+}
+
+func (a *queryStatsAggregator) record(metric QueryMetrics) {
+	if metric.Data == nil || metric.Data.ExecutionTimeMs == nil || metric.Data.SQLPattern == "" {
+		return
+	}
+	pattern := a.fingerprints.get(metric.Data.SQLPattern).pattern
+	elapsed := *metric.Data.ExecutionTimeMs
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats, ok := a.patterns[pattern]
+	if !ok {
+		if a.maxPatterns > 0 && len(a.patterns) >= a.maxPatterns {
+			pattern = overflowPattern
+			stats = a.patterns[pattern]
+		}
+		if stats == nil {
+			stats = &patternStats{}
+			a.patterns[pattern] = stats
+		}
+	}
+	stats.count++
+	stats.totalMs += elapsed
+	if len(stats.samples) < querySampleSize {
+		stats.samples = append(stats.samples, elapsed)
+	} else {
+		stats.samples[stats.next] = elapsed
+		stats.next = (stats.next + 1) % querySampleSize
+	}
+}
+
+// summary returns the stats per pattern, most executed first. The p95 is
+// taken over the most recent executions of each pattern.
+func (a *queryStatsAggregator) summary() []QueryStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]QueryStats, 0, len(a.patterns))
+	for pattern, stats := range a.patterns {
+		sorted := append([]int64(nil), stats.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		result = append(result, QueryStats{
+			Pattern:   pattern,
+			Count:     stats.count,
+			AvgTimeMs: float64(stats.totalMs) / float64(stats.count),
+			P95TimeMs: sorted[(len(sorted)*95+99)/100-1],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// queryStatsHandler serves GET /api/query-stats.
+func (h *Hub) queryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := h.queryStats.summary()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patterns":  stats,
+		"count":     len(stats),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
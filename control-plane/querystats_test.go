@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeSQLPattern(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM users WHERE id = 5", "SELECT * FROM users WHERE id = ?"},
+		{"select * from users where id=6", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT name FROM users WHERE name = 'O''Brien' AND age > 30", "SELECT name FROM users WHERE name = ? AND age > ?"},
+		{"SELECT * FROM orders WHERE id IN (1, 2, 3)", "SELECT * FROM orders WHERE id IN(?)"},
+		{"SELECT * FROM orders WHERE id in (4)", "SELECT * FROM orders WHERE id IN(?)"},
+		{"SELECT * FROM orders WHERE status IN ('a','b')", "SELECT * FROM orders WHERE status IN(?)"},
+		{"UPDATE accounts SET balance = balance - 12.50 WHERE id = 7", "UPDATE accounts SET balance = balance - ? WHERE id = ?"},
+		{"INSERT INTO t (a, b) VALUES (1, 'x')", "INSERT INTO t(a, b) VALUES(?, ?)"},
+		{"SELECT count(*) FROM t1 WHERE total >= 100 LIMIT 10", "SELECT COUNT(*) FROM t1 WHERE total >= ? LIMIT ?"},
+	}
+	for _, tt := range tests {
+		if got := normalizeSQLPattern(tt.sql); got != tt.want {
+			t.Errorf("normalizeSQLPattern(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestQueryStatsGroupsByPattern(t *testing.T) {
+	stats := newQueryStatsAggregator(0, newFingerprintCache(16))
+	for i := int64(1); i <= 100; i++ {
+		stats.record(testMetric("pod-a", i, func(m *QueryMetrics) { m.Data.SQLPattern = fmt.Sprintf("SELECT * FROM users WHERE id = %d", i) }))
+	}
+	for _, sql := range []string{"DELETE FROM sessions WHERE token = 'abc'", ""} {
+		stats.record(testMetric("pod-a", 40, func(m *QueryMetrics) { m.Data.SQLPattern = sql }))
+	}
+
+	summary := stats.summary()
+	if len(summary) != 2 {
+		t.Fatalf("got %d patterns, want 2: %+v", len(summary), summary)
+	}
+	users := summary[0]
+	if users.Pattern != "SELECT * FROM users WHERE id = ?" || users.Count != 100 || users.AvgTimeMs != 50.5 || users.P95TimeMs != 95 {
+		t.Errorf("users stats = %+v, want 100 executions averaging 50.5 with p95 95", users)
+	}
+	if deletes := summary[1]; deletes.Count != 1 || deletes.P95TimeMs != 40 {
+		t.Errorf("delete stats = %+v, want 1 execution at 40", deletes)
+	}
+}
+
+func TestQueryStatsOverflow(t *testing.T) {
+	stats := newQueryStatsAggregator(2, nil)
+	for _, table := range []string{"a", "b", "c", "d", "a"} {
+		stats.record(testMetric("pod-a", 10, func(m *QueryMetrics) { m.Data.SQLPattern = "SELECT * FROM " + table }))
+	}
+
+	counts := make(map[string]int64)
+	for _, pattern := range stats.summary() {
+		counts[pattern.Pattern] = pattern.Count
+	}
+	if len(counts) != 3 || counts["SELECT * FROM a"] != 2 || counts[overflowPattern] != 2 {
+		t.Errorf("counts = %v, want a twice and c, d under %s", counts, overflowPattern)
+	}
+}
+
+func TestQueryStatsHandler(t *testing.T) {
+	h := newHub(testConfig())
+	h.queryStats.record(testMetric("pod-a", 10, func(m *QueryMetrics) { m.Data.SQLPattern = "SELECT * FROM users WHERE id = 1" }))
+	h.queryStats.record(testMetric("pod-a", 30, func(m *QueryMetrics) { m.Data.SQLPattern = "SELECT * FROM users WHERE id = 2" }))
+
+	rec := httptest.NewRecorder()
+	h.queryStatsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/query-stats", nil))
+	var body struct {
+		Patterns []QueryStats `json:"patterns"`
+		Count    int          `json:"count"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Count != 1 || body.Patterns[0].Count != 2 || body.Patterns[0].AvgTimeMs != 20 {
+		t.Errorf("response = %+v, want one pattern with 2 executions averaging 20", body)
+	}
+}
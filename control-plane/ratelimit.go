@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ingestLimiter applies a token bucket per ingestion source. At most
+// maxKeys buckets are kept; the least recently used one is evicted to make
+// room, so a flood of distinct pod names cannot grow it without bound.
+type ingestLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	maxKeys int
+	order   *list.List
+	buckets map[string]*list.Element
+}
+
+type limiterEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+// newIngestLimiter returns nil, which allows everything, when perSecond is
+// not positive.
+func newIngestLimiter(perSecond float64, burst, maxKeys int) *ingestLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &ingestLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		maxKeys: max(maxKeys, 1),
+		order:   list.New(),
+		buckets: make(map[string]*list.Element),
+	}
+}
+
+// allow takes a token for key. When none is available it returns false and
+// how long until one will be.
+func (l *ingestLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, ok := l.buckets[key]
+	if ok {
+		l.order.MoveToFront(element)
+	} else {
+		if l.order.Len() >= l.maxKeys {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*limiterEntry).key)
+		}
+		element = l.order.PushFront(&limiterEntry{key: key, limiter: rate.NewLimiter(l.limit, l.burst)})
+		l.buckets[key] = element
+	}
+
+	reservation := element.Value.(*limiterEntry).limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// ingestSourceKey identifies the sender of an ingestion request: the pod
+// named in the payload, or the remote IP when the payload does not say.
+func ingestSourceKey(r *http.Request, metrics []QueryMetrics) string {
+	if len(metrics) > 0 && metrics[0].PodName != "" {
+		return "pod:" + metrics[0].PodName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
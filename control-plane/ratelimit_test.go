@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIngestLimiterRecoversAfterWindow(t *testing.T) {
+	limiter := newIngestLimiter(2, 3, 10)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("pod:a", now); !ok {
+			t.Fatalf("request %d within the burst was limited", i)
+		}
+	}
+	ok, retryAfter := limiter.allow("pod:a", now)
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("request over the burst = %v, retry after %v, want limited for 500ms", ok, retryAfter)
+	}
+	// Other sources have their own bucket.
+	if ok, _ := limiter.allow("pod:b", now); !ok {
+		t.Error("pod:b was limited by pod:a's requests")
+	}
+	if ok, _ := limiter.allow("pod:a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("request after the retry delay was limited")
+	}
+}
+
+func TestIngestLimiterIsBounded(t *testing.T) {
+	limiter := newIngestLimiter(1, 1, 2)
+	now := time.Now()
+	for _, key := range []string{"pod:a", "pod:b", "pod:c"} {
+		limiter.allow(key, now)
+	}
+	if len(limiter.buckets) != 2 || limiter.order.Len() != 2 {
+		t.Errorf("%d buckets kept, want 2", len(limiter.buckets))
+	}
+	// pod:a was evicted, so it starts over with a full bucket.
+	if ok, _ := limiter.allow("pod:a", now); !ok {
+		t.Error("evicted pod:a was limited")
+	}
+	if ok, _ := limiter.allow("pod:c", now); ok {
+		t.Error("pod:c was allowed past its burst")
+	}
+}
+
+func TestDisabledIngestLimiterAllowsEverything(t *testing.T) {
+	limiter := newIngestLimiter(0, 1, 1)
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiter.allow("pod:a", time.Now()); !ok {
+			t.Fatal("disabled limiter limited a request")
+		}
+	}
+}
+
+func TestIngestSourceKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/metrics", nil)
+	req.RemoteAddr = "10.0.0.7:5123"
+	if got := ingestSourceKey(req, []QueryMetrics{testMetric("pod-a", 10)}); got != "pod:pod-a" {
+		t.Errorf("key = %q, want pod:pod-a", got)
+	}
+	if got := ingestSourceKey(req, []QueryMetrics{testMetric("", 10)}); got != "ip:10.0.0.7" {
+		t.Errorf("key without a pod = %q, want ip:10.0.0.7", got)
+	}
+}
+
+func TestRateLimitedMetricsAreNotBroadcast(t *testing.T) {
+	cfg := testConfig()
+	cfg.IngestRateLimit = 1
+	cfg.IngestBurst = 2
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=query_metrics,done")
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		body, _ := json.Marshal(testMetric("pod-a", int64(i)))
+		rec := postTestBody(h, string(body))
+		if rec.Code != want {
+			t.Fatalf("request %d: status = %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+		}
+	}
+	h.publish(newMessage("done", nil))
+
+	broadcasts := 0
+	for readTestMessage(t, conn).Type != "done" {
+		broadcasts++
+	}
+	if broadcasts != 2 {
+		t.Errorf("got %d broadcasts, want 2 from the allowed requests", broadcasts)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Secondary index names on the recent metric store.
+const (
+	indexPod       = "pod"
+	indexNamespace = "namespace"
+	indexSQLHash   = "sql_hash"
+	indexUser      = "user"
+)
+
+// StoredMetric is an ingested metric as retained in memory.
+type StoredMetric struct {
+	Seq        uint64       `json:"seq"`
+	ReceivedAt time.Time    `json:"received_at"`
+	Metric     QueryMetrics `json:"metric"`
+}
+
+// metricFilter selects stored metrics. Empty fields match everything.
+type metricFilter struct {
+	Pod       string
+	Namespace string
+	SQLHash   string
+	User      string
+	EventType string
+	Limit     int
+}
+
+// metricStore is a ring of recently ingested metrics with secondary indexes
+// from pod, namespace, sql_hash and user to the records carrying them, so a
+// filtered lookup costs O(matches) rather than a full scan.
+//
+// Records are evicted strictly oldest first, which keeps every index list in
+// sequence order and means an evicted record is always at the front of the
+// lists it appears in.
+type metricStore struct {
+	mu      sync.RWMutex
+	records []StoredMetric
+	nextSeq uint64
+	indexes map[string]map[string][]uint64
+}
+
+func newMetricStore(capacity int) *metricStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &metricStore{
+		records: make([]StoredMetric, capacity),
+		nextSeq: 1,
+		indexes: map[string]map[string][]uint64{
+			indexPod:       {},
+			indexNamespace: {},
+			indexSQLHash:   {},
+			indexUser:      {},
+		},
+	}
+}
+
+// indexKeys returns the secondary index keys of a metric.
+func indexKeys(metric QueryMetrics) map[string]string {
+	keys := map[string]string{
+		indexPod:       metric.PodName,
+		indexNamespace: metric.Namespace,
+	}
+	if metric.Data != nil {
+		keys[indexSQLHash] = metric.Data.SQLHash
+	}
+	if metric.Context != nil {
+		keys[indexUser] = metric.Context.UserID
+	}
+	return keys
+}
+
+func (s *metricStore) add(metric QueryMetrics, now time.Time) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.nextSeq
+	s.nextSeq++
+	slot := &s.records[seq%uint64(len(s.records))]
+	if slot.Seq != 0 {
+		s.unindex(*slot)
+	}
+	*slot = StoredMetric{Seq: seq, ReceivedAt: now, Metric: metric}
+
+	for index, key := range indexKeys(metric) {
+		if key != "" {
+			s.indexes[index][key] = append(s.indexes[index][key], seq)
+		}
+	}
+	return seq
+}
+
+// unindex removes an evicted record from the indexes. Callers hold s.mu.
+func (s *metricStore) unindex(record StoredMetric) {
+	for index, key := range indexKeys(record.Metric) {
+		seqs := s.indexes[index][key]
+		if len(seqs) == 0 || seqs[0] != record.Seq {
+			continue
+		}
+		if len(seqs) == 1 {
+			delete(s.indexes[index], key)
+		} else {
+			s.indexes[index][key] = seqs[1:]
+		}
+	}
+}
+
+// lookup returns the record with seq if it is still retained. Callers hold s.mu.
+func (s *metricStore) lookup(seq uint64) (StoredMetric, bool) {
+	record := s.records[seq%uint64(len(s.records))]
+	return record, record.Seq == seq
+}
+
+func (f metricFilter) matches(metric QueryMetrics) bool {
+	keys := indexKeys(metric)
+	return (f.Pod == "" || keys[indexPod] == f.Pod) &&
+		(f.Namespace == "" || keys[indexNamespace] == f.Namespace) &&
+		(f.SQLHash == "" || keys[indexSQLHash] == f.SQLHash) &&
+		(f.User == "" || keys[indexUser] == f.User) &&
+		(f.EventType == "" || metric.EventType == f.EventType)
+}
+
+// query returns matching records, newest first. It walks the shortest index
+// list among the filtered fields, or the whole ring when none is indexed.
+func (s *metricStore) query(filter metricFilter) []StoredMetric {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var candidates []uint64
+	indexed := false
+	for index, key := range map[string]string{
+		indexPod:       filter.Pod,
+		indexNamespace: filter.Namespace,
+		indexSQLHash:   filter.SQLHash,
+		indexUser:      filter.User,
+	} {
+		if key == "" {
+			continue
+		}
+		seqs := s.indexes[index][key]
+		if !indexed || len(seqs) < len(candidates) {
+			candidates = seqs
+			indexed = true
+		}
+	}
+
+	result := make([]StoredMetric, 0)
+	collect := func(record StoredMetric) bool {
+		if filter.matches(record.Metric) {
+			result = append(result, record)
+		}
+		return filter.Limit <= 0 || len(result) < filter.Limit
+	}
+
+	if indexed {
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if record, ok := s.lookup(candidates[i]); ok && !collect(record) {
+				break
+			}
+		}
+		return result
+	}
+
+	for seq := s.nextSeq - 1; seq > 0; seq-- {
+		record, ok := s.lookup(seq)
+		if !ok || !collect(record) {
+			break
+		}
+	}
+	return result
+}
+
+// recentMetricsHandler serves
+// GET /api/metrics/recent?pod=&namespace=&sql_hash=&user=&event_type=&limit=.
+func (h *Hub) recentMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := metricFilter{
+		Pod:       query.Get("pod"),
+		Namespace: query.Get("namespace"),
+		SQLHash:   query.Get("sql_hash"),
+		User:      query.Get("user"),
+		EventType: query.Get("event_type"),
+		Limit:     100,
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records := h.recent.query(filter)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"metrics": records,
+		"count":   len(records),
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// bruteForceQuery filters every retained record, newest first.
+func bruteForceQuery(s *metricStore, filter metricFilter) []uint64 {
+	var seqs []uint64
+	for seq := s.nextSeq - 1; seq > 0; seq-- {
+		record, ok := s.lookup(seq)
+		if !ok {
+			break
+		}
+		if filter.matches(record.Metric) {
+			seqs = append(seqs, seq)
+		}
+	}
+	return seqs
+}
+
+func TestMetricStoreIndexesMatchScan(t *testing.T) {
+	store := newMetricStore(20)
+	now := time.Now()
+	for i := 0; i < 75; i++ {
+		store.add(testMetric(fmt.Sprintf("pod-%d", i%4), int64(i), func(m *QueryMetrics) {
+			m.Namespace = fmt.Sprintf("ns-%d", i%3)
+			m.Data.SQLHash = fmt.Sprintf("hash-%d", i%5)
+			m.Context = &ExecutionContext{UserID: fmt.Sprintf("user-%d", i%7)}
+			if i%2 == 0 {
+				m.EventType = "transaction_event"
+			}
+		}), now)
+	}
+
+	filters := []metricFilter{
+		{},
+		{Pod: "pod-1"},
+		{Namespace: "ns-2"},
+		{SQLHash: "hash-3"},
+		{User: "user-0"},
+		{Pod: "pod-2", Namespace: "ns-1"},
+		{Pod: "pod-0", EventType: "transaction_event"},
+		{User: "user-6", SQLHash: "hash-4", EventType: "query_execution"},
+		{Pod: "pod-9"},
+	}
+	for _, filter := range filters {
+		var got []uint64
+		for _, record := range store.query(filter) {
+			got = append(got, record.Seq)
+		}
+		if want := bruteForceQuery(store, filter); !slices.Equal(got, want) {
+			t.Errorf("query(%+v) = %v, want %v", filter, got, want)
+		}
+	}
+
+	if got := store.query(metricFilter{Pod: "pod-1", Limit: 2}); len(got) != 2 || got[0].Seq != 74 {
+		t.Errorf("limited query = %d records from seq %d, want 2 from 74", len(got), got[0].Seq)
+	}
+}
+
+func TestMetricStoreIndexesPrunedOnEviction(t *testing.T) {
+	store := newMetricStore(20)
+	now := time.Now()
+	for i := 0; i < 75; i++ {
+		store.add(testMetric(fmt.Sprintf("pod-%d", i%4), int64(i), func(m *QueryMetrics) {
+			m.Namespace = fmt.Sprintf("ns-%d", i%3)
+			m.Data.SQLHash = fmt.Sprintf("hash-%d", i%5)
+			m.Context = &ExecutionContext{UserID: fmt.Sprintf("user-%d", i%7)}
+			if i%2 == 0 {
+				m.EventType = "transaction_event"
+			}
+		}), now)
+	}
+
+	// Every index entry refers to a retained record carrying its key.
+	for index, keys := range store.indexes {
+		for key, seqs := range keys {
+			for _, seq := range seqs {
+				record, ok := store.lookup(seq)
+				if !ok || indexKeys(record.Metric)[index] != key {
+					t.Errorf("%s index %q holds evicted or foreign seq %d", index, key, seq)
+				}
+			}
+		}
+	}
+
+	// A key only carried by evicted records leaves the index.
+	store.add(testMetric("pod-once", 1), now)
+	for i := 0; i < 20; i++ {
+		store.add(testMetric(fmt.Sprintf("pod-%d", i%4), int64(i), func(m *QueryMetrics) {
+			m.Namespace = fmt.Sprintf("ns-%d", i%3)
+			m.Data.SQLHash = fmt.Sprintf("hash-%d", i%5)
+			m.Context = &ExecutionContext{UserID: fmt.Sprintf("user-%d", i%7)}
+			if i%2 == 0 {
+				m.EventType = "transaction_event"
+			}
+		}), now)
+	}
+	if _, ok := store.indexes[indexPod]["pod-once"]; ok {
+		t.Error("pod index kept a key whose records were all evicted")
+	}
+}
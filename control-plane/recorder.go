@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// recordedMetric is one line of a recording.
+type recordedMetric struct {
+	ReceivedAt time.Time    `json:"received_at"`
+	Metric     QueryMetrics `json:"metric"`
+}
+
+// metricRecorder appends every processed metric to a newline-delimited JSON
+// file for offline analysis. Once the file reaches maxBytes it is moved to
+// path.1, replacing the previous one, and a new file is started. A nil
+// recorder records nothing.
+type metricRecorder struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+func openMetricRecorder(path string, maxBytes int64) (*metricRecorder, error) {
+	r := &metricRecorder{path: path, maxBytes: maxBytes}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open (re)opens the recording file. Callers hold r.mu or own r exclusively.
+func (r *metricRecorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open recording: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("open recording: %w", err)
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+func (r *metricRecorder) record(metric QueryMetrics, now time.Time) {
+	if r == nil {
+		return
+	}
+	line, err := json.Marshal(recordedMetric{ReceivedAt: now, Metric: metric})
+	if err != nil {
+		slog.Error("failed to encode recorded metric", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(line)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			slog.Error("failed to rotate recording", "path", r.path, "error", err)
+			return
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		slog.Error("failed to record metric", "path", r.path, "error", err)
+	}
+}
+
+// rotate moves the current file to path.1 and starts a new one. Callers
+// hold r.mu.
+func (r *metricRecorder) rotate() error {
+	r.file.Close()
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *metricRecorder) close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// replayFile feeds a recording back through the ingestion pipeline, which
+// hands each metric to its cluster's hub, in order. With a positive speed
+// the original spacing between metrics is kept, divided by speed; otherwise
+// metrics are replayed as fast as they are processed. Replay stops early,
+// without an error, once ctx is cancelled or the pipeline is stopped.
+func (h *Hub) replayFile(ctx context.Context, path string, speed float64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var previous time.Time
+	replayed := 0
+	for scanner.Scan() {
+		var recorded recordedMetric
+		if err := json.Unmarshal(scanner.Bytes(), &recorded); err != nil {
+			slog.Warn("skipping corrupt recording line", "path", path, "error", err)
+			continue
+		}
+		if speed > 0 && !previous.IsZero() {
+			if gap := recorded.ReceivedAt.Sub(previous); gap > 0 {
+				select {
+				case <-time.After(time.Duration(float64(gap) / speed)):
+				case <-ctx.Done():
+				}
+			}
+		}
+		previous = recorded.ReceivedAt
+
+		err := h.replayMetric(ctx, recorded.Metric)
+		if ctx.Err() != nil || errors.Is(err, errPipelineClosed) {
+			slog.Info("replay stopped", "path", path, "metrics", replayed)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("replay line %d: %w", replayed+1, err)
+		}
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	slog.Info("replayed recording", "path", path, "metrics", replayed)
+	return nil
+}
+
+// replayMetric submits a replayed metric and waits for it to be processed.
+// A full queue is retried rather than dropping the metric, as the recording
+// can be read far faster than the hubs drain it.
+func (h *Hub) replayMetric(ctx context.Context, metric QueryMetrics) error {
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := h.ingest.submit(metric, true)
+		if !errors.Is(err, errQueueFull) {
+			return err
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestRecorder(t *testing.T, path string, maxBytes int64) *metricRecorder {
+	t.Helper()
+	recorder, err := openMetricRecorder(path, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recorder.close() })
+	return recorder
+}
+
+func TestRecordThenReplayPreservesOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	recorder := openTestRecorder(t, path, 0)
+	start := time.Now()
+	for i := int64(1); i <= 20; i++ {
+		recorder.record(testMetric("pod-a", i), start.Add(time.Duration(i)*time.Millisecond))
+	}
+	recorder.close()
+
+	// A line cut short by a crash is skipped.
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	file.WriteString(`{"received_at":"` + "\n")
+	file.Close()
+
+	h, processed := recordingTestHub(t)
+	if err := h.replayFile(context.Background(), path, 0); err != nil {
+		t.Fatal(err)
+	}
+	got := processed()
+	if len(got) != 20 {
+		t.Fatalf("replayed %d metrics, want 20", len(got))
+	}
+	for i, value := range got {
+		if value != int64(i+1) {
+			t.Fatalf("metric %d replayed at position %d", value, i)
+		}
+	}
+}
+
+func TestReplayKeepsScaledTiming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	recorder := openTestRecorder(t, path, 0)
+	start := time.Now()
+	for i := int64(0); i < 3; i++ {
+		recorder.record(testMetric("pod-a", i), start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+
+	h, _ := recordingTestHub(t)
+	began := time.Now()
+	if err := h.replayFile(context.Background(), path, 2); err != nil {
+		t.Fatal(err)
+	}
+	// 200ms of recording at double speed.
+	if elapsed := time.Since(began); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("replay took %v, want about 100ms", elapsed)
+	}
+}
+
+func TestReplayStopsOnShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	recorder := openTestRecorder(t, path, 0)
+	start := time.Now()
+	for i := int64(0); i < 3; i++ {
+		recorder.record(testMetric("pod-a", i), start.Add(time.Duration(i)*time.Hour))
+	}
+
+	// Cancelling interrupts the wait between metrics.
+	h, processed := recordingTestHub(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := h.replayFile(ctx, path, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := processed(); len(got) != 1 {
+		t.Errorf("replayed %v before the cancel, want only the first metric", got)
+	}
+
+	// A stopped pipeline ends the replay instead of processing after it.
+	h.ingest.stop()
+	if err := h.replayFile(context.Background(), path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := processed(); len(got) != 1 {
+		t.Errorf("replayed %v after the pipeline stopped, want nothing more", got)
+	}
+}
+
+func TestRecorderRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	recorder := openTestRecorder(t, path, 1024)
+	for i := int64(0); i < 10; i++ {
+		recorder.record(testMetric("pod-a", i), time.Now())
+	}
+
+	for _, name := range []string{path, path + ".1"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() > 1024 {
+			t.Errorf("%s is %d bytes, want at most 1024", filepath.Base(name), info.Size())
+		}
+	}
+	// Rotation only keeps the previous file.
+	if lines := countLines(t, path) + countLines(t, path+".1"); lines >= 10 {
+		t.Errorf("%d metrics kept after rotating, want older ones dropped", lines)
+	}
+}
+
+func TestNilRecorderRecordsNothing(t *testing.T) {
+	var recorder *metricRecorder
+	recorder.record(testMetric("pod-a", 10), time.Now())
+	if err := recorder.close(); err != nil {
+		t.Errorf("close = %v, want nil", err)
+	}
+}
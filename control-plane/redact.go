@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// defaultRedactPatterns mask email addresses and runs of nine or more digits,
+// optionally separated by spaces or dashes, which covers card, account and
+// phone numbers. Digits inside identifiers such as t_123456789 are left
+// alone.
+const defaultRedactPatterns = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,};\b\d(?:[ -]?\d){8,}\b`
+
+// redactedMask replaces every redacted substring.
+const redactedMask = "[REDACTED]"
+
+// parseRedactPatterns parses a semicolon-separated list of regular
+// expressions. "none" disables redaction; invalid expressions are ignored.
+func parseRedactPatterns(raw string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, expr := range strings.Split(raw, ";") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" || strings.EqualFold(expr, "none") {
+			continue
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			slog.Warn("ignoring invalid redact pattern", "pattern", expr, "error", err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// redact masks the configured patterns in the metric's SQL pattern and error
+// message. It copies the query data rather than changing it in place.
+func (h *Hub) redact(metric QueryMetrics) QueryMetrics {
+	if len(h.cfg.RedactPatterns) == 0 || metric.Data == nil {
+		return metric
+	}
+	data := *metric.Data
+	data.SQLPattern = redactString(h.cfg.RedactPatterns, data.SQLPattern)
+	data.ErrorMessage = redactString(h.cfg.RedactPatterns, data.ErrorMessage)
+	metric.Data = &data
+	return metric
+}
+
+func redactString(patterns []*regexp.Regexp, s string) string {
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllString(s, redactedMask)
+	}
+	return s
+}
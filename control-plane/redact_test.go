@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestDefaultRedactPatterns(t *testing.T) {
+	patterns := parseRedactPatterns(defaultRedactPatterns)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"SELECT * FROM users WHERE email = 'jane.doe+test@example.co.uk'", "SELECT * FROM users WHERE email = '[REDACTED]'"},
+		{"UPDATE cards SET pan = '4111 1111 1111 1111' WHERE id = ?", "UPDATE cards SET pan = '[REDACTED]' WHERE id = ?"},
+		{"INSERT INTO payments VALUES ('4111-1111-1111-1111', 25)", "INSERT INTO payments VALUES ('[REDACTED]', 25)"},
+		{"SELECT * FROM accounts WHERE number = 123456789", "SELECT * FROM accounts WHERE number = [REDACTED]"},
+		// Structure, short numbers and digits inside identifiers stay.
+		{"SELECT id, name FROM t_123456789 WHERE age > 30 LIMIT 100", "SELECT id, name FROM t_123456789 WHERE age > 30 LIMIT 100"},
+		{"SELECT * FROM orders WHERE id = 12345678", "SELECT * FROM orders WHERE id = 12345678"},
+	}
+	for _, tt := range tests {
+		if got := redactString(patterns, tt.in); got != tt.want {
+			t.Errorf("redactString(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRedactPatterns(t *testing.T) {
+	if patterns := parseRedactPatterns("none"); len(patterns) != 0 {
+		t.Errorf("none parsed to %d patterns, want redaction disabled", len(patterns))
+	}
+	patterns := parseRedactPatterns(`secret-\w+; ([unclosed ;token=\S+`)
+	if len(patterns) != 2 {
+		t.Fatalf("parsed %d patterns, want the invalid one skipped", len(patterns))
+	}
+	if got := redactString(patterns, "auth secret-abc token=xyz"); got != "auth [REDACTED] [REDACTED]" {
+		t.Errorf("redactString = %q, want both custom patterns applied", got)
+	}
+}
+
+func TestMetricsAreRedactedBeforeBroadcastAndStorage(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	metric := testMetric("pod-a", 10)
+	metric.Data.SQLPattern = "SELECT * FROM users WHERE email = 'jane@example.com'"
+	metric.Data.ErrorMessage = "duplicate key 4111111111111111"
+	postTestMetric(t, h, metric)
+
+	data := readTestMessage(t, conn).Data.(map[string]interface{})["data"].(map[string]interface{})
+	if data["sql_pattern"] != "SELECT * FROM users WHERE email = '[REDACTED]'" || data["error_message"] != "duplicate key [REDACTED]" {
+		t.Errorf("broadcast data = %v, want the email and card number redacted", data)
+	}
+	records := h.recent.query(metricFilter{})
+	if len(records) != 1 || records[0].Metric.Data.SQLPattern != "SELECT * FROM users WHERE email = '[REDACTED]'" {
+		t.Errorf("stored metrics = %+v, want the redacted SQL", records)
+	}
+	if redacted := h.redact(metric); redacted.Data == metric.Data || metric.Data.SQLPattern != "SELECT * FROM users WHERE email = 'jane@example.com'" {
+		t.Error("redact changed the caller's query data in place")
+	}
+}
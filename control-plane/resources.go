@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// thresholdTransition is the outcome of feeding one sample to a
+// thresholdMonitor.
+type thresholdTransition int
+
+const (
+	thresholdUnchanged thresholdTransition = iota
+	thresholdFired
+	thresholdRepeated
+	thresholdRecovered
+)
+
+// thresholdMonitor tracks a per-pod resource ratio against a hysteresis band:
+// an alert fires once the ratio reaches high and only recovers after it drops
+// below low, so a value hovering around a single threshold does not flap.
+//
+// With repeat set, a pod that stays in the alert band is reported again as
+// thresholdRepeated at most once per repeat interval. With consecutive set,
+// an alert only fires once that many samples in a row reached high.
+type thresholdMonitor struct {
+	mu          sync.Mutex
+	high        float64
+	low         float64
+	repeat      time.Duration
+	consecutive int
+	pods        map[string]*thresholdState
+}
+
+type thresholdState struct {
+	firing   bool
+	above    int
+	notified time.Time
+}
+
+func newThresholdMonitor(high, low float64) *thresholdMonitor {
+	if low > high {
+		low = high
+	}
+	return &thresholdMonitor{
+		high: high,
+		low:  low,
+		pods: make(map[string]*thresholdState),
+	}
+}
+
+func (m *thresholdMonitor) observe(podName string, value float64, now time.Time) thresholdTransition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.pods[podName]
+	if !ok {
+		state = &thresholdState{}
+		m.pods[podName] = state
+	}
+
+	if value >= m.high {
+		state.above++
+	} else {
+		state.above = 0
+	}
+
+	switch {
+	case !state.firing && state.above >= max(m.consecutive, 1):
+		state.firing = true
+		state.notified = now
+		return thresholdFired
+	case state.firing && value < m.low:
+		state.firing = false
+		return thresholdRecovered
+	case state.firing && m.repeat > 0 && value >= m.high && now.Sub(state.notified) >= m.repeat:
+		state.notified = now
+		return thresholdRepeated
+	}
+	return thresholdUnchanged
+}
+
+func (m *thresholdMonitor) forget(podName string) {
+	m.mu.Lock()
+	delete(m.pods, podName)
+	m.mu.Unlock()
+}
+
+// ratioSample is one timestamped observation of a resource ratio.
+type ratioSample struct {
+	Value float64   `json:"value"`
+	At    time.Time `json:"at"`
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// sampledOut reports whether a query_execution is left out of the broadcast
+// under QUERY_SAMPLE_RATE. Failed queries and queries at or above
+// QUERY_SAMPLE_SLOW_THRESHOLD are always broadcast. Only the broadcast is
+// sampled; the metric has already been counted by every aggregation.
+func (h *Hub) sampledOut(metric QueryMetrics) bool {
+	rate := h.cfg.QuerySampleRate
+	if rate >= 1 || metric.Data == nil || metric.Data.failed() {
+		return false
+	}
+	if ms := metric.Data.ExecutionTimeMs; ms != nil && time.Duration(*ms)*time.Millisecond >= h.cfg.QuerySampleSlowThreshold {
+		return false
+	}
+	if rate > 0 && rand.Float64() < rate {
+		return false
+	}
+	querySampledOutTotal.Inc()
+	return true
+}
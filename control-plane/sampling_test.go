@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSamplingRatio(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		min, max int
+	}{
+		{1, 4000, 4000},
+		{0, 0, 0},
+		// 1000 expected; the bounds are over five standard deviations out.
+		{0.25, 850, 1150},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		cfg.QuerySampleRate = tt.rate
+		h := newHub(cfg)
+		kept := 0
+		for i := 0; i < 4000; i++ {
+			if !h.sampledOut(testMetric("pod-a", 10)) {
+				kept++
+			}
+		}
+		if kept < tt.min || kept > tt.max {
+			t.Errorf("rate %v kept %d of 4000, want %d to %d", tt.rate, kept, tt.min, tt.max)
+		}
+	}
+}
+
+func TestSamplingBypass(t *testing.T) {
+	cfg := testConfig()
+	cfg.QuerySampleRate = 0
+	cfg.QuerySampleSlowThreshold = 500 * time.Millisecond
+	h := newHub(cfg)
+	before := counterValue(t, querySampledOutTotal)
+
+	for _, tt := range []struct {
+		name   string
+		metric QueryMetrics
+		want   bool
+	}{
+		{"fast", testMetric("pod-a", 10), true},
+		{"just under the threshold", testMetric("pod-a", 499), true},
+		{"slow", testMetric("pod-a", 500), false},
+		{"error", testMetric("pod-a", 10, func(m *QueryMetrics) { m.Data.Status = "ERROR" }), false},
+	} {
+		if got := h.sampledOut(tt.metric); got != tt.want {
+			t.Errorf("%s: sampledOut = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got := counterValue(t, querySampledOutTotal) - before; got != 2 {
+		t.Errorf("sampled out counted %v times, want 2", got)
+	}
+}
+
+func TestSampledOutQueriesStillCount(t *testing.T) {
+	cfg := testConfig()
+	cfg.QuerySampleRate = 0
+	cfg.QuerySampleSlowThreshold = time.Second
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=query_metrics,transaction_event,done")
+
+	for i := 0; i < 5; i++ {
+		postTestMetric(t, h, testMetric("pod-a", 10))
+	}
+	postTestMetric(t, h, testMetric("pod-a", 2000))
+	postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+		m.Data.Status = "ERROR"
+		m.Data.ErrorMessage = "timeout"
+	}))
+	postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+		m.EventType = "transaction_event"
+		m.Data.TransactionId = ptr("tx-1")
+		m.Data.TransactionDuration = ptr(int64(10))
+		m.Data.Status = "COMMITTED"
+	}))
+	h.publish(newMessage("done", nil))
+
+	var broadcast []string
+	for {
+		message := readTestMessage(t, conn)
+		if message.Type == "done" {
+			break
+		}
+		data := message.Data.(map[string]interface{})["data"].(map[string]interface{})
+		broadcast = append(broadcast, fmt.Sprintf("%s/%v/%v", message.Type, data["execution_time_ms"], data["status"]))
+	}
+	want := "[query_metrics/2000/SUCCESS query_metrics/10/ERROR transaction_event/10/COMMITTED]"
+	if fmt.Sprint(broadcast) != want {
+		t.Errorf("broadcast %v, want %s", broadcast, want)
+	}
+
+	// The aggregations saw all seven executions.
+	if stats := h.queryStats.summary(); len(stats) != 1 || stats[0].Count != 7 {
+		t.Errorf("query stats = %+v, want 7 executions", stats)
+	}
+	if rate := h.tps.rates(time.Now().Add(time.Second))["pod-a"]; rate.TPS15s != 7.0/tpsWindowSeconds {
+		t.Errorf("tps = %+v, want 7 executions over the window", rate)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// sqlRule is one injection heuristic applied to reported SQL patterns.
+type sqlRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// sqlRules are the available heuristics in the order they are tried. Agents
+// report parameterized SQL, so literals in these positions mean the value was
+// concatenated into the statement rather than bound.
+var sqlRules = []sqlRule{
+	{"tautology", regexp.MustCompile(`(?i)\bor\s+(?:'[^']*'\s*=\s*'[^']*'|\d+\s*=\s*\d+|true\b)`)},
+	{"union_select", regexp.MustCompile(`(?i)\bunion\s+(?:all\s+)?select\b`)},
+	{"stacked_query", regexp.MustCompile(`(?i);\s*(?:select|insert|update|delete|drop|create|alter|truncate|grant|exec)\b`)},
+	{"comment_terminator", regexp.MustCompile(`--|/\*`)},
+}
+
+// sqlRuleSet is the enabled subset of sqlRules.
+type sqlRuleSet []sqlRule
+
+// parseSQLRuleSet parses a comma-separated list of rule names. "all" enables
+// every rule and "none" disables detection; unknown names are ignored.
+func parseSQLRuleSet(raw string) sqlRuleSet {
+	var enabled sqlRuleSet
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			return append(sqlRuleSet(nil), sqlRules...)
+		}
+		found := false
+		for _, rule := range sqlRules {
+			if rule.name == name {
+				enabled = append(enabled, rule)
+				found = true
+			}
+		}
+		if !found {
+			slog.Warn("ignoring unknown sql security rule", "rule", name)
+		}
+	}
+	return enabled
+}
+
+// detectSuspiciousSQL reports whether the pattern matches an enabled rule,
+// and which one.
+func (h *Hub) detectSuspiciousSQL(pattern string) (bool, string) {
+	for _, rule := range h.cfg.SQLSecurityRules {
+		if rule.pattern.MatchString(pattern) {
+			return true, rule.name
+		}
+	}
+	return false, ""
+}
+
+// analyzeSQL broadcasts and records a security_alert for query executions
+// whose SQL pattern looks like an injection attempt. Nothing marks the end of
+// an attempt, so the alert stays open; later matches from the pod update it.
+func (h *Hub) analyzeSQL(metric QueryMetrics) {
+	if metric.Data == nil || metric.Data.SQLPattern == "" {
+		return
+	}
+	suspicious, rule := h.detectSuspiciousSQL(metric.Data.SQLPattern)
+	if !suspicious {
+		return
+	}
+
+	slog.Warn("suspicious sql detected", "rule", rule, "pod_name", metric.PodName, "namespace", metric.Namespace)
+	h.alerts.fire("security_alert", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+		"rule":        rule,
+		"query_id":    metric.Data.QueryID,
+		"sql_pattern": metric.Data.SQLPattern,
+	})
+	h.publish(newNamespacedMessage("security_alert", metric.Namespace, map[string]interface{}{
+		"rule":        rule,
+		"pod_name":    metric.PodName,
+		"namespace":   metric.Namespace,
+		"query_id":    metric.Data.QueryID,
+		"sql_pattern": metric.Data.SQLPattern,
+		"severity":    "warning",
+	}))
+}
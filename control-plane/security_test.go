@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectSuspiciousSQL(t *testing.T) {
+	h := newHub(testConfig())
+	tests := []struct {
+		sql  string
+		rule string // "" when benign
+	}{
+		{"SELECT * FROM users WHERE id = ?", ""},
+		{"SELECT * FROM users WHERE name = ? OR email = ?", ""},
+		{"SELECT * FROM orders WHERE status IN (?, ?) ORDER BY created_at", ""},
+		{"UPDATE accounts SET balance = ? WHERE id = ?", ""},
+		{"SELECT * FROM users WHERE id = 1 OR 1=1", "tautology"},
+		{"SELECT * FROM users WHERE name = '' or 'a'='a'", "tautology"},
+		{"SELECT * FROM users WHERE admin = false OR true", "tautology"},
+		{"SELECT name FROM users WHERE id = 1 UNION SELECT password FROM admins", "union_select"},
+		{"SELECT name FROM users WHERE id = 1 union all select secret FROM keys", "union_select"},
+		{"SELECT * FROM users WHERE id = 1; DROP TABLE users", "stacked_query"},
+		{"SELECT * FROM users WHERE name = 'admin'--' AND password = ?", "comment_terminator"},
+		{"SELECT * FROM users WHERE id = 1 /* bypass */", "comment_terminator"},
+	}
+	for _, tt := range tests {
+		suspicious, rule := h.detectSuspiciousSQL(tt.sql)
+		if suspicious != (tt.rule != "") || rule != tt.rule {
+			t.Errorf("detectSuspiciousSQL(%q) = %v, %q, want rule %q", tt.sql, suspicious, rule, tt.rule)
+		}
+	}
+}
+
+func TestParseSQLRuleSet(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{"all", []string{"tautology", "union_select", "stacked_query", "comment_terminator"}},
+		{"none", nil},
+		{"", nil},
+		{" Union_Select , tautology, bogus", []string{"union_select", "tautology"}},
+	}
+	for _, tt := range tests {
+		rules := parseSQLRuleSet(tt.raw)
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.name)
+		}
+		if len(names) != len(tt.want) {
+			t.Errorf("parseSQLRuleSet(%q) = %v, want %v", tt.raw, names, tt.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.want[i] {
+				t.Errorf("parseSQLRuleSet(%q) = %v, want %v", tt.raw, names, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSecurityAlert(t *testing.T) {
+	cfg := testConfig()
+	cfg.SQLSecurityRules = parseSQLRuleSet("union_select")
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=security_alert,done")
+
+	// Disabled rules do not alert.
+	for _, sql := range []string{"SELECT * FROM users WHERE id = 1 OR 1=1", "SELECT a FROM t UNION SELECT b FROM u"} {
+		postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) { m.Data.SQLPattern = sql }))
+	}
+	h.publish(newMessage("done", nil))
+
+	alert := readTestMessage(t, conn)
+	data, _ := alert.Data.(map[string]interface{})
+	if alert.Type != "security_alert" || data["rule"] != "union_select" || data["pod_name"] != "pod-a" {
+		t.Errorf("message = %s %v, want a union_select security_alert from pod-a", alert.Type, data)
+	}
+	if next := readTestMessage(t, conn); next.Type != "done" {
+		t.Errorf("message = %s %v, want no further alert", next.Type, next.Data)
+	}
+
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "security_alert")
+	if len(alerts) != 1 || alerts[0].PodName != "pod-a" || alerts[0].Details["rule"] != "union_select" {
+		t.Errorf("alert history = %+v, want one union_select alert for pod-a", alerts)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// shutdownBacklog counts the work still queued at some point of a shutdown.
+type shutdownBacklog struct {
+	metrics        int
+	broadcasts     int
+	clientMessages int
+	sinkWrites     int
+}
+
+// backlog counts what is queued. Client queues are only counted while the
+// hub is running, since only the hub goroutine can list its clients.
+func (h *Hub) backlog(withClients bool) shutdownBacklog {
+	backlog := shutdownBacklog{
+		metrics:    h.ingest.pending(),
+		broadcasts: len(h.broadcast),
+		sinkWrites: h.sink.pending(),
+	}
+	if withClients {
+		for _, client := range h.listClients() {
+			backlog.clientMessages += client.QueuedCount
+		}
+	}
+	return backlog
+}
+
+// drain stops ingestion and flushes what is queued behind it, in order: the
+// pipeline's metrics, the sink, the forwarders and then the broadcasts still
+// waiting for stream clients, which finish with a going-away close frame. It
+// gives up when ctx expires, logging what was left behind.
+func (h *Hub) drain(ctx context.Context) error {
+	queued := h.backlog(true)
+	slog.Info("draining before shutdown",
+		"queued_metrics", queued.metrics,
+		"queued_broadcasts", queued.broadcasts,
+		"queued_client_messages", queued.clientMessages,
+		"queued_sink_writes", queued.sinkWrites)
+
+	start := time.Now()
+	drained := make(chan error, 1)
+	go func() {
+		h.ingest.stop()
+		h.sink.stop()
+		if h.upstream != nil {
+			h.upstream.stop()
+		}
+		if h.webhook != nil {
+			h.webhook.stop()
+		}
+		drained <- h.shutdown(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		left := h.backlog(false)
+		slog.Warn("shutdown timeout reached before draining finished",
+			"dropped_metrics", left.metrics,
+			"dropped_broadcasts", left.broadcasts,
+			"dropped_sink_writes", left.sinkWrites,
+			"error", err)
+		return err
+	}
+	slog.Info("drained before shutdown",
+		"metrics", queued.metrics,
+		"broadcasts", queued.broadcasts,
+		"client_messages", queued.clientMessages,
+		"sink_writes", queued.sinkWrites,
+		"duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestPublishDuringShutdown races publishers and ingestion against the hub
+// closing. Run with -race; a send on the closed broadcast channel panics.
+func TestPublishDuringShutdown(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	dialTestHub(t, h, "")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := h.publish(newMessage("test", nil)); err != nil {
+					if !errors.Is(err, errHubClosed) {
+						t.Errorf("publish error = %v, want errHubClosed", err)
+					}
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if code := postTestMetric(t, h, testMetric("pod-a", 10)); code != http.StatusOK && code != http.StatusServiceUnavailable {
+					t.Errorf("status = %d, want 200 or 503", code)
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if code := postTestMetric(t, h, testMetric("pod-a", 10)); code != http.StatusServiceUnavailable {
+		t.Errorf("status after shutdown = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestShutdownFlushesClientsBeforeClosing(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conns := []*websocket.Conn{dialTestHub(t, h, "types=event"), dialTestHub(t, h, "types=event")}
+
+	for i := 0; i < 3; i++ {
+		h.publish(newMessage("event", map[string]interface{}{"n": i}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	for _, conn := range conns {
+		for i := 0; i < 3; i++ {
+			if message := readTestMessage(t, conn); message.Type != "event" {
+				t.Fatalf("message %d = %q, want the queued event", i, message.Type)
+			}
+		}
+		if closeErr := readTestClose(t, conn); closeErr.Code != websocket.CloseGoingAway {
+			t.Errorf("close code = %d, want %d", closeErr.Code, websocket.CloseGoingAway)
+		}
+	}
+}
+
+func TestShutdownTimeoutFromEnvironment(t *testing.T) {
+	if cfg := loadConfig(); cfg.ShutdownTimeout != 30*time.Second {
+		t.Errorf("default shutdown timeout = %v, want 30s", cfg.ShutdownTimeout)
+	}
+	t.Setenv("SHUTDOWN_TIMEOUT", "10s")
+	cfg := loadConfig()
+	if cfg.ShutdownTimeout != 10*time.Second {
+		t.Errorf("shutdown timeout = %v, want 10s", cfg.ShutdownTimeout)
+	}
+	cfg.ShutdownTimeout = 0
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT") {
+		t.Errorf("validate() = %v, want SHUTDOWN_TIMEOUT rejected", err)
+	}
+}
+
+func TestDrainFlushesQueuedWork(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	sink := &memorySink{}
+	h.sink = newSinkWriter(sink, 100)
+	h.sink.start()
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	for i := 0; i < 20; i++ {
+		if err := h.ingest.submit(testMetric("pod-a", int64(i)), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+
+	if len(sink.metrics) != 20 {
+		t.Errorf("sink stored %d metrics, want all 20", len(sink.metrics))
+	}
+	for i := 0; i < 20; i++ {
+		if message := readTestMessage(t, conn); message.Type != "query_metrics" {
+			t.Fatalf("message %d = %q, want the queued metric", i, message.Type)
+		}
+	}
+	if closeErr := readTestClose(t, conn); closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("close code = %d, want %d", closeErr.Code, websocket.CloseGoingAway)
+	}
+	if code := postTestMetric(t, h, testMetric("pod-a", 10)); code != http.StatusServiceUnavailable {
+		t.Errorf("status after drain = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestDrainGivesUpAtTimeout(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	sink := blockingSink{stored: make(chan struct{}, 1), release: make(chan struct{})}
+	h.sink = newSinkWriter(sink, 2)
+	h.sink.start()
+	defer close(sink.release)
+	h.sink.enqueue(testMetric("pod-a", 10))
+	<-sink.stored
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := h.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("drain error = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("drain took %v with a stuck sink, want it bounded by the timeout", elapsed)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Bounds on a simulation run, so a typo cannot flood a shared dashboard.
+const (
+	maxSimulationRate     = 1000
+	maxSimulationDuration = time.Hour
+	maxSimulationPods     = 50
+)
+
+// simulatedQueries are the statements a simulated pod runs, modelled on the
+// University Registration demo.
+var simulatedQueries = []struct {
+	sql     string
+	sqlType string
+	tables  []string
+	meanMs  float64
+}{
+	{"SELECT * FROM students WHERE student_id = ?", "SELECT", []string{"students"}, 4},
+	{"SELECT c.* FROM courses c JOIN enrollments e ON c.course_id = e.course_id WHERE e.student_id = ?", "SELECT", []string{"courses", "enrollments"}, 18},
+	{"INSERT INTO enrollments (student_id, course_id, enrolled_at) VALUES (?, ?, ?)", "INSERT", []string{"enrollments"}, 9},
+	{"UPDATE courses SET enrolled_count = enrolled_count + ? WHERE course_id = ?", "UPDATE", []string{"courses"}, 12},
+	{"DELETE FROM cart_items WHERE student_id = ? AND course_id = ?", "DELETE", []string{"cart_items"}, 7},
+	{"SELECT COUNT(*) FROM enrollments WHERE course_id = ? GROUP BY semester", "SELECT", []string{"enrollments"}, 35},
+}
+
+// SimulationRequest is the body of POST /api/simulate. Rate is metrics per
+// second; DeadlockRatio is the share of them that are deadlocks.
+type SimulationRequest struct {
+	Rate          int      `json:"rate"`
+	Duration      string   `json:"duration"`
+	Pods          int      `json:"pods"`
+	Namespace     string   `json:"namespace"`
+	DeadlockRatio *float64 `json:"deadlock_ratio"`
+}
+
+// simulationSpec is a validated SimulationRequest.
+type simulationSpec struct {
+	rate          int
+	duration      time.Duration
+	pods          int
+	namespace     string
+	deadlockRatio float64
+}
+
+var errSimulationRunning = errors.New("a simulation is already running")
+
+// parseSimulationRequest applies defaults and bounds to a request.
+func parseSimulationRequest(req SimulationRequest) (simulationSpec, error) {
+	spec := simulationSpec{
+		rate:          req.Rate,
+		duration:      time.Minute,
+		pods:          req.Pods,
+		namespace:     req.Namespace,
+		deadlockRatio: 0.01,
+	}
+	if spec.rate == 0 {
+		spec.rate = 20
+	}
+	if spec.rate < 0 || spec.rate > maxSimulationRate {
+		return spec, fmt.Errorf("rate must be between 1 and %d", maxSimulationRate)
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 || duration > maxSimulationDuration {
+			return spec, fmt.Errorf("duration must be a positive duration up to %s", maxSimulationDuration)
+		}
+		spec.duration = duration
+	}
+	if spec.pods == 0 {
+		spec.pods = 3
+	}
+	if spec.pods < 0 || spec.pods > maxSimulationPods {
+		return spec, fmt.Errorf("pods must be between 1 and %d", maxSimulationPods)
+	}
+	if spec.namespace == "" {
+		spec.namespace = "kubedb-simulation"
+	}
+	if req.DeadlockRatio != nil {
+		spec.deadlockRatio = *req.DeadlockRatio
+	}
+	if spec.deadlockRatio < 0 || spec.deadlockRatio > 1 {
+		return spec, errors.New("deadlock_ratio must be between 0 and 1")
+	}
+	return spec, nil
+}
+
+// simulator feeds synthetic metrics through processMetric so dashboards can
+// be exercised without an agent. At most one run is active at a time.
+type simulator struct {
+	hub     *Hub
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// newSimulator returns nil, which rejects every run, unless enabled.
+func newSimulator(hub *Hub, enabled bool) *simulator {
+	if !enabled {
+		return nil
+	}
+	return &simulator{hub: hub}
+}
+
+// start begins a run in the background.
+func (s *simulator) start(spec simulationSpec) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return errSimulationRunning
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spec.duration)
+	s.cancel, s.stopped = cancel, make(chan struct{})
+	go s.run(ctx, spec, s.stopped)
+	return nil
+}
+
+// stop ends the current run, if any, and waits for it to exit. It reports
+// whether a run was stopped.
+func (s *simulator) stop() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	cancel, stopped := s.cancel, s.stopped
+	s.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	<-stopped
+	return true
+}
+
+func (s *simulator) run(ctx context.Context, spec simulationSpec, stopped chan struct{}) {
+	defer func() {
+		s.mu.Lock()
+		s.cancel()
+		s.cancel, s.stopped = nil, nil
+		s.mu.Unlock()
+		close(stopped)
+	}()
+	slog.Info("simulation started", "rate", spec.rate, "duration", spec.duration.String(), "pods", spec.pods, "namespace", spec.namespace)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ticker := time.NewTicker(time.Second / time.Duration(spec.rate))
+	defer ticker.Stop()
+	generated := 0
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := s.hub.processMetric(simulatedMetric(rng, spec, now)); err != nil {
+				slog.Warn("simulation stopped", "generated", generated, "error", err)
+				return
+			}
+			generated++
+		case <-ctx.Done():
+			slog.Info("simulation finished", "generated", generated)
+			return
+		}
+	}
+}
+
+// simulatedMetric draws one metric: a deadlock with spec.deadlockRatio
+// probability, a completed transaction one time in five and a query
+// execution otherwise.
+func simulatedMetric(rng *rand.Rand, spec simulationSpec, now time.Time) QueryMetrics {
+	metric := QueryMetrics{
+		Timestamp: now.UTC().Format(time.RFC3339),
+		PodName:   fmt.Sprintf("simulated-pod-%d", rng.Intn(spec.pods)+1),
+		Namespace: spec.namespace,
+	}
+	connection := fmt.Sprintf("PgConnection@%x", rng.Uint32())
+
+	switch roll := rng.Float64(); {
+	case roll < spec.deadlockRatio:
+		duration := int64(50 + rng.Intn(500))
+		connections := fmt.Sprintf("%s:PgConnection@%x", connection, rng.Uint32())
+		metric.EventType = "deadlock_detected"
+		metric.Data = &QueryData{
+			QueryID:             fmt.Sprintf("sim-deadlock-%d", now.UnixNano()),
+			ConnectionID:        connection,
+			Status:              "deadlock",
+			DeadlockDuration:    &duration,
+			DeadlockConnections: &connections,
+		}
+	case roll < spec.deadlockRatio+0.2:
+		duration := int64(rng.ExpFloat64() * 200)
+		id := fmt.Sprintf("sim-tx-%d", now.UnixNano())
+		status, outcome := "committed", "commit"
+		if rng.Float64() < 0.1 {
+			status, outcome = "rolled_back", "rollback"
+		}
+		metric.EventType = "transaction_event"
+		metric.Data = &QueryData{
+			QueryID:             id,
+			ConnectionID:        connection,
+			Status:              status,
+			TransactionId:       &id,
+			TransactionDuration: &duration,
+			TransactionOutcome:  outcome,
+		}
+	default:
+		query := simulatedQueries[rng.Intn(len(simulatedQueries))]
+		elapsed := int64(rng.ExpFloat64() * query.meanMs)
+		rows := int64(rng.Intn(20))
+		metric.EventType = "query_execution"
+		metric.Data = &QueryData{
+			QueryID:         fmt.Sprintf("sim-query-%d", now.UnixNano()),
+			SQLPattern:      query.sql,
+			SQLType:         query.sqlType,
+			TableNames:      query.tables,
+			ExecutionTimeMs: &elapsed,
+			RowsAffected:    &rows,
+			ConnectionID:    connection,
+			Status:          "success",
+		}
+		if rng.Float64() < 0.02 {
+			metric.Data.Status = "error"
+			metric.Data.ErrorMessage = "ERROR: canceling statement due to statement timeout"
+		}
+	}
+	return metric
+}
+
+// simulateHandler serves POST /api/simulate, which starts a run, and
+// DELETE /api/simulate, which stops it. Both answer 404 unless
+// ENABLE_SIMULATOR is set.
+func (h *Hub) simulateHandler(w http.ResponseWriter, r *http.Request) {
+	if h.sim == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"stopped": h.sim.stop()})
+		return
+	}
+
+	var req SimulationRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	spec, err := parseSimulationRequest(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.sim.start(spec); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "started",
+		"rate":           spec.rate,
+		"duration":       spec.duration.String(),
+		"pods":           spec.pods,
+		"namespace":      spec.namespace,
+		"deadlock_ratio": spec.deadlockRatio,
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSimulationRequest(t *testing.T) {
+	spec, err := parseSimulationRequest(SimulationRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.rate != 20 || spec.duration != time.Minute || spec.pods != 3 || spec.namespace != "kubedb-simulation" || spec.deadlockRatio != 0.01 {
+		t.Errorf("defaults = %+v, want 20/s for a minute over 3 pods", spec)
+	}
+
+	for _, req := range []SimulationRequest{
+		{Rate: -1},
+		{Rate: maxSimulationRate + 1},
+		{Duration: "forever"},
+		{Duration: "2h"},
+		{Pods: maxSimulationPods + 1},
+		{DeadlockRatio: ptr(1.5)},
+	} {
+		if _, err := parseSimulationRequest(req); err == nil {
+			t.Errorf("request %+v accepted, want it rejected", req)
+		}
+	}
+}
+
+// simulateTestRequest serves a /api/simulate request with the given method
+// and body.
+func simulateTestRequest(h *Hub, method, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.simulateHandler(rec, httptest.NewRequest(method, "/api/simulate", strings.NewReader(body)))
+	return rec
+}
+
+func TestSimulationBroadcastsEventMix(t *testing.T) {
+	cfg := testConfig()
+	cfg.EnableSimulator = true
+	h := startTestHub(t, cfg)
+	h.sim = newSimulator(h, cfg.EnableSimulator)
+	conn := dialTestHub(t, h, "types=query_metrics,transaction_event,deadlock_event,done")
+
+	rec := simulateTestRequest(h, http.MethodPost, `{"rate": 100, "duration": "500ms", "pods": 2, "namespace": "sim", "deadlock_ratio": 0.2}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", rec.Code, rec.Body)
+	}
+	h.sim.mu.Lock()
+	stopped := h.sim.stopped
+	h.sim.mu.Unlock()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("simulation did not end after its duration")
+	}
+	h.publish(newMessage("done", nil))
+
+	counts := make(map[string]int)
+	for {
+		message := readTestMessage(t, conn)
+		if message.Type == "done" {
+			break
+		}
+		counts[message.Type]++
+		if data, ok := message.Data.(map[string]interface{}); ok && message.Type != "deadlock_event" {
+			if pod := data["pod_name"].(string); data["namespace"] != "sim" || (pod != "simulated-pod-1" && pod != "simulated-pod-2") {
+				t.Errorf("%s from %v/%v, want one of the two simulated pods", message.Type, data["namespace"], pod)
+			}
+		}
+	}
+	// About 50 metrics: 20% deadlocks, 20% transactions and the rest queries.
+	if counts["query_metrics"] < 10 || counts["transaction_event"] == 0 || counts["deadlock_event"] == 0 {
+		t.Errorf("broadcast %v, want mostly queries with some transactions and deadlocks", counts)
+	}
+}
+
+func TestSimulationStopsOnRequest(t *testing.T) {
+	cfg := testConfig()
+	cfg.EnableSimulator = true
+	h := startTestHub(t, cfg)
+	h.sim = newSimulator(h, cfg.EnableSimulator)
+
+	if rec := simulateTestRequest(h, http.MethodPost, `{"duration": "1h"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	if rec := simulateTestRequest(h, http.MethodPost, ""); rec.Code != http.StatusConflict {
+		t.Errorf("status of a second run = %d, want 409", rec.Code)
+	}
+	if rec := simulateTestRequest(h, http.MethodDelete, ""); !strings.Contains(rec.Body.String(), `"stopped":true`) {
+		t.Errorf("stop = %s, want the run stopped", rec.Body)
+	}
+	if rec := simulateTestRequest(h, http.MethodDelete, ""); !strings.Contains(rec.Body.String(), `"stopped":false`) {
+		t.Errorf("second stop = %s, want nothing to stop", rec.Body)
+	}
+	if rec := simulateTestRequest(h, http.MethodPost, `{"rate": -5}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status of an invalid run = %d, want 400", rec.Code)
+	}
+}
+
+func TestSimulatorDisabledByDefault(t *testing.T) {
+	h := newHub(testConfig())
+	h.sim = newSimulator(h, testConfig().EnableSimulator)
+	if rec := simulateTestRequest(h, http.MethodPost, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 without ENABLE_SIMULATOR", rec.Code)
+	}
+}
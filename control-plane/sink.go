@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// sinkBatchSize caps how many metrics are handed to a batching sink at once.
+const sinkBatchSize = 100
+
+// MetricSink persists ingested metrics outside the process.
+type MetricSink interface {
+	Store(ctx context.Context, metric QueryMetrics) error
+}
+
+// batchSink is implemented by sinks that can store several metrics more
+// cheaply than one at a time.
+type batchSink interface {
+	StoreBatch(ctx context.Context, metrics []QueryMetrics) error
+}
+
+// sinkPinger is implemented by sinks that can check their backend is
+// reachable.
+type sinkPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// sinkQuerier is implemented by sinks that can read stored metrics back. The
+// records' Seq is the sink's own position for the metric, not the in-memory
+// store's.
+type sinkQuerier interface {
+	QueryRange(ctx context.Context, query HistoryQuery) ([]StoredMetric, error)
+}
+
+// errHistoryUnsupported is returned when the sink cannot be queried.
+var errHistoryUnsupported = errors.New("metric sink does not support queries")
+
+// errSinkCircuitOpen is recorded for metrics short-circuited by the breaker.
+var errSinkCircuitOpen = errors.New("metric sink circuit breaker is open")
+
+// NullSink discards every metric. It is used when no database is configured.
+type NullSink struct{}
+
+func (NullSink) Store(context.Context, QueryMetrics) error { return nil }
+
+// sinkWriter feeds a MetricSink from a bounded queue on its own goroutine so
+// a slow database never holds up ingestion. Metrics arriving while the queue
+// is full are dropped and counted.
+//
+// With a breaker set, failing batches count towards opening it; while it is
+// open batches go to dlq without touching the sink, so a struggling database
+// is not kept busy and the queue cannot back up behind it.
+type sinkWriter struct {
+	sink    MetricSink
+	queue   chan QueryMetrics
+	once    sync.Once
+	done    chan struct{}
+	breaker *circuitBreaker
+	dlq     *deadLetters
+}
+
+func newSinkWriter(sink MetricSink, queueSize int) *sinkWriter {
+	return &sinkWriter{
+		sink:  sink,
+		queue: make(chan QueryMetrics, max(queueSize, 1)),
+		done:  make(chan struct{}),
+	}
+}
+
+func (w *sinkWriter) start() {
+	go w.run()
+}
+
+// enqueue hands a metric to the writer without blocking.
+func (w *sinkWriter) enqueue(metric QueryMetrics) {
+	select {
+	case w.queue <- metric:
+	default:
+		sinkDroppedTotal.Inc()
+	}
+}
+
+func (w *sinkWriter) run() {
+	defer close(w.done)
+	batch := make([]QueryMetrics, 0, sinkBatchSize)
+	for metric := range w.queue {
+		batch = append(batch[:0], metric)
+	fill:
+		for len(batch) < sinkBatchSize {
+			select {
+			case next, ok := <-w.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		w.flush(batch)
+	}
+}
+
+func (w *sinkWriter) flush(batch []QueryMetrics) {
+	if w.breaker == nil {
+		w.store(batch)
+		return
+	}
+	if !w.breaker.allow(time.Now()) {
+		sinkShortCircuitedTotal.Add(float64(len(batch)))
+		w.deadLetter(batch, errSinkCircuitOpen)
+		return
+	}
+	if failed, err := w.store(batch); err != nil {
+		w.breaker.failure(time.Now())
+		w.deadLetter(failed, err)
+		if w.breaker.state(time.Now()) == "open" {
+			slog.Warn("metric sink circuit opened", "error", err)
+		}
+		return
+	}
+	w.breaker.success()
+}
+
+// store persists a batch and returns the metrics that could not be stored
+// along with the last error.
+func (w *sinkWriter) store(batch []QueryMetrics) ([]QueryMetrics, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if batcher, ok := w.sink.(batchSink); ok {
+		if err := batcher.StoreBatch(ctx, batch); err != nil {
+			slog.Error("failed to persist metrics", "count", len(batch), "error", err)
+			return batch, err
+		}
+		return nil, nil
+	}
+	var failed []QueryMetrics
+	var lastErr error
+	for _, metric := range batch {
+		if err := w.sink.Store(ctx, metric); err != nil {
+			slog.Error("failed to persist metric", "event_type", metric.EventType, "pod_name", metric.PodName, "error", err)
+			failed, lastErr = append(failed, metric), err
+		}
+	}
+	return failed, lastErr
+}
+
+func (w *sinkWriter) deadLetter(metrics []QueryMetrics, err error) {
+	for _, metric := range metrics {
+		w.dlq.unpersisted(metric, err)
+	}
+}
+
+// breakerState reports the sink's circuit breaker state, or "" when the
+// sink has none.
+func (w *sinkWriter) breakerState() string {
+	if w.breaker == nil {
+		return ""
+	}
+	return w.breaker.state(time.Now())
+}
+
+// ping checks the sink's backend. Sinks without one are always reachable.
+func (w *sinkWriter) ping(ctx context.Context) error {
+	if pinger, ok := w.sink.(sinkPinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// queryRange reads stored metrics back from sinks that support it.
+func (w *sinkWriter) queryRange(ctx context.Context, query HistoryQuery) ([]StoredMetric, error) {
+	if querier, ok := w.sink.(sinkQuerier); ok {
+		return querier.QueryRange(ctx, query)
+	}
+	return nil, errHistoryUnsupported
+}
+
+// pending counts the metrics waiting to be stored.
+func (w *sinkWriter) pending() int {
+	return len(w.queue)
+}
+
+// stop stops accepting metrics and waits until the queued ones are stored.
+// Callers must not enqueue afterwards.
+func (w *sinkWriter) stop() {
+	w.once.Do(func() { close(w.queue) })
+	<-w.done
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps stored metrics in memory, recording each batch size.
+type memorySink struct {
+	mu      sync.Mutex
+	metrics []QueryMetrics
+	batches []int
+}
+
+func (s *memorySink) Store(ctx context.Context, metric QueryMetrics) error {
+	return s.StoreBatch(ctx, []QueryMetrics{metric})
+}
+
+func (s *memorySink) StoreBatch(ctx context.Context, metrics []QueryMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, metrics...)
+	s.batches = append(s.batches, len(metrics))
+	return nil
+}
+
+// flakySink fails every store while down, counting the attempts.
+type flakySink struct {
+	down  bool
+	calls int
+}
+
+func (s *flakySink) Store(ctx context.Context, metric QueryMetrics) error {
+	s.calls++
+	if s.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// blockingSink never finishes storing until released, and signals stored
+// when a store starts.
+type blockingSink struct {
+	stored  chan struct{}
+	release chan struct{}
+}
+
+func (s blockingSink) Store(ctx context.Context, metric QueryMetrics) error {
+	select {
+	case s.stored <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return nil
+}
+
+func TestSinkStoresEveryMetricInBatches(t *testing.T) {
+	sink := &memorySink{}
+	writer := newSinkWriter(sink, 500)
+	for i := 0; i < 250; i++ {
+		writer.enqueue(testMetric("pod-a", int64(i)))
+	}
+	writer.start()
+	writer.stop()
+
+	if len(sink.metrics) != 250 {
+		t.Fatalf("stored %d metrics, want 250", len(sink.metrics))
+	}
+	for i, metric := range sink.metrics {
+		if *metric.Data.ExecutionTimeMs != int64(i) {
+			t.Fatalf("metric %d stored at position %d", *metric.Data.ExecutionTimeMs, i)
+		}
+	}
+	for _, size := range sink.batches {
+		if size > sinkBatchSize {
+			t.Errorf("batch of %d metrics, want at most %d", size, sinkBatchSize)
+		}
+	}
+}
+
+func TestSlowSinkDoesNotBlockIngestion(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	sink := blockingSink{stored: make(chan struct{}, 1), release: make(chan struct{})}
+	h.sink = newSinkWriter(sink, 2)
+	h.sink.start()
+	defer func() {
+		close(sink.release)
+		h.sink.stop()
+	}()
+	// Get the writer stuck on a first metric.
+	h.sink.enqueue(testMetric("pod-a", 10))
+	<-sink.stored
+	dropped := counterValue(t, sinkDroppedTotal)
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if code := postTestMetric(t, h, testMetric("pod-a", 10)); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("ingestion took %v behind a stuck sink", elapsed)
+	}
+	// Two fit in the queue behind the stuck metric.
+	if got := counterValue(t, sinkDroppedTotal) - dropped; got != 18 {
+		t.Errorf("%v metrics dropped for the full sink queue, want 18", got)
+	}
+}
+
+func TestSinkBreakerDeadLettersWhileOpen(t *testing.T) {
+	sink := &flakySink{down: true}
+	writer := newSinkWriter(sink, 10)
+	writer.breaker = newCircuitBreaker(2, 50*time.Millisecond)
+	writer.dlq = newDeadLetters(10)
+	batch := []QueryMetrics{testMetric("pod-a", 10)}
+
+	if state := writer.breakerState(); state != "closed" {
+		t.Fatalf("state = %q, want closed", state)
+	}
+	writer.flush(batch)
+	writer.flush(batch)
+	if state := writer.breakerState(); state != "open" || sink.calls != 2 {
+		t.Fatalf("after two failures state = %q with %d calls, want open after 2", state, sink.calls)
+	}
+
+	// While open, batches skip the sink and go to the dead-letter buffer.
+	before := counterValue(t, sinkShortCircuitedTotal)
+	writer.flush(batch)
+	if sink.calls != 2 {
+		t.Errorf("sink called %d times with the circuit open, want 2", sink.calls)
+	}
+	if got := counterValue(t, sinkShortCircuitedTotal) - before; got != 1 {
+		t.Errorf("short circuits counted %v times, want 1", got)
+	}
+	letters := writer.dlq.recent(0)
+	if len(letters) != 3 {
+		t.Fatalf("dead letters = %d, want every unstored metric", len(letters))
+	}
+	if got := letters[0]; got.Reason != deadLetterSink || got.Source != "sink" || got.Detail != errSinkCircuitOpen.Error() {
+		t.Errorf("short-circuited dead letter = %+v, want the open circuit recorded", got)
+	}
+	if got := letters[1]; got.Detail != "connection refused" || got.MessageType != "query_execution" {
+		t.Errorf("failed dead letter = %+v, want the sink's error", got)
+	}
+
+	// After the cooldown a failed trial reopens the circuit and a
+	// successful one closes it.
+	time.Sleep(60 * time.Millisecond)
+	if state := writer.breakerState(); state != "half_open" {
+		t.Errorf("state after the cooldown = %q, want half_open", state)
+	}
+	writer.flush(batch)
+	if state := writer.breakerState(); state != "open" || sink.calls != 3 {
+		t.Errorf("after a failed trial state = %q with %d calls, want open after 3", state, sink.calls)
+	}
+	time.Sleep(60 * time.Millisecond)
+	sink.down = false
+	writer.flush(batch)
+	writer.flush(batch)
+	if state := writer.breakerState(); state != "closed" || sink.calls != 5 {
+		t.Errorf("after a good trial state = %q with %d calls, want closed after 5", state, sink.calls)
+	}
+}
+
+func TestReadyzReportsSinkBreaker(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	waitForRunning(t, h)
+	rec := httptest.NewRecorder()
+	h.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/api/readyz", nil))
+	if strings.Contains(rec.Body.String(), "sink_breaker") {
+		t.Errorf("readyz = %s, want no breaker state without a breaker", rec.Body)
+	}
+
+	h.sink.breaker = newCircuitBreaker(1, time.Minute)
+	h.sink.breaker.failure(time.Now())
+	rec = httptest.NewRecorder()
+	h.readyzHandler(rec, httptest.NewRequest(http.MethodGet, "/api/readyz", nil))
+	if !strings.Contains(rec.Body.String(), `"sink_breaker":"open"`) {
+		t.Errorf("readyz = %s, want the open breaker reported", rec.Body)
+	}
+}
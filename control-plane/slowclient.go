@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// What the hub does when a client's send queue is full.
+const (
+	// slowClientDisconnect closes the client with closeReasonSlow.
+	slowClientDisconnect = "disconnect"
+	// slowClientDropOldest discards the oldest queued message to make room,
+	// trading completeness for staying connected.
+	slowClientDropOldest = "drop_oldest"
+)
+
+func slowClientPolicyFromEnv() string {
+	value := strings.ToLower(getEnv("WS_SLOW_CLIENT_POLICY", slowClientDisconnect))
+	switch value {
+	case slowClientDisconnect, slowClientDropOldest:
+		return value
+	}
+	slog.Warn("invalid environment value, using default", "key", "WS_SLOW_CLIENT_POLICY", "value", value, "default", slowClientDisconnect)
+	return slowClientDisconnect
+}
+
+// deliver queues a broadcast message for a client, applying the slow client
+// policy when its queue is full. It runs on the hub goroutine, the only
+// sender on client.send, so after taking one message out there is always room.
+func (h *Hub) deliver(client *Client, message WebSocketMessage) {
+	message.queuedAt = time.Now()
+	select {
+	case client.send <- message:
+		return
+	default:
+	}
+
+	if h.cfg.SlowClientPolicy == slowClientDropOldest {
+		select {
+		case oldest := <-client.send:
+			h.dlq.add(DeadLetter{Reason: deadLetterSlowClient, Detail: slowClientDropOldest,
+				Source: client.remoteAddr, MessageType: oldest.Type, At: time.Now()})
+		default:
+		}
+		client.send <- message
+		client.dropped++
+		slowClientDroppedMessagesTotal.Inc()
+		if client.dropped == 1 {
+			slog.Warn("client send queue full, dropping oldest messages",
+				"policy", slowClientDropOldest, "remote_addr", client.remoteAddr)
+		}
+		return
+	}
+
+	slog.Warn("client send queue full, disconnecting",
+		"policy", slowClientDisconnect, "remote_addr", client.remoteAddr)
+	h.dlq.add(DeadLetter{Reason: deadLetterSlowClient, Detail: slowClientDisconnect,
+		Source: client.remoteAddr, MessageType: message.Type, At: time.Now()})
+	client.closeReason = closeReasonSlow
+	close(client.send)
+	delete(h.clients, client)
+	h.clientsChanged()
+	broadcastDroppedTotal.Inc()
+}
+
+// expired reports whether a queued broadcast has outlived WS_MESSAGE_TTL, in
+// which case writePump skips it: a client that stalled and recovered wants
+// the live view, not a burst of old updates. A run of skipped messages is
+// logged when the next fresh one goes out.
+func (c *Client) expired(message WebSocketMessage, now time.Time) bool {
+	ttl := c.hub.cfg.WSMessageTTL
+	if ttl > 0 && !message.queuedAt.IsZero() && now.Sub(message.queuedAt) > ttl {
+		c.stale++
+		c.staleRun++
+		staleMessagesDroppedTotal.Inc()
+		return true
+	}
+	if c.staleRun > 0 {
+		slog.Warn("skipped stale messages", "remote_addr", c.remoteAddr,
+			"skipped", c.staleRun, "total_skipped", c.stale, "ttl", ttl.String())
+		c.staleRun = 0
+	}
+	return false
+}
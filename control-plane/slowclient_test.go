@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// stalledTestClient registers a client with no writePump draining its send
+// queue of size buffer.
+func stalledTestClient(h *Hub, buffer int) *Client {
+	client := &Client{hub: h, send: make(chan WebSocketMessage, buffer), remoteAddr: "192.0.2.1:1234"}
+	h.clients[client] = true
+	return client
+}
+
+func TestSlowClientPolicies(t *testing.T) {
+	tests := []struct {
+		policy     string
+		registered bool
+		queued     []string
+	}{
+		{slowClientDisconnect, false, []string{"m0", "m1", "m2"}},
+		{slowClientDropOldest, true, []string{"m2", "m3", "m4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.SlowClientPolicy = tt.policy
+			h := newHub(cfg)
+			client := stalledTestClient(h, 3)
+
+			for i := 0; i < 5; i++ {
+				if !h.clients[client] {
+					break
+				}
+				h.deliver(client, newMessage(fmt.Sprintf("m%d", i), nil))
+			}
+
+			if h.clients[client] != tt.registered {
+				t.Errorf("registered = %v, want %v", h.clients[client], tt.registered)
+			}
+			var queued []string
+			for len(client.send) > 0 {
+				queued = append(queued, (<-client.send).Type)
+			}
+			if fmt.Sprint(queued) != fmt.Sprint(tt.queued) {
+				t.Errorf("queued = %v, want %v", queued, tt.queued)
+			}
+			letters := h.dlq.recent(10)
+			if len(letters) == 0 || letters[0].Reason != deadLetterSlowClient || letters[0].Detail != tt.policy {
+				t.Errorf("dead letters = %+v, want a %s entry for the %s policy", letters, deadLetterSlowClient, tt.policy)
+			}
+		})
+	}
+}
+
+func TestDropOldestCountsDrops(t *testing.T) {
+	cfg := testConfig()
+	cfg.SlowClientPolicy = slowClientDropOldest
+	h := newHub(cfg)
+	client := stalledTestClient(h, 1)
+	before := counterValue(t, slowClientDroppedMessagesTotal)
+
+	for i := 0; i < 4; i++ {
+		h.deliver(client, newMessage("test", nil))
+	}
+	if client.dropped != 3 {
+		t.Errorf("client dropped %d messages, want 3", client.dropped)
+	}
+	if got := counterValue(t, slowClientDroppedMessagesTotal) - before; got != 3 {
+		t.Errorf("drops counted %v times, want 3", got)
+	}
+}
+
+// pausedTestClient connects a client whose writePump is running but stalled
+// waiting for its replay, and returns it with the dashboard's end of the
+// connection. Sending on replay resumes it.
+func pausedTestClient(t *testing.T, h *Hub) (*Client, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := &Client{
+		hub:        h,
+		conn:       <-accepted,
+		send:       make(chan WebSocketMessage, 16),
+		replay:     make(chan []WebSocketMessage, 1),
+		remoteAddr: "192.0.2.1:1234",
+	}
+	h.writers.Add(1)
+	go client.writePump()
+	return client, conn
+}
+
+func TestStaleMessagesAreSkipped(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSMessageTTL = 50 * time.Millisecond
+	h := newHub(cfg)
+	client, conn := pausedTestClient(t, h)
+	before := counterValue(t, staleMessagesDroppedTotal)
+
+	for i := 0; i < 3; i++ {
+		h.deliver(client, newMessage("stale", nil))
+	}
+	time.Sleep(2 * cfg.WSMessageTTL)
+	h.deliver(client, newMessage("fresh", map[string]interface{}{"n": 0}))
+	h.deliver(client, newMessage("fresh", map[string]interface{}{"n": 1}))
+	client.replay <- nil
+
+	for i := 0; i < 2; i++ {
+		message := readTestMessage(t, conn)
+		if message.Type != "fresh" || message.Data.(map[string]interface{})["n"] != float64(i) {
+			t.Fatalf("message %d = %s %v, want fresh %d", i, message.Type, message.Data, i)
+		}
+	}
+	close(client.send)
+	readTestClose(t, conn)
+	h.writers.Wait()
+
+	if client.stale != 3 || client.staleRun != 0 {
+		t.Errorf("stale = %d, run = %d, want 3 skipped and the run logged", client.stale, client.staleRun)
+	}
+	if got := counterValue(t, staleMessagesDroppedTotal) - before; got != 3 {
+		t.Errorf("stale drops counted %v times, want 3", got)
+	}
+}
+
+func TestMessagesWithoutQueueTimeNeverExpire(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSMessageTTL = time.Second
+	client := &Client{hub: newHub(cfg)}
+	now := time.Now()
+
+	old := newMessage("old", nil)
+	old.queuedAt = now.Add(-2 * time.Second)
+	if !client.expired(old, now) {
+		t.Error("message queued 2s ago did not expire with a 1s TTL")
+	}
+	if reply := newMessage("pong", nil); client.expired(reply, now) {
+		t.Error("direct reply with no queue time expired")
+	}
+
+	client.hub.cfg.WSMessageTTL = 0
+	if client.expired(old, now) {
+		t.Error("message expired with the TTL disabled")
+	}
+	if defaults := loadConfig(); defaults.WSMessageTTL != 10*time.Second {
+		t.Errorf("default TTL = %v, want 10s", defaults.WSMessageTTL)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SlowQuery is a single query_execution occurrence, kept with its full
+// context so outliers can be traced back to a request.
+type SlowQuery struct {
+	QueryID         string    `json:"query_id"`
+	SQLPattern      string    `json:"sql_pattern,omitempty"`
+	SQLType         string    `json:"sql_type,omitempty"`
+	ExecutionTimeMs int64     `json:"execution_time_ms"`
+	PodName         string    `json:"pod_name,omitempty"`
+	Namespace       string    `json:"namespace,omitempty"`
+	RequestID       string    `json:"request_id,omitempty"`
+	UserID          string    `json:"user_id,omitempty"`
+	APIEndpoint     string    `json:"api_endpoint,omitempty"`
+	Timestamp       string    `json:"timestamp"`
+	ReceivedAt      time.Time `json:"received_at"`
+}
+
+// slowQueryHeap is a min-heap on execution time, so the root is always the
+// fastest of the retained queries and the first to be evicted.
+type slowQueryHeap []SlowQuery
+
+func (h slowQueryHeap) Len() int            { return len(h) }
+func (h slowQueryHeap) Less(i, j int) bool  { return h[i].ExecutionTimeMs < h[j].ExecutionTimeMs }
+func (h slowQueryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *slowQueryHeap) Push(x interface{}) { *h = append(*h, x.(SlowQuery)) }
+func (h *slowQueryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// slowestQueries retains the top-N slowest individual executions seen within
+// the retention window.
+type slowestQueries struct {
+	mu        sync.Mutex
+	capacity  int
+	retention time.Duration
+	queries   slowQueryHeap
+}
+
+func newSlowestQueries(capacity int, retention time.Duration) *slowestQueries {
+	return &slowestQueries{
+		capacity:  capacity,
+		retention: retention,
+		queries:   make(slowQueryHeap, 0, capacity),
+	}
+}
+
+// newSlowQuery flattens a query_execution metric that carries an execution
+// time.
+func newSlowQuery(metric QueryMetrics, receivedAt time.Time) SlowQuery {
+	query := SlowQuery{
+		QueryID:         metric.Data.QueryID,
+		SQLPattern:      metric.Data.SQLPattern,
+		SQLType:         metric.Data.SQLType,
+		ExecutionTimeMs: *metric.Data.ExecutionTimeMs,
+		PodName:         metric.PodName,
+		Namespace:       metric.Namespace,
+		Timestamp:       metric.Timestamp,
+		ReceivedAt:      receivedAt,
+	}
+	if metric.Context != nil {
+		query.RequestID = metric.Context.RequestID
+		query.UserID = metric.Context.UserID
+		query.APIEndpoint = metric.Context.APIEndpoint
+	}
+	return query
+}
+
+// record offers a query_execution metric to the heap.
+func (s *slowestQueries) record(metric QueryMetrics, now time.Time) {
+	if metric.Data == nil || metric.Data.ExecutionTimeMs == nil || s.capacity <= 0 {
+		return
+	}
+	query := newSlowQuery(metric, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+
+	if len(s.queries) < s.capacity {
+		heap.Push(&s.queries, query)
+		return
+	}
+	if query.ExecutionTimeMs > s.queries[0].ExecutionTimeMs {
+		s.queries[0] = query
+		heap.Fix(&s.queries, 0)
+	}
+}
+
+// expire drops queries older than the retention window. Callers hold s.mu.
+func (s *slowestQueries) expire(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.retention)
+	kept := s.queries[:0]
+	for _, query := range s.queries {
+		if query.ReceivedAt.After(cutoff) {
+			kept = append(kept, query)
+		}
+	}
+	if len(kept) != len(s.queries) {
+		s.queries = kept
+		heap.Init(&s.queries)
+	}
+}
+
+// top returns up to limit retained queries, slowest first.
+func (s *slowestQueries) top(limit int, now time.Time) []SlowQuery {
+	s.mu.Lock()
+	s.expire(now)
+	result := make([]SlowQuery, len(s.queries))
+	copy(result, s.queries)
+	s.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExecutionTimeMs > result[j].ExecutionTimeMs
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// slowestHandler serves GET /api/slowest?limit=20.
+func (h *Hub) slowestHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	queries := h.slowest.top(limit, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queries": queries,
+		"count":   len(queries),
+	})
+}
+
+// slowQueriesHandler serves GET /api/slow-queries?threshold_ms=1000&limit=20.
+// Unlike /api/slowest it lists every retained recent query over the
+// threshold rather than the all-time slowest, slowest first.
+func (h *Hub) slowQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	threshold := int64(1000)
+	if value := query.Get("threshold_ms"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid threshold_ms", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	queries := make([]SlowQuery, 0)
+	for _, record := range h.recent.query(metricFilter{EventType: "query_execution"}) {
+		data := record.Metric.Data
+		if data != nil && data.ExecutionTimeMs != nil && *data.ExecutionTimeMs > threshold {
+			queries = append(queries, newSlowQuery(record.Metric, record.ReceivedAt))
+		}
+	}
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].ExecutionTimeMs > queries[j].ExecutionTimeMs
+	})
+	if len(queries) > limit {
+		queries = queries[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queries":      queries,
+		"count":        len(queries),
+		"threshold_ms": threshold,
+	})
+}
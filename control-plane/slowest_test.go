@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSlowestQueriesKeepsTopN(t *testing.T) {
+	slowest := newSlowestQueries(3, time.Hour)
+	now := time.Now()
+	for _, ms := range []int64{40, 10, 90, 20, 70, 50} {
+		slowest.record(testMetric("pod-a", ms), now)
+	}
+
+	top := slowest.top(0, now)
+	want := []int64{90, 70, 50}
+	if len(top) != len(want) {
+		t.Fatalf("got %d queries, want %d", len(top), len(want))
+	}
+	for i, query := range top {
+		if query.ExecutionTimeMs != want[i] {
+			t.Errorf("top[%d] = %dms, want %dms", i, query.ExecutionTimeMs, want[i])
+		}
+	}
+	if got := slowest.top(1, now); len(got) != 1 || got[0].ExecutionTimeMs != 90 {
+		t.Errorf("top(1) = %+v, want the 90ms query", got)
+	}
+
+	// A query faster than every retained one is not kept.
+	slowest.record(testMetric("pod-a", 5), now)
+	if got := slowest.top(0, now); got[len(got)-1].ExecutionTimeMs != 50 {
+		t.Errorf("fastest retained = %dms, want 50ms", got[len(got)-1].ExecutionTimeMs)
+	}
+}
+
+func TestSlowestQueriesExpire(t *testing.T) {
+	slowest := newSlowestQueries(3, time.Minute)
+	start := time.Now()
+	slowest.record(testMetric("pod-a", 900), start)
+	slowest.record(testMetric("pod-a", 30), start.Add(30*time.Second))
+
+	// The 900ms query has left the window, which frees its slot for a
+	// faster query.
+	later := start.Add(61 * time.Second)
+	slowest.record(testMetric("pod-a", 10), later)
+	top := slowest.top(0, later)
+	if len(top) != 2 || top[0].ExecutionTimeMs != 30 || top[1].ExecutionTimeMs != 10 {
+		t.Errorf("top after expiry = %+v, want 30ms and 10ms", top)
+	}
+}
+
+func TestSlowestHandlerRejectsInvalidLimit(t *testing.T) {
+	h := newHub(testConfig())
+	for _, limit := range []string{"0", "-1", "many"} {
+		rec := httptest.NewRecorder()
+		h.slowestHandler(rec, httptest.NewRequest(http.MethodGet, "/api/slowest?limit="+limit, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: status = %d, want %d", limit, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSlowQueriesFiltersAndOrders(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	for i, ms := range []int64{50, 1500, 900, 3000, 1001, 2000} {
+		metric := testMetric("pod-a", ms)
+		metric.Data.QueryID = fmt.Sprintf("q-%d", i)
+		postTestMetric(t, h, metric)
+	}
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{3000, 2000, 1500, 1001}},
+		{"?threshold_ms=1500", []int64{3000, 2000}},
+		{"?threshold_ms=0&limit=2", []int64{3000, 2000}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.slowQueriesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/slow-queries"+tt.query, nil))
+		var body struct {
+			Queries []SlowQuery `json:"queries"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		var got []int64
+		for _, query := range body.Queries {
+			got = append(got, query.ExecutionTimeMs)
+			if query.PodName != "pod-a" || query.QueryID == "" || query.SQLPattern == "" {
+				t.Errorf("%q: query %+v lacks its context", tt.query, query)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: execution times = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.slowQueriesHandler(rec, httptest.NewRequest(http.MethodGet, "/api/slow-queries?threshold_ms=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("negative threshold: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// snapshotSlowQueries and snapshotDeadlocks bound the lists in /api/snapshot.
+const (
+	snapshotSlowQueries = 10
+	snapshotDeadlocks   = 10
+)
+
+// PodPool is a pod's latest reported connection pool usage.
+type PodPool struct {
+	UsageRatio float64 `json:"usage_ratio"`
+	Active     *int    `json:"active,omitempty"`
+	Idle       *int    `json:"idle,omitempty"`
+	Max        *int    `json:"max,omitempty"`
+}
+
+// Snapshot is the derived state a dashboard needs to render without
+// replaying the stream.
+type Snapshot struct {
+	Pods        []PodInfo                `json:"pods"`
+	TPS         map[string]PodTPS        `json:"tps"`
+	SlowQueries []SlowQuery              `json:"slow_queries"`
+	Deadlocks   []map[string]interface{} `json:"deadlocks"`
+	Pools       map[string]PodPool       `json:"connection_pools"`
+	Timestamp   time.Time                `json:"timestamp"`
+}
+
+// snapshot reads every aggregation while holding the state lock, so no
+// metric is reflected in some sections and not yet in others.
+func (h *Hub) snapshot(now time.Time) Snapshot {
+	h.state.Lock()
+	defer h.state.Unlock()
+
+	pods := h.pods.active()
+	pools := make(map[string]PodPool)
+	for _, pod := range pods {
+		metrics, ok := h.system.latest(pod.PodName)
+		if !ok || metrics == nil || metrics.ConnectionPoolUsageRatio == nil {
+			continue
+		}
+		pools[pod.PodName] = PodPool{
+			UsageRatio: *metrics.ConnectionPoolUsageRatio,
+			Active:     metrics.ConnectionPoolActive,
+			Idle:       metrics.ConnectionPoolIdle,
+			Max:        metrics.ConnectionPoolMax,
+		}
+	}
+
+	return Snapshot{
+		Pods:        pods,
+		TPS:         h.tps.rates(now),
+		SlowQueries: h.slowest.top(snapshotSlowQueries, now),
+		Deadlocks:   h.deadlocks.recent(snapshotDeadlocks),
+		Pools:       pools,
+		Timestamp:   now,
+	}
+}
+
+// snapshotHandler serves GET /api/snapshot.
+func (h *Hub) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.snapshot(time.Now()))
+}
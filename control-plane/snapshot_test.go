@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshotIncludesEachAggregation(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	for _, ms := range []int64{30, 900, 120} {
+		postTestMetric(t, h, testMetric("pod-a", ms))
+	}
+	system := testMetric("pod-b", 10)
+	system.EventType = "system_metrics"
+	system.Data = nil
+	system.Metrics = &SystemMetrics{
+		ConnectionPoolActive:     ptr(8),
+		ConnectionPoolIdle:       ptr(2),
+		ConnectionPoolMax:        ptr(10),
+		ConnectionPoolUsageRatio: ptr(0.8),
+	}
+	postTestMetric(t, h, system)
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+
+	// A second later, so the metrics' second counts towards the rates.
+	snapshot := h.snapshot(time.Now().Add(time.Second))
+
+	if len(snapshot.Pods) != 2 || snapshot.Pods[0].PodName != "pod-a" || snapshot.Pods[0].MetricCount != 4 {
+		t.Errorf("pods = %+v, want pod-a with 4 metrics and pod-b", snapshot.Pods)
+	}
+	if rate := snapshot.TPS["pod-a"]; rate.TPS15s != 3.0/tpsWindowSeconds {
+		t.Errorf("pod-a tps = %+v, want 3 queries over the window", rate)
+	}
+	if len(snapshot.SlowQueries) != 3 || snapshot.SlowQueries[0].ExecutionTimeMs != 900 {
+		t.Errorf("slow queries = %+v, want 3 led by the 900ms one", snapshot.SlowQueries)
+	}
+	if len(snapshot.Deadlocks) != 1 || snapshot.Deadlocks[0]["pod_name"] != "pod-a" {
+		t.Errorf("deadlocks = %v, want pod-a's deadlock", snapshot.Deadlocks)
+	}
+	pool, ok := snapshot.Pools["pod-b"]
+	if len(snapshot.Pools) != 1 || !ok || pool.UsageRatio != 0.8 || *pool.Active != 8 || *pool.Max != 10 {
+		t.Errorf("pools = %+v, want pod-b at 0.8 with 8 of 10 active", snapshot.Pools)
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	h := newHub(testConfig())
+	rec := httptest.NewRecorder()
+	h.snapshotHandler(rec, httptest.NewRequest(http.MethodGet, "/api/snapshot", nil))
+
+	var body map[string]json.RawMessage
+	json.NewDecoder(rec.Body).Decode(&body)
+	for _, section := range []string{"pods", "tps", "slow_queries", "deadlocks", "connection_pools", "timestamp"} {
+		if _, ok := body[section]; !ok {
+			t.Errorf("snapshot lacks %s", section)
+		}
+	}
+}
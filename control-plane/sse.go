@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// sseKeepalive is how often an idle event stream gets a comment line so
+// proxies do not time it out.
+const sseKeepalive = 15 * time.Second
+
+// streamHandler serves GET /api/stream, the broadcast stream as server-sent
+// events for networks that block WebSocket upgrades. It registers a client
+// without a connection and writes what the hub queues on its send channel as
+// data: lines. ?types= and ?namespace= filter like they do on /ws.
+func (h *Hub) streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// The server's WriteTimeout would otherwise end the stream.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	claims, ok := h.authorizeStream(w, r)
+	if !ok {
+		return
+	}
+
+	client := &Client{
+		hub:           h,
+		send:          make(chan WebSocketMessage, h.cfg.ClientBuffer),
+		replay:        make(chan []WebSocketMessage, 1),
+		subscriptions: parseSubscriptions(r.URL.Query().Get("types")),
+		namespace:     r.URL.Query().Get("namespace"),
+		version:       messageVersion,
+		remoteAddr:    r.RemoteAddr,
+	}
+	client.applyClaims(claims)
+	select {
+	case h.register <- client:
+	case <-h.done:
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer func() {
+		select {
+		case h.unregister <- client:
+		case <-h.done:
+		}
+		h.writers.Done()
+	}()
+	slog.Debug("sse client connected", "remote_addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, message := range <-client.replay {
+		if writeEvent(w, message) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case message, ok := <-client.send:
+			if !ok {
+				// Mirror the WebSocket close frame: tell the client why and
+				// how long to wait before reconnecting.
+				if client.closeReason != "" {
+					fmt.Fprintf(w, "retry: %d\n", h.cfg.ReconnectBackoff[client.closeReason].Milliseconds())
+					fmt.Fprintf(w, "event: close\ndata: {\"reason\":%q}\n\n", client.closeReason)
+					flusher.Flush()
+				}
+				return
+			}
+			if writeEvent(w, message) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, message WebSocketMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("failed to encode outbound message", "message_type", message.Type, "error", err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// openTestStream connects to the hub's /api/stream with query and returns a
+// reader over the event stream and a function that disconnects.
+func openTestStream(t *testing.T, h *Hub, query string) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(h.streamHandler))
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream?"+query, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("response = %d %s, want 200 text/event-stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body), cancel
+}
+
+// readTestEvent reads the next data: line of an event stream.
+func readTestEvent(t *testing.T, stream *bufio.Reader) WebSocketMessage {
+	t.Helper()
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := stream.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				lines <- strings.TrimPrefix(line, "data: ")
+				return
+			}
+		}
+	}()
+	select {
+	case line, ok := <-lines:
+		if !ok {
+			t.Fatal("event stream ended")
+		}
+		var message WebSocketMessage
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			t.Fatalf("decode event %s: %v", line, err)
+		}
+		return message
+	case <-time.After(testReadTimeout):
+		t.Fatal("timed out waiting for an event")
+	}
+	return WebSocketMessage{}
+}
+
+func TestStreamDeliversBroadcasts(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	stream, _ := openTestStream(t, h, "types=query_metrics")
+	if connected := readTestEvent(t, stream); connected.Type != "connected" {
+		t.Fatalf("first event = %s, want connected", connected.Type)
+	}
+
+	h.publish(newMessage("deadlock_event", nil))
+	postTestMetric(t, h, testMetric("pod-a", 10))
+
+	message := readTestEvent(t, stream)
+	if message.Type != "query_metrics" || message.Data.(map[string]interface{})["pod_name"] != "pod-a" {
+		t.Errorf("event = %s %v, want query_metrics from pod-a only", message.Type, message.Data)
+	}
+}
+
+func TestStreamUnregistersOnDisconnect(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	_, disconnect := openTestStream(t, h, "")
+	waitForClientCount(t, h, 1)
+
+	disconnect()
+	waitForClientCount(t, h, 0)
+}
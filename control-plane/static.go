@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// spaHandler serves the dashboard from dir. Paths naming a file are served
+// as is; any other path gets index.html, so the dashboard's client-side
+// routes survive a reload. Missing assets (paths with an extension) and
+// unknown API or stream paths still answer 404 instead of the page.
+func spaHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if isServerPath(name) {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		// The page must not be cached under a route's URL, or a new
+		// dashboard release would not be picked up there.
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, r, filepath.Join(dir, "index.html"))
+	})
+}
+
+// isServerPath reports whether a path belongs to the API, the streams or
+// the Prometheus endpoint rather than the dashboard.
+func isServerPath(name string) bool {
+	for _, prefix := range []string{"/api", "/ws", "/metrics"} {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
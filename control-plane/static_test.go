@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSPAHandler(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":   "<html>dashboard</html>",
+		"app.js":       "console.log('app')",
+		"assets/a.css": "body {}",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := spaHandler(dir)
+
+	tests := []struct {
+		path    string
+		status  int
+		body    string
+		noCache bool
+	}{
+		{"/", http.StatusOK, "<html>dashboard</html>", false},
+		{"/app.js", http.StatusOK, "console.log('app')", false},
+		{"/assets/a.css", http.StatusOK, "body {}", false},
+		// Client-side routes get the page, uncached.
+		{"/pods/pod-a", http.StatusOK, "<html>dashboard</html>", true},
+		{"/apiary", http.StatusOK, "<html>dashboard</html>", true},
+		// Missing assets and server paths do not.
+		{"/missing.js", http.StatusNotFound, "", false},
+		{"/api/unknown", http.StatusNotFound, "", false},
+		{"/api", http.StatusNotFound, "", false},
+		{"/ws/other", http.StatusNotFound, "", false},
+		{"/metrics/extra", http.StatusNotFound, "", false},
+		// Paths climbing out of the directory are refused.
+		{"/../../etc/passwd", http.StatusBadRequest, "", true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = tt.path
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: body = %q, want %q", tt.path, rec.Body, tt.body)
+		}
+		if noCache := rec.Header().Get("Cache-Control") == "no-cache"; noCache != tt.noCache {
+			t.Errorf("%s: Cache-Control = %q, want no-cache %v", tt.path, rec.Header().Get("Cache-Control"), tt.noCache)
+		}
+	}
+}
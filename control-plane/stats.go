@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reasons a WebSocket upgrade on /ws can be refused.
+const (
+	upgradeFailureOrigin       = "origin"
+	upgradeFailureAuth         = "auth"
+	upgradeFailureClientLimit  = "client_limit"
+	upgradeFailureBadHandshake = "bad_handshake"
+)
+
+// serverStats aggregates operational counters exposed on /api/stats.
+type serverStats struct {
+	mu              sync.Mutex
+	upgradeFailures map[string]uint64
+}
+
+var stats = newServerStats()
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		upgradeFailures: map[string]uint64{
+			upgradeFailureOrigin:       0,
+			upgradeFailureAuth:         0,
+			upgradeFailureClientLimit:  0,
+			upgradeFailureBadHandshake: 0,
+		},
+	}
+}
+
+func (s *serverStats) recordUpgradeFailure(reason string) {
+	s.mu.Lock()
+	s.upgradeFailures[reason]++
+	s.mu.Unlock()
+	websocketUpgradeFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+func (s *serverStats) upgradeFailureCounts() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]uint64, len(s.upgradeFailures))
+	for reason, count := range s.upgradeFailures {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// upgradeError replaces the upgrader's default error response so that every
+// rejected handshake is counted by reason.
+func upgradeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	category := upgradeFailureBadHandshake
+	if status == http.StatusForbidden {
+		category = upgradeFailureOrigin
+	}
+	stats.recordUpgradeFailure(category)
+
+	w.Header().Set("Sec-Websocket-Version", "13")
+	http.Error(w, http.StatusText(status), status)
+}
+
+func (h *Hub) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"websocket_clients":          h.clientCount(),
+		"websocket_upgrade_failures": stats.upgradeFailureCounts(),
+		"fingerprint_cache":          h.patterns.stats(),
+		"timestamp":                  time.Now().Format(time.RFC3339),
+	})
+}
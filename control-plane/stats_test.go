@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpgradeFailuresAreCountedByReason(t *testing.T) {
+	cfg := testConfig()
+	cfg.AllowedWSOrigins = parseOriginAllowlist("https://dashboard.example.com")
+	h := startTestHub(t, cfg)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		reason string
+	}{
+		{"plain GET", nil, http.StatusBadRequest, upgradeFailureBadHandshake},
+		{"foreign origin", http.Header{"Origin": {"https://evil.example.com"}}, http.StatusForbidden, upgradeFailureOrigin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := stats.upgradeFailureCounts()[tt.reason]
+			beforeMetric := counterValue(t, websocketUpgradeFailuresTotal.WithLabelValues(tt.reason))
+
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			h.handleWebSocket(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := stats.upgradeFailureCounts()[tt.reason]; got != before+1 {
+				t.Errorf("%s failures = %d, want %d", tt.reason, got, before+1)
+			}
+			if got := counterValue(t, websocketUpgradeFailuresTotal.WithLabelValues(tt.reason)); got != beforeMetric+1 {
+				t.Errorf("%s metric = %v, want %v", tt.reason, got, beforeMetric+1)
+			}
+		})
+	}
+}
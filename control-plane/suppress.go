@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// suppressList holds the normalized SQL patterns whose query executions are
+// not broadcast, such as connection pool health checks (SELECT 1) that
+// would otherwise flood the stream. Suppressed executions are still counted
+// by every aggregation, TPS included.
+type suppressList struct {
+	mu       sync.RWMutex
+	patterns map[string]bool
+}
+
+// parseSuppressPatterns splits SUPPRESS_PATTERNS, a semicolon-separated list
+// of SQL statements; commas cannot separate them as SQL contains commas.
+func parseSuppressPatterns(raw string) []string {
+	var patterns []string
+	for _, sql := range strings.Split(raw, ";") {
+		if sql = strings.TrimSpace(sql); sql != "" {
+			patterns = append(patterns, sql)
+		}
+	}
+	return patterns
+}
+
+func newSuppressList(patterns []string) *suppressList {
+	l := &suppressList{}
+	l.set(patterns)
+	return l
+}
+
+// set replaces the list. Statements are normalized, so literals in them
+// match any value.
+func (l *suppressList) set(patterns []string) {
+	normalized := make(map[string]bool, len(patterns))
+	for _, sql := range patterns {
+		if pattern := normalizeSQLPattern(sql); pattern != "" {
+			normalized[pattern] = true
+		}
+	}
+	l.mu.Lock()
+	l.patterns = normalized
+	l.mu.Unlock()
+}
+
+// contains reports whether a normalized pattern is suppressed.
+func (l *suppressList) contains(pattern string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.patterns[pattern]
+}
+
+// list returns the suppressed patterns in order.
+func (l *suppressList) list() []string {
+	l.mu.RLock()
+	patterns := make([]string, 0, len(l.patterns))
+	for pattern := range l.patterns {
+		patterns = append(patterns, pattern)
+	}
+	l.mu.RUnlock()
+	sort.Strings(patterns)
+	return patterns
+}
+
+// suppressed reports whether a query_execution is left out of the broadcast
+// because its SQL pattern is on the suppress list.
+func (h *Hub) suppressed(metric QueryMetrics) bool {
+	if metric.Data == nil || metric.Data.SQLPattern == "" || !h.suppress.contains(h.patterns.get(metric.Data.SQLPattern).pattern) {
+		return false
+	}
+	querySuppressedTotal.Inc()
+	return true
+}
+
+// suppressHandler serves POST /api/config/suppress, which replaces the
+// suppress list with {"patterns":["SELECT 1", ...]} and answers with the
+// normalized patterns now in effect. An empty list suppresses nothing.
+func (h *Hub) suppressHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Patterns []string `json:"patterns"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	h.suppress.set(body.Patterns)
+	patterns := h.suppress.list()
+	slog.Info("suppress list replaced", "remote_addr", r.RemoteAddr, "pattern_count", len(patterns))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"patterns": patterns,
+		"count":    len(patterns),
+	})
+}
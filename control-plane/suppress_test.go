@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSuppressPatterns(t *testing.T) {
+	got := parseSuppressPatterns(" SELECT 1; ;SELECT a, b FROM health WHERE id = 7 ")
+	if fmt.Sprint(got) != "[SELECT 1 SELECT a, b FROM health WHERE id = 7]" {
+		t.Errorf("parseSuppressPatterns = %q, want the two statements with their commas", got)
+	}
+	if got := parseSuppressPatterns(""); len(got) != 0 {
+		t.Errorf("parseSuppressPatterns(\"\") = %q, want none", got)
+	}
+}
+
+// postTestSuppress replaces the hub's suppress list and returns the patterns
+// now in effect.
+func postTestSuppress(t *testing.T, h *Hub, body string) (int, []string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.suppressHandler(rec, httptest.NewRequest(http.MethodPost, "/api/config/suppress", strings.NewReader(body)))
+	var response struct {
+		Patterns []string `json:"patterns"`
+		Count    int      `json:"count"`
+	}
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response.Count != len(response.Patterns) {
+		t.Errorf("count = %d for %d patterns", response.Count, len(response.Patterns))
+	}
+	return rec.Code, response.Patterns
+}
+
+func TestSuppressedQueriesStillCount(t *testing.T) {
+	cfg := testConfig()
+	cfg.SuppressPatterns = []string{"SELECT 1"}
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=query_metrics,done")
+	before := counterValue(t, querySuppressedTotal)
+
+	healthCheck := testMetric("pod-a", 1)
+	healthCheck.Data.SQLPattern = "SELECT 2"
+	postTestMetric(t, h, healthCheck)
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	postTestMetric(t, h, healthCheck)
+	h.publish(newMessage("done", nil))
+
+	var broadcast []interface{}
+	for {
+		message := readTestMessage(t, conn)
+		if message.Type == "done" {
+			break
+		}
+		broadcast = append(broadcast, message.Data.(map[string]interface{})["data"].(map[string]interface{})["execution_time_ms"])
+	}
+	// Literals are normalized, so SELECT 1 suppresses SELECT 2 too.
+	if fmt.Sprint(broadcast) != "[10]" {
+		t.Errorf("broadcast executions %v, want only the 10ms one", broadcast)
+	}
+	if got := counterValue(t, querySuppressedTotal) - before; got != 2 {
+		t.Errorf("suppressions counted %v times, want 2", got)
+	}
+	if rate := h.tps.rates(time.Now().Add(time.Second))["pod-a"]; rate.TPS15s != 3.0/tpsWindowSeconds {
+		t.Errorf("tps = %+v, want 3 executions over the window", rate)
+	}
+}
+
+func TestSuppressReloadTakesEffectLive(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics,done")
+
+	status, patterns := postTestSuppress(t, h, `{"patterns":["SELECT * FROM users WHERE id = 42", " "]}`)
+	if status != http.StatusOK || fmt.Sprint(patterns) != "[SELECT * FROM users WHERE id = ?]" {
+		t.Fatalf("reload = %d %q, want the normalized pattern", status, patterns)
+	}
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	h.publish(newMessage("done", nil))
+	if message := readTestMessage(t, conn); message.Type != "done" {
+		t.Errorf("message = %q, want the suppressed execution left out", message.Type)
+	}
+
+	// An empty list suppresses nothing again.
+	if status, patterns := postTestSuppress(t, h, `{"patterns":[]}`); status != http.StatusOK || len(patterns) != 0 {
+		t.Fatalf("clearing = %d %q, want no patterns", status, patterns)
+	}
+	postTestMetric(t, h, testMetric("pod-a", 20))
+	if message := readTestMessage(t, conn); message.Type != "query_metrics" {
+		t.Errorf("message = %q, want the execution broadcast once the list is cleared", message.Type)
+	}
+
+	if status, _ := postTestSuppress(t, h, `{"patterns":`); status != http.StatusBadRequest {
+		t.Errorf("status for invalid JSON = %d, want 400", status)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// systemMetricsDecimator lets a pod's SystemMetrics through at most once per
+// interval. Samples arriving in between only replace the pod's latest value,
+// so a burst of query events does not flood the system-metric consumers;
+// that value is forwarded on its own once the interval has elapsed, so the
+// last sample of a burst is never lost.
+type systemMetricsDecimator struct {
+	mu       sync.Mutex
+	interval time.Duration
+	pods     map[string]*decimatedPod
+}
+
+type decimatedPod struct {
+	forwardedAt time.Time
+	namespace   string
+	latest      *SystemMetrics
+	// pending is set while latest has not been forwarded.
+	pending bool
+}
+
+func newSystemMetricsDecimator(interval time.Duration) *systemMetricsDecimator {
+	return &systemMetricsDecimator{
+		interval: interval,
+		pods:     make(map[string]*decimatedPod),
+	}
+}
+
+// admit records metrics as the pod's latest sample and reports whether it
+// should be forwarded. A non-positive interval forwards every sample.
+func (d *systemMetricsDecimator) admit(podName, namespace string, metrics *SystemMetrics, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pod, ok := d.pods[podName]
+	if !ok {
+		pod = &decimatedPod{}
+		d.pods[podName] = pod
+	}
+	pod.namespace = namespace
+	pod.latest = metrics
+
+	if d.interval > 0 && !pod.forwardedAt.IsZero() && now.Sub(pod.forwardedAt) < d.interval {
+		pod.pending = true
+		return false
+	}
+	pod.forwardedAt = now
+	pod.pending = false
+	return true
+}
+
+// due returns, as system_metrics events, the held back samples of the pods
+// whose interval has elapsed, and counts them as forwarded.
+func (d *systemMetricsDecimator) due(now time.Time) []QueryMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var flushed []QueryMetrics
+	for podName, pod := range d.pods {
+		if !pod.pending || now.Sub(pod.forwardedAt) < d.interval {
+			continue
+		}
+		pod.forwardedAt = now
+		pod.pending = false
+		flushed = append(flushed, QueryMetrics{
+			Timestamp: now.UTC().Format(time.RFC3339),
+			PodName:   podName,
+			Namespace: pod.namespace,
+			EventType: "system_metrics",
+			Metrics:   pod.latest,
+		})
+	}
+	return flushed
+}
+
+// latest returns the most recent SystemMetrics seen for the pod, whether or
+// not it was forwarded.
+func (d *systemMetricsDecimator) latest(podName string) (*SystemMetrics, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pod, ok := d.pods[podName]
+	if !ok {
+		return nil, false
+	}
+	return pod.latest, true
+}
+
+// runSystemMetricsFlush broadcasts the samples the decimator held back once
+// their interval has elapsed without another sample taking their place.
+func (h *Hub) runSystemMetricsFlush() {
+	if h.cfg.SystemMetricsInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.SystemMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, metric := range h.system.due(now) {
+				if err := h.publish(newNamespacedMessage("system_metrics", metric.Namespace, metric)); err != nil {
+					return
+				}
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (d *systemMetricsDecimator) forget(podName string) {
+	d.mu.Lock()
+	delete(d.pods, podName)
+	d.mu.Unlock()
+}
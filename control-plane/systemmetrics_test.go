@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecimatorForwardsOncePerInterval(t *testing.T) {
+	d := newSystemMetricsDecimator(time.Second)
+	start := time.Now()
+	forwarded := 0
+	var last *SystemMetrics
+	for i := 0; i < 10; i++ {
+		last = &SystemMetrics{CPUUsageRatio: ptr(float64(i) / 10)}
+		if d.admit("pod-a", "default", last, start.Add(time.Duration(i)*90*time.Millisecond)) {
+			forwarded++
+		}
+	}
+	if forwarded != 1 {
+		t.Fatalf("forwarded %d of a 900ms burst, want 1", forwarded)
+	}
+
+	if due := d.due(start.Add(500 * time.Millisecond)); len(due) != 0 {
+		t.Fatalf("flushed %d samples before the interval elapsed", len(due))
+	}
+	due := d.due(start.Add(time.Second))
+	if len(due) != 1 || due[0].EventType != "system_metrics" || due[0].Metrics != last || due[0].Namespace != "default" {
+		t.Fatalf("due = %+v, want the last sample of the burst", due)
+	}
+	if due := d.due(start.Add(3 * time.Second)); len(due) != 0 {
+		t.Errorf("flushed the same sample %d more times", len(due))
+	}
+
+	// The flush counts as a forward, so the interval restarts from it.
+	if d.admit("pod-a", "default", last, start.Add(1500*time.Millisecond)) {
+		t.Error("forwarded a sample 500ms after the flush")
+	}
+	if !d.admit("pod-a", "default", last, start.Add(2*time.Second)) {
+		t.Error("held back a sample a full interval after the flush")
+	}
+}
+
+func TestBurstFeedsAnalyzersAtFullRate(t *testing.T) {
+	cfg := testConfig()
+	cfg.SystemMetricsInterval = time.Hour
+	h := startTestHub(t, cfg)
+
+	for i := 1; i <= 5; i++ {
+		metric := testMetric("pod-a", 10)
+		metric.Metrics = &SystemMetrics{CPUUsageRatio: ptr(float64(i) / 10)}
+		postTestMetric(t, h, metric)
+	}
+
+	if trend := h.cpu.trend("pod-a", time.Now()); len(trend) != 5 {
+		t.Errorf("CPU analyzer saw %d samples, want 5", len(trend))
+	}
+	withMetrics := 0
+	for _, record := range h.recent.query(metricFilter{Pod: "pod-a"}) {
+		if record.Metric.Metrics != nil {
+			withMetrics++
+		}
+	}
+	if withMetrics != 1 {
+		t.Errorf("%d retained metrics carry SystemMetrics, want 1", withMetrics)
+	}
+}
+
+func TestHeldBackSampleIsFlushed(t *testing.T) {
+	cfg := testConfig()
+	cfg.SystemMetricsInterval = 50 * time.Millisecond
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "")
+
+	for i := 1; i <= 3; i++ {
+		metric := testMetric("pod-a", 10)
+		metric.Metrics = &SystemMetrics{CPUUsageRatio: ptr(float64(i) / 10)}
+		postTestMetric(t, h, metric)
+	}
+
+	message := readTestMessageOfType(t, conn, "system_metrics")
+	metrics := message.Data.(map[string]interface{})["metrics"].(map[string]interface{})
+	if metrics["cpu_usage_ratio"] != 0.3 {
+		t.Errorf("flushed cpu_usage_ratio = %v, want the last sample 0.3", metrics["cpu_usage_ratio"])
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// overflowTable collects executions once the table cardinality limit is
+// reached.
+const overflowTable = "__other__"
+
+// latencyGrowth is the ratio between consecutive histogram bucket bounds.
+// Percentiles are reported at a bucket's geometric midpoint, so they are
+// within about 5% of the true value.
+const latencyGrowth = 1.1
+
+var logLatencyGrowth = math.Log(latencyGrowth)
+
+// latencyBucket maps an execution time to its histogram bucket. Bucket i
+// holds times in (growth^(i-1), growth^i]; times of 1ms or less share
+// bucket 0.
+func latencyBucket(ms int64) int {
+	if ms <= 1 {
+		return 0
+	}
+	return int(math.Ceil(math.Log(float64(ms)) / logLatencyGrowth))
+}
+
+// latencyBucketValue is the representative execution time of a bucket.
+func latencyBucketValue(bucket int) float64 {
+	if bucket == 0 {
+		return 1
+	}
+	return math.Pow(latencyGrowth, float64(bucket)-0.5)
+}
+
+// tableMinute is one minute of execution times for a table, as a sparse
+// log-scale histogram.
+type tableMinute struct {
+	minute int64
+	counts map[int]int64
+}
+
+// TableLatency is the latency summary served by /api/table-latency.
+type TableLatency struct {
+	Table string  `json:"table"`
+	Count int64   `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+// tableLatencyTracker keeps per-table execution time histograms over a
+// rolling retention window of one-minute buckets.
+type tableLatencyTracker struct {
+	mu        sync.Mutex
+	retention time.Duration
+	maxTables int
+	tables    map[string][]tableMinute
+}
+
+func newTableLatencyTracker(retention time.Duration, maxTables int) *tableLatencyTracker {
+	return &tableLatencyTracker{
+		retention: retention,
+		maxTables: maxTables,
+		tables:    make(map[string][]tableMinute),
+	}
+}
+
+func (t *tableLatencyTracker) record(metric QueryMetrics, now time.Time) {
+	if metric.Data == nil || metric.Data.ExecutionTimeMs == nil {
+		return
+	}
+	bucket := latencyBucket(*metric.Data.ExecutionTimeMs)
+	minute := now.Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, table := range metric.Data.TableNames {
+		minutes, ok := t.tables[table]
+		if !ok && t.maxTables > 0 && len(t.tables) >= t.maxTables {
+			table = overflowTable
+			minutes = t.tables[table]
+		}
+		if len(minutes) == 0 || minutes[len(minutes)-1].minute != minute {
+			minutes = append(t.prune(minutes, now, t.retention), tableMinute{minute: minute, counts: make(map[int]int64)})
+		}
+		minutes[len(minutes)-1].counts[bucket]++
+		t.tables[table] = minutes
+	}
+}
+
+// prune drops minutes older than window. Callers hold t.mu.
+func (t *tableLatencyTracker) prune(minutes []tableMinute, now time.Time, window time.Duration) []tableMinute {
+	oldest := now.Add(-window).Unix() / 60
+	for len(minutes) > 0 && minutes[0].minute <= oldest {
+		minutes = minutes[1:]
+	}
+	return minutes
+}
+
+// summary returns latency percentiles per table over the last window,
+// capped at the retention, busiest table first.
+func (t *tableLatencyTracker) summary(window time.Duration, now time.Time) []TableLatency {
+	if window <= 0 || window > t.retention {
+		window = t.retention
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]TableLatency, 0, len(t.tables))
+	for table, minutes := range t.tables {
+		minutes = t.prune(minutes, now, t.retention)
+		if len(minutes) == 0 {
+			delete(t.tables, table)
+			continue
+		}
+		t.tables[table] = minutes
+
+		counts := make(map[int]int64)
+		var total int64
+		for _, m := range t.prune(minutes, now, window) {
+			for bucket, count := range m.counts {
+				counts[bucket] += count
+				total += count
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		result = append(result, TableLatency{
+			Table: table,
+			Count: total,
+			P50Ms: histogramPercentile(counts, total, 0.50),
+			P95Ms: histogramPercentile(counts, total, 0.95),
+			P99Ms: histogramPercentile(counts, total, 0.99),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+func histogramPercentile(counts map[int]int64, total int64, percentile float64) float64 {
+	buckets := make([]int, 0, len(counts))
+	for bucket := range counts {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+
+	rank := int64(math.Ceil(percentile * float64(total)))
+	var seen int64
+	for _, bucket := range buckets {
+		seen += counts[bucket]
+		if seen >= rank {
+			return math.Round(latencyBucketValue(bucket)*10) / 10
+		}
+	}
+	return latencyBucketValue(buckets[len(buckets)-1])
+}
+
+// tableLatencyHandler serves GET /api/table-latency?window=15, where window
+// is a number of minutes.
+func (h *Hub) tableLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	window := h.cfg.TableLatencyRetention
+	if value := r.URL.Query().Get("window"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(minutes) * time.Minute
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tables": h.tables.summary(window, time.Now()),
+		"window": min(window, h.cfg.TableLatencyRetention).String(),
+	})
+}
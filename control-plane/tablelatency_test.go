@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTableLatencyPercentileAccuracy(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	distributions := []struct {
+		name   string
+		sample func() int64
+	}{
+		{"uniform", func() int64 { return 1 + random.Int63n(10000) }},
+		// Long tailed, like real query latencies.
+		{"lognormal", func() int64 { return int64(math.Exp(4+1.2*random.NormFloat64())) + 1 }},
+	}
+	for _, distribution := range distributions {
+		t.Run(distribution.name, func(t *testing.T) {
+			tracker := newTableLatencyTracker(time.Hour, 0)
+			now := time.Now()
+			values := make([]int64, 20000)
+			for i := range values {
+				values[i] = distribution.sample()
+				metric := testMetric("pod-a", values[i])
+				metric.Data.TableNames = []string{"orders"}
+				tracker.record(metric, now)
+			}
+			sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+			summary := tracker.summary(0, now)
+			if len(summary) != 1 || summary[0].Count != int64(len(values)) {
+				t.Fatalf("summary = %+v, want %d executions on orders", summary, len(values))
+			}
+			for _, tt := range []struct {
+				percentile float64
+				got        float64
+			}{
+				{0.50, summary[0].P50Ms},
+				{0.95, summary[0].P95Ms},
+				{0.99, summary[0].P99Ms},
+			} {
+				exact := float64(values[int(math.Ceil(tt.percentile*float64(len(values))))-1])
+				if relative := math.Abs(tt.got-exact) / exact; relative > 0.05 {
+					t.Errorf("p%.0f = %.1f, exact %.0f, off by %.1f%%", tt.percentile*100, tt.got, exact, relative*100)
+				}
+			}
+		})
+	}
+}
+
+func TestTableLatencyWindow(t *testing.T) {
+	tracker := newTableLatencyTracker(10*time.Minute, 0)
+	now := time.Now()
+	for _, execution := range []struct {
+		ms     int64
+		tables []string
+		age    time.Duration
+	}{
+		{1000, []string{"users"}, 5 * time.Minute},
+		{10, []string{"users", "orders"}, 0},
+		{20, []string{"users"}, 0},
+		{10, []string{"sessions"}, 20 * time.Minute},
+	} {
+		metric := testMetric("pod-a", execution.ms)
+		metric.Data.TableNames = execution.tables
+		tracker.record(metric, now.Add(-execution.age))
+	}
+
+	tests := []struct {
+		window time.Duration
+		want   map[string]int64
+	}{
+		{time.Minute, map[string]int64{"users": 2, "orders": 1}},
+		{0, map[string]int64{"users": 3, "orders": 1}},
+		// Capped at the retention, which the sessions minute is beyond.
+		{time.Hour, map[string]int64{"users": 3, "orders": 1}},
+	}
+	for _, tt := range tests {
+		summary := tracker.summary(tt.window, now)
+		got := make(map[string]int64)
+		for _, table := range summary {
+			got[table.Table] = table.Count
+		}
+		if len(got) != len(tt.want) || got["users"] != tt.want["users"] || got["orders"] != tt.want["orders"] {
+			t.Errorf("window %v: counts = %v, want %v", tt.window, got, tt.want)
+		}
+		if summary[0].Table != "users" {
+			t.Errorf("window %v: first table = %s, want the busiest", tt.window, summary[0].Table)
+		}
+	}
+}
+
+func TestTableLatencyOverflow(t *testing.T) {
+	tracker := newTableLatencyTracker(time.Hour, 2)
+	now := time.Now()
+	for _, table := range []string{"a", "b", "c", "d"} {
+		metric := testMetric("pod-a", 10)
+		metric.Data.TableNames = []string{table}
+		tracker.record(metric, now)
+	}
+	summary := tracker.summary(0, now)
+	if len(summary) != 3 || summary[0].Table != overflowTable || summary[0].Count != 2 {
+		t.Errorf("summary = %+v, want c and d under %s", summary, overflowTable)
+	}
+}
+
+func TestTableLatencyHandlerRejectsInvalidWindow(t *testing.T) {
+	h := newHub(testConfig())
+	for _, window := range []string{"0", "-5", "soon"} {
+		rec := httptest.NewRecorder()
+		h.tableLatencyHandler(rec, httptest.NewRequest(http.MethodGet, "/api/table-latency?window="+window, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("window=%s: status = %d, want 400", window, rec.Code)
+		}
+	}
+}
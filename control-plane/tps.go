@@ -0,0 +1,152 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tpsWindowSeconds is the longest window reported in tps_update messages;
+// the tracker keeps one one-second bucket per pod for each second of it.
+const tpsWindowSeconds = 15
+
+// PodTPS is one pod's query rate over the trailing 1, 5 and 15 seconds.
+type PodTPS struct {
+	TPS1s  float64 `json:"tps_1s"`
+	TPS5s  float64 `json:"tps_5s"`
+	TPS15s float64 `json:"tps_15s"`
+}
+
+// tpsTracker counts query_execution events per pod in one-second buckets so
+// transaction rates are computed the same way for every pod, independently
+// of the tps_value some agents report.
+type tpsTracker struct {
+	mu   sync.Mutex
+	pods map[string]*[tpsWindowSeconds]tpsBucket
+	// namespaces is the namespace each pod last reported from, so each
+	// namespace's rates go only to the clients allowed to see it.
+	namespaces map[string]string
+}
+
+type tpsBucket struct {
+	second int64
+	count  int64
+}
+
+func newTPSTracker() *tpsTracker {
+	return &tpsTracker{
+		pods:       make(map[string]*[tpsWindowSeconds]tpsBucket),
+		namespaces: make(map[string]string),
+	}
+}
+
+func (t *tpsTracker) record(podName, namespace string, now time.Time) {
+	second := now.Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buckets, ok := t.pods[podName]
+	if !ok {
+		buckets = new([tpsWindowSeconds]tpsBucket)
+		t.pods[podName] = buckets
+	}
+	t.namespaces[podName] = namespace
+	bucket := &buckets[second%tpsWindowSeconds]
+	if bucket.second != second {
+		*bucket = tpsBucket{second: second}
+	}
+	bucket.count++
+}
+
+func (t *tpsTracker) forget(podName string) {
+	t.mu.Lock()
+	delete(t.pods, podName)
+	delete(t.namespaces, podName)
+	t.mu.Unlock()
+}
+
+// rates returns the per-pod rates for the windows ending at now. The current,
+// still-filling second is not counted, so the 1s rate is that of the last
+// complete second. Pods with no events in the last 15 seconds are dropped.
+func (t *tpsTracker) rates(now time.Time) map[string]PodTPS {
+	current := now.Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]PodTPS, len(t.pods))
+	for podName, buckets := range t.pods {
+		var last1, last5, last15 int64
+		for _, bucket := range buckets {
+			age := current - bucket.second
+			if age < 1 || age > tpsWindowSeconds {
+				continue
+			}
+			last15 += bucket.count
+			if age <= 5 {
+				last5 += bucket.count
+			}
+			if age == 1 {
+				last1 += bucket.count
+			}
+		}
+		if last15 == 0 && !t.hasCurrent(buckets, current) {
+			delete(t.pods, podName)
+			delete(t.namespaces, podName)
+			continue
+		}
+		result[podName] = PodTPS{
+			TPS1s:  float64(last1),
+			TPS5s:  float64(last5) / 5,
+			TPS15s: float64(last15) / tpsWindowSeconds,
+		}
+	}
+	return result
+}
+
+// hasCurrent reports whether the pod has events in the second still being
+// filled. Callers hold t.mu.
+func (t *tpsTracker) hasCurrent(buckets *[tpsWindowSeconds]tpsBucket, current int64) bool {
+	bucket := buckets[current%tpsWindowSeconds]
+	return bucket.second == current && bucket.count > 0
+}
+
+// byNamespace splits rates by the namespace of each pod.
+func (t *tpsTracker) byNamespace(rates map[string]PodTPS) map[string]map[string]PodTPS {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make(map[string]map[string]PodTPS)
+	for podName, rate := range rates {
+		namespace := t.namespaces[podName]
+		if result[namespace] == nil {
+			result[namespace] = make(map[string]PodTPS)
+		}
+		result[namespace][podName] = rate
+	}
+	return result
+}
+
+// runTPS broadcasts the tps_update of each namespace every second until the
+// hub stops, so namespace filters and token claims apply to rates as they do
+// to the metrics themselves. Rates roll forward on every tick, so a pod that
+// goes quiet decays to zero rather than keeping its last value.
+func (h *Hub) runTPS() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			rates := h.tps.rates(now)
+			if len(rates) == 0 {
+				continue
+			}
+			for namespace, namespaceRates := range h.tps.byNamespace(rates) {
+				if err := h.publish(newNamespacedMessage("tps_update", namespace, namespaceRates)); err != nil {
+					return
+				}
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
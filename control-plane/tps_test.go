@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTPSRollingWindows(t *testing.T) {
+	tracker := newTPSTracker()
+	start := time.Unix(1_700_000_000, 0)
+	for i := 0; i < 3; i++ {
+		tracker.record("pod-a", "default", start)
+	}
+	for i := 0; i < 2; i++ {
+		tracker.record("pod-a", "default", start.Add(time.Second+300*time.Millisecond))
+	}
+	tracker.record("pod-b", "default", start)
+
+	steps := []struct {
+		at   time.Duration
+		want PodTPS
+	}{
+		// The current second is still filling and not counted.
+		{time.Second, PodTPS{TPS1s: 3, TPS5s: 3.0 / 5, TPS15s: 3.0 / 15}},
+		{2 * time.Second, PodTPS{TPS1s: 2, TPS5s: 5.0 / 5, TPS15s: 5.0 / 15}},
+		// With no new events the rates roll forward and decay.
+		{7 * time.Second, PodTPS{TPS1s: 0, TPS5s: 0, TPS15s: 5.0 / 15}},
+	}
+	for _, step := range steps {
+		rates := tracker.rates(start.Add(step.at))
+		if got := rates["pod-a"]; got != step.want {
+			t.Errorf("pod-a at +%v = %+v, want %+v", step.at, got, step.want)
+		}
+		if got := rates["pod-b"].TPS15s; got != 1.0/15 {
+			t.Errorf("pod-b at +%v: tps_15s = %v, want %v", step.at, got, 1.0/15)
+		}
+	}
+
+	if rates := tracker.rates(start.Add(17 * time.Second)); len(rates) != 0 {
+		t.Errorf("rates after 15 quiet seconds = %v, want none", rates)
+	}
+}
+
+func TestTPSKeepsPodWithOnlyCurrentSecond(t *testing.T) {
+	tracker := newTPSTracker()
+	now := time.Unix(1_700_000_000, 0)
+	tracker.record("pod-a", "default", now)
+	if rates := tracker.rates(now); len(rates) != 1 || rates["pod-a"] != (PodTPS{}) {
+		t.Errorf("rates = %v, want pod-a at zero until its first second completes", rates)
+	}
+}
+
+func TestTPSByNamespace(t *testing.T) {
+	tracker := newTPSTracker()
+	now := time.Unix(1_700_000_000, 0)
+	tracker.record("pod-a", "team-a", now)
+	tracker.record("pod-b", "team-b", now)
+	tracker.record("pod-c", "team-a", now)
+
+	split := tracker.byNamespace(tracker.rates(now.Add(time.Second)))
+	if len(split) != 2 || len(split["team-a"]) != 2 || len(split["team-b"]) != 1 || split["team-a"]["pod-c"].TPS1s != 1 {
+		t.Errorf("byNamespace = %v, want pod-a and pod-c in team-a, pod-b in team-b", split)
+	}
+}
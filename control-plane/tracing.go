@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the control plane's spans.
+const tracerName = "kubedb-monitor-control-plane"
+
+// tracer resolves through the global provider on every call, so spans are
+// no-ops until setupTracing installs an exporting one.
+var tracer = otel.Tracer(tracerName)
+
+// setupTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// (or its traces-specific variant) is set; the exporter reads the standard
+// OTEL_EXPORTER_OTLP_* variables itself. Otherwise tracing stays a no-op.
+// Incoming W3C traceparent headers are honoured either way. The returned
+// function flushes pending spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("exporting traces over otlp")
+	return provider.Shutdown, nil
+}
+
+// startIngestSpan starts the span covering one /api/metrics request,
+// continuing the caller's trace when it sent a traceparent header.
+func startIngestSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer.Start(ctx, "ingest metrics", trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("net.peer.addr", r.RemoteAddr)))
+}
+
+// metricAttributes describes a metric on a span.
+func metricAttributes(metric QueryMetrics) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("kubedb.event_type", metric.EventType),
+		attribute.String("k8s.pod.name", metric.PodName),
+		attribute.String("k8s.namespace.name", metric.Namespace),
+	}
+	if metric.Context != nil && metric.Context.RequestID != "" {
+		attrs = append(attrs, attribute.String("kubedb.request_id", metric.Context.RequestID))
+	}
+	return attrs
+}
+
+// annotateIngestSpan records what a request carried. A batch is described
+// by its first metric.
+func annotateIngestSpan(span trace.Span, metrics []QueryMetrics, batch bool) {
+	span.SetAttributes(attribute.Bool("kubedb.batch", batch), attribute.Int("kubedb.metric_count", len(metrics)))
+	if len(metrics) > 0 {
+		span.SetAttributes(metricAttributes(metrics[0])...)
+	}
+}
+
+// failSpan marks the span as failed with err.
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
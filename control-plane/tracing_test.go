@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	testSpansOnce sync.Once
+	testSpans     *tracetest.InMemoryExporter
+)
+
+// recordTestSpans installs an in-memory exporter as the global tracer
+// provider and empties it. The global tracer only ever delegates to the
+// first provider set, so every test shares one exporter.
+func recordTestSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	testSpansOnce.Do(func() {
+		testSpans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(testSpans)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	testSpans.Reset()
+	return testSpans
+}
+
+// spanAttributes flattens a span's attributes for comparison.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]string {
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+// spansNamed returns the recorded spans called name.
+func spansNamed(exporter *tracetest.InMemoryExporter, name string) []tracetest.SpanStub {
+	var spans []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestIngestSpanPerRequest(t *testing.T) {
+	exporter := recordTestSpans(t)
+	h := startTestHub(t, testConfig())
+
+	metric := testMetric("pod-a", 10)
+	metric.Context = &ExecutionContext{RequestID: "req-42"}
+	req := httptest.NewRequest(http.MethodPost, "/api/metrics?sync=true", strings.NewReader(ndjsonLine(t, metric)))
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	h.receiveMetrics(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	ingest := spansNamed(exporter, "ingest metrics")
+	if len(ingest) != 1 {
+		t.Fatalf("recorded %d ingest spans, want 1", len(ingest))
+	}
+	span := ingest[0]
+	if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span trace %s parent %s, want it to continue the traceparent", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	want := map[attribute.Key]string{
+		"kubedb.event_type":   "query_execution",
+		"k8s.pod.name":        "pod-a",
+		"k8s.namespace.name":  "default",
+		"kubedb.request_id":   "req-42",
+		"kubedb.batch":        "false",
+		"kubedb.metric_count": "1",
+	}
+	attrs := spanAttributes(span)
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("attribute %s = %q, want %q", key, attrs[key], value)
+		}
+	}
+	if span.Status.Code == codes.Error {
+		t.Errorf("span status = %v, want no error", span.Status)
+	}
+
+	process := spansNamed(exporter, "process metric")
+	if len(process) != 1 || process[0].Parent.SpanID() != span.SpanContext.SpanID() {
+		t.Errorf("process spans = %d, want one child of the ingest span", len(process))
+	}
+}
+
+func TestIngestSpanForBatchAndFailure(t *testing.T) {
+	exporter := recordTestSpans(t)
+	h := startTestHub(t, testConfig())
+
+	postTestBody(h, testBatch(t, testMetric("pod-a", 10), testMetric("pod-b", 10)))
+	ingest := spansNamed(exporter, "ingest metrics")
+	if len(ingest) != 1 {
+		t.Fatalf("recorded %d ingest spans, want 1", len(ingest))
+	}
+	if attrs := spanAttributes(ingest[0]); attrs["kubedb.batch"] != "true" || attrs["kubedb.metric_count"] != "2" {
+		t.Errorf("batch span attributes = %v, want a batch of 2", attrs)
+	}
+	if process := spansNamed(exporter, "process metric"); len(process) != 2 {
+		t.Errorf("recorded %d process spans, want one per metric", len(process))
+	}
+
+	exporter.Reset()
+	invalid := testMetric("pod-a", 10)
+	invalid.EventType = ""
+	if rec := postTestBody(h, testBatch(t, invalid)); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	ingest = spansNamed(exporter, "ingest metrics")
+	if len(ingest) != 1 || ingest[0].Status.Code != codes.Error || len(ingest[0].Events) == 0 {
+		t.Errorf("spans = %+v, want a failed ingest span with the error recorded", ingest)
+	}
+}
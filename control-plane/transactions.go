@@ -0,0 +1,312 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Escalation tiers for long_transaction_warning. A transaction is warned
+// about once at the configured threshold and again at each later tier.
+var longTransactionTiers = []struct {
+	after    time.Duration
+	severity string
+}{
+	{60 * time.Second, "critical"},
+	{30 * time.Second, "high"},
+}
+
+// openTransaction is what the tracker knows about one transaction that has
+// not completed yet.
+type openTransaction struct {
+	podName  string
+	severity string
+	lastSeen time.Time
+}
+
+// transactionTracker follows open transactions by pod and id, since ids are
+// only unique within the pod that reports them, and decides when their
+// duration warrants a (re-)escalated warning. Entries are dropped when the
+// transaction completes or has not been reported for ttl.
+type transactionTracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	ttl       time.Duration
+	open      map[string]*openTransaction // keyed by transactionKey
+	swept     time.Time
+}
+
+func newTransactionTracker(threshold, ttl time.Duration) *transactionTracker {
+	return &transactionTracker{
+		threshold: threshold,
+		ttl:       ttl,
+		open:      make(map[string]*openTransaction),
+	}
+}
+
+func transactionKey(podName, id string) string {
+	return podName + "/" + id
+}
+
+// transactionCompleted reports whether a transaction event marks the end of
+// the transaction: it carries a transaction_outcome, which agents only send
+// once a transaction has completed, or its status says so.
+func transactionCompleted(data *QueryData) bool {
+	if data.TransactionOutcome != "" {
+		return true
+	}
+	switch strings.ToLower(data.Status) {
+	case "committed", "commit", "rolled_back", "rollback", "completed", "failed":
+		return true
+	}
+	return false
+}
+
+// severityFor maps a duration to its tier, or "" below the threshold.
+func (t *transactionTracker) severityFor(duration time.Duration) string {
+	for _, tier := range longTransactionTiers {
+		if duration >= tier.after {
+			return tier.severity
+		}
+	}
+	if duration >= t.threshold {
+		return "warning"
+	}
+	return ""
+}
+
+// observe records a report of one of a pod's transactions. It returns the
+// severity to warn with when the transaction reached a new tier, or ""
+// otherwise, and the pods whose last warned transaction completed or was
+// forgotten, whose long transaction alerts are over.
+func (t *transactionTracker) observe(podName, id string, duration time.Duration, completed bool, now time.Time) (string, []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cleared := t.sweep(now)
+
+	key := transactionKey(podName, id)
+	if completed {
+		if tx, ok := t.open[key]; ok {
+			delete(t.open, key)
+			if tx.severity != "" && !t.warned(podName) {
+				cleared = append(cleared, podName)
+			}
+		}
+		return "", cleared
+	}
+
+	tx, ok := t.open[key]
+	if !ok {
+		tx = &openTransaction{podName: podName}
+		t.open[key] = tx
+	}
+	tx.lastSeen = now
+
+	severity := t.severityFor(duration)
+	if severity == "" || severity == tx.severity {
+		return "", cleared
+	}
+	tx.severity = severity
+	return severity, cleared
+}
+
+// warned reports whether the pod has an open transaction it was warned
+// about. Callers hold t.mu.
+func (t *transactionTracker) warned(podName string) bool {
+	for _, tx := range t.open {
+		if tx.podName == podName && tx.severity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep drops transactions that stopped being reported and returns the pods
+// left without a warned transaction. It runs at most once per ttl. Callers
+// hold t.mu.
+func (t *transactionTracker) sweep(now time.Time) []string {
+	if now.Sub(t.swept) < t.ttl {
+		return nil
+	}
+	t.swept = now
+	var dropped []string
+	for key, tx := range t.open {
+		if now.Sub(tx.lastSeen) >= t.ttl {
+			delete(t.open, key)
+			if tx.severity != "" {
+				dropped = append(dropped, tx.podName)
+			}
+		}
+	}
+	var cleared []string
+	for _, podName := range dropped {
+		if !t.warned(podName) && !slices.Contains(cleared, podName) {
+			cleared = append(cleared, podName)
+		}
+	}
+	return cleared
+}
+
+// analyzeTransaction tracks transaction and long_running_transaction events
+// and broadcasts a long_transaction_warning each time an open transaction
+// crosses into a higher severity tier. The pod's long_transaction_warning
+// alert follows its most recent warning and is resolved once none of the
+// pod's warned transactions is open any more.
+func (h *Hub) analyzeTransaction(metric QueryMetrics) {
+	if metric.Data == nil || metric.Data.TransactionId == nil || *metric.Data.TransactionId == "" {
+		return
+	}
+	id := *metric.Data.TransactionId
+	completed := metric.EventType == "transaction_event" && transactionCompleted(metric.Data)
+
+	var duration time.Duration
+	if metric.Data.TransactionDuration != nil {
+		duration = time.Duration(*metric.Data.TransactionDuration) * time.Millisecond
+	}
+	severity, cleared := h.txns.observe(metric.PodName, id, duration, completed, time.Now())
+	for _, podName := range cleared {
+		h.alerts.resolve("long_transaction_warning", podName)
+	}
+	if severity == "" {
+		return
+	}
+
+	h.alerts.fire("long_transaction_warning", severity, metric.PodName, metric.Namespace, map[string]interface{}{
+		"transaction_id": id,
+		"duration_ms":    duration.Milliseconds(),
+	})
+	h.publish(newNamespacedMessage("long_transaction_warning", metric.Namespace, map[string]interface{}{
+		"transaction_id": id,
+		"pod_name":       metric.PodName,
+		"namespace":      metric.Namespace,
+		"duration_ms":    duration.Milliseconds(),
+		"severity":       severity,
+		"threshold_ms":   h.txns.threshold.Milliseconds(),
+	}))
+}
+
+// transactionOutcome classifies a completed transaction event as "commit" or
+// "rollback" from its transaction_outcome, falling back to its status. It
+// returns "" for events that are neither.
+func transactionOutcome(data *QueryData) string {
+	outcome := data.TransactionOutcome
+	if outcome == "" {
+		outcome = data.Status
+	}
+	switch strings.ToLower(outcome) {
+	case "commit", "committed":
+		return "commit"
+	case "rollback", "rolled_back":
+		return "rollback"
+	}
+	return ""
+}
+
+// ratioUpdates coalesces transaction_ratio_update broadcasts: each completed
+// transaction replaces its pod's unsent update, and runTransactionRatios
+// sends what is pending once a second, as tps_update is sent.
+type ratioUpdates struct {
+	mu      sync.Mutex
+	pending map[string]WebSocketMessage
+}
+
+func newRatioUpdates() *ratioUpdates {
+	return &ratioUpdates{pending: make(map[string]WebSocketMessage)}
+}
+
+func (u *ratioUpdates) set(podName string, message WebSocketMessage) {
+	u.mu.Lock()
+	u.pending[podName] = message
+	u.mu.Unlock()
+}
+
+// take returns the pending updates and clears them.
+func (u *ratioUpdates) take() []WebSocketMessage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	messages := make([]WebSocketMessage, 0, len(u.pending))
+	for podName, message := range u.pending {
+		messages = append(messages, message)
+		delete(u.pending, podName)
+	}
+	return messages
+}
+
+func (u *ratioUpdates) forget(podName string) {
+	u.mu.Lock()
+	delete(u.pending, podName)
+	u.mu.Unlock()
+}
+
+// runTransactionRatios broadcasts the pending transaction_ratio_updates every
+// second until the hub stops.
+func (h *Hub) runTransactionRatios() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, message := range h.ratios.take() {
+				if err := h.publish(message); err != nil {
+					return
+				}
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// analyzeTransactionOutcome tracks each pod's rolling commit/rollback ratio
+// and queues it as the pod's transaction_ratio_update for every completed
+// transaction. A rollback_ratio_alert is raised once the rollback share over
+// the window reaches the configured ratio with enough samples, repeated
+// while it lasts, and rollback_ratio_recovered follows when it drops.
+func (h *Hub) analyzeTransactionOutcome(metric QueryMetrics) {
+	if metric.EventType != "transaction_event" || metric.Data == nil {
+		return
+	}
+	outcome := transactionOutcome(metric.Data)
+	if outcome == "" {
+		return
+	}
+	now := time.Now()
+	ratio, samples, _ := h.txOutcomes.record(metric.PodName, outcome == "rollback", "", now)
+
+	data := map[string]interface{}{
+		"pod_name":       metric.PodName,
+		"namespace":      metric.Namespace,
+		"rollback_ratio": ratio,
+		"commit_ratio":   1 - ratio,
+		"sample_size":    samples,
+		"window_seconds": h.txOutcomes.window,
+	}
+	h.ratios.set(metric.PodName, newNamespacedMessage("transaction_ratio_update", metric.Namespace, data))
+	if samples < h.txOutcomes.minSamples {
+		return
+	}
+
+	var messageType string
+	switch h.txOutcomes.monitor.observe(metric.PodName, ratio, now) {
+	case thresholdFired, thresholdRepeated:
+		messageType = "rollback_ratio_alert"
+		h.alerts.fire("rollback_ratio_alert", "warning", metric.PodName, metric.Namespace, map[string]interface{}{
+			"rollback_ratio": ratio,
+		})
+	case thresholdRecovered:
+		messageType = "rollback_ratio_recovered"
+		h.alerts.resolve("rollback_ratio_alert", metric.PodName)
+	default:
+		return
+	}
+
+	alert := map[string]interface{}{"threshold": h.txOutcomes.monitor.high}
+	for key, value := range data {
+		alert[key] = value
+	}
+	if messageType == "rollback_ratio_alert" {
+		alert["severity"] = "warning"
+	}
+	h.publish(newNamespacedMessage(messageType, metric.Namespace, alert))
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTransactionTrackerEscalates(t *testing.T) {
+	tracker := newTransactionTracker(10*time.Second, time.Hour)
+	now := time.Now()
+	steps := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{5 * time.Second, ""},
+		{10 * time.Second, "warning"},
+		{20 * time.Second, ""},
+		{30 * time.Second, "high"},
+		{45 * time.Second, ""},
+		{60 * time.Second, "critical"},
+		{90 * time.Second, ""},
+	}
+	for _, step := range steps {
+		if got, _ := tracker.observe("pod-a", "tx-1", step.duration, false, now); got != step.want {
+			t.Errorf("at %v: severity = %q, want %q", step.duration, got, step.want)
+		}
+	}
+
+	got, cleared := tracker.observe("pod-a", "tx-1", 95*time.Second, true, now)
+	if got != "" || len(tracker.open) != 0 || !slices.Equal(cleared, []string{"pod-a"}) {
+		t.Errorf("completion: severity = %q, cleared %v with %d open, want pod-a cleared and nothing tracked", got, cleared, len(tracker.open))
+	}
+	// A transaction id reused after completion starts over.
+	if got, _ := tracker.observe("pod-a", "tx-1", 12*time.Second, false, now); got != "warning" {
+		t.Errorf("reused id: severity = %q, want warning", got)
+	}
+}
+
+func TestTransactionTrackerForgetsUnreported(t *testing.T) {
+	tracker := newTransactionTracker(10*time.Second, time.Minute)
+	start := time.Now()
+	tracker.observe("pod-a", "quiet", 15*time.Second, false, start)
+	tracker.observe("pod-b", "busy", 15*time.Second, false, start.Add(30*time.Second))
+
+	_, cleared := tracker.observe("pod-b", "busy", 20*time.Second, false, start.Add(70*time.Second))
+	if _, ok := tracker.open["pod-a/quiet"]; ok {
+		t.Error("transaction not reported for the TTL is still tracked")
+	}
+	if _, ok := tracker.open["pod-b/busy"]; !ok {
+		t.Error("recently reported transaction was forgotten")
+	}
+	if !slices.Equal(cleared, []string{"pod-a"}) {
+		t.Errorf("cleared = %v, want the forgotten transaction's pod", cleared)
+	}
+}
+
+func TestTransactionTrackerSeparatesPods(t *testing.T) {
+	tracker := newTransactionTracker(10*time.Second, time.Hour)
+	now := time.Now()
+	// Transaction ids are only unique per pod.
+	tracker.observe("pod-a", "tx-1", 15*time.Second, false, now)
+	if got, _ := tracker.observe("pod-b", "tx-1", 15*time.Second, false, now); got != "warning" {
+		t.Errorf("pod-b severity = %q, want its own warning", got)
+	}
+	tracker.observe("pod-a", "tx-2", 15*time.Second, false, now)
+
+	// pod-a still has a warned transaction open after tx-1 completes.
+	if _, cleared := tracker.observe("pod-a", "tx-1", 16*time.Second, true, now); len(cleared) != 0 {
+		t.Errorf("cleared = %v, want none while pod-a/tx-2 is open", cleared)
+	}
+	if _, ok := tracker.open["pod-b/tx-1"]; !ok {
+		t.Error("completing pod-a/tx-1 dropped pod-b/tx-1")
+	}
+	if _, cleared := tracker.observe("pod-a", "tx-2", 16*time.Second, true, now); !slices.Equal(cleared, []string{"pod-a"}) {
+		t.Errorf("cleared = %v, want pod-a", cleared)
+	}
+}
+
+func TestTransactionCompleted(t *testing.T) {
+	tests := []struct {
+		data QueryData
+		want bool
+	}{
+		{QueryData{Status: "COMMITTED"}, true},
+		{QueryData{Status: "rolled_back"}, true},
+		{QueryData{Status: "ACTIVE"}, false},
+		{QueryData{TransactionOutcome: "commit"}, true},
+		// The outcome is only sent once the transaction is over, whatever
+		// the status still says.
+		{QueryData{TransactionOutcome: "rollback", Status: "ACTIVE"}, true},
+		{QueryData{}, false},
+	}
+	for _, tt := range tests {
+		if got := transactionCompleted(&tt.data); got != tt.want {
+			t.Errorf("transactionCompleted(%+v) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLongTransactionWarnings(t *testing.T) {
+	cfg := testConfig()
+	cfg.AlertHistoryFile = filepath.Join(t.TempDir(), "alerts.jsonl")
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=long_transaction_warning")
+
+	for _, duration := range []int64{4000, 12000, 15000, 31000, 61000} {
+		postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.EventType = "long_running_transaction"
+			m.Data.TransactionId = ptr("tx-1")
+			m.Data.TransactionDuration = ptr(duration)
+			m.Data.Status = "ACTIVE"
+		}))
+	}
+	for _, want := range []struct {
+		severity string
+		duration float64
+	}{
+		{"warning", 12000},
+		{"high", 31000},
+		{"critical", 61000},
+	} {
+		data := readTestMessage(t, conn).Data.(map[string]interface{})
+		if data["severity"] != want.severity || data["duration_ms"] != want.duration || data["transaction_id"] != "tx-1" {
+			t.Errorf("warning = %v, want %s at %v", data, want.severity, want.duration)
+		}
+	}
+	alerts := h.alerts.query(time.Time{}, time.Time{}, "long_transaction_warning")
+	if len(alerts) != 1 || alerts[0].Severity != "critical" || alerts[0].ResolvedAt != nil {
+		t.Fatalf("alert history = %+v, want one open critical alert", alerts)
+	}
+
+	postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+		m.EventType = "transaction_event"
+		m.Data.TransactionId = ptr("tx-1")
+		m.Data.TransactionDuration = ptr(int64(62000))
+		m.Data.Status = "COMMITTED"
+	}))
+	h.txns.mu.Lock()
+	_, open := h.txns.open["pod-a/tx-1"]
+	h.txns.mu.Unlock()
+	if open {
+		t.Error("completed transaction is still tracked")
+	}
+	if alerts := h.alerts.query(time.Time{}, time.Time{}, "long_transaction_warning"); alerts[0].ResolvedAt == nil {
+		t.Error("alert is still open after the transaction completed")
+	}
+}
+
+func TestTransactionOutcome(t *testing.T) {
+	tests := []struct {
+		data QueryData
+		want string
+	}{
+		{QueryData{Status: "COMMITTED"}, "commit"},
+		{QueryData{Status: "rolled_back"}, "rollback"},
+		{QueryData{TransactionOutcome: "ROLLBACK"}, "rollback"},
+		// transaction_outcome takes precedence over the status.
+		{QueryData{TransactionOutcome: "rollback", Status: "COMMITTED"}, "rollback"},
+		{QueryData{TransactionOutcome: "commit", Status: "FAILED"}, "commit"},
+		{QueryData{Status: "ACTIVE"}, ""},
+		{QueryData{Status: "failed"}, ""},
+	}
+	for _, tt := range tests {
+		if got := transactionOutcome(&tt.data); got != tt.want {
+			t.Errorf("transactionOutcome(%+v) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestRatioUpdatesCoalescePerPod(t *testing.T) {
+	updates := newRatioUpdates()
+	for i := 1; i <= 3; i++ {
+		updates.set("pod-a", newMessage("transaction_ratio_update", map[string]interface{}{"pod_name": "pod-a", "sample_size": i}))
+	}
+	updates.set("pod-b", newMessage("transaction_ratio_update", map[string]interface{}{"pod_name": "pod-b", "sample_size": 1}))
+	updates.set("pod-c", newMessage("transaction_ratio_update", map[string]interface{}{"pod_name": "pod-c", "sample_size": 1}))
+	updates.forget("pod-c")
+
+	sizes := map[interface{}]interface{}{}
+	for _, message := range updates.take() {
+		data := message.Data.(map[string]interface{})
+		sizes[data["pod_name"]] = data["sample_size"]
+	}
+	if len(sizes) != 2 || sizes["pod-a"] != 3 || sizes["pod-b"] != 1 {
+		t.Errorf("pending updates = %v, want pod-a's latest and pod-b's", sizes)
+	}
+	if rest := updates.take(); len(rest) != 0 {
+		t.Errorf("second take = %d updates, want none", len(rest))
+	}
+}
+
+func TestTransactionRatioUpdate(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=transaction_ratio_update")
+
+	for i, status := range []string{"COMMITTED", "ROLLED_BACK", "COMMITTED", "ACTIVE"} {
+		postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.EventType = "transaction_event"
+			m.Data.TransactionId = ptr(fmt.Sprintf("tx-%d", i))
+			m.Data.TransactionDuration = ptr(int64(10))
+			m.Data.Status = status
+		}))
+	}
+	// Updates are sent once a second, so earlier ones may come first.
+	for {
+		data := readTestMessage(t, conn).Data.(map[string]interface{})
+		if data["sample_size"] != float64(3) {
+			continue
+		}
+		rollback := 1.0 / 3
+		if data["pod_name"] != "pod-a" || data["rollback_ratio"] != rollback || data["commit_ratio"] != 1-rollback {
+			t.Errorf("update = %v, want pod-a with one rollback in three", data)
+		}
+		return
+	}
+}
+
+func TestRollbackRatioAlert(t *testing.T) {
+	cfg := testConfig()
+	cfg.RollbackRatioAlert = 0.5
+	cfg.RollbackRatioMinSamples = 4
+	h := startTestHub(t, cfg)
+	conn := dialTestHub(t, h, "types=rollback_ratio_alert,rollback_ratio_recovered,done")
+
+	// Three rollbacks in four: the first three are too few to alert on.
+	statuses := []string{"COMMITTED", "ROLLED_BACK", "ROLLED_BACK", "ROLLED_BACK"}
+	// 3 in 6 is still at the threshold; 3 in 7 recovers.
+	statuses = append(statuses, "COMMITTED", "COMMITTED", "COMMITTED")
+	for i, status := range statuses {
+		postTestMetric(t, h, testMetric("pod-a", 10, func(m *QueryMetrics) {
+			m.EventType = "transaction_event"
+			m.Data.TransactionId = ptr(fmt.Sprintf("tx-%d", i))
+			m.Data.TransactionDuration = ptr(int64(10))
+			m.Data.Status = status
+		}))
+	}
+	h.publish(newMessage("done", nil))
+
+	for _, want := range []struct {
+		messageType string
+		ratio       float64
+		samples     float64
+	}{
+		{"rollback_ratio_alert", 0.75, 4},
+		{"rollback_ratio_recovered", 3.0 / 7, 7},
+	} {
+		message := readTestMessage(t, conn)
+		data, _ := message.Data.(map[string]interface{})
+		if message.Type != want.messageType || data["rollback_ratio"] != want.ratio || data["sample_size"] != want.samples || data["threshold"] != 0.5 {
+			t.Errorf("message = %s %v, want %s at %v over %v", message.Type, data, want.messageType, want.ratio, want.samples)
+		}
+	}
+	if next := readTestMessage(t, conn); next.Type != "done" {
+		t.Errorf("message = %s %v, want nothing else", next.Type, next.Data)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ingestPayload feeds a message received from a transport other than HTTP
+// into the ingestion pipeline. Unlike receiveMetrics there is nobody to
+// answer, so invalid metrics are logged and skipped. With wait set it
+// returns only once every metric has been processed, so that callers can
+// acknowledge the message to the transport afterwards.
+func (h *Hub) ingestPayload(payload []byte, source string, wait bool) error {
+	_, err := h.ingestPayloadFrom(payload, source, 0, wait)
+	return err
+}
+
+// ingestPayloadFrom is ingestPayload for transports that retry a message
+// after errQueueFull. It skips the first skip metrics, which an earlier
+// attempt already submitted, and returns the index of the metric it stopped
+// at, so that a retry resumes there instead of submitting metrics twice.
+func (h *Hub) ingestPayloadFrom(payload []byte, source string, skip int, wait bool) (int, error) {
+	metrics, _, err := decodeMetrics(payload, h.cfg.FieldAliases)
+	if err != nil {
+		slog.Warn("failed to decode metrics", "source", source, "error", err)
+		h.dlq.add(DeadLetter{Reason: deadLetterDecode, Detail: err.Error(), Source: source, Payload: string(payload), At: time.Now()})
+		return 0, nil
+	}
+
+	for i := skip; i < len(metrics); i++ {
+		metric := metrics[i]
+		metricsReceivedTotal.WithLabelValues(eventTypeLabel(metric.EventType)).Inc()
+		if err := validateMetric(metric); err != nil {
+			slog.Warn("rejected invalid metric", "source", source, "event_type", metric.EventType,
+				"pod_name", metric.PodName, "rule", err.Error())
+			h.dlq.rejectMetric(metric, source, err)
+			continue
+		}
+		if err := h.ingest.submit(metric, wait); err != nil {
+			return i, fmt.Errorf("submit %s metric from %s: %w", metric.EventType, metric.PodName, err)
+		}
+	}
+	return len(metrics), nil
+}
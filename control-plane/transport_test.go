@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestIngestPayloadFeedsProcessingPath(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn := dialTestHub(t, h, "types=query_metrics")
+
+	invalid := testMetric("pod-b", 20)
+	invalid.Data.QueryID = ""
+	payload := testBatch(t, testMetric("pod-a", 10), invalid, testMetric("pod-c", 30))
+	if err := h.ingestPayload([]byte(payload), "nats", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// With wait set the valid metrics are processed before it returns.
+	for _, pod := range []string{"pod-a", "pod-c"} {
+		if _, ok := h.latest.get(pod); !ok {
+			t.Errorf("metric from %s was not processed", pod)
+		}
+	}
+	if _, ok := h.latest.get("pod-b"); ok {
+		t.Error("invalid metric from pod-b was processed")
+	}
+	for _, pod := range []string{"pod-a", "pod-c"} {
+		data := readTestMessage(t, conn).Data.(map[string]interface{})
+		if data["pod_name"] != pod {
+			t.Errorf("broadcast from %v, want %s", data["pod_name"], pod)
+		}
+	}
+
+	letters := h.dlq.recent(0)
+	if len(letters) != 1 || letters[0].Reason != deadLetterInvalid || letters[0].Source != "nats" {
+		t.Errorf("dead letters = %+v, want the invalid metric from nats", letters)
+	}
+}
+
+func TestIngestPayloadDeadLettersUndecodable(t *testing.T) {
+	h := startTestHub(t, testConfig())
+
+	// Undecodable messages are dropped rather than retried.
+	if err := h.ingestPayload([]byte(`{"event_type":`), "nats", true); err != nil {
+		t.Errorf("ingestPayload = %v, want nil", err)
+	}
+	letters := h.dlq.recent(0)
+	if len(letters) != 1 || letters[0].Reason != deadLetterDecode || letters[0].Payload != `{"event_type":` {
+		t.Errorf("dead letters = %+v, want the undecodable payload", letters)
+	}
+}
+
+func TestIngestPayloadAfterPipelineStopped(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	h.ingest.stop()
+
+	stopped, err := h.ingestPayloadFrom([]byte(testBatch(t, testMetric("pod-a", 10))), "nats", 0, true)
+	if err == nil || stopped != 0 {
+		t.Errorf("ingestPayloadFrom = %d, %v, want an error at metric 0", stopped, err)
+	}
+}
+
+func TestNATSSubscriberReportsUnreachableServer(t *testing.T) {
+	h := newHub(testConfig())
+	if subscriber, err := startNATSSubscriber(h, "nats://127.0.0.1:1", "metrics"); err == nil {
+		subscriber.stop()
+		t.Fatal("startNATSSubscriber succeeded without a server")
+	}
+}
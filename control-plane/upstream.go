@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reconnect backoff bounds for the upstream forwarder.
+const (
+	upstreamMinBackoff = time.Second
+	upstreamMaxBackoff = 30 * time.Second
+)
+
+// upstreamDialer bounds how long connecting to the upstream may take.
+var upstreamDialer = &websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+
+// upstreamMetricType is the envelope type of a forwarded metric.
+const upstreamMetricType = "metric"
+
+// upstreamForwarder relays processed metrics to a parent control plane's
+// /ws/ingest endpoint. Metrics queue up to a bound while the upstream is
+// unreachable; past it the oldest are dropped.
+type upstreamForwarder struct {
+	url    string
+	header http.Header
+	queue  chan QueryMetrics
+	done   chan struct{}
+	exited chan struct{}
+}
+
+func newUpstreamForwarder(url, apiKey string, bufferSize int) *upstreamForwarder {
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
+	}
+	return &upstreamForwarder{
+		url:    url,
+		header: header,
+		queue:  make(chan QueryMetrics, max(bufferSize, 1)),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+}
+
+// enqueue queues a metric for the upstream without blocking. A nil forwarder
+// ignores it, so callers need not check whether forwarding is enabled.
+func (f *upstreamForwarder) enqueue(metric QueryMetrics) {
+	if f == nil {
+		return
+	}
+	for {
+		select {
+		case f.queue <- metric:
+			return
+		default:
+		}
+		select {
+		case <-f.queue:
+			upstreamDroppedTotal.Inc()
+		default:
+		}
+	}
+}
+
+func (f *upstreamForwarder) start() {
+	go f.run()
+	slog.Info("forwarding metrics upstream", "url", f.url)
+}
+
+// run keeps a connection to the upstream open, reconnecting with exponential
+// backoff, until stop is called.
+func (f *upstreamForwarder) run() {
+	defer close(f.exited)
+	backoff := upstreamMinBackoff
+	var pending *QueryMetrics
+	for {
+		conn, _, err := upstreamDialer.Dial(f.url, f.header)
+		if err != nil {
+			slog.Warn("failed to connect upstream", "url", f.url, "retry_in", backoff.String(), "error", err)
+			select {
+			case <-time.After(backoff):
+				backoff = min(backoff*2, upstreamMaxBackoff)
+				continue
+			case <-f.done:
+				return
+			}
+		}
+		slog.Info("connected upstream", "url", f.url)
+		backoff = upstreamMinBackoff
+
+		pending, err = f.forward(conn, pending)
+		conn.Close()
+		if err == nil {
+			return
+		}
+		slog.Warn("upstream connection lost", "url", f.url, "error", err)
+	}
+}
+
+// forward writes queued metrics to conn until it fails or stop is called,
+// starting with the metric a previous connection failed to send. It returns
+// the metric that could not be sent, if any, and a nil error once stopped.
+func (f *upstreamForwarder) forward(conn *websocket.Conn, pending *QueryMetrics) (*QueryMetrics, error) {
+	// Reading is needed to process pings and to notice the upstream
+	// closing the connection.
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	send := func(metric QueryMetrics) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(newMessage(upstreamMetricType, metric))
+	}
+	if pending != nil {
+		if err := send(*pending); err != nil {
+			return pending, err
+		}
+	}
+
+	for {
+		select {
+		case metric := <-f.queue:
+			if err := send(metric); err != nil {
+				return &metric, err
+			}
+		case err := <-closed:
+			return nil, err
+		case <-f.done:
+			f.drain(send)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(time.Second))
+			return nil, nil
+		}
+	}
+}
+
+// drain sends what is still queued at shutdown, giving up at the first
+// failure.
+func (f *upstreamForwarder) drain(send func(QueryMetrics) error) {
+	for {
+		select {
+		case metric := <-f.queue:
+			if send(metric) != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// stop flushes queued metrics if the upstream is connected and closes the
+// connection. It must run after the ingestion pipeline has stopped.
+func (f *upstreamForwarder) stop() {
+	close(f.done)
+	<-f.exited
+}
+
+// ingestWebSocket serves /ws/ingest, where child control planes forward
+// their metrics as "metric" messages.
+func (h *Hub) ingestWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "remote_addr", r.RemoteAddr, "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(h.cfg.MaxBatchBytes)
+	slog.Info("downstream control plane connected", "remote_addr", r.RemoteAddr)
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("downstream control plane read failed", "remote_addr", r.RemoteAddr, "error", err)
+			}
+			return
+		}
+		var envelope struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(payload, &envelope); err != nil || envelope.Type != upstreamMetricType {
+			slog.Warn("ignoring unexpected downstream message", "remote_addr", r.RemoteAddr, "message_type", envelope.Type)
+			continue
+		}
+		// Waiting for each metric pushes back on the downstream through the
+		// connection instead of dropping metrics when the pipeline is busy.
+		if err := h.ingestPayload(envelope.Data, "upstream:"+r.RemoteAddr, true); err != nil {
+			slog.Error("failed to ingest downstream metric", "remote_addr", r.RemoteAddr, "error", err)
+		}
+	}
+}
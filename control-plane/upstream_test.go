@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeUpstream is a parent control plane that records the metrics forwarded
+// to it. It hangs up its first connection after dropFirstAfter metrics.
+type fakeUpstream struct {
+	url         string
+	received    chan QueryMetrics
+	apiKeys     chan string
+	connections atomic.Int32
+}
+
+func startFakeUpstream(t *testing.T, dropFirstAfter int) *fakeUpstream {
+	t.Helper()
+	upstream := &fakeUpstream{received: make(chan QueryMetrics, 100), apiKeys: make(chan string, 10)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		upstream.apiKeys <- r.Header.Get("X-API-Key")
+		first := upstream.connections.Add(1) == 1
+		for n := 1; ; n++ {
+			var envelope struct {
+				Type string       `json:"type"`
+				Data QueryMetrics `json:"data"`
+			}
+			if err := conn.ReadJSON(&envelope); err != nil {
+				return
+			}
+			if envelope.Type == upstreamMetricType {
+				upstream.received <- envelope.Data
+			}
+			if first && n == dropFirstAfter {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	upstream.url = "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/ingest"
+	return upstream
+}
+
+// startTestForwarder runs a forwarder to url until the test ends.
+func startTestForwarder(t *testing.T, url string, bufferSize int) *upstreamForwarder {
+	t.Helper()
+	f := newUpstreamForwarder(url, "test-key", bufferSize)
+	f.start()
+	t.Cleanup(f.stop)
+	return f
+}
+
+// readForwarded returns the pod of the next metric the upstream received.
+func (u *fakeUpstream) readForwarded(t *testing.T) string {
+	t.Helper()
+	select {
+	case metric := <-u.received:
+		return metric.PodName
+	case <-time.After(testReadTimeout):
+		t.Fatal("no metric reached the upstream")
+		return ""
+	}
+}
+
+func TestForwarderRelaysMetrics(t *testing.T) {
+	upstream := startFakeUpstream(t, 0)
+	f := startTestForwarder(t, upstream.url, 10)
+
+	for _, pod := range []string{"pod-a", "pod-b", "pod-c"} {
+		f.enqueue(testMetric(pod, 10))
+	}
+	for _, want := range []string{"pod-a", "pod-b", "pod-c"} {
+		if got := upstream.readForwarded(t); got != want {
+			t.Errorf("forwarded %s, want %s", got, want)
+		}
+	}
+	if key := <-upstream.apiKeys; key != "test-key" {
+		t.Errorf("X-API-Key = %q, want test-key", key)
+	}
+}
+
+func TestForwarderReconnects(t *testing.T) {
+	upstream := startFakeUpstream(t, 1)
+	f := startTestForwarder(t, upstream.url, 10)
+
+	f.enqueue(testMetric("pod-a", 10))
+	if got := upstream.readForwarded(t); got != "pod-a" {
+		t.Fatalf("forwarded %s, want pod-a", got)
+	}
+	// The upstream hung up after that metric; wait for the forwarder to
+	// dial again so nothing is written to the dead connection.
+	deadline := time.Now().Add(testReadTimeout)
+	for upstream.connections.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("forwarder did not reconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	f.enqueue(testMetric("pod-b", 10))
+	if got := upstream.readForwarded(t); got != "pod-b" {
+		t.Errorf("forwarded %s after reconnecting, want pod-b", got)
+	}
+}
+
+func TestForwarderBuffersWhileUpstreamIsDown(t *testing.T) {
+	f := newUpstreamForwarder("ws://127.0.0.1:1/ws/ingest", "", 2)
+	before := counterValue(t, upstreamDroppedTotal)
+
+	for _, pod := range []string{"pod-a", "pod-b", "pod-c", "pod-d"} {
+		f.enqueue(testMetric(pod, 10))
+	}
+	if got := counterValue(t, upstreamDroppedTotal) - before; got != 2 {
+		t.Errorf("drops counted %v times, want 2", got)
+	}
+	var queued []string
+	for len(f.queue) > 0 {
+		queued = append(queued, (<-f.queue).PodName)
+	}
+	if strings.Join(queued, ",") != "pod-c,pod-d" {
+		t.Errorf("queued = %v, want the newest two", queued)
+	}
+
+	var none *upstreamForwarder
+	none.enqueue(testMetric("pod-a", 10))
+}
+
+func TestProcessedMetricsReachParentPlane(t *testing.T) {
+	parent := startTestHub(t, testConfig())
+	server := httptest.NewServer(http.HandlerFunc(parent.ingestWebSocket))
+	t.Cleanup(server.Close)
+	watcher := dialTestHub(t, parent, "types=query_metrics")
+
+	child := startTestHub(t, testConfig())
+	child.upstream = startTestForwarder(t, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws/ingest", 10)
+	postTestMetric(t, child, testMetric("pod-a", 10))
+
+	message := readTestMessage(t, watcher)
+	data, _ := json.Marshal(message.Data)
+	var metric QueryMetrics
+	json.Unmarshal(data, &metric)
+	if metric.PodName != "pod-a" {
+		t.Errorf("parent broadcast %s, want the child's pod-a metric", data)
+	}
+}
+
+func TestIngestWebSocketIgnoresOtherMessages(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	server := httptest.NewServer(http.HandlerFunc(h.ingestWebSocket))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	watcher := dialTestHub(t, h, "types=query_metrics")
+
+	conn.WriteJSON(newMessage("query_metrics", testMetric("pod-x", 10)))
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	conn.WriteJSON(newMessage(upstreamMetricType, testMetric("pod-a", 10)))
+
+	data := readTestMessage(t, watcher).Data.(map[string]interface{})
+	if data["pod_name"] != "pod-a" {
+		t.Errorf("broadcast data = %v, want only the pod-a metric", data)
+	}
+}
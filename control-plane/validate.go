@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// validationError names the rule a metric broke.
+type validationError struct {
+	Rule string
+}
+
+func (e *validationError) Error() string {
+	return e.Rule
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &validationError{Rule: fmt.Sprintf(format, args...)}
+}
+
+// validateMetric checks the fields the dashboard relies on for each event
+// type, so malformed metrics are rejected at ingestion instead of breaking
+// clients after the broadcast.
+func validateMetric(metric QueryMetrics) error {
+	if metric.EventType == "" {
+		return invalid("event_type is required")
+	}
+	if _, err := time.Parse(time.RFC3339, metric.Timestamp); err != nil {
+		return invalid("timestamp must be an RFC3339 timestamp, got %q", metric.Timestamp)
+	}
+
+	switch metric.EventType {
+	case "query_execution":
+		if metric.Data == nil {
+			return invalid("query_execution requires data")
+		}
+		if metric.Data.QueryID == "" {
+			return invalid("query_execution requires data.query_id")
+		}
+	case "query_start":
+		if metric.Data == nil || metric.Data.QueryID == "" {
+			return invalid("query_start requires data.query_id")
+		}
+	case "deadlock_detected":
+		if metric.Data == nil {
+			return invalid("deadlock_detected requires data")
+		}
+		if metric.Data.DeadlockConnections == nil && metric.Data.DeadlockDuration == nil {
+			return invalid("deadlock_detected requires data.deadlock_connections or data.deadlock_duration")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateMetric(t *testing.T) {
+	withEvent := func(eventType string, change func(*QueryMetrics)) QueryMetrics {
+		metric := testMetric("pod-a", 10)
+		metric.EventType = eventType
+		if change != nil {
+			change(&metric)
+		}
+		return metric
+	}
+	connections := "PgConnection@a:PgConnection@b"
+	var duration int64 = 1500
+
+	tests := []struct {
+		name   string
+		metric QueryMetrics
+		rule   string // "" when valid
+	}{
+		{"query_execution", withEvent("query_execution", nil), ""},
+		{"query_execution without data", withEvent("query_execution", func(m *QueryMetrics) { m.Data = nil }), "query_execution requires data"},
+		{"query_execution without query_id", withEvent("query_execution", func(m *QueryMetrics) { m.Data.QueryID = "" }), "query_execution requires data.query_id"},
+		{"query_start", withEvent("query_start", nil), ""},
+		{"query_start without query_id", withEvent("query_start", func(m *QueryMetrics) { m.Data.QueryID = "" }), "query_start requires data.query_id"},
+		{"deadlock_detected with connections", withEvent("deadlock_detected", func(m *QueryMetrics) { m.Data.DeadlockConnections = &connections }), ""},
+		{"deadlock_detected with duration", withEvent("deadlock_detected", func(m *QueryMetrics) { m.Data.DeadlockDuration = &duration }), ""},
+		{"deadlock_detected without data", withEvent("deadlock_detected", func(m *QueryMetrics) { m.Data = nil }), "deadlock_detected requires data"},
+		{"deadlock_detected without details", withEvent("deadlock_detected", nil), "deadlock_detected requires data.deadlock_connections or data.deadlock_duration"},
+		{"transaction_event without data", withEvent("transaction_event", func(m *QueryMetrics) { m.Data = nil }), ""},
+		{"missing event_type", withEvent("", nil), "event_type is required"},
+		{"missing timestamp", withEvent("query_execution", func(m *QueryMetrics) { m.Timestamp = "" }), `timestamp must be an RFC3339 timestamp, got ""`},
+		{"non-RFC3339 timestamp", withEvent("query_execution", func(m *QueryMetrics) { m.Timestamp = "2024-01-02 03:04:05" }), `timestamp must be an RFC3339 timestamp, got "2024-01-02 03:04:05"`},
+	}
+	for _, tt := range tests {
+		err := validateMetric(tt.metric)
+		switch {
+		case tt.rule == "" && err != nil:
+			t.Errorf("%s: validateMetric = %v, want valid", tt.name, err)
+		case tt.rule != "" && (err == nil || err.Error() != tt.rule):
+			t.Errorf("%s: validateMetric = %v, want %q", tt.name, err, tt.rule)
+		}
+	}
+}
+
+func TestInvalidMetricIs422WithRule(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	metric := testMetric("pod-a", 10)
+	metric.Data.QueryID = ""
+	body, _ := json.Marshal([]QueryMetrics{testMetric("pod-a", 10), metric})
+
+	rec := postTestBody(h, string(body))
+	var response map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if response["rule"] != "query_execution requires data.query_id" || response["index"] != float64(1) {
+		t.Errorf("response = %v, want the query_id rule at index 1", response)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Content-Type = %q, want JSON", rec.Header().Get("Content-Type"))
+	}
+	if records := h.recent.query(metricFilter{}); len(records) != 0 {
+		t.Errorf("%d metrics of the rejected batch were processed", len(records))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// messageVersion is the envelope version stamped on every outbound message.
+const messageVersion = "v1"
+
+// supportedVersions lists the envelope versions a client may ask for with
+// /ws?v=. Clients that do not ask get messageVersion.
+var supportedVersions = map[string]bool{
+	"v1": true,
+}
+
+// negotiateVersion normalizes the requested version ("1" or "v1") and
+// reports whether the server can speak it.
+func negotiateVersion(requested string) (string, bool) {
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if requested == "" {
+		return messageVersion, true
+	}
+	if !strings.HasPrefix(requested, "v") {
+		requested = "v" + requested
+	}
+	return requested, supportedVersions[requested]
+}
+
+// unsupportedVersionClose is the close frame sent to a client that asked for
+// an envelope version the server does not speak.
+func unsupportedVersionClose(requested string) []byte {
+	return websocket.FormatCloseMessage(websocket.ClosePolicyViolation,
+		fmt.Sprintf("unsupported message version %q; supported: %s", requested, messageVersion))
+}
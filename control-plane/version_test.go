@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		requested string
+		want      string
+		ok        bool
+	}{
+		{"", "v1", true},
+		{"1", "v1", true},
+		{"v1", "v1", true},
+		{" V1 ", "v1", true},
+		{"2", "v2", false},
+		{"v0", "v0", false},
+	}
+	for _, tt := range tests {
+		if got, ok := negotiateVersion(tt.requested); got != tt.want || ok != tt.ok {
+			t.Errorf("negotiateVersion(%q) = %q, %v, want %q, %v", tt.requested, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMessagesCarryVersion(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn, _, err := dialTestHubWithHeader(t, h, "v=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connected := readTestMessage(t, conn); connected.Type != "connected" || connected.Version != "v1" {
+		t.Errorf("first message = %s version %q, want connected v1", connected.Type, connected.Version)
+	}
+
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	if message := readTestMessageOfType(t, conn, "query_metrics"); message.Version != "v1" {
+		t.Errorf("query_metrics version = %q, want v1", message.Version)
+	}
+}
+
+func TestUnsupportedVersionIsClosed(t *testing.T) {
+	h := startTestHub(t, testConfig())
+	conn, _, err := dialTestHubWithHeader(t, h, "v=7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeErr := readTestClose(t, conn)
+	if closeErr.Code != websocket.ClosePolicyViolation || !strings.Contains(closeErr.Text, `unsupported message version "7"`) {
+		t.Errorf("close = %d %q, want a policy violation naming version 7", closeErr.Code, closeErr.Text)
+	}
+}
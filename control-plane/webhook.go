@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook delivery tuning: each notification is tried webhookAttempts times
+// with doubling backoff, and webhookBreakerFailures failed notifications in
+// a row pause delivery for webhookBreakerCooldown.
+const (
+	webhookQueueSize       = 100
+	webhookAttempts        = 3
+	webhookRetryBackoff    = 500 * time.Millisecond
+	webhookBreakerFailures = 5
+	webhookBreakerCooldown = 30 * time.Second
+)
+
+// severityRank orders the severities used across the analyzers.
+var severityRank = map[string]int{
+	"info":     1,
+	"warning":  2,
+	"high":     3,
+	"critical": 4,
+}
+
+// WebhookNotification is the JSON body POSTed to ALERT_WEBHOOK_URL.
+type WebhookNotification struct {
+	Type      string      `json:"type"`
+	Severity  string      `json:"severity"`
+	Namespace string      `json:"namespace,omitempty"`
+	PodName   string      `json:"pod_name,omitempty"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// alertWebhook pushes critical broadcasts to an on-call webhook from a
+// background goroutine, so a slow or failing endpoint never holds up
+// processing. Notifications that find the queue full or the circuit open
+// are dropped.
+type alertWebhook struct {
+	url         string
+	types       map[string]bool
+	minSeverity int
+	client      *http.Client
+	breaker     *circuitBreaker
+	queue       chan WebhookNotification
+	done        chan struct{}
+	exited      chan struct{}
+}
+
+func newAlertWebhook(cfg Config) *alertWebhook {
+	types := make(map[string]bool)
+	for _, messageType := range strings.Split(cfg.AlertWebhookEvents, ",") {
+		if messageType = strings.TrimSpace(messageType); messageType != "" {
+			types[messageType] = true
+		}
+	}
+	return &alertWebhook{
+		url:         cfg.AlertWebhookURL,
+		types:       types,
+		minSeverity: severityRank[strings.ToLower(cfg.AlertWebhookMinSeverity)],
+		client:      &http.Client{Timeout: cfg.AlertWebhookTimeout},
+		breaker:     newCircuitBreaker(webhookBreakerFailures, webhookBreakerCooldown),
+		queue:       make(chan WebhookNotification, webhookQueueSize),
+		done:        make(chan struct{}),
+		exited:      make(chan struct{}),
+	}
+}
+
+// notify queues a broadcast for delivery when its type is configured and its
+// severity reaches the minimum. A nil webhook ignores it.
+func (w *alertWebhook) notify(message WebSocketMessage) {
+	if w == nil || !w.types[message.Type] {
+		return
+	}
+	data, _ := message.Data.(map[string]interface{})
+	severity, _ := data["severity"].(string)
+	if severityRank[strings.ToLower(severity)] < w.minSeverity {
+		return
+	}
+	podName, _ := data["pod_name"].(string)
+
+	notification := WebhookNotification{
+		Type:      message.Type,
+		Severity:  severity,
+		Namespace: message.Namespace,
+		PodName:   podName,
+		Timestamp: message.Timestamp,
+		Data:      message.Data,
+	}
+	select {
+	case w.queue <- notification:
+	default:
+		webhookNotificationsTotal.WithLabelValues("dropped").Inc()
+		slog.Warn("alert webhook queue full, dropping notification", "message_type", message.Type, "pod_name", podName)
+	}
+}
+
+func (w *alertWebhook) start() {
+	go w.run()
+	slog.Info("sending critical alerts to webhook", "url", w.url)
+}
+
+func (w *alertWebhook) run() {
+	defer close(w.exited)
+	for {
+		select {
+		case notification := <-w.queue:
+			w.deliver(notification)
+		case <-w.done:
+			for {
+				select {
+				case notification := <-w.queue:
+					w.deliver(notification)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver posts one notification, retrying with backoff, unless the circuit
+// is open.
+func (w *alertWebhook) deliver(notification WebhookNotification) {
+	if !w.breaker.allow(time.Now()) {
+		webhookNotificationsTotal.WithLabelValues("dropped").Inc()
+		slog.Warn("alert webhook circuit open, dropping notification", "message_type", notification.Type)
+		return
+	}
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		slog.Error("failed to encode webhook notification", "message_type", notification.Type, "error", err)
+		return
+	}
+
+	backoff := webhookRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err = w.post(payload)
+		if err == nil {
+			w.breaker.success()
+			webhookNotificationsTotal.WithLabelValues("delivered").Inc()
+			return
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-w.done:
+			// Shutting down: make one last attempt at most.
+			attempt = webhookAttempts - 1
+		}
+	}
+	w.breaker.failure(time.Now())
+	webhookNotificationsTotal.WithLabelValues("failed").Inc()
+	slog.Error("failed to deliver alert webhook", "message_type", notification.Type, "attempts", webhookAttempts, "error", err)
+}
+
+func (w *alertWebhook) post(payload []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// stop delivers what is still queued and waits for the sender to exit. It
+// must run after the ingestion pipeline has stopped.
+func (w *alertWebhook) stop() {
+	close(w.done)
+	<-w.exited
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebhook records the notifications posted to it, failing the first
+// failFirst requests with a 500.
+type fakeWebhook struct {
+	mu            sync.Mutex
+	failFirst     int
+	requests      int
+	notifications []WebhookNotification
+}
+
+func (f *fakeWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.requests++; f.requests <= f.failFirst {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var notification WebhookNotification
+	json.NewDecoder(r.Body).Decode(&notification)
+	f.notifications = append(f.notifications, notification)
+}
+
+func (f *fakeWebhook) received() (int, []WebhookNotification) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests, append([]WebhookNotification(nil), f.notifications...)
+}
+
+// startTestWebhook points a webhook for the given events at a fake server.
+// Stopping it, which delivers what is queued, is left to the test.
+func startTestWebhook(t *testing.T, fake *fakeWebhook, events string) *alertWebhook {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	cfg := testConfig()
+	cfg.AlertWebhookURL = server.URL
+	cfg.AlertWebhookEvents = events
+	webhook := newAlertWebhook(cfg)
+	webhook.start()
+	return webhook
+}
+
+func TestWebhookDeliversCriticalDeadlock(t *testing.T) {
+	fake := &fakeWebhook{}
+	h := startTestHub(t, testConfig())
+	h.webhook = startTestWebhook(t, fake, "deadlock_event,resource_alert")
+
+	postTestMetric(t, h, testMetric("pod-a", 10))
+	postTestMetric(t, h, testDeadlock("pod-a", "PgConnection@a:PgConnection@b"))
+	h.ingest.stop()
+	h.webhook.stop()
+
+	_, notifications := fake.received()
+	if len(notifications) != 1 {
+		t.Fatalf("webhook received %+v, want the deadlock only", notifications)
+	}
+	got := notifications[0]
+	if got.Type != "deadlock_event" || got.Severity != "critical" || got.PodName != "pod-a" || got.Namespace != "default" {
+		t.Errorf("notification = %+v, want a critical deadlock_event for pod-a", got)
+	}
+}
+
+func TestWebhookFiltersByTypeAndSeverity(t *testing.T) {
+	fake := &fakeWebhook{}
+	webhook := startTestWebhook(t, fake, " deadlock_event , pool_alert")
+	webhook.minSeverity = severityRank["high"]
+
+	for _, message := range []WebSocketMessage{
+		newMessage("deadlock_event", map[string]interface{}{"severity": "warning", "pod_name": "pod-a"}),
+		newMessage("deadlock_event", map[string]interface{}{"severity": "HIGH", "pod_name": "pod-b"}),
+		newMessage("resource_alert", map[string]interface{}{"severity": "critical", "pod_name": "pod-c"}),
+		newMessage("pool_alert", map[string]interface{}{"severity": "critical", "pod_name": "pod-d"}),
+		newMessage("pool_alert", nil),
+	} {
+		webhook.notify(message)
+	}
+	webhook.stop()
+
+	_, notifications := fake.received()
+	var pods []string
+	for _, notification := range notifications {
+		pods = append(pods, notification.PodName)
+	}
+	if len(pods) != 2 || pods[0] != "pod-b" || pods[1] != "pod-d" {
+		t.Errorf("notified pods %v, want pod-b and pod-d", pods)
+	}
+
+	var none *alertWebhook
+	none.notify(newMessage("deadlock_event", map[string]interface{}{"severity": "critical"}))
+}
+
+func TestWebhookRetriesFailedDeliveries(t *testing.T) {
+	fake := &fakeWebhook{failFirst: 2}
+	webhook := startTestWebhook(t, fake, "deadlock_event")
+	before := counterValue(t, webhookNotificationsTotal.WithLabelValues("delivered"))
+
+	webhook.notify(newMessage("deadlock_event", map[string]interface{}{"severity": "critical"}))
+	deadline := time.Now().Add(2 * testReadTimeout)
+	for {
+		if _, notifications := fake.received(); len(notifications) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("notification was not delivered on a retry")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	webhook.stop()
+
+	if requests, _ := fake.received(); requests != 3 {
+		t.Errorf("webhook got %d requests, want 3", requests)
+	}
+	if got := counterValue(t, webhookNotificationsTotal.WithLabelValues("delivered")) - before; got != 1 {
+		t.Errorf("deliveries counted %v times, want 1", got)
+	}
+}
+
+func TestOpenCircuitDropsNotifications(t *testing.T) {
+	fake := &fakeWebhook{}
+	webhook := startTestWebhook(t, fake, "deadlock_event")
+	for i := 0; i < webhookBreakerFailures; i++ {
+		webhook.breaker.failure(time.Now())
+	}
+	before := counterValue(t, webhookNotificationsTotal.WithLabelValues("dropped"))
+
+	webhook.notify(newMessage("deadlock_event", map[string]interface{}{"severity": "critical"}))
+	webhook.stop()
+
+	if requests, _ := fake.received(); requests != 0 {
+		t.Errorf("webhook got %d requests with the circuit open, want none", requests)
+	}
+	if got := counterValue(t, webhookNotificationsTotal.WithLabelValues("dropped")) - before; got != 1 {
+		t.Errorf("drops counted %v times, want 1", got)
+	}
+}